@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/constants"
+	"github.com/dgerlanc/mmi/internal/patterns"
+	"github.com/spf13/cobra"
+)
+
+var addDeny bool
+
+var addCmd = &cobra.Command{
+	Use:   "add <command>",
+	Short: "Add a command to the allow list",
+	Long: `Add appends an entry for a command to the active config.toml.
+
+A single word is added as a simple command, so 'mmi add make' approves make
+with any arguments. Several words are added as a command and subcommand, so
+'mmi add git push' approves git push but not other git subcommands.
+
+The entry is appended to the end of the file, leaving existing content and
+comments untouched, and the resulting configuration is validated before it
+is written. Adding a command that is already listed does nothing.
+
+Use --deny to add the command to the deny list instead.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runAdd,
+}
+
+func init() {
+	rootCmd.AddCommand(addCmd)
+	addCmd.Flags().BoolVar(&addDeny, "deny", false, "Add the command to the deny list")
+}
+
+func runAdd(cmd *cobra.Command, args []string) error {
+	words := strings.Fields(strings.Join(args, " "))
+	if len(words) == 0 {
+		return fmt.Errorf("command must not be empty")
+	}
+	for _, w := range words {
+		if strings.HasPrefix(w, "-") {
+			return fmt.Errorf("flags are not supported by mmi add; edit %s to add %q", constants.ConfigFileName, w)
+		}
+	}
+
+	configPath, configDir, data, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	current, err := config.LoadConfigWithDir(data, configDir)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	section, list, existing := "commands", "allow list", current.SafeCommands
+	if addDeny {
+		section, list, existing = "deny", "deny list", current.DenyPatterns
+	}
+
+	command := strings.Join(words, " ")
+	if hasEntry(existing, words) {
+		fmt.Printf("%s is already in the %s\n", command, list)
+		return nil
+	}
+
+	updated := appendEntry(data, section, words)
+	if err := writeConfigFile(configPath, configDir, updated); err != nil {
+		return fmt.Errorf("cannot add %q: %w", command, err)
+	}
+
+	fmt.Printf("Added %s to the %s in %s\n", command, list, configPath)
+	return nil
+}
+
+// readConfigFile reads the active config file. A missing file is reported
+// with a hint to run mmi init.
+func readConfigFile() (configPath, configDir string, data []byte, err error) {
+	configPath, err = config.GetConfigFile()
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to get config directory: %w", err)
+	}
+	configDir = filepath.Dir(configPath)
+
+	data, err = os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil, fmt.Errorf("no config file at %s (run 'mmi init' to create one)", configPath)
+		}
+		return "", "", nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return configPath, configDir, data, nil
+}
+
+// writeConfigFile validates data as a config and writes it to configPath,
+// then reloads the active configuration. Invalid data is not written.
+func writeConfigFile(configPath, configDir string, data []byte) error {
+	if _, err := config.LoadConfigWithDir(data, configDir); err != nil {
+		return fmt.Errorf("config would be invalid: %w", err)
+	}
+	if err := os.WriteFile(configPath, data, constants.FileMode); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	config.Reset()
+	config.Init()
+	return nil
+}
+
+// hasEntry reports whether pats already contains the entry that appendEntry
+// would create for words.
+func hasEntry(pats []patterns.Pattern, words []string) bool {
+	if len(words) == 1 {
+		simple := patterns.BuildSimplePattern(words[0])
+		return slices.ContainsFunc(pats, func(p patterns.Pattern) bool {
+			return p.Pattern == simple
+		})
+	}
+
+	sub := strings.Join(words[1:], " ")
+	return slices.ContainsFunc(pats, func(p patterns.Pattern) bool {
+		return p.Type == "subcommand" && p.Command == words[0] && slices.Contains(p.Subcommands, sub)
+	})
+}
+
+// appendEntry returns data with a simple or subcommand entry for words
+// appended to section.
+func appendEntry(data []byte, section string, words []string) []byte {
+	var buf bytes.Buffer
+	buf.Write(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	if len(words) == 1 {
+		fmt.Fprintf(&buf, "[[%s.simple]]\n", section)
+		fmt.Fprintf(&buf, "name = %q\n", words[0])
+		fmt.Fprintf(&buf, "commands = [%q]\n", words[0])
+	} else {
+		fmt.Fprintf(&buf, "[[%s.subcommand]]\n", section)
+		fmt.Fprintf(&buf, "command = %q\n", words[0])
+		fmt.Fprintf(&buf, "subcommands = [%q]\n", strings.Join(words[1:], " "))
+	}
+	return buf.Bytes()
+}
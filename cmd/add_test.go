@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/constants"
+	"github.com/dgerlanc/mmi/internal/testutil"
+	"github.com/spf13/cobra"
+)
+
+func readTestConfigFile(t *testing.T) string {
+	t.Helper()
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, constants.ConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunAddApprovesCommand(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	result := evaluateCommandString("foo bar")
+	if result.Approved {
+		t.Fatal("foo bar should not be approved before mmi add")
+	}
+
+	var runErr error
+	output := captureStdout(t, func() {
+		runErr = runAdd(&cobra.Command{}, []string{"foo"})
+	})
+	if runErr != nil {
+		t.Fatalf("runAdd() error = %v", runErr)
+	}
+	if !strings.Contains(output, "Added foo to the allow list") {
+		t.Errorf("output = %q, want added message", output)
+	}
+
+	result = evaluateCommandString("foo bar")
+	if !result.Approved {
+		t.Error("foo bar should be approved after mmi add foo")
+	}
+
+	content := readTestConfigFile(t)
+	if !strings.HasPrefix(content, testutil.MinimalTestConfig) {
+		t.Errorf("existing config content should be preserved, got:\n%s", content)
+	}
+}
+
+func TestRunAddIsIdempotent(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	var output string
+	for range 2 {
+		output = captureStdout(t, func() {
+			if err := runAdd(&cobra.Command{}, []string{"foo"}); err != nil {
+				t.Fatalf("runAdd() error = %v", err)
+			}
+		})
+	}
+
+	if !strings.Contains(output, "foo is already in the allow list") {
+		t.Errorf("second add output = %q, want already message", output)
+	}
+	if got := strings.Count(readTestConfigFile(t), `commands = ["foo"]`); got != 1 {
+		t.Errorf("config contains %d entries for foo, want 1", got)
+	}
+
+	// Commands already in the original config aren't added again
+	before := readTestConfigFile(t)
+	captureStdout(t, func() {
+		if err := runAdd(&cobra.Command{}, []string{"ls"}); err != nil {
+			t.Fatalf("runAdd() error = %v", err)
+		}
+	})
+	if after := readTestConfigFile(t); after != before {
+		t.Errorf("adding an existing command changed the config:\n%s", after)
+	}
+}
+
+func TestRunAddSubcommand(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	captureStdout(t, func() {
+		if err := runAdd(&cobra.Command{}, []string{"git", "push"}); err != nil {
+			t.Fatalf("runAdd() error = %v", err)
+		}
+	})
+
+	content := readTestConfigFile(t)
+	if !strings.Contains(content, "[[commands.subcommand]]\ncommand = \"git\"\nsubcommands = [\"push\"]") {
+		t.Errorf("config should contain a subcommand entry, got:\n%s", content)
+	}
+
+	tests := []struct {
+		command  string
+		approved bool
+	}{
+		{"git push origin main", true},
+		{"git reset --hard", false},
+	}
+	for _, tt := range tests {
+		result := evaluateCommandString(tt.command)
+		if result.Approved != tt.approved {
+			t.Errorf("%q approved = %v, want %v", tt.command, result.Approved, tt.approved)
+		}
+	}
+}
+
+func TestRunAddDeny(t *testing.T) {
+	resetGlobalState()
+	cleanup := testutil.SetupTestConfig(t, `
+[[commands.simple]]
+name = "safe"
+commands = ["curl"]
+`)
+	defer func() {
+		cleanup()
+		resetGlobalState()
+	}()
+
+	addDeny = true
+	output := captureStdout(t, func() {
+		if err := runAdd(&cobra.Command{}, []string{"curl"}); err != nil {
+			t.Fatalf("runAdd() error = %v", err)
+		}
+	})
+	if !strings.Contains(output, "Added curl to the deny list") {
+		t.Errorf("output = %q, want added message", output)
+	}
+	if !strings.Contains(readTestConfigFile(t), "[[deny.simple]]") {
+		t.Error("config should contain a deny entry")
+	}
+
+	result := evaluateCommandString("curl example.com")
+	if result.Approved {
+		t.Error("curl should be rejected after mmi add --deny curl")
+	}
+}
+
+func TestRunAddWithoutConfigFile(t *testing.T) {
+	resetGlobalState()
+	cleanup := testutil.SetupTestConfig(t, "")
+	defer cleanup()
+
+	err := runAdd(&cobra.Command{}, []string{"foo"})
+	if err == nil || !strings.Contains(err.Error(), "mmi init") {
+		t.Errorf("runAdd() error = %v, want error suggesting mmi init", err)
+	}
+}
+
+func TestRunAddRejectsFlags(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	before := readTestConfigFile(t)
+	if err := runAdd(&cobra.Command{}, []string{"git", "--no-pager", "log"}); err == nil {
+		t.Error("runAdd() with a flag should return an error")
+	}
+	if after := readTestConfigFile(t); after != before {
+		t.Error("config should not change when runAdd fails")
+	}
+}
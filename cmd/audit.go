@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// audit query flags
+	querySession         string
+	queryApproved        bool
+	queryRejected        bool
+	querySince           string
+	queryCommandContains string
+	queryLimit           int
+
+	// audit stats flags
+	statsJSON bool
+	statsTop  int
+
+	// audit tail flags
+	tailFollow bool
+	tailLines  int
+
+	// audit purge flags
+	purgeYes      bool
+	purgeKeepDays int
+)
+
+// tailPollInterval is how often tail --follow checks the audit log for new entries.
+const tailPollInterval = 250 * time.Millisecond
+
+// maxQueryCommandWidth truncates long commands so table rows stay on one line.
+const maxQueryCommandWidth = 80
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log",
+	Long: `Audit provides commands for inspecting the audit log written by the hook.
+
+The audit log is stored at ~/.local/share/mmi/audit.log. Rotated backups
+(audit.log.1, audit.log.2.gz, ...) are read as well.`,
+}
+
+var auditQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Search the audit log",
+	Long: `Query searches the audit log and prints matching entries as a table,
+oldest first.
+
+Examples:
+  mmi audit query --rejected --since 24h
+  mmi audit query --session abc123 --command-contains git
+  mmi audit query --since 2025-01-15T00:00:00Z --limit 100`,
+	Args: cobra.NoArgs,
+	RunE: runAuditQuery,
+}
+
+var auditStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize approval decisions in the audit log",
+	Long: `Stats summarizes the audit log: the overall approval rate, how often each
+pattern matched, how often each rejection code occurred, and the most
+frequently evaluated commands.
+
+Use --json for machine-readable output.`,
+	Args: cobra.NoArgs,
+	RunE: runAuditStats,
+}
+
+var auditTailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Show recent audit log entries",
+	Long: `Tail prints the most recent audit log entries, one per line, with the
+timestamp, decision, command, and reason.
+
+With --follow, it keeps running and prints new entries as they are written,
+reopening the log if it is rotated or truncated. Press Ctrl-C to stop.
+
+Examples:
+  mmi audit tail --lines 50
+  mmi audit tail -f`,
+	Args: cobra.NoArgs,
+	RunE: runAuditTail,
+}
+
+var auditPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete the audit log and its backups",
+	Long: `Purge deletes the audit log and its rotated backups (audit.log.1,
+audit.log.2.gz, ...) after asking for confirmation.
+
+With --keep-days, only older data is removed: backups last modified more
+than N days ago are deleted, and entries older than N days are removed from
+the current log.
+
+Examples:
+  mmi audit purge
+  mmi audit purge --keep-days 30 --yes`,
+	Args: cobra.NoArgs,
+	RunE: runAuditPurge,
+}
+
+func init() {
+	auditQueryCmd.Flags().StringVar(&querySession, "session", "", "Only show entries from this session ID")
+	auditQueryCmd.Flags().BoolVar(&queryApproved, "approved", false, "Only show approved commands")
+	auditQueryCmd.Flags().BoolVar(&queryRejected, "rejected", false, "Only show rejected commands")
+	auditQueryCmd.Flags().StringVar(&querySince, "since", "", "Only show entries newer than a duration (e.g. 24h) or RFC 3339 timestamp")
+	auditQueryCmd.Flags().StringVar(&queryCommandContains, "command-contains", "", "Only show commands containing this substring")
+	auditQueryCmd.Flags().IntVar(&queryLimit, "limit", 50, "Maximum number of entries to show, most recent first kept (0 for no limit)")
+	auditQueryCmd.MarkFlagsMutuallyExclusive("approved", "rejected")
+
+	auditStatsCmd.Flags().BoolVar(&statsJSON, "json", false, "Output statistics as JSON")
+	auditStatsCmd.Flags().IntVar(&statsTop, "top", 10, "Number of most frequent commands to show (0 for all)")
+
+	auditTailCmd.Flags().BoolVarP(&tailFollow, "follow", "f", false, "Keep printing new entries as they are written")
+	auditTailCmd.Flags().IntVarP(&tailLines, "lines", "n", 20, "Number of recent entries to show (0 for all)")
+
+	auditPurgeCmd.Flags().BoolVarP(&purgeYes, "yes", "y", false, "Delete without asking for confirmation")
+	auditPurgeCmd.Flags().IntVar(&purgeKeepDays, "keep-days", 0, "Keep entries and backups from the last N days (0 deletes everything)")
+
+	auditCmd.AddCommand(auditQueryCmd)
+	auditCmd.AddCommand(auditStatsCmd)
+	auditCmd.AddCommand(auditTailCmd)
+	auditCmd.AddCommand(auditPurgeCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+// parseSince parses a --since value, either a duration before now or an
+// RFC 3339 timestamp.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q: expected a duration (e.g. 24h) or RFC 3339 timestamp", value)
+}
+
+// buildQueryFilter builds an audit filter from the query flags.
+func buildQueryFilter() (audit.Filter, error) {
+	filter := audit.Filter{
+		SessionID:       querySession,
+		CommandContains: queryCommandContains,
+	}
+	if queryApproved || queryRejected {
+		approved := queryApproved
+		filter.Approved = &approved
+	}
+	if querySince != "" {
+		since, err := parseSince(querySince, time.Now())
+		if err != nil {
+			return audit.Filter{}, err
+		}
+		filter.Since = since
+	}
+	return filter, nil
+}
+
+// auditLogPath returns the audit log file: the configured output if it is a
+// file, otherwise the default path.
+func auditLogPath() (string, error) {
+	switch output := auditOutput(); output {
+	case "", audit.OutputStderr, audit.OutputStdout:
+		return audit.DefaultLogPath()
+	default:
+		return output, nil
+	}
+}
+
+// readAuditLog reads all entries from the audit log and its backups.
+func readAuditLog() ([]audit.Entry, error) {
+	path, err := auditLogPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate audit log: %w", err)
+	}
+	entries, err := audit.ReadEntries(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+func runAuditQuery(cmd *cobra.Command, args []string) error {
+	if queryLimit < 0 {
+		return errors.New("--limit must not be negative")
+	}
+	filter, err := buildQueryFilter()
+	if err != nil {
+		return err
+	}
+
+	entries, err := readAuditLog()
+	if err != nil {
+		return err
+	}
+
+	var matches []audit.Entry
+	for _, e := range entries {
+		if filter.Match(e) {
+			matches = append(matches, e)
+		}
+	}
+
+	// Keep the most recent matches
+	if queryLimit > 0 && len(matches) > queryLimit {
+		matches = matches[len(matches)-queryLimit:]
+	}
+
+	if len(matches) == 0 {
+		fmt.Println("No matching audit entries.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIMESTAMP\tDECISION\tSESSION\tCOMMAND")
+	for _, e := range matches {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Timestamp, entryDecision(e), e.SessionID, truncateCommand(e.Command))
+	}
+	return w.Flush()
+}
+
+// entryDecision returns the display label for an entry's decision.
+func entryDecision(e audit.Entry) string {
+	if e.Approved {
+		return "approved"
+	}
+	return "rejected"
+}
+
+// truncateCommand shortens a command for single-line table display.
+func truncateCommand(command string) string {
+	runes := []rune(command)
+	if len(runes) <= maxQueryCommandWidth {
+		return command
+	}
+	return string(runes[:maxQueryCommandWidth-3]) + "..."
+}
+
+func runAuditStats(cmd *cobra.Command, args []string) error {
+	if statsTop < 0 {
+		return errors.New("--top must not be negative")
+	}
+
+	entries, err := readAuditLog()
+	if err != nil {
+		return err
+	}
+	stats := audit.ComputeStats(entries, statsTop)
+
+	if statsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	fmt.Printf("Total commands: %d\n", stats.Total)
+	if stats.Total == 0 {
+		return nil
+	}
+	fmt.Printf("Approved: %d (%.1f%%)\n", stats.Approved, stats.ApprovalRate*100)
+	fmt.Printf("Rejected: %d (%.1f%%)\n", stats.Rejected, (1-stats.ApprovalRate)*100)
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Matched patterns: %d\n", len(stats.Matches))
+	for _, name := range sortedByCount(stats.Matches) {
+		fmt.Fprintf(w, "  %s\t%d\n", name, stats.Matches[name])
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Rejection codes: %d\n", len(stats.Rejections))
+	for _, code := range sortedByCount(stats.Rejections) {
+		fmt.Fprintf(w, "  %s\t%d\n", code, stats.Rejections[code])
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Top commands: %d\n", len(stats.TopCommands))
+	for _, c := range stats.TopCommands {
+		fmt.Fprintf(w, "  %s\t%d\n", truncateCommand(c.Command), c.Count)
+	}
+
+	return w.Flush()
+}
+
+// sortedByCount returns the keys of counts ordered by descending count, then name.
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func runAuditTail(cmd *cobra.Command, args []string) error {
+	if tailLines < 0 {
+		return errors.New("--lines must not be negative")
+	}
+
+	path, err := auditLogPath()
+	if err != nil {
+		return fmt.Errorf("failed to locate audit log: %w", err)
+	}
+	entries, err := audit.TailEntries(path, tailLines)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	for _, e := range entries {
+		fmt.Println(formatTailEntry(e))
+	}
+
+	if !tailFollow {
+		return nil
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	return audit.Follow(ctx, path, tailPollInterval, func(e audit.Entry) {
+		fmt.Println(formatTailEntry(e))
+	})
+}
+
+// formatTailEntry formats an entry as a single line for tail output.
+func formatTailEntry(e audit.Entry) string {
+	decision := "APPROVED"
+	if !e.Approved {
+		decision = "DENIED  "
+	}
+	line := fmt.Sprintf("%s  %s  %s", e.Timestamp, decision, e.Command)
+	if reason := entryReason(e); reason != "" {
+		line += "  (" + reason + ")"
+	}
+	return line
+}
+
+// entryReason summarizes why an entry was approved or rejected: the matched
+// pattern names, or the rejection codes of the rejected segments.
+func entryReason(e audit.Entry) string {
+	var parts []string
+	for _, seg := range e.Segments {
+		switch {
+		case !e.Approved && seg.Rejection != nil:
+			part := seg.Rejection.Code
+			if seg.Rejection.Name != "" {
+				part += " " + seg.Rejection.Name
+			}
+			parts = append(parts, part)
+		case e.Approved && seg.Match != nil:
+			parts = append(parts, seg.Match.Name)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// runAuditPurge deletes the audit log and its backups, or with --keep-days
+// only the data older than that.
+func runAuditPurge(cmd *cobra.Command, args []string) error {
+	if purgeKeepDays < 0 {
+		return errors.New("--keep-days must not be negative")
+	}
+	path, err := auditLogPath()
+	if err != nil {
+		return err
+	}
+
+	if !purgeYes {
+		prompt := fmt.Sprintf("Delete the audit log %s and all of its backups? [y/N] ", path)
+		if purgeKeepDays > 0 {
+			prompt = fmt.Sprintf("Delete audit data older than %d days from %s and its backups? [y/N] ", purgeKeepDays, path)
+		}
+		fmt.Print(prompt)
+		answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Println("Nothing deleted.")
+			return nil
+		}
+	}
+
+	if purgeKeepDays == 0 {
+		removed, err := audit.Purge(path)
+		if err != nil {
+			return fmt.Errorf("cannot purge audit log: %w", err)
+		}
+		fmt.Printf("Deleted %d audit log files\n", len(removed))
+		return nil
+	}
+
+	keep := time.Duration(purgeKeepDays) * 24 * time.Hour
+	removed, err := audit.RemoveExpiredBackups(path, keep)
+	if err != nil {
+		return fmt.Errorf("cannot purge audit log: %w", err)
+	}
+	pruned, err := audit.PruneEntries(path, time.Now().Add(-keep))
+	if err != nil {
+		return fmt.Errorf("cannot purge audit log: %w", err)
+	}
+	fmt.Printf("Deleted %d backups and %d entries older than %d days\n", len(removed), pruned, purgeKeepDays)
+	return nil
+}
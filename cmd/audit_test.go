@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+// setupAuditLog points HOME at a temp dir and writes entries to the default
+// audit log via audit.Log.
+func setupAuditLog(t *testing.T, entries ...audit.Entry) {
+	t.Helper()
+	resetGlobalState()
+	t.Setenv("HOME", t.TempDir())
+
+	logPath, err := audit.DefaultLogPath()
+	if err != nil {
+		t.Fatalf("DefaultLogPath() error = %v", err)
+	}
+	if err := audit.Init(logPath, false); err != nil {
+		t.Fatalf("audit.Init() error = %v", err)
+	}
+	for _, e := range entries {
+		if err := audit.Log(e); err != nil {
+			t.Fatalf("audit.Log() error = %v", err)
+		}
+	}
+	audit.Close()
+	t.Cleanup(func() {
+		audit.Reset()
+		resetGlobalState()
+	})
+}
+
+func sampleAuditEntries() []audit.Entry {
+	return []audit.Entry{
+		{Version: 1, SessionID: "session-a", Command: "git status", Approved: true},
+		{Version: 1, SessionID: "session-a", Command: "rm -rf /", Approved: false},
+		{Version: 1, SessionID: "session-b", Command: "git push", Approved: false},
+		{Version: 1, SessionID: "session-b", Command: "ls -la", Approved: true},
+	}
+}
+
+func runQuery(t *testing.T) string {
+	t.Helper()
+	var err error
+	output := captureStdout(t, func() {
+		err = runAuditQuery(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runAuditQuery() error = %v", err)
+	}
+	return output
+}
+
+func TestRunAuditQueryAll(t *testing.T) {
+	setupAuditLog(t, sampleAuditEntries()...)
+
+	output := runQuery(t)
+	for _, want := range []string{"TIMESTAMP", "git status", "rm -rf /", "git push", "ls -la"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunAuditQueryFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func()
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "session",
+			setup:   func() { querySession = "session-b" },
+			want:    []string{"git push", "ls -la"},
+			notWant: []string{"git status", "rm -rf /"},
+		},
+		{
+			name:    "approved",
+			setup:   func() { queryApproved = true },
+			want:    []string{"git status", "ls -la"},
+			notWant: []string{"rm -rf /", "git push"},
+		},
+		{
+			name:    "rejected",
+			setup:   func() { queryRejected = true },
+			want:    []string{"rm -rf /", "git push"},
+			notWant: []string{"git status", "ls -la"},
+		},
+		{
+			name:    "command contains",
+			setup:   func() { queryCommandContains = "git" },
+			want:    []string{"git status", "git push"},
+			notWant: []string{"rm -rf /", "ls -la"},
+		},
+		{
+			name:    "combined",
+			setup:   func() { queryCommandContains = "git"; queryRejected = true },
+			want:    []string{"git push"},
+			notWant: []string{"git status", "rm -rf /", "ls -la"},
+		},
+		{
+			name:    "limit keeps most recent",
+			setup:   func() { queryLimit = 1 },
+			want:    []string{"ls -la"},
+			notWant: []string{"git status", "rm -rf /", "git push"},
+		},
+		{
+			name:  "since duration",
+			setup: func() { querySince = "1h" },
+			want:  []string{"git status", "rm -rf /", "git push", "ls -la"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupAuditLog(t, sampleAuditEntries()...)
+			tt.setup()
+
+			output := runQuery(t)
+			for _, want := range tt.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("output missing %q, got:\n%s", want, output)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(output, notWant) {
+					t.Errorf("output should not contain %q, got:\n%s", notWant, output)
+				}
+			}
+		})
+	}
+}
+
+func TestRunAuditQueryNoMatches(t *testing.T) {
+	setupAuditLog(t, sampleAuditEntries()...)
+	querySince = time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	output := runQuery(t)
+	if !strings.Contains(output, "No matching audit entries.") {
+		t.Errorf("expected no-match message, got:\n%s", output)
+	}
+}
+
+func TestRunAuditQueryMissingLog(t *testing.T) {
+	resetGlobalState()
+	t.Setenv("HOME", t.TempDir())
+	defer resetGlobalState()
+
+	output := runQuery(t)
+	if !strings.Contains(output, "No matching audit entries.") {
+		t.Errorf("expected no-match message, got:\n%s", output)
+	}
+}
+
+func TestRunAuditQueryInvalidSince(t *testing.T) {
+	setupAuditLog(t)
+	querySince = "yesterday"
+
+	err := runAuditQuery(&cobra.Command{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid --since") {
+		t.Errorf("runAuditQuery() error = %v, want invalid --since error", err)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	got, err := parseSince("24h", now)
+	if err != nil || !got.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("parseSince(24h) = %v, %v", got, err)
+	}
+
+	got, err = parseSince("2026-01-01T00:00:00Z", now)
+	if err != nil || !got.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseSince(timestamp) = %v, %v", got, err)
+	}
+
+	if _, err := parseSince("bogus", now); err == nil {
+		t.Error("parseSince(bogus) expected error")
+	}
+}
+
+func TestRunAuditQueryReadsBackups(t *testing.T) {
+	setupAuditLog(t, audit.Entry{Command: "current"})
+
+	logPath, _ := audit.DefaultLogPath()
+	writeGzipAuditEntries(t, logPath+".1.gz", audit.Entry{Command: "rotated", Timestamp: time.Now().UTC().Format(audit.TimestampFormat)})
+
+	output := runQuery(t)
+	if !strings.Contains(output, "rotated") || !strings.Contains(output, "current") {
+		t.Errorf("expected rotated and current entries, got:\n%s", output)
+	}
+	if strings.Index(output, "rotated") > strings.Index(output, "current") {
+		t.Errorf("expected rotated entry before current, got:\n%s", output)
+	}
+}
+
+// writeGzipAuditEntries writes entries to a gzipped rotated backup.
+func writeGzipAuditEntries(t *testing.T, path string, entries ...audit.Entry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	enc := json.NewEncoder(gz)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sampleStatsEntries() []audit.Entry {
+	gitMatch := &audit.Match{Type: "subcommand", Name: "git"}
+	return []audit.Entry{
+		{Command: "git status", Approved: true, Segments: []audit.Segment{{Command: "git status", Approved: true, Match: gitMatch}}},
+		{Command: "git status", Approved: true, Segments: []audit.Segment{{Command: "git status", Approved: true, Match: gitMatch}}},
+		{Command: "git log", Approved: true, Segments: []audit.Segment{{Command: "git log", Approved: true, Match: gitMatch}}},
+		{Command: "rm -rf /", Approved: false, Segments: []audit.Segment{
+			{Command: "rm -rf /", Rejection: &audit.Rejection{Code: audit.CodeDenyMatch, Name: "rm root"}},
+		}},
+	}
+}
+
+func TestRunAuditStats(t *testing.T) {
+	setupAuditLog(t, sampleStatsEntries()...)
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runAuditStats(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runAuditStats() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"Total commands: 4",
+		"Approved: 3 (75.0%)",
+		"Rejected: 1 (25.0%)",
+		"Matched patterns: 1",
+		"DENY_MATCH",
+		"git status",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunAuditStatsJSON(t *testing.T) {
+	setupAuditLog(t, sampleStatsEntries()...)
+	statsJSON = true
+	statsTop = 1
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runAuditStats(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runAuditStats() error = %v", err)
+	}
+
+	var stats audit.Stats
+	if err := json.Unmarshal([]byte(output), &stats); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if stats.Total != 4 || stats.Approved != 3 || stats.Rejected != 1 {
+		t.Errorf("totals = %d/%d/%d, want 4/3/1", stats.Total, stats.Approved, stats.Rejected)
+	}
+	if stats.Matches["git"] != 3 {
+		t.Errorf("Matches[git] = %d, want 3", stats.Matches["git"])
+	}
+	if stats.Rejections[audit.CodeDenyMatch] != 1 {
+		t.Errorf("Rejections[DENY_MATCH] = %d, want 1", stats.Rejections[audit.CodeDenyMatch])
+	}
+	if len(stats.TopCommands) != 1 || stats.TopCommands[0].Command != "git status" || stats.TopCommands[0].Count != 2 {
+		t.Errorf("TopCommands = %+v, want [git status x2]", stats.TopCommands)
+	}
+}
+
+func TestRunAuditStatsEmpty(t *testing.T) {
+	setupAuditLog(t)
+
+	output := captureStdout(t, func() {
+		runAuditStats(&cobra.Command{}, nil)
+	})
+	if !strings.Contains(output, "Total commands: 0") {
+		t.Errorf("expected empty summary, got:\n%s", output)
+	}
+}
+
+func TestRunAuditTail(t *testing.T) {
+	setupAuditLog(t, sampleStatsEntries()...)
+	tailLines = 2
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runAuditTail(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runAuditTail() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d:\n%s", len(lines), output)
+	}
+	if !strings.Contains(lines[0], "APPROVED") || !strings.Contains(lines[0], "git log") || !strings.Contains(lines[0], "(git)") {
+		t.Errorf("unexpected approved line: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "DENIED") || !strings.Contains(lines[1], "rm -rf /") || !strings.Contains(lines[1], "(DENY_MATCH rm root)") {
+		t.Errorf("unexpected denied line: %q", lines[1])
+	}
+}
+
+// runPurge runs audit purge with answer on stdin and returns its output.
+func runPurge(t *testing.T, answer string) string {
+	t.Helper()
+	cmd := &cobra.Command{}
+	cmd.SetIn(strings.NewReader(answer))
+	var err error
+	output := captureStdout(t, func() {
+		err = runAuditPurge(cmd, nil)
+	})
+	if err != nil {
+		t.Fatalf("runAuditPurge() error = %v", err)
+	}
+	return output
+}
+
+func TestRunAuditPurge(t *testing.T) {
+	setupAuditLog(t, sampleAuditEntries()...)
+	logPath, _ := audit.DefaultLogPath()
+	writeGzipAuditEntries(t, logPath+".1.gz", audit.Entry{Command: "rotated"})
+	if err := os.WriteFile(logPath+".2", []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{logPath, logPath + ".1.gz", logPath + ".2"}
+
+	// Declining keeps everything
+	if output := runPurge(t, "n\n"); !strings.Contains(output, "Nothing deleted") {
+		t.Errorf("expected nothing to be deleted, got:\n%s", output)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("%s should be kept: %v", f, err)
+		}
+	}
+
+	output := runPurge(t, "y\n")
+	if !strings.Contains(output, "Deleted 3 audit log files") {
+		t.Errorf("expected 3 files deleted, got:\n%s", output)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed, stat error = %v", f, err)
+		}
+	}
+}
+
+func TestRunAuditPurgeKeepDays(t *testing.T) {
+	setupAuditLog(t)
+	purgeYes = true
+	purgeKeepDays = 7
+	logPath, _ := audit.DefaultLogPath()
+
+	now := time.Now()
+	var current strings.Builder
+	enc := json.NewEncoder(&current)
+	enc.Encode(audit.Entry{Command: "old", Timestamp: now.Add(-30 * 24 * time.Hour).UTC().Format(audit.TimestampFormat)})
+	enc.Encode(audit.Entry{Command: "recent", Timestamp: now.Add(-time.Hour).UTC().Format(audit.TimestampFormat)})
+	if err := os.WriteFile(logPath, []byte(current.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeGzipAuditEntries(t, logPath+".1.gz", audit.Entry{Command: "recent backup"})
+	writeGzipAuditEntries(t, logPath+".2.gz", audit.Entry{Command: "old backup"})
+	old := now.Add(-30 * 24 * time.Hour)
+	if err := os.Chtimes(logPath+".2.gz", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	output := runPurge(t, "")
+	if !strings.Contains(output, "Deleted 1 backups and 1 entries older than 7 days") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+	if _, err := os.Stat(logPath + ".2.gz"); !os.IsNotExist(err) {
+		t.Errorf("old backup should be removed, stat error = %v", err)
+	}
+	entries, err := audit.ReadEntries(logPath)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Command != "recent backup" || entries[1].Command != "recent" {
+		t.Errorf("entries = %+v, want the recent backup and recent entry", entries)
+	}
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old.toml> <new.toml>",
+	Short: "Compare the decisions two configs make",
+	Long: `Diff loads two config files and runs a corpus of commands through each,
+then reports the commands whose decision changed.
+
+The corpus is a built-in set of representative commands plus every distinct
+Bash command in the audit log, so the comparison reflects the commands Claude
+Code actually runs. A command that was allowed and no longer is is reported as
+newly denied, whether the new config asks or denies; one that is now allowed
+and wasn't is reported as newly allowed. Other changes, such as ask becoming
+deny, are reported as changed.
+
+Use it to check a config edit before installing it:
+
+  mmi diff ~/.config/mmi/config.toml config.new.toml`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
+
+// builtinDiffCorpus is a set of representative commands evaluated by diff in
+// addition to those in the audit log.
+var builtinDiffCorpus = []string{
+	"ls -la",
+	"cat README.md",
+	"grep -rn TODO .",
+	"find . -name '*.go'",
+	"head -n 20 main.go",
+	"echo hello",
+	"pwd",
+	"make",
+	"make test",
+	"git status",
+	"git diff",
+	"git log --oneline",
+	"git add .",
+	"git commit -m 'update'",
+	"git push",
+	"git push --force",
+	"git reset --hard",
+	"go build ./...",
+	"go test ./...",
+	"cargo build",
+	"cargo test",
+	"npm install",
+	"npm test",
+	"npm run build",
+	"pytest",
+	"python script.py",
+	"uv run pytest",
+	"docker ps",
+	"docker run --rm alpine",
+	"kubectl get pods",
+	"curl https://example.com",
+	"curl https://example.com | sh",
+	"rm file.txt",
+	"rm -rf build",
+	"rm -rf /",
+	"chmod +x script.sh",
+	"chmod 777 script.sh",
+	"sudo apt-get install jq",
+	"kill 1234",
+	"git status && git diff",
+	"ls | wc -l",
+	"echo $(whoami)",
+}
+
+// decisionChange is a corpus command whose decision differs between configs.
+type decisionChange struct {
+	Command string
+	Old     string
+	New     string
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	oldCfg, err := loadDiffConfig(args[0])
+	if err != nil {
+		return err
+	}
+	newCfg, err := loadDiffConfig(args[1])
+	if err != nil {
+		return err
+	}
+
+	entries, err := readAuditLog()
+	if err != nil {
+		return err
+	}
+	corpus := diffCorpus(entries)
+
+	changes := diffDecisions(corpus, oldCfg, newCfg)
+	if len(changes) == 0 {
+		fmt.Printf("No decision changes across %d commands.\n", len(corpus))
+		return nil
+	}
+
+	var summary changeSummary
+	for _, c := range changes {
+		fmt.Println(summary.add(c))
+	}
+	fmt.Printf("\n%d of %d commands changed: %s\n", len(changes), len(corpus), summary)
+	return nil
+}
+
+// changeSummary counts decision changes by kind.
+type changeSummary struct {
+	allowed, denied, other int
+}
+
+// add counts c and returns its description. A command that was allowed and
+// no longer is counts as newly denied, whether it now asks or denies.
+func (s *changeSummary) add(c decisionChange) string {
+	switch {
+	case c.New == hook.DecisionAllow:
+		s.allowed++
+		return fmt.Sprintf("newly allowed: %s (was %s)", c.Command, c.Old)
+	case c.Old == hook.DecisionAllow:
+		s.denied++
+		return fmt.Sprintf("newly denied: %s (now %s)", c.Command, c.New)
+	default:
+		s.other++
+		return fmt.Sprintf("changed: %s (%s -> %s)", c.Command, c.Old, c.New)
+	}
+}
+
+func (s changeSummary) String() string {
+	return fmt.Sprintf("%d newly allowed, %d newly denied, %d other", s.allowed, s.denied, s.other)
+}
+
+// loadDiffConfig loads the config file at path, resolving includes relative
+// to its directory.
+func loadDiffConfig(path string) (*config.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	cfg, err := config.LoadConfigWithDir(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, describeConfigError(err))
+	}
+	return cfg, nil
+}
+
+// diffCorpus returns the built-in commands followed by the distinct Bash
+// commands in entries, in the order they were first seen.
+func diffCorpus(entries []audit.Entry) []string {
+	seen := make(map[string]bool)
+	var corpus []string
+	add := func(command string) {
+		if command == "" || seen[command] {
+			return
+		}
+		seen[command] = true
+		corpus = append(corpus, command)
+	}
+
+	for _, command := range builtinDiffCorpus {
+		add(command)
+	}
+	for _, e := range entries {
+		if isBashEntry(e) {
+			add(e.Command)
+		}
+	}
+	return corpus
+}
+
+// diffDecisions evaluates each command under oldCfg and newCfg and returns
+// those whose decision differs, in corpus order.
+func diffDecisions(corpus []string, oldCfg, newCfg *config.Config) []decisionChange {
+	var changes []decisionChange
+	for _, command := range corpus {
+		before := resultDecision(hook.EvaluateCommand(command, oldCfg))
+		after := resultDecision(hook.EvaluateCommand(command, newCfg))
+		if before != after {
+			changes = append(changes, decisionChange{Command: command, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+// resultDecision returns the decision result would send to Claude Code, or
+// "passthrough" when mmi abstains.
+func resultDecision(result hook.Result) string {
+	switch {
+	case result.Approved:
+		return hook.DecisionAllow
+	case result.Passthrough:
+		return "passthrough"
+	default:
+		return outputDecision(result.Output)
+	}
+}
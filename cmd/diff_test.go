@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+// writeDiffConfigs writes oldConfig and newConfig to a temp dir and returns
+// their paths.
+func writeDiffConfigs(t *testing.T, oldConfig, newConfig string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.toml")
+	newPath := filepath.Join(dir, "new.toml")
+	if err := os.WriteFile(oldPath, []byte(oldConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte(newConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return oldPath, newPath
+}
+
+func TestRunDiff(t *testing.T) {
+	setupAuditLog(t)
+	oldPath, newPath := writeDiffConfigs(t, `
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+
+[[commands.simple]]
+name = "read-only"
+commands = ["ls", "cat", "pwd"]
+`, `
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo", "kill"]
+
+[[commands.simple]]
+name = "read-only"
+commands = ["cat", "pwd", "echo"]
+`)
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runDiff(&cobra.Command{}, []string{oldPath, newPath})
+	})
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"newly denied: ls -la (now ask)",
+		"newly allowed: echo hello (was ask)",
+		"changed: kill 1234 (ask -> deny)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"cat README.md", "sudo apt-get"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %q:\n%s", unwanted, output)
+		}
+	}
+}
+
+func TestRunDiffUsesAuditLog(t *testing.T) {
+	setupAuditLog(t,
+		audit.Entry{Version: 1, Command: "terraform plan", Input: `{"tool_name":"Bash","tool_input":{"command":"terraform plan"}}`},
+		audit.Entry{Version: 1, Command: "terraform apply"},
+		audit.Entry{Version: 1, Command: "terraform destroy", Input: `{"tool_name":"Read","tool_input":{"file_path":"terraform destroy"}}`},
+	)
+	oldPath, newPath := writeDiffConfigs(t, `
+[[commands.simple]]
+name = "terraform"
+commands = ["terraform"]
+`, "")
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runDiff(&cobra.Command{}, []string{oldPath, newPath})
+	})
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+
+	for _, want := range []string{"newly denied: terraform plan", "newly denied: terraform apply"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "terraform destroy") {
+		t.Errorf("output should skip commands logged for other tools:\n%s", output)
+	}
+}
+
+func TestRunDiffNoChanges(t *testing.T) {
+	setupAuditLog(t)
+	config := `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`
+	oldPath, newPath := writeDiffConfigs(t, config, config)
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runDiff(&cobra.Command{}, []string{oldPath, newPath})
+	})
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	if !strings.Contains(output, "No decision changes") {
+		t.Errorf("output = %q, want no decision changes", output)
+	}
+}
+
+func TestRunDiffInvalidConfig(t *testing.T) {
+	setupAuditLog(t)
+	oldPath, newPath := writeDiffConfigs(t, "", "[[commands.simple]\n")
+
+	err := runDiff(&cobra.Command{}, []string{oldPath, newPath})
+	if err == nil || !strings.Contains(err.Error(), "new.toml") {
+		t.Errorf("runDiff() error = %v, want error naming new.toml", err)
+	}
+}
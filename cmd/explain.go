@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/spf13/cobra"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <command>",
+	Short: "Explain why a command would be approved or rejected",
+	Long: `Explain runs a command string through the full approval pipeline and prints
+a human-readable trace of each step:
+
+- How the command was split into segments
+- Which wrappers were stripped from each segment
+- Whether a deny pattern matched, and which one
+- Which safe pattern matched, or that nothing did
+
+For rejected segments it also reports the closest near miss, such as a
+command whose subcommand isn't in the allowed list.
+
+Always exits 0.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExplain,
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+}
+
+func runExplain(cmd *cobra.Command, args []string) error {
+	result := evaluateCommandString(args[0])
+
+	fmt.Printf("Command: %s\n", result.Command)
+	switch {
+	case result.Approved:
+		fmt.Printf("Decision: APPROVED (reason: %s)\n", result.Reason)
+	case result.Passthrough:
+		fmt.Println("Decision: PASSTHROUGH (Claude Code decides)")
+	default:
+		fmt.Println("Decision: REJECTED")
+	}
+	fmt.Printf("Segments: %d\n", len(result.Segments))
+
+	cfg := config.ForDir(currentDir())
+	for i, seg := range result.Segments {
+		fmt.Println()
+		explainSegment(i+1, seg, cfg)
+	}
+
+	return nil
+}
+
+// explainSegment prints the evaluation trace for a single segment.
+func explainSegment(index int, seg audit.Segment, cfg *config.Config) {
+	coreCmd, _ := hook.StripWrappers(seg.Command, cfg.WrapperPatterns)
+
+	fmt.Printf("Segment %d: %s\n", index, seg.Command)
+	if len(seg.Wrappers) > 0 {
+		fmt.Printf("  Wrappers stripped: %s\n", strings.Join(seg.Wrappers, ", "))
+	} else {
+		fmt.Println("  Wrappers stripped: (none)")
+	}
+	fmt.Printf("  Core command: %s\n", coreCmd)
+
+	if seg.Match != nil && seg.Match.Type == hook.MatchTypeAllowOverride {
+		fmt.Printf("  Allow override: matched %q %s (deny check skipped)\n", seg.Match.Name, seg.Match.Pattern)
+		if seg.Match.Note != "" {
+			fmt.Printf("  Note: %s\n", seg.Match.Note)
+		}
+		return
+	}
+	if seg.Match != nil {
+		fmt.Println("  Deny check: no deny pattern matched")
+		fmt.Printf("  Safe check: matched %q (%s) %s\n", seg.Match.Name, seg.Match.Type, seg.Match.Pattern)
+		if seg.Match.Note != "" {
+			fmt.Printf("  Note: %s\n", seg.Match.Note)
+		}
+		return
+	}
+
+	rej := seg.Rejection
+	if rej == nil {
+		return
+	}
+
+	switch rej.Code {
+	case audit.CodeDenyMatch:
+		fmt.Printf("  Deny check: matched %q %s\n", rej.Name, rej.Pattern)
+		if rej.Detail != "" {
+			fmt.Printf("  Deny reason: %s\n", rej.Detail)
+		}
+	case audit.CodeNoMatch, audit.CodePassthrough:
+		fmt.Println("  Deny check: no deny pattern matched")
+		fmt.Println("  Safe check: no safe pattern matched")
+		if nearMiss := hook.FindNearMiss(coreCmd, cfg.SafeCommands); nearMiss != "" {
+			fmt.Printf("  Near miss: %s\n", nearMiss)
+		}
+	case audit.CodeRewrite:
+		fmt.Println("  Deny check: no deny pattern matched")
+		fmt.Printf("  Rewrite: %q suggests %q\n", rej.Name, rej.Detail)
+	case audit.CodePathRestricted, audit.CodeArgCount:
+		fmt.Println("  Deny check: no deny pattern matched")
+		fmt.Printf("  Safe check: %q matched but %s\n", rej.Name, rej.Detail)
+	default:
+		detail := rej.Code
+		if rej.Pattern != "" {
+			detail += " " + rej.Pattern
+		}
+		if rej.Detail != "" {
+			detail += " (" + rej.Detail + ")"
+		}
+		fmt.Printf("  Rejected: %s\n", detail)
+	}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/testutil"
+	"github.com/spf13/cobra"
+)
+
+const explainTestConfig = `
+[[deny.regex]]
+pattern = 'rm\s+-rf'
+name = "recursive delete"
+
+[[allow.regex]]
+pattern = '^rm -rf \./dist$'
+name = "clean dist"
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["diff", "log", "status"]
+
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+note = "needed for CI"
+`
+
+func setupExplainConfig(t *testing.T) func() {
+	t.Helper()
+	resetGlobalState()
+	cleanup := testutil.SetupTestConfig(t, explainTestConfig)
+	return func() {
+		cleanup()
+		resetGlobalState()
+	}
+}
+
+func TestRunExplainApproved(t *testing.T) {
+	cleanup := setupExplainConfig(t)
+	defer cleanup()
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runExplain(&cobra.Command{}, []string{"timeout 10 git status"})
+	})
+	if err != nil {
+		t.Fatalf("runExplain() error = %v", err)
+	}
+
+	for _, expected := range []string{
+		"Decision: APPROVED",
+		"Segment 1: timeout 10 git status",
+		"Wrappers stripped: timeout",
+		"Core command: git status",
+		"Deny check: no deny pattern matched",
+		`Safe check: matched "git" (subcommand)`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunExplainDenyMatch(t *testing.T) {
+	cleanup := setupExplainConfig(t)
+	defer cleanup()
+
+	output := captureStdout(t, func() {
+		runExplain(&cobra.Command{}, []string{"ls && rm -rf build"})
+	})
+
+	for _, expected := range []string{
+		"Decision: REJECTED",
+		"Segments: 2",
+		`Deny check: matched "recursive delete" rm\s+-rf`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunExplainAllowOverride(t *testing.T) {
+	cleanup := setupExplainConfig(t)
+	defer cleanup()
+
+	output := captureStdout(t, func() {
+		runExplain(&cobra.Command{}, []string{"rm -rf ./dist"})
+	})
+
+	for _, expected := range []string{
+		"Decision: APPROVED",
+		`Allow override: matched "clean dist" ^rm -rf \./dist$ (deny check skipped)`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunExplainNearMiss(t *testing.T) {
+	cleanup := setupExplainConfig(t)
+	defer cleanup()
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runExplain(&cobra.Command{}, []string{"git push origin main"})
+	})
+	if err != nil {
+		t.Errorf("runExplain() should always succeed, got %v", err)
+	}
+
+	expected := "Near miss: git is allowed but subcommand 'push' is not in [diff, log, status]"
+	if !strings.Contains(output, expected) {
+		t.Errorf("output should contain %q, got:\n%s", expected, output)
+	}
+}
+
+func TestRunExplainShowsNote(t *testing.T) {
+	cleanup := setupExplainConfig(t)
+	defer cleanup()
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runExplain(&cobra.Command{}, []string{"ls -la"})
+	})
+	if err != nil {
+		t.Fatalf("runExplain() error = %v", err)
+	}
+	if !strings.Contains(output, "Note: needed for CI") {
+		t.Errorf("output should contain the pattern note, got:\n%s", output)
+	}
+}
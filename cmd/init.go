@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/dgerlanc/mmi/internal/config"
 	"github.com/dgerlanc/mmi/internal/constants"
@@ -15,6 +16,8 @@ import (
 var initForce bool
 var initConfigOnly bool
 var initClaudeSettings string
+var initPreset string
+var initProject bool
 
 var initCmd = &cobra.Command{
 	Use:   "init",
@@ -28,6 +31,13 @@ By default, this command also configures Claude Code's settings.json to add
 the mmi PreToolUse hook for Bash commands. This enables mmi to intercept
 and validate commands before execution.
 
+Use --project to write a project config, .mmi.toml, to the current directory
+instead. Its patterns are added to the global config for commands run in the
+project, so it can be checked into the repository and shared. Claude Code
+settings are left alone in this mode unless --claude-settings is given.
+
+Use --preset to write a curated config for a common stack (python, node,
+or datascience) instead of the default config.
 Use --force to overwrite an existing configuration file.
 Use --config-only to skip configuring Claude Code settings.
 Use --claude-settings to specify a custom path to Claude's settings.json.`,
@@ -39,9 +49,15 @@ func init() {
 	initCmd.Flags().BoolVarP(&initForce, "force", "f", false, "Overwrite existing config file")
 	initCmd.Flags().BoolVar(&initConfigOnly, "config-only", false, "Only write config.toml, skip Claude settings")
 	initCmd.Flags().StringVar(&initClaudeSettings, "claude-settings", "", "Path to Claude settings.json (default: ~/.claude/settings.json)")
+	initCmd.Flags().StringVar(&initPreset, "preset", "", "Write the config for a preset: "+strings.Join(config.Presets(), ", "))
+	initCmd.Flags().BoolVar(&initProject, "project", false, "Write .mmi.toml to the current directory instead of the global config")
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
+	if initProject {
+		return runInitProject()
+	}
+
 	configDir, err := config.GetConfigDir()
 	if err != nil {
 		return fmt.Errorf("failed to get config directory: %w", err)
@@ -49,6 +65,14 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	configPath := filepath.Join(configDir, constants.ConfigFileName)
 
+	configData := config.GetDefaultConfig()
+	if initPreset != "" {
+		configData, err = config.GetPreset(initPreset)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Check if config already exists
 	configExists := false
 	if _, err := os.Stat(configPath); err == nil {
@@ -64,8 +88,8 @@ func runInit(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to create config directory: %w", err)
 		}
 
-		// Write default config file
-		if err := os.WriteFile(configPath, config.GetDefaultConfig(), constants.FileMode); err != nil {
+		// Write the default or preset config file
+		if err := os.WriteFile(configPath, configData, constants.FileMode); err != nil {
 			return fmt.Errorf("failed to write config file: %w", err)
 		}
 
@@ -83,6 +107,38 @@ func runInit(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// runInitProject writes a project config to the current directory. Claude
+// settings are only configured if --claude-settings was given.
+func runInitProject() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	configPath := filepath.Join(cwd, constants.ProjectConfigFile)
+
+	configData := config.GetProjectTemplate()
+	if initPreset != "" {
+		configData, err = config.GetPreset(initPreset)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(configPath); err == nil && !initForce {
+		fmt.Printf("Project config already exists at %s (use --force to overwrite)\n", configPath)
+	} else {
+		if err := os.WriteFile(configPath, configData, constants.FileMode); err != nil {
+			return fmt.Errorf("failed to write project config: %w", err)
+		}
+		fmt.Printf("Project configuration written to: %s\n", configPath)
+	}
+
+	if initClaudeSettings != "" && !initConfigOnly {
+		return configureClaudeSettings()
+	}
+	return nil
+}
+
 // getClaudeSettingsPath returns the path to Claude's settings.json file.
 // It checks the --claude-settings flag first, then falls back to
 // ~/.claude/settings.json.
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
 	"github.com/spf13/cobra"
 )
 
@@ -413,6 +414,68 @@ func TestRunInitWithConfigOnlySkipsSettings(t *testing.T) {
 	}
 }
 
+func TestRunInitWithPreset(t *testing.T) {
+	resetGlobalState()
+
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, "mmi")
+	claudeDir := filepath.Join(tmpDir, ".claude")
+
+	os.Setenv("MMI_CONFIG", configDir)
+	defer os.Unsetenv("MMI_CONFIG")
+	initClaudeSettings = filepath.Join(claudeDir, "settings.json")
+
+	cmd := &cobra.Command{}
+	initForce = false
+	initConfigOnly = false
+	initPreset = "python"
+
+	if err := runInit(cmd, []string{}); err != nil {
+		t.Fatalf("runInit() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "config.toml"))
+	if err != nil {
+		t.Fatalf("failed to read config file: %v", err)
+	}
+	cfg, err := config.LoadConfig(data)
+	if err != nil {
+		t.Fatalf("preset config failed to load: %v", err)
+	}
+
+	if result := hook.EvaluateCommand("pytest -x tests", cfg); !result.Approved {
+		t.Errorf("pytest should be approved by the python preset, got %s", result.Output)
+	}
+	if result := hook.EvaluateCommand("rm -rf /", cfg); !result.DenyMatch {
+		t.Errorf("rm -rf / should be denied by the python preset, got %s", result.Output)
+	}
+
+	// The preset still wires Claude settings
+	if _, err := os.Stat(initClaudeSettings); err != nil {
+		t.Errorf("settings.json should be created with --preset: %v", err)
+	}
+}
+
+func TestRunInitWithUnknownPreset(t *testing.T) {
+	resetGlobalState()
+
+	tmpDir := t.TempDir()
+	os.Setenv("MMI_CONFIG", tmpDir)
+	defer os.Unsetenv("MMI_CONFIG")
+	initClaudeSettings = filepath.Join(tmpDir, "settings.json")
+
+	initForce = false
+	initPreset = "cobol"
+
+	err := runInit(&cobra.Command{}, []string{})
+	if err == nil || !strings.Contains(err.Error(), "unknown preset") {
+		t.Errorf("runInit() error = %v, want unknown preset error", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "config.toml")); !os.IsNotExist(err) {
+		t.Error("config file should not be written for an unknown preset")
+	}
+}
+
 func TestRunInitConfiguresClaudeSettings(t *testing.T) {
 	resetGlobalState()
 
@@ -766,6 +829,112 @@ func TestRunInitHandlesInvalidJSON(t *testing.T) {
 
 // Unit tests for helper functions
 
+func TestRunInitProjectCreatesFileInCwd(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, "mmi")
+	t.Setenv("MMI_CONFIG", configDir)
+	projectDir := filepath.Join(tmpDir, "project")
+	if err := os.Mkdir(projectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(projectDir)
+
+	initProject = true
+	initForce = false
+	initConfigOnly = false
+
+	output := captureStdout(t, func() {
+		if err := runInit(&cobra.Command{}, []string{}); err != nil {
+			t.Fatalf("runInit() error = %v", err)
+		}
+	})
+
+	projectPath := filepath.Join(projectDir, ".mmi.toml")
+	content, err := os.ReadFile(projectPath)
+	if err != nil {
+		t.Fatalf(".mmi.toml was not created: %v", err)
+	}
+	if !bytes.Equal(content, config.GetProjectTemplate()) {
+		t.Error(".mmi.toml content does not match the project template")
+	}
+	if _, err := config.LoadConfig(content); err != nil {
+		t.Errorf("project template does not load: %v", err)
+	}
+	if !strings.Contains(output, projectPath) {
+		t.Errorf("output should contain the project config path %s, got: %s", projectPath, output)
+	}
+
+	// The global config and Claude settings are left alone
+	if _, err := os.Stat(configDir); !os.IsNotExist(err) {
+		t.Error("global config directory should not be created in project mode")
+	}
+	if strings.Contains(output, "Claude Code hook") {
+		t.Errorf("Claude settings should not be configured in project mode, got: %s", output)
+	}
+}
+
+func TestRunInitProjectWithPresetAndClaudeSettings(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+	settingsPath := filepath.Join(tmpDir, ".claude", "settings.json")
+
+	initProject = true
+	initPreset = "python"
+	initClaudeSettings = settingsPath
+	initConfigOnly = false
+
+	captureStdout(t, func() {
+		if err := runInit(&cobra.Command{}, []string{}); err != nil {
+			t.Fatalf("runInit() error = %v", err)
+		}
+	})
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, ".mmi.toml"))
+	if err != nil {
+		t.Fatalf(".mmi.toml was not created: %v", err)
+	}
+	preset, _ := config.GetPreset("python")
+	if !bytes.Equal(content, preset) {
+		t.Error(".mmi.toml content does not match the python preset")
+	}
+	if _, err := os.Stat(settingsPath); err != nil {
+		t.Errorf("settings.json should be configured when --claude-settings is given: %v", err)
+	}
+}
+
+func TestRunInitProjectWithExistingFilePrintsNotice(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+	projectPath := filepath.Join(tmpDir, ".mmi.toml")
+	if err := os.WriteFile(projectPath, []byte("# existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	initProject = true
+	initForce = false
+
+	output := captureStdout(t, func() {
+		if err := runInit(&cobra.Command{}, []string{}); err != nil {
+			t.Fatalf("runInit() error = %v", err)
+		}
+	})
+	if !strings.Contains(output, "already exists") {
+		t.Errorf("output should report the existing file, got: %s", output)
+	}
+	if content, _ := os.ReadFile(projectPath); string(content) != "# existing" {
+		t.Error("existing .mmi.toml should not be overwritten without --force")
+	}
+}
+
 func TestIsMMIHookPresent(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/spf13/cobra"
+)
+
+var learnTop int
+var learnApply bool
+
+var learnCmd = &cobra.Command{
+	Use:   "learn",
+	Short: "Suggest allow patterns from rejected commands in the audit log",
+	Long: `Learn scans the audit log for segments rejected because they matched no
+pattern (NO_MATCH), groups them by command, and prints suggested config
+entries, most frequently rejected first.
+
+A command that was always followed by a subcommand-like word (git push,
+cargo build) is suggested as a [[commands.subcommand]] entry listing those
+subcommands; anything else is suggested as a [[commands.simple]] entry.
+Commands the current config already allows or denies are skipped.
+
+Review the suggestions before using them: a simple entry allows the command
+with any arguments.
+
+Use --apply to append the suggestions to config.toml after confirmation.`,
+	RunE: runLearn,
+}
+
+func init() {
+	rootCmd.AddCommand(learnCmd)
+	learnCmd.Flags().IntVar(&learnTop, "top", 10, "Number of suggestions to show (0 for all)")
+	learnCmd.Flags().BoolVar(&learnApply, "apply", false, "Append the suggestions to config.toml after confirmation")
+}
+
+// suggestion is a proposed allow list entry for a rejected command.
+type suggestion struct {
+	Command string
+	Count   int
+	// Subcommands is set when every rejection of the command had a
+	// subcommand-like second word, most frequent first
+	Subcommands []audit.CommandCount
+}
+
+var (
+	// learnCommandWord matches command names worth suggesting; assignments
+	// and shell syntax are skipped
+	learnCommandWord = regexp.MustCompile(`^[\w./+-]+$`)
+	// learnSubcommandWord matches words that look like subcommands rather
+	// than paths, flags, or values
+	learnSubcommandWord = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+)
+
+// suggestPatterns groups the NO_MATCH segments of entries by command and
+// returns allow list suggestions, most frequently rejected first. Commands
+// that cfg now allows or denies are skipped. topN <= 0 returns all of them.
+func suggestPatterns(entries []audit.Entry, cfg *config.Config, topN int) []suggestion {
+	type group struct {
+		count int
+		bare  int // rejections without a subcommand-like second word
+		subs  map[string]int
+	}
+	groups := make(map[string]*group)
+
+	for _, e := range entries {
+		for _, seg := range e.Segments {
+			if seg.Rejection == nil || seg.Rejection.Code != audit.CodeNoMatch {
+				continue
+			}
+			core, _ := hook.StripWrappers(seg.Command, cfg.WrapperPatterns)
+			if hook.CheckSafe(core, cfg.SafeCommands).Matched || hook.CheckDeny(core, cfg.DenyPatterns).Denied {
+				continue
+			}
+			words := strings.Fields(core)
+			if len(words) == 0 || !learnCommandWord.MatchString(words[0]) {
+				continue
+			}
+
+			g, ok := groups[words[0]]
+			if !ok {
+				g = &group{subs: make(map[string]int)}
+				groups[words[0]] = g
+			}
+			g.count++
+			if len(words) > 1 && learnSubcommandWord.MatchString(words[1]) {
+				g.subs[words[1]]++
+			} else {
+				g.bare++
+			}
+		}
+	}
+
+	suggestions := make([]suggestion, 0, len(groups))
+	for name, g := range groups {
+		s := suggestion{Command: name, Count: g.count}
+		if g.bare == 0 {
+			for _, sub := range sortedByCount(g.subs) {
+				s.Subcommands = append(s.Subcommands, audit.CommandCount{Command: sub, Count: g.subs[sub]})
+			}
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	// Most frequent first, ties broken alphabetically for stable output
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Command < b.Command
+	})
+	if topN > 0 && len(suggestions) > topN {
+		suggestions = suggestions[:topN]
+	}
+	return suggestions
+}
+
+// formatSuggestion renders a suggestion as a commented TOML entry.
+func formatSuggestion(s suggestion) string {
+	var buf bytes.Buffer
+	if len(s.Subcommands) == 0 {
+		fmt.Fprintf(&buf, "# %s: %d rejections\n", s.Command, s.Count)
+		fmt.Fprintf(&buf, "[[commands.simple]]\n")
+		fmt.Fprintf(&buf, "name = %q\n", s.Command)
+		fmt.Fprintf(&buf, "commands = [%q]\n", s.Command)
+		return buf.String()
+	}
+
+	counts := make([]string, len(s.Subcommands))
+	subs := make([]string, len(s.Subcommands))
+	for i, sub := range s.Subcommands {
+		counts[i] = fmt.Sprintf("%s %d", sub.Command, sub.Count)
+		subs[i] = fmt.Sprintf("%q", sub.Command)
+	}
+	fmt.Fprintf(&buf, "# %s: %d rejections (%s)\n", s.Command, s.Count, strings.Join(counts, ", "))
+	fmt.Fprintf(&buf, "[[commands.subcommand]]\n")
+	fmt.Fprintf(&buf, "command = %q\n", s.Command)
+	fmt.Fprintf(&buf, "subcommands = [%s]\n", strings.Join(subs, ", "))
+	return buf.String()
+}
+
+func runLearn(cmd *cobra.Command, args []string) error {
+	if learnTop < 0 {
+		return errors.New("--top must not be negative")
+	}
+
+	entries, err := readAuditLog()
+	if err != nil {
+		return err
+	}
+
+	suggestions := suggestPatterns(entries, config.ForDir(currentDir()), learnTop)
+	if len(suggestions) == 0 {
+		fmt.Println("No suggestions: the audit log has no unmatched commands that the config doesn't already cover.")
+		return nil
+	}
+
+	stanzas := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		stanzas[i] = formatSuggestion(s)
+	}
+	addition := strings.Join(stanzas, "\n")
+	fmt.Print(addition)
+
+	if !learnApply {
+		return nil
+	}
+
+	configPath, configDir, data, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nAppend %d suggestions to %s? [y/N] ", len(suggestions), configPath)
+	answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		fmt.Println("Nothing written.")
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(addition)
+
+	if err := writeConfigFile(configPath, configDir, buf.Bytes()); err != nil {
+		return fmt.Errorf("cannot apply suggestions: %w", err)
+	}
+	fmt.Printf("Added %d suggestions to %s\n", len(suggestions), configPath)
+	return nil
+}
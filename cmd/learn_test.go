@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/testutil"
+	"github.com/spf13/cobra"
+)
+
+// noMatchEntry builds a rejected audit entry with one NO_MATCH segment per command.
+func noMatchEntry(commands ...string) audit.Entry {
+	entry := audit.Entry{Version: 1, Command: strings.Join(commands, " && ")}
+	for _, c := range commands {
+		entry.Segments = append(entry.Segments, audit.Segment{
+			Command:   c,
+			Rejection: &audit.Rejection{Code: audit.CodeNoMatch},
+		})
+	}
+	return entry
+}
+
+func TestSuggestPatterns(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	entries := []audit.Entry{
+		noMatchEntry("cargo build", "cargo test"),
+		noMatchEntry("cargo build --release"),
+		noMatchEntry("timeout 60 make"),
+		noMatchEntry("make install", "ls"),
+		noMatchEntry("rm -rf target"),
+		noMatchEntry("FOO=bar"),
+		{Version: 1, Command: "curl x", Segments: []audit.Segment{{
+			Command:   "curl x",
+			Rejection: &audit.Rejection{Code: audit.CodeDenyMatch},
+		}}},
+	}
+
+	got := suggestPatterns(entries, cfg, 0)
+	if len(got) != 2 {
+		t.Fatalf("suggestPatterns() = %+v, want cargo and make", got)
+	}
+
+	cargo := got[0]
+	if cargo.Command != "cargo" || cargo.Count != 3 {
+		t.Errorf("first suggestion = %+v, want cargo with 3 rejections", cargo)
+	}
+	wantSubs := []audit.CommandCount{{Command: "build", Count: 2}, {Command: "test", Count: 1}}
+	if len(cargo.Subcommands) != len(wantSubs) {
+		t.Fatalf("cargo subcommands = %+v, want %+v", cargo.Subcommands, wantSubs)
+	}
+	for i, want := range wantSubs {
+		if cargo.Subcommands[i] != want {
+			t.Errorf("cargo subcommand %d = %+v, want %+v", i, cargo.Subcommands[i], want)
+		}
+	}
+
+	// make was run bare once, so it is suggested as a simple command
+	second := got[1]
+	if second.Command != "make" || second.Count != 2 || len(second.Subcommands) != 0 {
+		t.Errorf("second suggestion = %+v, want simple make with 2 rejections", second)
+	}
+
+	if top := suggestPatterns(entries, cfg, 1); len(top) != 1 || top[0].Command != "cargo" {
+		t.Errorf("suggestPatterns(topN=1) = %+v, want only cargo", top)
+	}
+}
+
+func TestFormatSuggestion(t *testing.T) {
+	simple := formatSuggestion(suggestion{Command: "make", Count: 2})
+	want := "# make: 2 rejections\n[[commands.simple]]\nname = \"make\"\ncommands = [\"make\"]\n"
+	if simple != want {
+		t.Errorf("formatSuggestion(simple) = %q, want %q", simple, want)
+	}
+
+	sub := formatSuggestion(suggestion{Command: "cargo", Count: 3, Subcommands: []audit.CommandCount{
+		{Command: "build", Count: 2}, {Command: "test", Count: 1},
+	}})
+	want = "# cargo: 3 rejections (build 2, test 1)\n[[commands.subcommand]]\ncommand = \"cargo\"\nsubcommands = [\"build\", \"test\"]\n"
+	if sub != want {
+		t.Errorf("formatSuggestion(subcommand) = %q, want %q", sub, want)
+	}
+}
+
+func TestRunLearnApply(t *testing.T) {
+	setupAuditLog(t,
+		noMatchEntry("cargo build"),
+		noMatchEntry("cargo test"),
+		noMatchEntry("make"),
+	)
+	cleanup := testutil.SetupTestConfig(t, testutil.MinimalTestConfig)
+	defer cleanup()
+
+	learnApply = true
+	cmd := &cobra.Command{}
+	cmd.SetIn(strings.NewReader("y\n"))
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runLearn(cmd, nil)
+	})
+	if err != nil {
+		t.Fatalf("runLearn() error = %v", err)
+	}
+	for _, expected := range []string{"[[commands.subcommand]]", `command = "cargo"`, "[[commands.simple]]", "Added 2 suggestions"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	for _, command := range []string{"cargo build --release", "make all"} {
+		result := evaluateCommandString(command)
+		if !result.Approved {
+			t.Errorf("%q should be approved after mmi learn --apply", command)
+		}
+	}
+}
+
+func TestRunLearnApplyDeclined(t *testing.T) {
+	setupAuditLog(t, noMatchEntry("make"))
+	cleanup := testutil.SetupTestConfig(t, testutil.MinimalTestConfig)
+	defer cleanup()
+
+	learnApply = true
+	cmd := &cobra.Command{}
+	cmd.SetIn(strings.NewReader("n\n"))
+
+	before := readTestConfigFile(t)
+	output := captureStdout(t, func() {
+		if err := runLearn(cmd, nil); err != nil {
+			t.Fatalf("runLearn() error = %v", err)
+		}
+	})
+	if !strings.Contains(output, "Nothing written.") {
+		t.Errorf("output should say nothing was written, got:\n%s", output)
+	}
+	if after := readTestConfigFile(t); after != before {
+		t.Error("config should not change when the prompt is declined")
+	}
+}
+
+func TestRunLearnNoSuggestions(t *testing.T) {
+	setupAuditLog(t, noMatchEntry("ls -la"))
+	cleanup := testutil.SetupTestConfig(t, testutil.MinimalTestConfig)
+	defer cleanup()
+
+	output := captureStdout(t, func() {
+		if err := runLearn(&cobra.Command{}, nil); err != nil {
+			t.Fatalf("runLearn() error = %v", err)
+		}
+	})
+	if !strings.Contains(output, "No suggestions") {
+		t.Errorf("output = %q, want no suggestions message", output)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/patterns"
+	"github.com/spf13/cobra"
+)
+
+var listJSON bool
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the active patterns",
+	Long: `List prints every compiled pattern in the active configuration, after
+includes, extended profiles, and the project's .mmi.toml are resolved.
+
+Deny patterns, wrappers, and safe commands are listed with their name, type,
+and the regex they compile to.
+
+Use --json for machine-readable output.`,
+	RunE: runList,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Output patterns as JSON")
+}
+
+// listedPattern is the JSON form of a compiled pattern
+type listedPattern struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	Note    string `json:"note,omitempty"`
+}
+
+// listedPatterns is the JSON output of mmi list
+type listedPatterns struct {
+	Deny     []listedPattern `json:"deny"`
+	Allow    []listedPattern `json:"allow"`
+	Wrappers []listedPattern `json:"wrappers"`
+	Commands []listedPattern `json:"commands"`
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	config.Get()
+	if err := config.InitError(); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	cfg := config.ForDir(currentDir())
+
+	if listJSON {
+		out := listedPatterns{
+			Deny:     toListedPatterns(cfg.DenyPatterns),
+			Allow:    toListedPatterns(cfg.AllowOverrides),
+			Wrappers: toListedPatterns(cfg.WrapperPatterns),
+			Commands: toListedPatterns(cfg.SafeCommands),
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode patterns: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	printPatternList("Deny patterns", cfg.DenyPatterns)
+	fmt.Println()
+	if len(cfg.AllowOverrides) > 0 {
+		printPatternList("Allow overrides", cfg.AllowOverrides)
+		fmt.Println()
+	}
+	printPatternList("Wrapper patterns", cfg.WrapperPatterns)
+	fmt.Println()
+	printPatternList("Safe command patterns", cfg.SafeCommands)
+	return nil
+}
+
+// toListedPatterns converts compiled patterns to their JSON form.
+func toListedPatterns(pats []patterns.Pattern) []listedPattern {
+	result := make([]listedPattern, len(pats))
+	for i, p := range pats {
+		result[i] = listedPattern{Name: p.Name, Type: p.Type, Pattern: p.Pattern, Note: p.Note}
+	}
+	return result
+}
+
+// printPatternList prints a heading with the pattern count, then one line per pattern.
+func printPatternList(heading string, pats []patterns.Pattern) {
+	fmt.Printf("%s: %d\n", heading, len(pats))
+	for _, p := range pats {
+		fmt.Printf("  [%s] %s: %s\n", p.Type, p.Name, p.Pattern)
+	}
+}
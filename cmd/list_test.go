@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/testutil"
+	"github.com/spf13/cobra"
+)
+
+const listTestConfig = `
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+`
+
+func TestRunListText(t *testing.T) {
+	resetGlobalState()
+	cleanup := testutil.SetupTestConfig(t, listTestConfig)
+	defer func() { cleanup(); resetGlobalState() }()
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runList(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runList() error = %v", err)
+	}
+
+	for _, expected := range []string{
+		"Deny patterns: 1",
+		`[simple] dangerous: ^rm\b`,
+		"Wrapper patterns: 1",
+		`[command] timeout: ^timeout\s+`,
+		"Safe command patterns: 2",
+		`[simple] safe: ^ls\b`,
+		`[subcommand] git: ^git\s+`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunListJSON(t *testing.T) {
+	resetGlobalState()
+	cleanup := testutil.SetupTestConfig(t, listTestConfig)
+	defer func() { cleanup(); resetGlobalState() }()
+
+	listJSON = true
+	var err error
+	output := captureStdout(t, func() {
+		err = runList(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runList() error = %v", err)
+	}
+
+	var got listedPatterns
+	if err := json.Unmarshal([]byte(output), &got); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(got.Deny) != 1 || got.Deny[0].Name != "dangerous" || got.Deny[0].Pattern != `^rm\b` {
+		t.Errorf("deny = %+v, want dangerous ^rm\\b", got.Deny)
+	}
+	if len(got.Wrappers) != 1 || got.Wrappers[0].Type != "command" {
+		t.Errorf("wrappers = %+v, want one command wrapper", got.Wrappers)
+	}
+	if len(got.Commands) != 2 {
+		t.Fatalf("commands = %+v, want 2", got.Commands)
+	}
+	for _, p := range got.Commands {
+		if p.Name == "" || p.Type == "" || p.Pattern == "" {
+			t.Errorf("command pattern %+v should have name, type, and pattern", p)
+		}
+	}
+}
+
+func TestRunListInvalidConfig(t *testing.T) {
+	resetGlobalState()
+	cleanup := testutil.SetupTestConfig(t, "[[commands.simple]\n")
+	defer func() { cleanup(); resetGlobalState() }()
+
+	if err := runList(&cobra.Command{}, nil); err == nil {
+		t.Error("runList() with invalid config should return an error")
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/spf13/cobra"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Re-evaluate audit log entries against the current config",
+	Long: `Replay re-runs the command of every Bash entry in the audit log through the
+current config, in the entry's working directory so project configs apply,
+and reports the entries whose decision would now differ from the one
+recorded.
+
+Use it after changing the config to see which past commands it affects:
+
+  mmi replay
+
+Unlike "mmi diff", which compares two config files over a corpus of
+commands, replay compares the current config with the decisions actually
+made, one line per entry.`,
+	Args: cobra.NoArgs,
+	RunE: runReplay,
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	entries, err := readAuditLog()
+	if err != nil {
+		return err
+	}
+
+	replayed := 0
+	var summary changeSummary
+	for _, e := range entries {
+		if !isBashEntry(e) {
+			continue
+		}
+		replayed++
+		cfg := config.ForDir(e.Cwd)
+		after := resultDecision(hook.EvaluateCommandInDir(e.Command, e.Cwd, cfg))
+		before := recordedDecision(e)
+		if before == after || before == "" && after != hook.DecisionAllow {
+			continue
+		}
+		if before == "" {
+			before = "rejected"
+		}
+		line := summary.add(decisionChange{Command: e.Command, Old: before, New: after})
+		fmt.Printf("%s  %s\n", e.Timestamp, line)
+	}
+
+	changed := summary.allowed + summary.denied + summary.other
+	if changed == 0 {
+		fmt.Printf("No decision changes across %d entries.\n", replayed)
+		return nil
+	}
+	fmt.Printf("\n%d of %d entries changed: %s\n", changed, replayed, summary)
+	return nil
+}
+
+// isBashEntry reports whether e records a Bash command. Entries for other
+// tools hold a file path or URL instead, and entries without a command have
+// nothing to replay.
+func isBashEntry(e audit.Entry) bool {
+	if e.Command == "" {
+		return false
+	}
+	var input hook.Input
+	if e.Input != "" && json.Unmarshal([]byte(e.Input), &input) == nil && input.ToolName != "" && input.ToolName != hook.ToolNameBash {
+		return false
+	}
+	return true
+}
+
+// recordedDecision returns the decision an entry records, like
+// resultDecision. A rejected entry without output was either passed through
+// or written before outputs were logged, so its decision is unknown and ""
+// is returned; it only counts as changed if the command is now allowed.
+func recordedDecision(e audit.Entry) string {
+	if e.Approved {
+		return hook.DecisionAllow
+	}
+	return outputDecision(e.Output)
+}
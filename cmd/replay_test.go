@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/dgerlanc/mmi/internal/testutil"
+	"github.com/spf13/cobra"
+)
+
+func TestRunReplay(t *testing.T) {
+	setupAuditLog(t,
+		audit.Entry{Version: 1, Command: "ls -la", Approved: true, Output: hook.FormatApproval("read-only")},
+		audit.Entry{Version: 1, Command: "cat README.md", Approved: true, Output: hook.FormatApproval("read-only")},
+		audit.Entry{Version: 1, Command: "echo hello", Output: hook.FormatAsk("command not in allow list")},
+		audit.Entry{Version: 1, Command: "kill 1234", Output: hook.FormatAsk("command not in allow list")},
+		audit.Entry{Version: 1, Command: "make", Output: ""},
+		audit.Entry{Version: 1, Command: "ls secrets", Input: `{"tool_name":"Read","tool_input":{"file_path":"ls secrets"}}`},
+	)
+	cleanup := testutil.SetupTestConfig(t, `
+[[deny.simple]]
+name = "kill"
+commands = ["kill"]
+
+[[commands.simple]]
+name = "read-only"
+commands = ["cat", "echo"]
+`)
+	defer cleanup()
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runReplay(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runReplay() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"  newly denied: ls -la (now ask)",
+		"  newly allowed: echo hello (was ask)",
+		"  changed: kill 1234 (ask -> deny)",
+		"3 of 5 entries changed: 1 newly allowed, 1 newly denied, 1 other",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+	// Unchanged decisions, rejections with an unknown decision that are
+	// still rejected, and other tools' entries aren't reported
+	for _, unwanted := range []string{"cat README.md", "make", "ls secrets"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %q:\n%s", unwanted, output)
+		}
+	}
+}
+
+func TestRunReplayNoChanges(t *testing.T) {
+	setupAuditLog(t,
+		audit.Entry{Version: 1, Command: "ls", Approved: true, Output: hook.FormatApproval("ls")},
+	)
+	cleanup := testutil.SetupTestConfig(t, `
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`)
+	defer cleanup()
+
+	output := captureStdout(t, func() {
+		if err := runReplay(&cobra.Command{}, nil); err != nil {
+			t.Errorf("runReplay() error = %v", err)
+		}
+	})
+	if !strings.Contains(output, "No decision changes across 1 entries.") {
+		t.Errorf("output = %q, want no changes", output)
+	}
+}
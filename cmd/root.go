@@ -2,17 +2,30 @@
 package cmd
 
 import (
+	"errors"
+	"os"
+	"strconv"
+
 	"github.com/dgerlanc/mmi/internal/audit"
 	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/constants"
 	"github.com/dgerlanc/mmi/internal/logger"
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Global flags
-	verbose    bool
-	dryRun     bool
-	noAuditLog bool
+	verbose       bool
+	dryRun        bool
+	dryRunFormat  string
+	noAuditLog    bool
+	auditPath     string
+	passthrough   bool
+	configFile    string
+	noDefaultDeny bool
+	hookSocket    string
+	timeoutMs     int
+	outputFile    string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -33,7 +46,8 @@ Usage in ~/.claude/settings.json:
     }]
   }`,
 	// Run the hook by default when no subcommand is given
-	Run: runHook,
+	PreRunE: validateHookFlags,
+	Run:     runHook,
 	// Silence usage on errors
 	SilenceUsage: true,
 }
@@ -50,7 +64,33 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output (debug logging)")
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Test command approval without JSON output")
+	rootCmd.PersistentFlags().StringVar(&dryRunFormat, "dry-run-format", "text", "Dry-run output format: text or json")
 	rootCmd.PersistentFlags().BoolVar(&noAuditLog, "no-audit-log", false, "Disable audit logging")
+	rootCmd.PersistentFlags().StringVar(&auditPath, "audit-path", "", "Write the audit log to this file instead of the configured location")
+	rootCmd.MarkFlagsMutuallyExclusive("audit-path", "no-audit-log")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Load this config file instead of config.toml in the config directory")
+	rootCmd.PersistentFlags().BoolVar(&noDefaultDeny, "no-default-deny", false, "Use the built-in default config when the config file doesn't exist, instead of asking about every command (or set MMI_NO_DEFAULT_DENY=1)")
+	rootCmd.PersistentFlags().BoolVar(&passthrough, "passthrough", false, "Emit nothing instead of asking, leaving unmatched commands to Claude Code (or set MMI_PASSTHROUGH=1)")
+
+	// Hook-only flags
+	rootCmd.Flags().StringVar(&hookSocket, "socket", "", "Forward the hook request to an mmi serve process listening on this Unix socket")
+	rootCmd.Flags().IntVar(&timeoutMs, "timeout-ms", 500, "Ask instead of deciding if the hook takes longer than this many milliseconds (0 disables)")
+	rootCmd.Flags().StringVar(&outputFile, "output-file", "", "With --dry-run, write the exact hook JSON output to this file instead of a summary")
+	// A forwarded request is evaluated with the server's config and audit
+	// settings, so flags that would change them can't be combined with --socket
+	for _, flag := range []string{"config", "no-default-deny", "audit-path", "no-audit-log", "dry-run"} {
+		rootCmd.MarkFlagsMutuallyExclusive("socket", flag)
+	}
+}
+
+// validateHookFlags rejects hook flags that only make sense together.
+// --output-file replaces the dry-run summary, while a hook's decision must
+// go to stdout for Claude Code to read it.
+func validateHookFlags(cmd *cobra.Command, args []string) error {
+	if outputFile != "" && !dryRun {
+		return errors.New("--output-file requires --dry-run")
+	}
+	return nil
 }
 
 // initApp initializes the application (logger, config, audit)
@@ -58,11 +98,48 @@ func initApp() {
 	// Initialize logger
 	logger.Init(logger.Options{Verbose: verbose})
 
-	// Initialize config (uses embedded defaults if no config file exists)
+	// Initialize config. --config names the exact file to load and takes
+	// precedence over MMI_CONFIG, which otherwise sets the directory holding
+	// config.toml (~/.config/mmi by default); MMI_CONFIG_EXTRA directories
+	// are layered on either way. A missing config file asks about every
+	// command unless --no-default-deny opts into the embedded defaults
+	config.SetConfigFile(configFile)
+	config.SetDefaultsWhenMissing(IsNoDefaultDeny())
+
+	// A hook forwarding to mmi serve uses the server's config, and only
+	// loads its own if the server can't be reached
+	if hookSocket != "" {
+		return
+	}
+	initConfig()
+}
+
+// initConfig loads the config and opens the audit log it names
+func initConfig() {
 	config.Init()
 
 	// Initialize audit logging (unless disabled)
-	audit.Init("", noAuditLog)
+	audit.InitOutput(auditOutput(), noAuditLog)
+
+	// Delete rotated backups older than [audit] max_age
+	if maxAge := config.Get().Audit.MaxAge; maxAge > 0 && !noAuditLog {
+		if path, err := auditLogPath(); err == nil {
+			audit.RemoveExpiredBackups(path, maxAge)
+		}
+	}
+}
+
+// auditOutput returns where audit entries are written: the --audit-path flag
+// if set, then the MMI_AUDIT_OUTPUT environment variable, otherwise [audit]
+// output from the config
+func auditOutput() string {
+	if auditPath != "" {
+		return auditPath
+	}
+	if output := os.Getenv(constants.EnvAuditOutput); output != "" {
+		return output
+	}
+	return config.Get().Audit.Output
 }
 
 // IsVerbose returns whether verbose mode is enabled
@@ -74,3 +151,24 @@ func IsVerbose() bool {
 func IsDryRun() bool {
 	return dryRun
 }
+
+// IsNoDefaultDeny returns whether a missing config file falls back to the
+// embedded defaults, enabled by flag or by the MMI_NO_DEFAULT_DENY
+// environment variable
+func IsNoDefaultDeny() bool {
+	if noDefaultDeny {
+		return true
+	}
+	enabled, err := strconv.ParseBool(os.Getenv(constants.EnvNoDefaultDeny))
+	return err == nil && enabled
+}
+
+// IsPassthrough returns whether passthrough mode is enabled by flag or by
+// the MMI_PASSTHROUGH environment variable
+func IsPassthrough() bool {
+	if passthrough {
+		return true
+	}
+	enabled, err := strconv.ParseBool(os.Getenv(constants.EnvPassthrough))
+	return err == nil && enabled
+}
@@ -2,10 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dgerlanc/mmi/internal/audit"
 	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/constants"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/dgerlanc/mmi/internal/testutil"
 	"github.com/spf13/cobra"
 )
 
@@ -13,9 +21,72 @@ import (
 func resetGlobalState() {
 	verbose = false
 	dryRun = false
+	dryRunFormat = "text"
 	noAuditLog = false
+	auditPath = ""
+	passthrough = false
+	configFile = ""
+	noDefaultDeny = false
+	hookSocket = ""
+	timeoutMs = 500
+	outputFile = ""
+	serveSocketPath = ""
+	serveWatchInterval = time.Second
+	config.SetConfigFile("")
+	config.SetDefaultsWhenMissing(false)
 	initClaudeSettings = ""
+	initPreset = ""
+	initProject = false
+	validateFile = ""
+	validateStdin = false
+	validateFormat = "text"
+	testFile = ""
+	querySession = ""
+	queryApproved = false
+	queryRejected = false
+	querySince = ""
+	queryCommandContains = ""
+	queryLimit = 50
+	statsJSON = false
+	statsTop = 10
+	tailFollow = false
+	tailLines = 20
+	purgeYes = false
+	purgeKeepDays = 0
+	addDeny = false
+	listJSON = false
+	learnTop = 10
+	learnApply = false
 	config.Reset()
+	// Tests that execute rootCmd leave its flags marked as set
+	rootCmd.SetArgs(nil)
+	for _, name := range []string{"audit-path", "no-audit-log", "config", "no-default-deny", "dry-run"} {
+		rootCmd.PersistentFlags().Lookup(name).Changed = false
+	}
+	for _, name := range []string{"socket", "output-file"} {
+		rootCmd.Flags().Lookup(name).Changed = false
+	}
+}
+
+// captureStdout runs fn and returns everything it wrote to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	oldStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = oldStdout
+
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	return buf.String()
 }
 
 func TestIsVerbose(t *testing.T) {
@@ -178,7 +249,7 @@ func TestRootCmdFlags(t *testing.T) {
 }
 
 func TestRootCmdHasExpectedSubcommands(t *testing.T) {
-	expectedCommands := []string{"init", "validate", "completion"}
+	expectedCommands := []string{"init", "validate", "completion", "test", "explain", "audit", "add", "list", "learn", "version"}
 
 	for _, cmdName := range expectedCommands {
 		found := false
@@ -205,3 +276,174 @@ func TestRootCmdUsageContainsDescription(t *testing.T) {
 		t.Errorf("rootCmd.Use = %q, want 'mmi'", rootCmd.Use)
 	}
 }
+
+func TestAuditOutputEnvOverridesConfig(t *testing.T) {
+	resetGlobalState()
+	cleanup := testutil.SetupTestConfig(t, `
+[audit]
+output = "/tmp/from-config.log"
+`)
+	defer cleanup()
+
+	if got := auditOutput(); got != "/tmp/from-config.log" {
+		t.Errorf("auditOutput() = %q, want the config value", got)
+	}
+	t.Setenv(constants.EnvAuditOutput, "stderr")
+	if got := auditOutput(); got != "stderr" {
+		t.Errorf("auditOutput() = %q, want the environment value", got)
+	}
+}
+
+func TestInitAppUsesProfileAuditOutput(t *testing.T) {
+	resetGlobalState()
+	t.Cleanup(func() {
+		audit.Reset()
+		resetGlobalState()
+	})
+
+	configDir := t.TempDir()
+	t.Setenv("MMI_CONFIG", configDir)
+	logPath := filepath.Join(t.TempDir(), "ci-audit.log")
+	if err := os.MkdirAll(filepath.Join(configDir, config.ProfilesDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	profile := fmt.Sprintf(`
+[audit]
+output = %q
+
+[[commands.simple]]
+name = "echo"
+commands = ["echo"]
+`, logPath)
+	if err := os.WriteFile(filepath.Join(configDir, config.ProfilesDir, "ci.toml"), []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "config.toml"), []byte(`extends = "ci"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	initApp()
+	runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"echo hi"}}`)
+	audit.Close()
+
+	entries, err := audit.ReadEntries(logPath)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Command != "echo hi" || entries[0].Profile != "ci" {
+		t.Fatalf("entries = %+v, want one echo hi entry for profile ci", entries)
+	}
+
+	// --no-audit-log still wins over the profile's output
+	if err := os.Remove(logPath); err != nil {
+		t.Fatal(err)
+	}
+	config.Reset()
+	noAuditLog = true
+	initApp()
+	runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"echo hi"}}`)
+	audit.Close()
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("audit log written despite --no-audit-log, stat error = %v", err)
+	}
+}
+
+func TestAuditPathFlagOverridesEnvAndConfig(t *testing.T) {
+	resetGlobalState()
+	t.Cleanup(func() {
+		audit.Reset()
+		resetGlobalState()
+	})
+
+	configDir := t.TempDir()
+	t.Setenv("MMI_CONFIG", configDir)
+	t.Setenv(constants.EnvAuditOutput, filepath.Join(t.TempDir(), "env.log"))
+	configLog := filepath.Join(t.TempDir(), "config.log")
+	content := fmt.Sprintf(`
+[audit]
+output = %q
+
+[[commands.simple]]
+name = "echo"
+commands = ["echo"]
+`, configLog)
+	if err := os.WriteFile(filepath.Join(configDir, "config.toml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	flagLog := filepath.Join(t.TempDir(), "logs", "flag.log")
+	rootCmd.SetArgs([]string{"--audit-path", flagLog, "version"})
+	captureStdout(t, func() {
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	})
+	runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"echo hi"}}`)
+	audit.Close()
+
+	entries, err := audit.ReadEntries(flagLog)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Command != "echo hi" {
+		t.Fatalf("entries = %+v, want an echo hi entry", entries)
+	}
+	if _, err := os.Stat(configLog); !os.IsNotExist(err) {
+		t.Errorf("config audit log written despite --audit-path, stat error = %v", err)
+	}
+	if got, err := auditLogPath(); err != nil || got != flagLog {
+		t.Errorf("auditLogPath() = %q, %v, want %q", got, err, flagLog)
+	}
+}
+
+func TestAuditPathExcludesNoAuditLog(t *testing.T) {
+	resetGlobalState()
+	t.Cleanup(resetGlobalState)
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	rootCmd.SetArgs([]string{"--audit-path", filepath.Join(t.TempDir(), "a.log"), "--no-audit-log", "version"})
+	rootCmd.SetErr(&bytes.Buffer{})
+	defer rootCmd.SetErr(nil)
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "none of the others can be") {
+		t.Errorf("Execute() error = %v, want a mutually exclusive flags error", err)
+	}
+}
+
+func TestNoDefaultDenyWithMissingConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    string
+		wantOK bool
+	}{
+		{"default asks", nil, "", false},
+		{"flag uses embedded defaults", []string{"--no-default-deny"}, "", true},
+		{"env uses embedded defaults", nil, "1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobalState()
+			t.Cleanup(resetGlobalState)
+			t.Setenv(constants.EnvConfigDir, t.TempDir())
+			t.Setenv(constants.EnvNoDefaultDeny, tt.env)
+
+			oldStdin := os.Stdin
+			stdinR, stdinW, _ := os.Pipe()
+			stdinW.WriteString(`{"tool_name":"Bash","tool_input":{"command":"ls"}}`)
+			stdinW.Close()
+			os.Stdin = stdinR
+			defer func() { os.Stdin = oldStdin }()
+
+			rootCmd.SetArgs(append([]string{"--no-audit-log"}, tt.args...))
+			output := captureStdout(t, func() {
+				if err := rootCmd.Execute(); err != nil {
+					t.Errorf("Execute() error = %v", err)
+				}
+			})
+			if got := outputDecision(output) == hook.DecisionAllow; got != tt.wantOK {
+				t.Errorf("ls approved = %v, want %v (output: %s)", got, tt.wantOK, output)
+			}
+		})
+	}
+}
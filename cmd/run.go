@@ -1,32 +1,166 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/constants"
 	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/dgerlanc/mmi/internal/logger"
 	"github.com/spf13/cobra"
 )
 
+// Dry-run output formats
+const (
+	dryRunFormatText = "text"
+	dryRunFormatJSON = "json"
+)
+
+// dryRunResult is the JSON form of a dry-run decision
+type dryRunResult struct {
+	Command     string          `json:"command"`
+	Approved    bool            `json:"approved"`
+	Reason      string          `json:"reason,omitempty"`
+	Passthrough bool            `json:"passthrough,omitempty"`
+	DenyMatch   bool            `json:"deny_match,omitempty"`
+	Segments    []audit.Segment `json:"segments"`
+}
+
 // runHook is the default command that processes stdin for command approval
 func runHook(cmd *cobra.Command, args []string) {
+	input := io.Reader(os.Stdin)
+	if hookSocket != "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			logger.Debug("failed to read stdin", "error", err)
+		}
+		timeout := time.Duration(timeoutMs) * time.Millisecond
+		output, sent, err := forwardToSocket(hookSocket, bytes.NewReader(data), timeout)
+		if err == nil {
+			emitDecision(output)
+			return
+		}
+		if timeout > 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+			logger.Warn("mmi serve timed out", "socket", hookSocket, "timeout", timeout)
+			emitDecision(hook.TimedOut(timeout).Output)
+			return
+		}
+		if sent {
+			// The server may have logged the request, so evaluating it
+			// again could record it twice
+			logger.Warn("mmi serve did not respond", "socket", hookSocket, "error", err)
+			emitDecision(hook.FormatAsk("mmi serve did not respond"))
+			return
+		}
+		logger.Debug("failed to reach mmi serve, evaluating locally", "socket", hookSocket, "error", err)
+		initConfig()
+		input = bytes.NewReader(data)
+	}
+
 	// Process the command
-	result := hook.ProcessWithResult(os.Stdin)
+	result := hook.ProcessWithTimeout(input, time.Duration(timeoutMs)*time.Millisecond)
+
+	if dryRun && dryRunFormat != dryRunFormatText && dryRunFormat != dryRunFormatJSON {
+		fmt.Fprintf(os.Stderr, "invalid --dry-run-format %q (want %s or %s)\n", dryRunFormat, dryRunFormatText, dryRunFormatJSON)
+		return
+	}
+
+	if dryRun && outputFile != "" {
+		// Write the exact hook output for snapshot tests instead of a summary
+		if err := os.WriteFile(outputFile, []byte(passthroughOutput(result.Output)), constants.FileMode); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write output file: %v\n", err)
+		}
+		return
+	}
+
+	if dryRun && dryRunFormat == dryRunFormatJSON {
+		// Emit the full decision as a single JSON object on stdout
+		out := dryRunResult{
+			Command:     result.Command,
+			Approved:    result.Approved,
+			Reason:      result.Reason,
+			Passthrough: result.Passthrough,
+			DenyMatch:   result.DenyMatch,
+			Segments:    result.Segments,
+		}
+		if out.Segments == nil {
+			out.Segments = []audit.Segment{}
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode result: %v\n", err)
+		}
+		return
+	}
 
 	if dryRun {
 		// In dry-run mode, output to stderr instead of JSON to stdout
 		if result.Approved {
 			fmt.Fprintf(os.Stderr, "APPROVED: %s (reason: %s)\n", result.Command, result.Reason)
+		} else if result.DenyMatch {
+			fmt.Fprintf(os.Stderr, "REJECTED: %s (reason: %s)\n", result.Command, result.Reason)
 		} else if result.Passthrough {
 			fmt.Fprintf(os.Stderr, "PASSTHROUGH: %s\n", result.Command)
-		} else if result.Command != "" {
+		} else if strings.TrimSpace(result.Command) != "" {
 			fmt.Fprintf(os.Stderr, "REJECTED: %s\n", result.Command)
+		} else if result.Reason != "" {
+			fmt.Fprintf(os.Stderr, "REJECTED: (%s)\n", result.Reason)
 		} else {
 			fmt.Fprintf(os.Stderr, "REJECTED: (no command parsed)\n")
 		}
 		return
 	}
 
-	// Normal mode: output JSON decision to stdout
-	fmt.Print(result.Output)
+	defer writeMetrics(result)
+	emitDecision(result.Output)
+}
+
+// emitDecision prints the hook JSON output to stdout. Deny matches always
+// produce an explicit deny decision; passthrough produces no output at all.
+func emitDecision(output string) {
+	fmt.Print(passthroughOutput(output))
+}
+
+// passthroughOutput returns the hook output to emit for output. In
+// passthrough mode, ask decisions are dropped so Claude Code's own permission
+// rules decide; allow and deny are still emitted.
+func passthroughOutput(output string) string {
+	if IsPassthrough() && outputDecision(output) == hook.DecisionAsk {
+		return ""
+	}
+	return output
+}
+
+// writeMetrics adds the decision emitted for result to the [metrics] file.
+// Failures are logged and don't affect the decision.
+func writeMetrics(result hook.Result) {
+	path := config.Get().Metrics.File
+	if path == "" {
+		return
+	}
+	entry := audit.Entry{
+		Approved: result.Approved,
+		Output:   passthroughOutput(result.Output),
+		Segments: result.Segments,
+	}
+	if err := audit.UpdateMetrics(path, entry); err != nil {
+		logger.Debug("failed to write metrics", "path", path, "error", err)
+	}
+}
+
+// outputDecision returns the permission decision of a hook JSON output, or ""
+// if output is empty or not a hook decision.
+func outputDecision(output string) string {
+	var out hook.Output
+	if err := json.Unmarshal([]byte(output), &out); err != nil {
+		return ""
+	}
+	return out.HookSpecificOutput.PermissionDecision
 }
@@ -2,11 +2,17 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/constants"
+	"github.com/dgerlanc/mmi/internal/hook"
 	"github.com/dgerlanc/mmi/internal/testutil"
 	"github.com/spf13/cobra"
 )
@@ -120,7 +126,7 @@ func TestRunHookDryRunEmptyCommand(t *testing.T) {
 	defer func() { dryRun = false }()
 
 	// Create input JSON with empty command
-	// Empty commands are approved (they're trivially safe - nothing to execute)
+	// Empty commands get an explicit ask decision by default
 	input := `{"tool_name":"Bash","tool_input":{"command":""}}`
 
 	// Capture stderr
@@ -146,9 +152,8 @@ func TestRunHookDryRunEmptyCommand(t *testing.T) {
 	io.Copy(&buf, stderrR)
 	output := buf.String()
 
-	// Empty commands are approved (considered safe as there's nothing to execute)
-	if !strings.Contains(output, "APPROVED") {
-		t.Errorf("expected 'APPROVED' in output for empty command, got: %s", output)
+	if !strings.Contains(output, "REJECTED: (empty command)") {
+		t.Errorf("expected 'REJECTED: (empty command)' in output for empty command, got: %s", output)
 	}
 }
 
@@ -405,3 +410,282 @@ func TestRunHookNonBashTool(t *testing.T) {
 		t.Errorf("expected 'REJECTED' for non-Bash tool, got: %s", output)
 	}
 }
+
+// runHookWithInput runs the hook with the given stdin and returns what it wrote to stdout
+func runHookWithInput(t *testing.T, input string) string {
+	t.Helper()
+
+	oldStdin := os.Stdin
+	stdinR, stdinW, _ := os.Pipe()
+	stdinW.WriteString(input)
+	stdinW.Close()
+	os.Stdin = stdinR
+	defer func() { os.Stdin = oldStdin }()
+
+	return captureStdout(t, func() {
+		runHook(&cobra.Command{}, []string{})
+	})
+}
+
+func TestRunHookNormalModeDenyMatchEmitsDeny(t *testing.T) {
+	resetGlobalState()
+
+	cleanup := testutil.SetupTestConfig(t, `
+[defaults]
+unmatched = "passthrough"
+
+[[deny.regex]]
+pattern = 'rm\s+(-[rRfF]+\s+)*/'
+name = "rm root"
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+`)
+	defer func() { cleanup(); resetGlobalState() }()
+
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"rm -rf /"}}`)
+	if !strings.Contains(output, `"permissionDecision":"deny"`) {
+		t.Errorf("expected deny decision for deny-list match, got: %s", output)
+	}
+	if !strings.Contains(output, "rm root") {
+		t.Errorf("expected deny pattern name in reason, got: %s", output)
+	}
+
+	output = runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"curl http://x"}}`)
+	if output != "" {
+		t.Errorf("expected no output for unmatched command, got: %s", output)
+	}
+}
+
+func TestRunHookDryRunJSON(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	dryRun = true
+	dryRunFormat = dryRunFormatJSON
+
+	tests := []struct {
+		name         string
+		command      string
+		wantApproved bool
+		wantMatch    string
+		wantCode     string
+	}{
+		{"approved", "ls -la", true, "safe", ""},
+		{"rejected", "rm -rf /tmp/x", false, "", audit.CodeDenyMatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"`+tt.command+`"}}`)
+
+			var got dryRunResult
+			if err := json.Unmarshal([]byte(output), &got); err != nil {
+				t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+			}
+			if got.Command != tt.command {
+				t.Errorf("command = %q, want %q", got.Command, tt.command)
+			}
+			if got.Approved != tt.wantApproved {
+				t.Errorf("approved = %v, want %v", got.Approved, tt.wantApproved)
+			}
+			if len(got.Segments) != 1 {
+				t.Fatalf("len(segments) = %d, want 1", len(got.Segments))
+			}
+			seg := got.Segments[0]
+			if tt.wantMatch != "" && (seg.Match == nil || seg.Match.Name != tt.wantMatch) {
+				t.Errorf("segment match = %+v, want name %q", seg.Match, tt.wantMatch)
+			}
+			if tt.wantCode != "" {
+				if seg.Rejection == nil || seg.Rejection.Code != tt.wantCode {
+					t.Errorf("segment rejection = %+v, want code %q", seg.Rejection, tt.wantCode)
+				}
+				if !got.DenyMatch || got.Reason == "" {
+					t.Errorf("deny_match = %v, reason = %q, want deny match with reason", got.DenyMatch, got.Reason)
+				}
+			}
+		})
+	}
+}
+
+func TestRunHookPassthroughMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string // expected decision, or "" for no output
+	}{
+		{"approved", "ls -la", `"permissionDecision":"allow"`},
+		{"deny match", "rm -rf /tmp/x", `"permissionDecision":"deny"`},
+		{"no match", "curl http://x", ""},
+		{"unparseable", "echo 'unclosed", ""},
+	}
+
+	enable := map[string]func(t *testing.T){
+		"flag": func(t *testing.T) { passthrough = true },
+		"env":  func(t *testing.T) { t.Setenv(constants.EnvPassthrough, "1") },
+	}
+
+	for mode, setup := range enable {
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				cleanup := setupTestConfig(t)
+				defer cleanup()
+				setup(t)
+
+				output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"`+tt.command+`"}}`)
+				if tt.want == "" {
+					if output != "" {
+						t.Errorf("expected no output, got: %s", output)
+					}
+					return
+				}
+				if !strings.Contains(output, tt.want) {
+					t.Errorf("expected %s, got: %s", tt.want, output)
+				}
+			})
+		}
+	}
+}
+
+func TestRunHookAskWithoutPassthrough(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+	t.Setenv(constants.EnvPassthrough, "false")
+
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"curl http://x"}}`)
+	if !strings.Contains(output, `"permissionDecision":"ask"`) {
+		t.Errorf("expected ask decision when passthrough is off, got: %s", output)
+	}
+}
+
+func TestRunHookConfigFlag(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	// The config directory only allows ls
+	cleanup := testutil.SetupTestConfig(t, testutil.MinimalTestConfig)
+	defer cleanup()
+
+	configPath := filepath.Join(t.TempDir(), "one-off.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[[commands.simple]]
+name = "build"
+commands = ["make"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configFile = configPath
+	noAuditLog = true
+	config.Reset()
+	initApp()
+
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"make test"}}`)
+	if !strings.Contains(output, `"permissionDecision":"allow"`) {
+		t.Errorf("make should be approved by the --config file, got %s", output)
+	}
+	if got := config.GetConfigPath(); got != configPath {
+		t.Errorf("GetConfigPath() = %q, want %q", got, configPath)
+	}
+
+	output = runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"ls"}}`)
+	if strings.Contains(output, `"permissionDecision":"allow"`) {
+		t.Errorf("ls from the config directory should not be active, got %s", output)
+	}
+}
+
+func TestRunHookWritesMetrics(t *testing.T) {
+	resetGlobalState()
+
+	tmpDir := t.TempDir()
+	metricsPath := filepath.Join(tmpDir, "mmi.prom")
+	cleanup := testutil.SetupTestConfig(t, `
+[metrics]
+file = "`+metricsPath+`"
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+`)
+	defer func() { cleanup(); resetGlobalState() }()
+
+	// The counters are kept in the metrics file, not rebuilt from the audit log
+	audit.Reset()
+	defer audit.Reset()
+
+	runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"ls"}}`)
+	runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"curl http://x"}}`)
+	runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"ls"}}`)
+
+	data, err := os.ReadFile(metricsPath)
+	if err != nil {
+		t.Fatalf("metrics file was not written: %v", err)
+	}
+	for _, want := range []string{
+		`mmi_decisions_total{decision="allow"} 2`,
+		`mmi_decisions_total{decision="ask"} 1`,
+		`mmi_rejections_total{code="NO_MATCH"} 1`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics file missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestRunHookOutputFile(t *testing.T) {
+	resetGlobalState()
+
+	cleanup := testutil.SetupTestConfig(t, `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`)
+	defer func() { cleanup(); resetGlobalState() }()
+
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"approved", "ls -la", hook.FormatApproval("read-only")},
+		{"unmatched", "kill 1234", hook.FormatAsk("command not in allow list")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile = filepath.Join(t.TempDir(), "output.json")
+			dryRun = true
+			defer func() { outputFile = ""; dryRun = false }()
+
+			stdout := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"`+tt.command+`"}}`)
+			if stdout != "" {
+				t.Errorf("stdout = %q, want nothing when --output-file is set", stdout)
+			}
+			data, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("failed to read output file: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("output file = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunHookOutputFileRequiresDryRun(t *testing.T) {
+	t.Cleanup(resetGlobalState)
+	resetGlobalState()
+	t.Cleanup(testutil.SetupTestConfig(t, ""))
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+	rootCmd.SetArgs([]string{"--no-audit-log", "--output-file", outputFile})
+	rootCmd.SetErr(&bytes.Buffer{})
+	defer rootCmd.SetErr(nil)
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--output-file requires --dry-run") {
+		t.Errorf("Execute() error = %v, want --output-file rejected without --dry-run", err)
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Errorf("output file should not be written without --dry-run, stat error = %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/dgerlanc/mmi/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// serveRequestTimeout bounds how long the server waits on one client, so a
+// stalled client can't hold a connection, or a reload waiting for it, forever.
+const serveRequestTimeout = 10 * time.Second
+
+var serveSocketPath string
+var serveWatchInterval time.Duration
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve hook requests over a Unix socket",
+	Long: `Serve loads the config once and answers hook requests over a Unix domain
+socket, avoiding the process startup and config compilation cost of running
+mmi for every command.
+
+Each connection carries one request: the same JSON payload the hook reads
+from stdin, followed by the client closing its write side. The response is
+the JSON decision the hook would print. Each connection is handled on its
+own, so a slow client doesn't hold up the others, and requests are recorded
+in the audit log as usual.
+
+Point the hook at the server with --socket:
+
+  mmi serve --socket /tmp/mmi.sock &
+  mmi --socket /tmp/mmi.sock < request.json
+
+If the server can't be reached, the hook evaluates the request itself. Once
+the request has been sent, the server may already have logged it, so if no
+response arrives the hook asks instead of evaluating it again.
+Forwarded requests use the server's config and audit settings, so --socket
+can't be combined with --config, --audit-path, --no-audit-log, or --dry-run.
+The socket is only accessible to the user running the server.
+
+The server checks the config file, its includes and profiles, and the
+environment variables they reference for changes every --watch-interval, and
+reloads the config when one changes. Send SIGHUP to reload it immediately. If
+the new config fails to load, the server logs the error and keeps using the
+current config.`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveSocketPath, "socket", "", "Path of the Unix socket to listen on (required)")
+	serveCmd.MarkFlagRequired("socket")
+	serveCmd.Flags().DurationVar(&serveWatchInterval, "watch-interval", time.Second, "How often to check the config for changes (0 disables)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	listener, err := listenSocket(serveSocketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(serveSocketPath)
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	var watch <-chan time.Time
+	if serveWatchInterval > 0 {
+		ticker := time.NewTicker(serveWatchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+
+	fmt.Fprintf(os.Stderr, "mmi: serving on %s\n", serveSocketPath)
+	return serveSocket(ctx, listener, reload, watch)
+}
+
+// listenSocket listens on the Unix socket at path, replacing a stale socket
+// file left by a server that is no longer running. The socket is only
+// accessible to its owner.
+func listenSocket(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another server is already listening on %s", path)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	// Only the owner may send requests, which are logged as their own
+	listener, err := listenUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %w", err)
+	}
+	return listener, nil
+}
+
+// serveSocket answers requests on listener until ctx is done, reloading the
+// config whenever reload receives, and whenever watch receives and the config
+// changed. Each request is handled in its own goroutine. A reload waits for
+// the requests in progress and holds off new ones, so it never races with an
+// evaluation. Requests in progress are finished before returning.
+func serveSocket(ctx context.Context, listener net.Listener, reload <-chan os.Signal, watch <-chan time.Time) error {
+	conns := make(chan net.Conn)
+	acceptErr := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				acceptErr <- err
+				return
+			}
+			conns <- conn
+		}
+	}()
+	defer listener.Close()
+
+	var configLock sync.RWMutex
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+	reloadLocked := func() {
+		configLock.Lock()
+		defer configLock.Unlock()
+		reloadConfig()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-reload:
+			reloadLocked()
+		case <-watch:
+			if config.Stale() {
+				reloadLocked()
+			}
+		case conn := <-conns:
+			inFlight.Add(1)
+			configLock.RLock()
+			go func() {
+				defer inFlight.Done()
+				defer configLock.RUnlock()
+				handleServeConn(conn)
+			}()
+		case err := <-acceptErr:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+	}
+}
+
+// handleServeConn evaluates the hook request on conn and writes back the
+// decision. Failures are logged and close the connection without one.
+func handleServeConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(serveRequestTimeout))
+
+	input, err := io.ReadAll(conn)
+	if err != nil {
+		logger.Debug("failed to read request", "error", err)
+		return
+	}
+	result := hook.ProcessWithResult(bytes.NewReader(input))
+	if _, err := io.WriteString(conn, result.Output); err != nil {
+		logger.Debug("failed to write response", "error", err)
+	}
+	writeMetrics(result)
+}
+
+// reloadConfig reloads the config file and reopens the audit log, which the
+// new config may have moved. A config that fails to load is reported and the
+// current one kept.
+func reloadConfig() {
+	if err := config.Reload(); err != nil {
+		fmt.Fprintf(os.Stderr, "mmi: config reload failed, keeping the current config: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "mmi: config reloaded from %s\n", config.GetConfigPath())
+	audit.InitOutput(auditOutput(), noAuditLog)
+}
+
+// forwardToSocket sends the hook request read from input to the server at
+// path and returns its response. The whole exchange must finish within
+// timeout, or serveRequestTimeout if timeout is 0; an exchange that runs
+// over fails with os.ErrDeadlineExceeded. sent reports whether the whole
+// request reached the server, which may then have evaluated and logged it
+// even if the exchange failed.
+func forwardToSocket(path string, input io.Reader, timeout time.Duration) (output string, sent bool, err error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return "", false, err
+	}
+	defer conn.Close()
+	if timeout <= 0 {
+		timeout = serveRequestTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := io.Copy(conn, input); err != nil {
+		return "", false, err
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return "", false, errors.New("not a Unix socket connection")
+	}
+	if err := unixConn.CloseWrite(); err != nil {
+		return "", false, err
+	}
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		return "", true, err
+	}
+	return string(response), true, nil
+}
@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/constants"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/dgerlanc/mmi/internal/testutil"
+)
+
+// startTestServer serves hook requests on a socket in a temp dir until the
+// test ends, and returns the socket path and the server's reload and watch
+// channels.
+func startTestServer(t *testing.T) (string, chan<- os.Signal, chan<- time.Time) {
+	t.Helper()
+
+	// Socket paths are limited to about 100 bytes, which t.TempDir can exceed
+	dir, err := os.MkdirTemp("", "mmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "mmi.sock")
+
+	listener, err := listenSocket(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reload := make(chan os.Signal)
+	watch := make(chan time.Time)
+	done := make(chan error, 1)
+	go func() { done <- serveSocket(ctx, listener, reload, watch) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serveSocket() error = %v", err)
+		}
+	})
+	return path, reload, watch
+}
+
+// forwardDecision sends a Bash hook request for command to the server at path
+// and returns the decision in its response.
+func forwardDecision(t *testing.T, path, command string) string {
+	t.Helper()
+	input := `{"tool_name":"Bash","tool_input":{"command":"` + command + `"}}`
+	output, _, err := forwardToSocket(path, strings.NewReader(input), 0)
+	if err != nil {
+		t.Fatalf("forwardToSocket() error = %v", err)
+	}
+	return outputDecision(output)
+}
+
+func TestServeSocketRoundTrip(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, _ := startTestServer(t)
+
+	if got := forwardDecision(t, path, "ls -la"); got != hook.DecisionAllow {
+		t.Errorf("decision for ls -la = %q, want %q", got, hook.DecisionAllow)
+	}
+	if got := forwardDecision(t, path, "rm -rf /tmp/x"); got != hook.DecisionDeny {
+		t.Errorf("decision for rm -rf /tmp/x = %q, want %q", got, hook.DecisionDeny)
+	}
+}
+
+func TestServeSocketReload(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, reload, _ := startTestServer(t)
+
+	if got := forwardDecision(t, path, "pwd"); got != hook.DecisionAsk {
+		t.Fatalf("decision for pwd before reload = %q, want %q", got, hook.DecisionAsk)
+	}
+
+	writeTestConfig(t, testutil.MinimalTestConfig+`
+[[commands.simple]]
+name = "pwd"
+commands = ["pwd"]
+`)
+	reload <- syscall.SIGHUP
+
+	if got := forwardDecision(t, path, "pwd"); got != hook.DecisionAllow {
+		t.Errorf("decision for pwd after reload = %q, want %q", got, hook.DecisionAllow)
+	}
+}
+
+// writeTestConfig replaces the config file of the test config directory.
+func writeTestConfig(t *testing.T, content string) {
+	t.Helper()
+	configPath := filepath.Join(os.Getenv(constants.EnvConfigDir), constants.ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(content), constants.FileMode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeSocketWatchReloadsChangedConfig(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, watch := startTestServer(t)
+
+	// Nothing changed, so the config is kept
+	watch <- time.Now()
+	if got := forwardDecision(t, path, "ls"); got != hook.DecisionAllow {
+		t.Fatalf("decision for ls before the change = %q, want %q", got, hook.DecisionAllow)
+	}
+
+	writeTestConfig(t, `
+[[commands.simple]]
+name = "pwd"
+commands = ["pwd"]
+`)
+	watch <- time.Now()
+
+	if got := forwardDecision(t, path, "pwd"); got != hook.DecisionAllow {
+		t.Errorf("decision for pwd after the change = %q, want %q", got, hook.DecisionAllow)
+	}
+	if got := forwardDecision(t, path, "ls"); got != hook.DecisionAsk {
+		t.Errorf("decision for ls after the change = %q, want %q", got, hook.DecisionAsk)
+	}
+}
+
+func TestServeSocketWatchKeepsConfigOnLoadFailure(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, watch := startTestServer(t)
+
+	writeTestConfig(t, "[[commands.simple]\nname = ")
+	watch <- time.Now()
+
+	if got := forwardDecision(t, path, "ls"); got != hook.DecisionAllow {
+		t.Errorf("decision for ls after a broken change = %q, want %q from the kept config", got, hook.DecisionAllow)
+	}
+	if got := forwardDecision(t, path, "rm -rf /tmp/x"); got != hook.DecisionDeny {
+		t.Errorf("decision for rm after a broken change = %q, want %q from the kept config", got, hook.DecisionDeny)
+	}
+
+	// Fixing the file is picked up on the next check
+	writeTestConfig(t, testutil.MinimalTestConfig+`
+[[commands.simple]]
+name = "pwd"
+commands = ["pwd"]
+`)
+	watch <- time.Now()
+	if got := forwardDecision(t, path, "pwd"); got != hook.DecisionAllow {
+		t.Errorf("decision for pwd after the fix = %q, want %q", got, hook.DecisionAllow)
+	}
+}
+
+func TestListenSocketAlreadyServing(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, _ := startTestServer(t)
+
+	if _, err := listenSocket(path); err == nil || !strings.Contains(err.Error(), "already listening") {
+		t.Errorf("listenSocket() error = %v, want already listening", err)
+	}
+}
+
+func TestRunHookForwardsToSocket(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, _ := startTestServer(t)
+	hookSocket = path
+
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"ls"}}`)
+	if got := outputDecision(output); got != hook.DecisionAllow {
+		t.Errorf("decision = %q, want %q (output: %s)", got, hook.DecisionAllow, output)
+	}
+}
+
+func TestRunHookSocketUnreachableEvaluatesLocally(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+	config.Reset()
+	hookSocket = filepath.Join(t.TempDir(), "missing.sock")
+
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"rm -rf /tmp/x"}}`)
+	if got := outputDecision(output); got != hook.DecisionDeny {
+		t.Errorf("decision = %q, want %q (output: %s)", got, hook.DecisionDeny, output)
+	}
+}
+
+func TestListenSocketOwnerOnly(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, _ := startTestServer(t)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+}
+
+func TestRunHookSocketRejectsLocalFlags(t *testing.T) {
+	t.Cleanup(resetGlobalState)
+
+	for _, args := range [][]string{
+		{"--config", "other.toml"},
+		{"--no-default-deny"},
+		{"--audit-path", "audit.log"},
+		{"--no-audit-log"},
+		{"--dry-run"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			resetGlobalState()
+			rootCmd.SetArgs(append([]string{"--socket", "/tmp/mmi.sock"}, args...))
+			rootCmd.SetErr(&bytes.Buffer{})
+			defer rootCmd.SetErr(nil)
+			if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "none of the others can be") {
+				t.Errorf("Execute() error = %v, want a mutually exclusive flags error", err)
+			}
+		})
+	}
+}
+
+func TestRunHookSocketPassthrough(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, _ := startTestServer(t)
+	hookSocket = path
+	passthrough = true
+
+	if output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"unknown-cmd"}}`); output != "" {
+		t.Errorf("output = %q, want nothing in passthrough mode", output)
+	}
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"ls"}}`)
+	if got := outputDecision(output); got != hook.DecisionAllow {
+		t.Errorf("decision = %q, want %q (output: %s)", got, hook.DecisionAllow, output)
+	}
+}
+
+func TestRunHookSocketTimeout(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+
+	dir, err := os.MkdirTemp("", "mmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "mmi.sock")
+
+	// A server that accepts the request but never answers
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+			time.Sleep(time.Second)
+		}
+	}()
+
+	hookSocket = path
+	timeoutMs = 50
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"ls"}}`)
+	if want := hook.TimedOut(50 * time.Millisecond).Output; output != want {
+		t.Errorf("output = %s, want %s", output, want)
+	}
+}
+
+func TestServeSocketStalledClientDoesNotBlockOthers(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+	path, _, _ := startTestServer(t)
+
+	// A client that connects but never sends its request
+	stalled, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+
+	input := `{"tool_name":"Bash","tool_input":{"command":"ls"}}`
+	output, _, err := forwardToSocket(path, strings.NewReader(input), time.Second)
+	if err != nil {
+		t.Fatalf("forwardToSocket() error = %v, want a response while another client is stalled", err)
+	}
+	if got := outputDecision(output); got != hook.DecisionAllow {
+		t.Errorf("decision = %q, want %q", got, hook.DecisionAllow)
+	}
+}
+
+func TestRunHookSocketNoResponseDoesNotEvaluateAgain(t *testing.T) {
+	t.Cleanup(setupTestConfig(t))
+
+	dir, err := os.MkdirTemp("", "mmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "mmi.sock")
+
+	// A server that receives the request and drops the connection without
+	// reading all of it, which resets the connection
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Read(make([]byte, 1))
+			time.Sleep(100 * time.Millisecond)
+			conn.Close()
+		}
+	}()
+
+	hookSocket = path
+	output := runHookWithInput(t, `{"tool_name":"Bash","tool_input":{"command":"rm -rf /tmp/x"}}`)
+	if want := hook.FormatAsk("mmi serve did not respond"); output != want {
+		t.Errorf("output = %s, want %s rather than a local evaluation", output, want)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cmd
+
+import "net"
+
+// listenUnix listens on a Unix socket at path. Platforms without a umask
+// leave its permissions to the platform.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
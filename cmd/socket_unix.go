@@ -0,0 +1,17 @@
+//go:build unix
+
+package cmd
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix listens on a Unix socket at path that only its owner can
+// connect to. The socket is created with a restrictive umask rather than
+// chmodded afterwards, so there's no window in which others can connect.
+func listenUnix(path string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
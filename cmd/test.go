@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/spf13/cobra"
+)
+
+// errCommandRejected is returned by the test command so the process exits non-zero
+// when the command would not be approved.
+var errCommandRejected = errors.New("command rejected")
+
+var testFile string
+
+var testCmd = &cobra.Command{
+	Use:   "test <command>",
+	Short: "Test how a command string would be evaluated",
+	Long: `Test runs a raw command string through the approval pipeline and prints
+the result for each segment, without requiring a JSON hook payload.
+
+For each segment it shows the core command, the wrappers that were stripped,
+and either the matched pattern or the rejection code.
+
+Exits 0 if the command would be approved and 1 otherwise, so it can be used
+in shell scripts:
+
+  mmi test "git status" && echo "approved"
+
+Nothing is written to the audit log.
+
+With --file, test reads one command per line from a file instead, such as a
+saved shell history, and prints a table of each command's decision and
+reason followed by a count of each decision. Blank lines and lines starting
+with # are skipped. Exits 1 if any command would not be approved:
+
+  mmi test --file cmds.txt`,
+	Args:          testArgs,
+	SilenceErrors: true,
+	RunE:          runTest,
+}
+
+func init() {
+	testCmd.Flags().StringVar(&testFile, "file", "", "Evaluate each line of a file as a separate command")
+	rootCmd.AddCommand(testCmd)
+}
+
+// testArgs requires a command argument unless commands are read from --file.
+func testArgs(cmd *cobra.Command, args []string) error {
+	if testFile != "" {
+		return cobra.NoArgs(cmd, args)
+	}
+	return cobra.ExactArgs(1)(cmd, args)
+}
+
+// currentDir returns the working directory, or "" if it can't be determined.
+func currentDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// evaluateCommandString runs a bare command string through the approval
+// pipeline with the config for the current directory. Unlike the hook, it
+// doesn't write to the audit log.
+func evaluateCommandString(command string) hook.Result {
+	dir := currentDir()
+	return hook.EvaluateCommandInDir(command, dir, config.ForDir(dir))
+}
+
+func runTest(cmd *cobra.Command, args []string) error {
+	if testFile != "" {
+		return runTestFile(testFile)
+	}
+
+	result := evaluateCommandString(args[0])
+
+	switch {
+	case result.Approved:
+		fmt.Printf("APPROVED: %s (reason: %s)\n", result.Command, result.Reason)
+	case result.Passthrough:
+		fmt.Printf("PASSTHROUGH: %s\n", result.Command)
+	default:
+		fmt.Printf("REJECTED: %s\n", result.Command)
+	}
+
+	printSegments(result.Segments)
+
+	if !result.Approved {
+		return errCommandRejected
+	}
+	return nil
+}
+
+// printSegments prints the evaluation details of each segment.
+func printSegments(segments []audit.Segment) {
+	cfg := config.ForDir(currentDir())
+	for i, seg := range segments {
+		coreCmd, _ := hook.StripWrappers(seg.Command, cfg.WrapperPatterns)
+		fmt.Printf("  [%d] %s\n", i+1, seg.Command)
+		fmt.Printf("      core:     %s\n", coreCmd)
+		if len(seg.Wrappers) > 0 {
+			fmt.Printf("      wrappers: %s\n", strings.Join(seg.Wrappers, ", "))
+		}
+		if seg.Match != nil {
+			fmt.Printf("      match:    %s (%s)\n", seg.Match.Name, seg.Match.Type)
+		}
+		if seg.Rejection != nil {
+			rejection := seg.Rejection.Code
+			if len(seg.Rejection.Matches) > 0 {
+				rejection += " " + strings.Join(seg.Rejection.Matches, ", ")
+			} else if seg.Rejection.Name != "" {
+				rejection += " " + seg.Rejection.Name
+			}
+			if seg.Rejection.Detail != "" {
+				rejection += " (" + seg.Rejection.Detail + ")"
+			}
+			fmt.Printf("      rejected: %s\n", rejection)
+		}
+	}
+}
+
+// runTestFile evaluates each command in path and prints a table of the
+// decisions followed by a summary count.
+func runTestFile(path string) error {
+	commands, err := readCommandFile(path)
+	if err != nil {
+		return err
+	}
+	if len(commands) == 0 {
+		fmt.Println("No commands to test.")
+		return nil
+	}
+
+	cfg := config.ForDir(currentDir())
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DECISION\tCOMMAND\tREASON")
+	for _, command := range commands {
+		result := hook.EvaluateCommandInDir(command, currentDir(), cfg)
+		decision := resultDecision(result)
+		counts[decision]++
+		fmt.Fprintf(w, "%s\t%s\t%s\n", decision, truncateCommand(command), result.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d commands: %d allowed, %d ask, %d denied\n",
+		len(commands), counts[hook.DecisionAllow], counts[hook.DecisionAsk], counts[hook.DecisionDeny])
+	if counts[hook.DecisionAllow] < len(commands) {
+		return errCommandRejected
+	}
+	return nil
+}
+
+// readCommandFile returns the commands in path, one per line, skipping blank
+// lines and # comments.
+func readCommandFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read command file: %w", err)
+	}
+	defer f.Close()
+
+	var commands []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commands = append(commands, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read command file: %w", err)
+	}
+	return commands, nil
+}
@@ -1,12 +1,25 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/dgerlanc/mmi/internal/config"
 	"github.com/spf13/cobra"
 )
 
+var (
+	validateFile   string
+	validateStdin  bool
+	validateFormat string
+)
+
 var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate configuration and show compiled patterns",
@@ -15,28 +28,128 @@ var validateCmd = &cobra.Command{
 This is useful for:
 - Checking that your config.toml syntax is correct
 - Seeing what patterns will actually be used
-- Debugging pattern matching issues`,
+- Debugging pattern matching issues
+
+Use --file or --stdin to validate a candidate config, such as in CI, without
+touching the installed one. Includes in a --file config are resolved relative
+to its directory, and in a --stdin config relative to the current directory.
+Use --format json for a machine-readable summary:
+
+  {"valid": true, "deny_patterns": 5, "wrapper_patterns": 4, "safe_commands": 12, "errors": [], "warnings": []}
+
+Exits non-zero if the config is invalid.`,
+	Args: cobra.NoArgs,
 	RunE: runValidate,
 }
 
 func init() {
+	validateCmd.Flags().StringVar(&validateFile, "file", "", "Validate this config file instead of the installed config")
+	validateCmd.Flags().BoolVar(&validateStdin, "stdin", false, "Validate a config read from stdin instead of the installed config")
+	validateCmd.Flags().StringVar(&validateFormat, "format", "text", "Output format: text or json")
+	validateCmd.MarkFlagsMutuallyExclusive("file", "stdin")
 	rootCmd.AddCommand(validateCmd)
 }
 
+// loadValidateConfig loads the config named by --file or --stdin, or the
+// installed config if neither is set.
+func loadValidateConfig() (*config.Config, error) {
+	var data []byte
+	var dir string
+	var err error
+	switch {
+	case validateFile != "":
+		data, err = os.ReadFile(validateFile)
+		dir = filepath.Dir(validateFile)
+	case validateStdin:
+		data, err = io.ReadAll(os.Stdin)
+		dir = currentDir()
+	default:
+		cfg := config.Get()
+		return cfg, config.InitError()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return config.LoadConfigWithDir(data, dir)
+}
+
+// describeConfigError adds the offending line to TOML syntax errors; other
+// errors already name the section and entry at fault.
+func describeConfigError(err error) string {
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return "failed to parse TOML: " + parseErr.ErrorWithPosition()
+	}
+	return err.Error()
+}
+
+// validateResult is the JSON output of mmi validate --format json
+type validateResult struct {
+	Valid           bool     `json:"valid"`
+	DenyPatterns    int      `json:"deny_patterns"`
+	WrapperPatterns int      `json:"wrapper_patterns"`
+	SafeCommands    int      `json:"safe_commands"`
+	Errors          []string `json:"errors"`
+	Warnings        []string `json:"warnings"`
+}
+
 func runValidate(cmd *cobra.Command, args []string) error {
-	cfg := config.Get()
-	if err := config.InitError(); err != nil {
-		return fmt.Errorf("configuration error: %w", err)
+	switch validateFormat {
+	case "text":
+	case "json":
+		return runValidateJSON()
+	default:
+		return fmt.Errorf("invalid --format %q (want text or json)", validateFormat)
+	}
+
+	cfg, err := loadValidateConfig()
+	if err != nil {
+		return fmt.Errorf("configuration error: %s", describeConfigError(err))
 	}
 
 	fmt.Println("Configuration valid!")
 	fmt.Println()
 
+	// Show warnings right after the verdict so they aren't missed
+	if len(cfg.Warnings) > 0 {
+		fmt.Printf("Warnings: %d\n", len(cfg.Warnings))
+		for _, w := range cfg.Warnings {
+			fmt.Printf("  - %s\n", w)
+		}
+		fmt.Println()
+	}
+
 	// Show unmatched behavior (first, most important setting)
 	fmt.Printf("Unmatched command behavior: %s\n", cfg.Unmatched)
 
 	// Show subshell settings
 	fmt.Printf("Subshell allow all: %v\n", cfg.SubshellAllowAll)
+	fmt.Printf("Allow subshells: %v\n", cfg.Security.AllowSubshells)
+	fmt.Printf("Allow backticks: %v\n", cfg.Security.AllowBackticks)
+	fmt.Printf("Allow process substitution: %v\n", cfg.Security.AllowProcessSubstitution)
+	fmt.Printf("Unparseable command behavior: %s\n", cfg.Security.Unparseable)
+	fmt.Printf("Empty command behavior: %s\n", cfg.Security.EmptyCommand)
+	fmt.Printf("Any deny denies all: %v\n", !cfg.Security.IgnoreSegmentDeny)
+	fmt.Printf("Require all allow: %v\n", !cfg.Security.AllowPartialApproval)
+	fmt.Printf("Allow multiline: %v\n", cfg.Security.AllowMultiline)
+	fmt.Printf("Allow declarations: %v\n", cfg.Security.AllowDeclarations)
+	fmt.Printf("Protected write paths: %s\n", strings.Join(cfg.Security.ProtectedWritePaths, ", "))
+	fmt.Printf("Protected env vars: %s\n", strings.Join(cfg.Security.ProtectedEnvVars, ", "))
+	var dangerousWrappers []string
+	for _, re := range cfg.Security.DangerousWrappers {
+		dangerousWrappers = append(dangerousWrappers, re.String())
+	}
+	fmt.Printf("Dangerous wrappers: %s\n", strings.Join(dangerousWrappers, ", "))
+	if cfg.Security.AllowedEnvVars != nil {
+		fmt.Printf("Allowed env vars: %s\n", strings.Join(cfg.Security.AllowedEnvVars, ", "))
+	}
+	fmt.Printf("Match timeout: %s\n", cfg.Limits.MatchTimeout)
+	if cfg.Output.ApprovalReasonTemplate != "" {
+		fmt.Printf("Approval reason template: %s\n", cfg.Output.ApprovalReasonTemplate)
+	}
+	if cfg.Output.NearMissHints {
+		fmt.Println("Near-miss hints: enabled")
+	}
 	fmt.Println()
 
 	// Show deny patterns
@@ -46,6 +159,15 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Println()
 
+	// Show allow overrides
+	if len(cfg.AllowOverrides) > 0 {
+		fmt.Printf("Allow overrides: %d\n", len(cfg.AllowOverrides))
+		for _, p := range cfg.AllowOverrides {
+			fmt.Printf("  - %s: %s\n", p.Name, p.Regex.String())
+		}
+		fmt.Println()
+	}
+
 	// Show wrapper patterns
 	fmt.Printf("Wrapper patterns: %d\n", len(cfg.WrapperPatterns))
 	for _, p := range cfg.WrapperPatterns {
@@ -68,3 +190,30 @@ func runValidate(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// runValidateJSON prints the validation result as JSON. An invalid config is
+// still reported on stdout, and the error only sets the exit code.
+func runValidateJSON() error {
+	result := validateResult{Errors: []string{}, Warnings: []string{}}
+	cfg, err := loadValidateConfig()
+	if err != nil {
+		result.Errors = append(result.Errors, describeConfigError(err))
+	} else {
+		result.Valid = true
+		result.DenyPatterns = len(cfg.DenyPatterns)
+		result.WrapperPatterns = len(cfg.WrapperPatterns)
+		result.SafeCommands = len(cfg.SafeCommands)
+		result.Warnings = append(result.Warnings, cfg.Warnings...)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode validation result: %w", err)
+	}
+	fmt.Println(string(data))
+
+	if !result.Valid {
+		return errors.New("configuration invalid")
+	}
+	return nil
+}
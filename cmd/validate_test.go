@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -561,3 +562,281 @@ commands = ["true"]
 		t.Errorf("expected 'Wrapper patterns: 0' in output, got:\n%s", output)
 	}
 }
+
+func TestRunValidateWarnsOnPathologicalRegex(t *testing.T) {
+	resetGlobalState()
+
+	tmpDir := t.TempDir()
+	os.Setenv("MMI_CONFIG", tmpDir)
+	defer os.Unsetenv("MMI_CONFIG")
+
+	testConfig := `
+schema_version = 1
+
+[[commands.regex]]
+pattern = '^(a+)+$'
+name = "pathological"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.toml"), []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Reset()
+	config.Init()
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runValidate(&cobra.Command{}, []string{})
+	})
+	if err != nil {
+		t.Fatalf("runValidate() error = %v", err)
+	}
+
+	for _, expected := range []string{"Warnings: 1", `commands.regex[0] "pathological"`, "nested quantifiers"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunValidateWarnsOnUnanchoredPatterns(t *testing.T) {
+	resetGlobalState()
+
+	tmpDir := t.TempDir()
+	os.Setenv("MMI_CONFIG", tmpDir)
+	defer os.Unsetenv("MMI_CONFIG")
+
+	testConfig := `
+schema_version = 1
+
+[[commands.regex]]
+pattern = 'status'
+name = "git status"
+
+[[commands.simple]]
+name = "git log"
+commands = ["git log"]
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.toml"), []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Reset()
+	config.Init()
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runValidate(&cobra.Command{}, []string{})
+	})
+	if err != nil {
+		t.Fatalf("runValidate() error = %v", err)
+	}
+
+	for _, expected := range []string{"Warnings: 2", `commands.regex[0] "git status"`, "doesn't start with ^", `commands.simple[0] "git log"`, "contains a space"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunValidateFile(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "extra.toml"), []byte(`
+[[commands.simple]]
+name = "extra"
+commands = ["cat", "head"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "candidate.toml")
+	if err := os.WriteFile(path, []byte(`
+schema_version = 1
+include = ["extra.toml"]
+
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	validateFile = path
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runValidate(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runValidate() error = %v", err)
+	}
+	for _, expected := range []string{"Configuration valid!", "Safe command patterns: 3"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output should contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunValidateInvalidFile(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	dir := t.TempDir()
+	syntaxError := filepath.Join(dir, "syntax.toml")
+	if err := os.WriteFile(syntaxError, []byte(`
+[[commands.simple]]
+name = "broken"
+commands = ["ls"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missingField := filepath.Join(dir, "missing.toml")
+	if err := os.WriteFile(missingField, []byte(`
+[[commands.subcommand]]
+command = "git"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{syntaxError, "At line 4"},
+		{missingField, `commands.subcommand[0] "git"`},
+		{filepath.Join(dir, "absent.toml"), "failed to read config"},
+	}
+	for _, tt := range tests {
+		validateFile = tt.path
+		err := runValidate(&cobra.Command{}, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runValidate(%s) error = %v, want one containing %q", filepath.Base(tt.path), err, tt.want)
+		}
+	}
+}
+
+func TestRunValidateStdin(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	stdin, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.WriteString("[[deny.simple]]\nname = \"root\"\ncommands = [\"sudo\"]\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+	validateStdin = true
+
+	output := captureStdout(t, func() {
+		err = runValidate(&cobra.Command{}, nil)
+	})
+	if err != nil {
+		t.Fatalf("runValidate() error = %v", err)
+	}
+	if !strings.Contains(output, "Deny patterns: 1") {
+		t.Errorf("output should count the stdin config's patterns, got:\n%s", output)
+	}
+}
+
+func TestRunValidateFormatJSON(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.toml")
+	if err := os.WriteFile(valid, []byte(`
+schema_version = 1
+
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.simple]]
+name = "read-only"
+commands = ["ls", "cat"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.toml")
+	if err := os.WriteFile(invalid, []byte("[[commands.simple]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    validateResult
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			path: valid,
+			want: validateResult{Valid: true, DenyPatterns: 1, WrapperPatterns: 1, SafeCommands: 2, Errors: []string{}, Warnings: []string{}},
+		},
+		{
+			name:    "invalid",
+			path:    invalid,
+			want:    validateResult{Errors: []string{"failed to parse TOML"}, Warnings: []string{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validateFile = tt.path
+			validateFormat = "json"
+
+			var err error
+			output := captureStdout(t, func() {
+				err = runValidate(&cobra.Command{}, nil)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runValidate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got validateResult
+			if err := json.Unmarshal([]byte(output), &got); err != nil {
+				t.Fatalf("output is not JSON: %v\n%s", err, output)
+			}
+			if got.Valid != tt.want.Valid || got.DenyPatterns != tt.want.DenyPatterns ||
+				got.WrapperPatterns != tt.want.WrapperPatterns || got.SafeCommands != tt.want.SafeCommands {
+				t.Errorf("result = %+v, want %+v", got, tt.want)
+			}
+			if len(got.Errors) != len(tt.want.Errors) {
+				t.Fatalf("Errors = %v, want %v", got.Errors, tt.want.Errors)
+			}
+			for i, prefix := range tt.want.Errors {
+				if !strings.HasPrefix(got.Errors[i], prefix) {
+					t.Errorf("Errors[%d] = %q, want prefix %q", i, got.Errors[i], prefix)
+				}
+			}
+			// Empty lists are encoded as [] rather than null
+			for _, key := range []string{`"errors": [`, `"warnings": [`} {
+				if !strings.Contains(output, key) {
+					t.Errorf("output missing %s:\n%s", key, output)
+				}
+			}
+		})
+	}
+}
+
+func TestRunValidateInvalidFormat(t *testing.T) {
+	resetGlobalState()
+	defer resetGlobalState()
+
+	validateFormat = "yaml"
+	err := runValidate(&cobra.Command{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("runValidate() error = %v, want invalid --format error", err)
+	}
+}
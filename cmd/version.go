@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/hook"
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, set by SetVersionInfo from the values main is built with
+var (
+	buildVersion = "dev"
+	buildCommit  = "none"
+	buildDate    = "unknown"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version and build information",
+	Long: `Version prints the mmi version, the git commit and date it was built from,
+the Go version, and the config schema and audit log format versions.`,
+	Args: cobra.NoArgs,
+	Run:  runVersion,
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
+
+// SetVersionInfo records the build metadata reported by mmi version. Empty
+// values keep the defaults.
+func SetVersionInfo(version, commit, date string) {
+	if version != "" {
+		buildVersion = version
+	}
+	if commit != "" {
+		buildCommit = commit
+	}
+	if date != "" {
+		buildDate = date
+	}
+}
+
+func runVersion(cmd *cobra.Command, args []string) {
+	fmt.Printf("mmi %s\n", buildVersion)
+	fmt.Printf("commit: %s\n", buildCommit)
+	fmt.Printf("built: %s\n", buildDate)
+	fmt.Printf("go: %s\n", runtime.Version())
+	fmt.Printf("config schema: %d\n", config.SchemaVersion)
+	fmt.Printf("audit log format: %d\n", hook.AuditVersion)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestRunVersion(t *testing.T) {
+	oldVersion, oldCommit, oldDate := buildVersion, buildCommit, buildDate
+	defer func() { buildVersion, buildCommit, buildDate = oldVersion, oldCommit, oldDate }()
+
+	SetVersionInfo("1.2.3", "abc1234", "")
+	output := captureStdout(t, func() {
+		runVersion(&cobra.Command{}, nil)
+	})
+
+	lines := strings.Split(output, "\n")
+	if lines[0] != "mmi 1.2.3" {
+		t.Errorf("first line = %q, want %q", lines[0], "mmi 1.2.3")
+	}
+	for _, want := range []string{"commit: abc1234", "built: unknown", "go: " + runtime.Version(), "config schema: 1", "audit log format: 1"} {
+		if !strings.Contains(output, want+"\n") {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunVersionDefaults(t *testing.T) {
+	output := captureStdout(t, func() {
+		runVersion(&cobra.Command{}, nil)
+	})
+	if first := strings.SplitN(output, "\n", 2)[0]; first == "mmi " || !strings.HasPrefix(first, "mmi ") {
+		t.Errorf("version line = %q, want a non-empty version", first)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+var whyLastCmd = &cobra.Command{
+	Use:   "why-last",
+	Short: "Show the most recent rejected command and why it was rejected",
+	Long: `Why-last finds the most recent rejected entry in the audit log and prints
+the command along with the rejection code, pattern name, and pattern of each
+rejected segment.
+
+Use it right after Claude Code hits a rejection; use "mmi audit query" to
+search further back.`,
+	Args: cobra.NoArgs,
+	RunE: runWhyLast,
+}
+
+func init() {
+	rootCmd.AddCommand(whyLastCmd)
+}
+
+func runWhyLast(cmd *cobra.Command, args []string) error {
+	path, err := auditLogPath()
+	if err != nil {
+		return fmt.Errorf("failed to locate audit log: %w", err)
+	}
+	entries, err := audit.TailEntries(path, 0)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	entry, ok := lastRejected(entries)
+	if !ok {
+		fmt.Println("No rejected commands in the audit log.")
+		return nil
+	}
+
+	fmt.Printf("Command: %s\n", entry.Command)
+	fmt.Printf("Time:    %s\n", entry.Timestamp)
+	if entry.SessionID != "" {
+		fmt.Printf("Session: %s\n", entry.SessionID)
+	}
+	if entry.Cwd != "" {
+		fmt.Printf("Cwd:     %s\n", entry.Cwd)
+	}
+
+	for i, seg := range entry.Segments {
+		if seg.Rejection == nil {
+			continue
+		}
+		fmt.Printf("\n  [%d] %s\n", i+1, seg.Command)
+		fmt.Printf("      code:    %s\n", seg.Rejection.Code)
+		if len(seg.Rejection.Matches) > 0 {
+			fmt.Printf("      name:    %s\n", strings.Join(seg.Rejection.Matches, ", "))
+		} else if seg.Rejection.Name != "" {
+			fmt.Printf("      name:    %s\n", seg.Rejection.Name)
+		}
+		if seg.Rejection.Pattern != "" {
+			fmt.Printf("      pattern: %s\n", seg.Rejection.Pattern)
+		}
+		if seg.Rejection.Detail != "" {
+			fmt.Printf("      detail:  %s\n", seg.Rejection.Detail)
+		}
+	}
+	return nil
+}
+
+// lastRejected returns the most recent entry in entries that was not approved.
+func lastRejected(entries []audit.Entry) (audit.Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Approved {
+			return entries[i], true
+		}
+	}
+	return audit.Entry{}, false
+}
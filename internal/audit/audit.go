@@ -3,6 +3,8 @@ package audit
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -20,6 +22,20 @@ const (
 	CodeNoMatch             = "NO_MATCH"
 	CodeRewrite             = "REWRITE"
 	CodePassthrough         = "PASSTHROUGH"
+	CodePathRestricted      = "PATH_RESTRICTED"
+	CodePipeToShell         = "PIPE_TO_SHELL"
+	CodeObfuscatedExec      = "OBFUSCATED_EXEC"
+	CodeProcessSubstitution = "PROCESS_SUBSTITUTION"
+	CodeInnerCommand        = "INNER_COMMAND"
+	CodeSensitiveRedirect   = "SENSITIVE_REDIRECT"
+	CodeDeviceWrite         = "DEVICE_WRITE"
+	CodeEnvAssignment       = "ENV_ASSIGNMENT"
+	CodeTimeout             = "TIMEOUT"
+	CodeMultiline           = "MULTILINE"
+	CodeDangerousWrapper    = "DANGEROUS_WRAPPER"
+	CodeInvalidChars        = "INVALID_CHARS"
+	CodeScriptEscape        = "SCRIPT_ESCAPE"
+	CodeArgCount            = "ARG_COUNT"
 )
 
 // TimestampFormat is the format used for audit log timestamps.
@@ -34,21 +50,30 @@ type Entry struct {
 	DurationMs  float64   `json:"duration_ms"`
 	Command     string    `json:"command"`
 	Approved    bool      `json:"approved"`
+	Reason      string    `json:"reason,omitempty"`
 	Segments    []Segment `json:"segments"`
 	Cwd         string    `json:"cwd"`
 	Input       string    `json:"input"`
 	Output      string    `json:"output"`
 	ConfigPath  string    `json:"config_path"`
 	ConfigError string    `json:"config_error,omitempty"`
+	Profile     string    `json:"profile,omitempty"`
 }
 
 // Segment represents a single command segment within a chained command.
 type Segment struct {
-	Command   string     `json:"command"`
+	Command string `json:"command"`
+	// Operator joins the segment to the one before it: "&&", "||", ";",
+	// "|", "|&", or "&". Empty for the first segment.
+	Operator  string     `json:"operator,omitempty"`
 	Approved  bool       `json:"approved"`
 	Wrappers  []string   `json:"wrappers,omitempty"`
 	Match     *Match     `json:"match,omitempty"`
 	Rejection *Rejection `json:"rejection,omitempty"`
+	// ResolvedPath is the absolute path of the program the segment runs
+	// when it is named by a relative path, like ./deploy.sh. Only recorded
+	// with [audit] resolve_paths.
+	ResolvedPath string `json:"resolved_path,omitempty"`
 }
 
 // Match contains information about the pattern that matched a command.
@@ -56,6 +81,8 @@ type Match struct {
 	Type    string `json:"type"`
 	Pattern string `json:"pattern,omitempty"`
 	Name    string `json:"name"`
+	// Note is the matched pattern's note, if it has one
+	Note string `json:"note,omitempty"`
 }
 
 // Rejection contains information about why a command was rejected.
@@ -64,12 +91,28 @@ type Rejection struct {
 	Name    string `json:"name,omitempty"`
 	Pattern string `json:"pattern,omitempty"`
 	Detail  string `json:"detail,omitempty"`
+	// Matches names every deny rule that matched, when there were several
+	Matches []string `json:"matches,omitempty"`
 }
 
+// Audit outputs that name a stream instead of a file.
+const (
+	OutputStderr = "stderr"
+	OutputStdout = "stdout"
+)
+
+// ErrStdoutOutput is returned when the audit log is sent to stdout, where it
+// would corrupt the hook's JSON decision.
+var ErrStdoutOutput = errors.New("audit output cannot be stdout: the hook writes its decision there")
+
 var (
-	auditFile *os.File
-	mu        sync.Mutex
-	enabled   bool
+	// auditWriter receives the log entries; auditFile is set when it is a
+	// file opened by Init, which Close closes, and auditPath is its path
+	auditWriter io.Writer
+	auditFile   *os.File
+	auditPath   string
+	mu          sync.Mutex
+	enabled     bool
 )
 
 // DefaultLogPath returns the default audit log path (~/.local/share/mmi/audit.log)
@@ -116,20 +159,58 @@ func Init(path string, disable bool) error {
 	}
 
 	auditFile = f
+	auditWriter = f
+	auditPath = path
 	enabled = true
 	logger.Debug("audit logging initialized", "path", path)
 	return nil
 }
 
+// InitOutput initializes the audit log for an output setting: "stderr" writes
+// entries to stderr, "" uses the default file, and anything else is a file
+// path. "stdout" is rejected with ErrStdoutOutput and leaves logging disabled.
+func InitOutput(output string, disable bool) error {
+	switch {
+	case disable:
+		return Init("", true)
+	case output == OutputStdout:
+		Init("", true)
+		logger.Debug("audit logging disabled", "error", ErrStdoutOutput)
+		return ErrStdoutOutput
+	case output == OutputStderr:
+		InitWriter(os.Stderr)
+		return nil
+	default:
+		return Init(output, false)
+	}
+}
+
+// InitWriter initializes the audit log to write entries to w, such as a
+// stream in containers without a persistent home directory. w is not closed
+// by Close.
+func InitWriter(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if auditFile != nil {
+		auditFile.Close()
+		auditFile = nil
+	}
+	auditWriter = w
+	enabled = true
+	logger.Debug("audit logging initialized to a stream")
+}
+
 // Close closes the audit log file.
 func Close() error {
 	mu.Lock()
 	defer mu.Unlock()
 
+	auditWriter = nil
+	enabled = false
 	if auditFile != nil {
 		err := auditFile.Close()
 		auditFile = nil
-		enabled = false
 		return err
 	}
 	return nil
@@ -141,7 +222,7 @@ func Log(entry Entry) error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	if !enabled || auditFile == nil {
+	if !enabled || auditWriter == nil {
 		return nil
 	}
 
@@ -154,7 +235,13 @@ func Log(entry Entry) error {
 		return err
 	}
 
-	if _, err := auditFile.Write(append(data, '\n')); err != nil {
+	data = append(data, '\n')
+	if auditFile != nil {
+		err = appendFile(data)
+	} else {
+		_, err = auditWriter.Write(data)
+	}
+	if err != nil {
 		logger.Debug("failed to write audit entry", "error", err)
 		return err
 	}
@@ -162,6 +249,31 @@ func Log(entry Entry) error {
 	return nil
 }
 
+// appendFile appends data to the audit log file under the lock PruneEntries
+// takes, reopening the file first if it was replaced since it was opened.
+// mu must be held.
+func appendFile(data []byte) error {
+	for {
+		current, err := lockCurrent(auditFile, auditPath)
+		if err != nil {
+			return err
+		}
+		if current {
+			break
+		}
+		f, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, constants.FileMode)
+		if err != nil {
+			return err
+		}
+		auditFile.Close()
+		auditFile = f
+		auditWriter = f
+	}
+	defer unlockFile(auditFile)
+	_, err := auditFile.Write(data)
+	return err
+}
+
 // IsEnabled returns whether audit logging is enabled.
 func IsEnabled() bool {
 	mu.Lock()
@@ -177,5 +289,7 @@ func Reset() {
 		auditFile.Close()
 	}
 	auditFile = nil
+	auditWriter = nil
+	auditPath = ""
 	enabled = false
 }
@@ -1,6 +1,7 @@
 package audit
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -59,6 +60,71 @@ func TestInitDisabled(t *testing.T) {
 	}
 }
 
+func TestInitWriter(t *testing.T) {
+	defer Reset()
+
+	var buf bytes.Buffer
+	InitWriter(&buf)
+	if !IsEnabled() {
+		t.Fatal("Expected audit logging to be enabled")
+	}
+
+	if err := Log(Entry{Version: 1, Command: "ls", Approved: true}); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+	if err := Log(Entry{Version: 1, Command: "rm", Approved: false}); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("line is not JSON: %v", err)
+	}
+	if entry.Command != "rm" || entry.Timestamp == "" {
+		t.Errorf("entry = %+v, want command rm with a timestamp", entry)
+	}
+
+	// Close stops logging without closing the writer
+	if err := Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	Log(Entry{Command: "after close"})
+	if strings.Contains(buf.String(), "after close") {
+		t.Error("entries should not be written after Close")
+	}
+}
+
+func TestInitOutput(t *testing.T) {
+	defer Reset()
+
+	if err := InitOutput(OutputStdout, false); err != ErrStdoutOutput {
+		t.Errorf("InitOutput(stdout) error = %v, want ErrStdoutOutput", err)
+	}
+	if IsEnabled() {
+		t.Error("audit logging should stay disabled for stdout")
+	}
+
+	if err := InitOutput(OutputStderr, false); err != nil || !IsEnabled() {
+		t.Errorf("InitOutput(stderr) error = %v, enabled = %v", err, IsEnabled())
+	}
+
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	if err := InitOutput(logPath, false); err != nil || !IsEnabled() {
+		t.Fatalf("InitOutput(path) error = %v, enabled = %v", err, IsEnabled())
+	}
+	if _, err := os.Stat(logPath); err != nil {
+		t.Errorf("audit log file was not created: %v", err)
+	}
+
+	if err := InitOutput(OutputStderr, true); err != nil || IsEnabled() {
+		t.Errorf("InitOutput(disable) error = %v, enabled = %v", err, IsEnabled())
+	}
+}
+
 func TestLog(t *testing.T) {
 	defer Reset()
 
@@ -1075,6 +1141,51 @@ func TestEntryConfigErrorOmitEmpty(t *testing.T) {
 	}
 }
 
+func TestEntryReasonAndProfileSerialization(t *testing.T) {
+	entry := Entry{
+		Version:  1,
+		Command:  "sudo ls",
+		Approved: false,
+		Reason:   "command matches deny pattern: privilege escalation",
+		Profile:  "ci",
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	jsonStr := string(data)
+	for _, want := range []string{`"reason":"command matches deny pattern: privilege escalation"`, `"profile":"ci"`} {
+		if !strings.Contains(jsonStr, want) {
+			t.Errorf("JSON missing %s: %s", want, jsonStr)
+		}
+	}
+
+	var parsed Entry
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if parsed.Reason != entry.Reason || parsed.Profile != entry.Profile {
+		t.Errorf("parsed Reason, Profile = %q, %q, want %q, %q", parsed.Reason, parsed.Profile, entry.Reason, entry.Profile)
+	}
+}
+
+func TestEntryReasonAndProfileOmitEmpty(t *testing.T) {
+	data, err := json.Marshal(Entry{Version: 1, Command: "ls", Approved: true})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	jsonStr := string(data)
+	if strings.Contains(jsonStr, `"reason"`) {
+		t.Error("Expected reason field to be omitted when empty")
+	}
+	if strings.Contains(jsonStr, `"profile"`) {
+		t.Error("Expected profile field to be omitted when empty")
+	}
+}
+
 func TestLogWritesConfigFields(t *testing.T) {
 	defer Reset()
 
@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/logger"
+)
+
+// Follow streams entries appended to the audit log at path, calling fn for
+// each, until ctx is cancelled. It starts at the current end of the file and
+// polls for new data every interval. If the file is rotated (renamed or
+// replaced) or truncated, it is reopened and read from the beginning.
+// A log that doesn't exist yet is waited for.
+func Follow(ctx context.Context, path string, interval time.Duration, fn func(Entry)) error {
+	f, info, err := openForFollow(path)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	var offset int64
+	if info != nil {
+		offset = info.Size()
+	}
+	var partial []byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if f != nil {
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			offset += int64(len(data))
+			partial = emitLines(append(partial, data...), path, fn)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Detect rotation or truncation
+		current, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if f == nil || !os.SameFile(info, current) || current.Size() < offset {
+			logger.Debug("audit log rotated, reopening", "path", path)
+			if f != nil {
+				// Drain entries written to the old file before it was rotated
+				if data, err := io.ReadAll(f); err == nil {
+					emitLines(append(partial, data...), path, fn)
+				}
+				f.Close()
+			}
+			f, info, err = openForFollow(path)
+			if err != nil {
+				return err
+			}
+			offset = 0
+			partial = nil
+		}
+	}
+}
+
+// openForFollow opens the log for reading. Returns a nil file if it doesn't exist.
+func openForFollow(path string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// emitLines calls fn for each complete line in data that decodes to an entry
+// and returns the trailing partial line.
+func emitLines(data []byte, source string, fn func(Entry)) []byte {
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return data
+		}
+		line := bytes.TrimSpace(data[:i])
+		data = data[i+1:]
+		if len(line) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			logger.Debug("skipping malformed audit entry", "file", source, "error", err)
+			continue
+		}
+		fn(entry)
+	}
+}
+
+// TailEntries returns the last n entries from the audit log at path and its
+// rotated backups, in chronological order. n <= 0 returns all entries.
+func TailEntries(path string, n int) ([]Entry, error) {
+	entries, err := ReadEntries(path)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// followCollector records entries delivered by Follow.
+type followCollector struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (c *followCollector) add(e Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commands = append(c.commands, e.Command)
+}
+
+// waitFor waits until n entries have been collected and returns them.
+func (c *followCollector) waitFor(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		if len(c.commands) >= n {
+			got := append([]string(nil), c.commands...)
+			c.mu.Unlock()
+			return got
+		}
+		c.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.Fatalf("timed out waiting for %d entries, got %v", n, c.commands)
+	return nil
+}
+
+func startFollow(t *testing.T, path string) *followCollector {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &followCollector{}
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, path, 10*time.Millisecond, c.add)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Follow() error = %v", err)
+		}
+	})
+	// Give Follow time to open the file and seek to the end
+	time.Sleep(50 * time.Millisecond)
+	return c
+}
+
+func appendLine(t *testing.T, path, line string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowStreamsNewEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	appendLine(t, path, `{"command":"existing"}`+"\n")
+
+	c := startFollow(t, path)
+
+	appendLine(t, path, `{"command":"first"}`+"\n")
+	// A partial line is held until it is completed
+	appendLine(t, path, `{"command":"sec`)
+	appendLine(t, path, `ond"}`+"\n")
+
+	got := c.waitFor(t, 2)
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("Follow() delivered %v, want [first second]", got)
+	}
+}
+
+func TestFollowReopensAfterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	appendLine(t, path, "")
+
+	c := startFollow(t, path)
+
+	appendLine(t, path, `{"command":"before"}`+"\n")
+	c.waitFor(t, 1)
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLine(t, path, `{"command":"after"}`+"\n")
+
+	got := c.waitFor(t, 2)
+	if got[1] != "after" {
+		t.Errorf("Follow() delivered %v, want [before after]", got)
+	}
+}
+
+func TestFollowReopensAfterTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	appendLine(t, path, `{"command":"old entry with a long command"}`+"\n")
+
+	c := startFollow(t, path)
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendLine(t, path, `{"command":"new"}`+"\n")
+
+	got := c.waitFor(t, 1)
+	if got[0] != "new" {
+		t.Errorf("Follow() delivered %v, want [new]", got)
+	}
+}
+
+func TestFollowWaitsForMissingLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	c := startFollow(t, path)
+
+	appendLine(t, path, `{"command":"created"}`+"\n")
+
+	got := c.waitFor(t, 1)
+	if got[0] != "created" {
+		t.Errorf("Follow() delivered %v, want [created]", got)
+	}
+}
+
+func TestTailEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeEntries(t, path+".1", Entry{Command: "a"}, Entry{Command: "b"})
+	writeEntries(t, path, Entry{Command: "c"})
+
+	entries, err := TailEntries(path, 2)
+	if err != nil {
+		t.Fatalf("TailEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Command != "b" || entries[1].Command != "c" {
+		t.Errorf("TailEntries() = %+v, want [b c]", entries)
+	}
+
+	entries, _ = TailEntries(path, 0)
+	if len(entries) != 3 {
+		t.Errorf("TailEntries(0) returned %d entries, want 3", len(entries))
+	}
+}
@@ -0,0 +1,28 @@
+package audit
+
+import "os"
+
+// lockCurrent takes an exclusive lock on f and reports whether f is still
+// the file at path. If PruneEntries replaced or removed the file while the
+// lock was awaited, the lock is released and false returned, so the caller
+// can reopen path and try again.
+func lockCurrent(f *os.File, path string) (bool, error) {
+	if err := lockFile(f); err != nil {
+		return false, err
+	}
+	opened, err := f.Stat()
+	if err != nil {
+		unlockFile(f)
+		return false, err
+	}
+	current, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		unlockFile(f)
+		return false, err
+	}
+	if err != nil || !os.SameFile(opened, current) {
+		unlockFile(f)
+		return false, nil
+	}
+	return true, nil
+}
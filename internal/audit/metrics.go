@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/constants"
+)
+
+// Metric decisions. Passthrough is recorded when the hook emitted nothing.
+var metricDecisions = []string{"allow", "ask", "deny", "passthrough"}
+
+// entryDecision returns the permission decision recorded in e's output, or
+// "passthrough" if the hook emitted nothing.
+func entryDecision(e Entry) string {
+	if e.Output == "" {
+		return "passthrough"
+	}
+	var out struct {
+		HookSpecificOutput struct {
+			PermissionDecision string `json:"permissionDecision"`
+		} `json:"hookSpecificOutput"`
+	}
+	if err := json.Unmarshal([]byte(e.Output), &out); err != nil || out.HookSpecificOutput.PermissionDecision == "" {
+		// Entries without a decision, such as ones logged for unparseable
+		// input, fall back to whether the command was approved
+		if e.Approved {
+			return "allow"
+		}
+		return "ask"
+	}
+	return out.HookSpecificOutput.PermissionDecision
+}
+
+// Metrics holds the hook decision and segment rejection code counters.
+type Metrics struct {
+	Decisions  map[string]int
+	Rejections map[string]int
+}
+
+// NewMetrics returns Metrics with every counter at zero.
+func NewMetrics() Metrics {
+	return Metrics{Decisions: make(map[string]int), Rejections: make(map[string]int)}
+}
+
+// Add counts the decision and segment rejection codes of e.
+func (m Metrics) Add(e Entry) {
+	m.Decisions[entryDecision(e)]++
+	for _, seg := range e.Segments {
+		if seg.Rejection != nil {
+			m.Rejections[seg.Rejection.Code]++
+		}
+	}
+}
+
+// FormatMetrics writes the counters in m to w, in the Prometheus text
+// exposition format.
+func FormatMetrics(w io.Writer, m Metrics) error {
+	var buf bytes.Buffer
+	buf.WriteString("# HELP mmi_decisions_total Hook decisions by outcome.\n")
+	buf.WriteString("# TYPE mmi_decisions_total counter\n")
+	// Every known decision is written, even at zero, so the series exist
+	// from the first scrape
+	names := slices.Clone(metricDecisions)
+	for decision := range m.Decisions {
+		if !slices.Contains(names, decision) {
+			names = append(names, decision)
+		}
+	}
+	slices.Sort(names)
+	for _, decision := range names {
+		fmt.Fprintf(&buf, "mmi_decisions_total{decision=%s} %d\n", strconv.Quote(decision), m.Decisions[decision])
+	}
+
+	buf.WriteString("# HELP mmi_rejections_total Rejected command segments by rejection code.\n")
+	buf.WriteString("# TYPE mmi_rejections_total counter\n")
+	codes := make([]string, 0, len(m.Rejections))
+	for code := range m.Rejections {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&buf, "mmi_rejections_total{code=%s} %d\n", strconv.Quote(code), m.Rejections[code])
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ParseMetrics reads the counters from a file written by FormatMetrics.
+// Lines that aren't mmi counters are skipped.
+func ParseMetrics(r io.Reader) (Metrics, error) {
+	m := NewMetrics()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var counters map[string]int
+		var prefix string
+		switch {
+		case strings.HasPrefix(line, "mmi_decisions_total{decision="):
+			counters, prefix = m.Decisions, "mmi_decisions_total{decision="
+		case strings.HasPrefix(line, "mmi_rejections_total{code="):
+			counters, prefix = m.Rejections, "mmi_rejections_total{code="
+		default:
+			continue
+		}
+		label, value, ok := strings.Cut(strings.TrimPrefix(line, prefix), "} ")
+		if !ok {
+			continue
+		}
+		name, err := strconv.Unquote(label)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		counters[name] = n
+	}
+	return m, scanner.Err()
+}
+
+// UpdateMetrics adds e to the counters in the metrics file at path, for a
+// textfile collector such as node_exporter's. The counters persist in the
+// file itself, so they only ever increase, even as the audit log rotates.
+// Concurrent hook runs are serialized by a lock on path + ".lock", and the
+// file is written to a temporary file in the same directory and renamed over
+// path, so a scrape never reads a partial file.
+func UpdateMetrics(path string, e Entry) error {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, constants.FileMode)
+	if err != nil {
+		return fmt.Errorf("failed to lock metrics file: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock metrics file: %w", err)
+	}
+	defer unlockFile(lock)
+
+	m := NewMetrics()
+	if f, err := os.Open(path); err == nil {
+		m, err = ParseMetrics(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read metrics file: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read metrics file: %w", err)
+	}
+	m.Add(e)
+	return writeMetricsFile(path, m)
+}
+
+// writeMetricsFile replaces the metrics file at path with m.
+func writeMetricsFile(path string, m Metrics) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := FormatMetrics(tmp, m); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	// CreateTemp creates the file readable only by its owner; the collector
+	// may run as another user
+	if err := os.Chmod(tmp.Name(), constants.FileMode); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace metrics file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFormatMetrics(t *testing.T) {
+	entries := []Entry{
+		{Approved: true, Output: `{"hookSpecificOutput":{"permissionDecision":"allow"}}`},
+		{Approved: true, Output: `{"hookSpecificOutput":{"permissionDecision":"allow"}}`},
+		{
+			Output: `{"hookSpecificOutput":{"permissionDecision":"deny"}}`,
+			Segments: []Segment{
+				{Rejection: &Rejection{Code: CodeDenyMatch}},
+				{Rejection: &Rejection{Code: CodeNoMatch}},
+			},
+		},
+		{
+			Output:   `{"hookSpecificOutput":{"permissionDecision":"ask"}}`,
+			Segments: []Segment{{Rejection: &Rejection{Code: CodeNoMatch}}},
+		},
+		{Output: "", Segments: []Segment{{Rejection: &Rejection{Code: CodeNoMatch}}}},
+	}
+
+	m := NewMetrics()
+	for _, e := range entries {
+		m.Add(e)
+	}
+
+	var sb strings.Builder
+	if err := FormatMetrics(&sb, m); err != nil {
+		t.Fatalf("FormatMetrics failed: %v", err)
+	}
+
+	want := `# HELP mmi_decisions_total Hook decisions by outcome.
+# TYPE mmi_decisions_total counter
+mmi_decisions_total{decision="allow"} 2
+mmi_decisions_total{decision="ask"} 1
+mmi_decisions_total{decision="deny"} 1
+mmi_decisions_total{decision="passthrough"} 1
+# HELP mmi_rejections_total Rejected command segments by rejection code.
+# TYPE mmi_rejections_total counter
+mmi_rejections_total{code="DENY_MATCH"} 1
+mmi_rejections_total{code="NO_MATCH"} 3
+`
+	if got := sb.String(); got != want {
+		t.Errorf("FormatMetrics() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatMetricsEmpty(t *testing.T) {
+	var sb strings.Builder
+	if err := FormatMetrics(&sb, NewMetrics()); err != nil {
+		t.Fatalf("FormatMetrics failed: %v", err)
+	}
+	for _, decision := range metricDecisions {
+		if !strings.Contains(sb.String(), `mmi_decisions_total{decision="`+decision+`"} 0`) {
+			t.Errorf("FormatMetrics(NewMetrics()) should report %s at zero:\n%s", decision, sb.String())
+		}
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Add(Entry{Output: `{"hookSpecificOutput":{"permissionDecision":"deny"}}`, Segments: []Segment{{Rejection: &Rejection{Code: CodeDenyMatch}}}})
+	m.Add(Entry{Approved: true, Output: `{"hookSpecificOutput":{"permissionDecision":"allow"}}`})
+
+	var sb strings.Builder
+	if err := FormatMetrics(&sb, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseMetrics(strings.NewReader(sb.String() + "unrelated_metric 7\n"))
+	if err != nil {
+		t.Fatalf("ParseMetrics failed: %v", err)
+	}
+	if got.Decisions["allow"] != 1 || got.Decisions["deny"] != 1 || got.Decisions["ask"] != 0 {
+		t.Errorf("Decisions = %v, want allow and deny at 1", got.Decisions)
+	}
+	if got.Rejections[CodeDenyMatch] != 1 || len(got.Rejections) != 1 {
+		t.Errorf("Rejections = %v, want DENY_MATCH at 1", got.Rejections)
+	}
+}
+
+func TestUpdateMetrics(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mmi.prom")
+
+	allow := Entry{Approved: true, Output: `{"hookSpecificOutput":{"permissionDecision":"allow"}}`}
+	ask := Entry{Output: `{"hookSpecificOutput":{"permissionDecision":"ask"}}`, Segments: []Segment{{Rejection: &Rejection{Code: CodeNoMatch}}}}
+	for _, e := range []Entry{allow, ask, allow} {
+		if err := UpdateMetrics(path, e); err != nil {
+			t.Fatalf("UpdateMetrics failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`mmi_decisions_total{decision="allow"} 2`,
+		`mmi_decisions_total{decision="ask"} 1`,
+		`mmi_rejections_total{code="NO_MATCH"} 1`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics file missing %q:\n%s", want, data)
+		}
+	}
+	files, _ := os.ReadDir(dir)
+	for _, f := range files {
+		if name := f.Name(); name != "mmi.prom" && name != "mmi.prom.lock" {
+			t.Errorf("unexpected file %s left in the metrics directory", name)
+		}
+	}
+}
+
+func TestUpdateMetricsConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mmi.prom")
+	allow := Entry{Approved: true, Output: `{"hookSpecificOutput":{"permissionDecision":"allow"}}`}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if err := UpdateMetrics(path, allow); err != nil {
+				t.Errorf("UpdateMetrics failed: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := ParseMetrics(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Decisions["allow"] != 20 {
+		t.Errorf("allow = %d, want 20", m.Decisions["allow"])
+	}
+}
@@ -0,0 +1,356 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/logger"
+)
+
+// backupSuffix matches rotated backup suffixes like ".1" or ".2.gz"
+var backupSuffix = regexp.MustCompile(`^\.(\d+)(\.gz)?$`)
+
+// maxLineSize bounds a single audit log line; entries embed the raw hook input
+// and output, so they can be much larger than bufio's 64KB default.
+const maxLineSize = 10 * 1024 * 1024
+
+// BackupFiles returns the rotated backups of the audit log at path
+// (path.1, path.2.gz, ...), ordered oldest first. Missing backups are not an error.
+func BackupFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		path  string
+		index int
+	}
+	var backups []backup
+	for _, m := range matches {
+		sub := backupSuffix.FindStringSubmatch(m[len(path):])
+		if sub == nil {
+			continue
+		}
+		index, err := strconv.Atoi(sub[1])
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: m, index: index})
+	}
+
+	// Higher indexes are older
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].index > backups[j].index
+	})
+
+	result := make([]string, len(backups))
+	for i, b := range backups {
+		result[i] = b.path
+	}
+	return result, nil
+}
+
+// RemoveExpiredBackups deletes the rotated backups of the audit log at path
+// that were last modified more than maxAge ago, and returns the paths it
+// deleted. The log itself is never deleted.
+func RemoveExpiredBackups(path string, maxAge time.Duration) ([]string, error) {
+	files, err := BackupFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var removed []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return removed, err
+		}
+		logger.Debug("removed expired audit backup", "path", file)
+		removed = append(removed, file)
+	}
+	return removed, nil
+}
+
+// Purge deletes the audit log at path and all of its rotated backups, and
+// returns the paths it deleted. Missing files are not an error.
+func Purge(path string) ([]string, error) {
+	files, err := BackupFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, path)
+
+	var removed []string
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, err
+		}
+		logger.Debug("purged audit log file", "path", file)
+		removed = append(removed, file)
+	}
+	return removed, nil
+}
+
+// PruneEntries removes the entries of the audit log at path timestamped
+// before cutoff, keeping lines it can't parse, and returns how many it
+// removed. The log is rewritten only if an entry is removed, and deleted if
+// none remain. Rotated backups are not touched; see RemoveExpiredBackups.
+// The log is locked against writers for the whole read and rewrite, so no
+// entry logged meanwhile is lost.
+func PruneEntries(path string, cutoff time.Time) (int, error) {
+	var f *os.File
+	for {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return 0, nil
+			}
+			return 0, err
+		}
+		current, err := lockCurrent(f, path)
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		if current {
+			break
+		}
+		f.Close()
+	}
+	defer f.Close()
+	defer unlockFile(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+
+	var kept []byte
+	pruned := 0
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		var entry Entry
+		if strings.TrimSpace(line) != "" && json.Unmarshal([]byte(line), &entry) == nil {
+			if ts, err := time.Parse(time.RFC3339, entry.Timestamp); err == nil && ts.Before(cutoff) {
+				pruned++
+				continue
+			}
+		}
+		kept = append(kept, line...)
+	}
+	if pruned == 0 {
+		return 0, nil
+	}
+	if strings.TrimSpace(string(kept)) == "" {
+		return pruned, os.Remove(path)
+	}
+
+	// Replace the log atomically so a crash can't lose the kept entries
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".purge-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(kept); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+// ReadEntries reads all entries from the audit log at path and its rotated
+// backups, in chronological order. Gzipped backups are decompressed. Lines
+// that aren't valid entries are skipped. A missing log file yields no entries.
+func ReadEntries(path string) ([]Entry, error) {
+	files, err := BackupFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, path)
+
+	var entries []Entry
+	for _, file := range files {
+		fileEntries, err := readEntriesFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+// readEntriesFile reads the entries from a single audit log file.
+func readEntriesFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if filepath.Ext(path) == ".gz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	return decodeEntries(r, path)
+}
+
+// decodeEntries parses JSON-lines audit entries from r. source is used for logging.
+func decodeEntries(r io.Reader, source string) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			logger.Debug("skipping malformed audit entry", "file", source, "error", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Filter selects audit entries. Zero-valued fields match everything.
+type Filter struct {
+	SessionID       string
+	Approved        *bool     // nil matches both approved and rejected entries
+	Since           time.Time // entries at or after this time
+	CommandContains string
+}
+
+// Match reports whether the entry satisfies every set criterion.
+func (f Filter) Match(e Entry) bool {
+	if f.SessionID != "" && e.SessionID != f.SessionID {
+		return false
+	}
+	if f.Approved != nil && e.Approved != *f.Approved {
+		return false
+	}
+	if f.CommandContains != "" && !strings.Contains(e.Command, f.CommandContains) {
+		return false
+	}
+	if !f.Since.IsZero() {
+		ts, err := time.Parse(time.RFC3339, e.Timestamp)
+		if err != nil || ts.Before(f.Since) {
+			return false
+		}
+	}
+	return true
+}
+
+// CommandCount is a command and the number of times it was evaluated.
+type CommandCount struct {
+	Command string `json:"command"`
+	Count   int    `json:"count"`
+}
+
+// Stats summarizes a set of audit entries.
+type Stats struct {
+	Total        int            `json:"total"`
+	Approved     int            `json:"approved"`
+	Rejected     int            `json:"rejected"`
+	ApprovalRate float64        `json:"approval_rate"`
+	Matches      map[string]int `json:"matches"`
+	Rejections   map[string]int `json:"rejections"`
+	TopCommands  []CommandCount `json:"top_commands"`
+}
+
+// ComputeStats aggregates entries by decision, matched pattern name,
+// rejection code, and command. At most topN commands are returned, most
+// frequent first; topN <= 0 returns all of them.
+func ComputeStats(entries []Entry, topN int) Stats {
+	stats := Stats{
+		Matches:     make(map[string]int),
+		Rejections:  make(map[string]int),
+		TopCommands: []CommandCount{},
+	}
+
+	commandCounts := make(map[string]int)
+	for _, e := range entries {
+		stats.Total++
+		if e.Approved {
+			stats.Approved++
+		} else {
+			stats.Rejected++
+		}
+		commandCounts[e.Command]++
+
+		for _, seg := range e.Segments {
+			if seg.Match != nil {
+				name := seg.Match.Name
+				if name == "" {
+					name = seg.Match.Type
+				}
+				stats.Matches[name]++
+			}
+			if seg.Rejection != nil {
+				stats.Rejections[seg.Rejection.Code]++
+			}
+		}
+	}
+
+	if stats.Total > 0 {
+		stats.ApprovalRate = float64(stats.Approved) / float64(stats.Total)
+	}
+
+	for cmd, count := range commandCounts {
+		stats.TopCommands = append(stats.TopCommands, CommandCount{Command: cmd, Count: count})
+	}
+	// Most frequent first, ties broken alphabetically for stable output
+	sort.Slice(stats.TopCommands, func(i, j int) bool {
+		a, b := stats.TopCommands[i], stats.TopCommands[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Command < b.Command
+	})
+	if topN > 0 && len(stats.TopCommands) > topN {
+		stats.TopCommands = stats.TopCommands[:topN]
+	}
+
+	return stats
+}
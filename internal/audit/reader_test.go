@@ -0,0 +1,346 @@
+package audit
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeEntries writes entries as JSON lines to path, gzipping if the path ends in .gz.
+func writeEntries(t *testing.T, path string, entries ...Entry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var enc *json.Encoder
+	if filepath.Ext(path) == ".gz" {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		enc = json.NewEncoder(gz)
+	} else {
+		enc = json.NewEncoder(f)
+	}
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			t.Fatalf("Failed to encode entry: %v", err)
+		}
+	}
+}
+
+func TestBackupFilesOrdering(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "audit.log")
+
+	for _, name := range []string{"audit.log", "audit.log.1", "audit.log.2.gz", "audit.log.10.gz", "audit.log.bak"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := BackupFiles(logPath)
+	if err != nil {
+		t.Fatalf("BackupFiles() error = %v", err)
+	}
+
+	want := []string{logPath + ".10.gz", logPath + ".2.gz", logPath + ".1"}
+	if len(backups) != len(want) {
+		t.Fatalf("BackupFiles() = %v, want %v", backups, want)
+	}
+	for i := range want {
+		if backups[i] != want[i] {
+			t.Errorf("BackupFiles()[%d] = %q, want %q", i, backups[i], want[i])
+		}
+	}
+}
+
+func TestRemoveExpiredBackups(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "audit.log")
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"audit.log", "audit.log.1", "audit.log.2.gz", "audit.log.3.gz", "audit.log.bak"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "audit.log.1" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	removed, err := RemoveExpiredBackups(logPath, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("RemoveExpiredBackups() error = %v", err)
+	}
+	want := []string{logPath + ".3.gz", logPath + ".2.gz"}
+	if len(removed) != len(want) || removed[0] != want[0] || removed[1] != want[1] {
+		t.Errorf("RemoveExpiredBackups() = %v, want %v", removed, want)
+	}
+
+	// The log, recent backups, and unrelated files are kept
+	for _, name := range []string{"audit.log", "audit.log.1", "audit.log.bak"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("%s should be kept: %v", name, err)
+		}
+	}
+	for _, path := range want {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed, stat error = %v", path, err)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "audit.log")
+	for _, name := range []string{"audit.log", "audit.log.1", "audit.log.2.gz", "audit.log.bak"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := Purge(logPath)
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	want := []string{logPath + ".2.gz", logPath + ".1", logPath}
+	if len(removed) != len(want) {
+		t.Fatalf("Purge() = %v, want %v", removed, want)
+	}
+	for i := range want {
+		if removed[i] != want[i] {
+			t.Errorf("Purge()[%d] = %q, want %q", i, removed[i], want[i])
+		}
+		if _, err := os.Stat(want[i]); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed, stat error = %v", want[i], err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "audit.log.bak")); err != nil {
+		t.Errorf("unrelated file should be kept: %v", err)
+	}
+
+	// Nothing left to purge is not an error
+	if removed, err := Purge(logPath); err != nil || len(removed) != 0 {
+		t.Errorf("Purge() of a missing log = %v, %v, want nothing", removed, err)
+	}
+}
+
+func TestPruneEntries(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Now()
+	stamp := func(age time.Duration) string { return now.Add(-age).UTC().Format(TimestampFormat) }
+	writeEntries(t, logPath,
+		Entry{Command: "old", Timestamp: stamp(72 * time.Hour)},
+		Entry{Command: "recent", Timestamp: stamp(time.Hour)},
+		Entry{Command: "older", Timestamp: stamp(96 * time.Hour)},
+		Entry{Command: "undated"},
+	)
+
+	pruned, err := PruneEntries(logPath, now.Add(-48*time.Hour))
+	if err != nil {
+		t.Fatalf("PruneEntries() error = %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("PruneEntries() = %d, want 2", pruned)
+	}
+	entries, err := ReadEntries(logPath)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Command != "recent" || entries[1].Command != "undated" {
+		t.Errorf("entries = %+v, want recent and undated", entries)
+	}
+
+	// A log with only old entries is deleted
+	writeEntries(t, logPath, Entry{Command: "old", Timestamp: stamp(72 * time.Hour)})
+	if pruned, err := PruneEntries(logPath, now.Add(-48*time.Hour)); err != nil || pruned != 1 {
+		t.Fatalf("PruneEntries() = %d, %v, want 1", pruned, err)
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("log should be removed, stat error = %v", err)
+	}
+}
+
+func TestPruneEntriesKeepsConcurrentWrites(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Now()
+	writeEntries(t, logPath, Entry{Command: "old", Timestamp: now.Add(-72 * time.Hour).UTC().Format(TimestampFormat)})
+
+	if err := Init(logPath, false); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer Reset()
+
+	const written = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range written {
+			if err := Log(Entry{Command: fmt.Sprintf("cmd %d", i)}); err != nil {
+				t.Errorf("Log() error = %v", err)
+			}
+		}
+	}()
+	for pruning := true; pruning; {
+		select {
+		case <-done:
+			pruning = false
+		default:
+		}
+		if _, err := PruneEntries(logPath, now.Add(-48*time.Hour)); err != nil {
+			t.Fatalf("PruneEntries() error = %v", err)
+		}
+	}
+
+	entries, err := ReadEntries(logPath)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != written {
+		t.Errorf("log has %d entries after pruning, want all %d written meanwhile", len(entries), written)
+	}
+}
+
+func TestReadEntriesIncludesBackups(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "audit.log")
+
+	writeEntries(t, logPath+".2.gz", Entry{Command: "oldest"})
+	writeEntries(t, logPath+".1", Entry{Command: "older"})
+	writeEntries(t, logPath, Entry{Command: "newest"})
+
+	entries, err := ReadEntries(logPath)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+
+	want := []string{"oldest", "older", "newest"}
+	if len(entries) != len(want) {
+		t.Fatalf("ReadEntries() returned %d entries, want %d", len(entries), len(want))
+	}
+	for i := range want {
+		if entries[i].Command != want[i] {
+			t.Errorf("entries[%d].Command = %q, want %q", i, entries[i].Command, want[i])
+		}
+	}
+}
+
+func TestReadEntriesSkipsMalformedLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "audit.log")
+
+	data := `{"command":"ls"}` + "\n" + "not json\n\n" + `{"command":"pwd"}` + "\n"
+	if err := os.WriteFile(logPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadEntries(logPath)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ReadEntries() returned %d entries, want 2", len(entries))
+	}
+}
+
+func TestReadEntriesMissingLog(t *testing.T) {
+	entries, err := ReadEntries(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("ReadEntries() returned %d entries, want 0", len(entries))
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	approved := true
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	entry := Entry{
+		SessionID: "session-1",
+		Command:   "git status",
+		Approved:  true,
+		Timestamp: now.Format(TimestampFormat),
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"session match", Filter{SessionID: "session-1"}, true},
+		{"session mismatch", Filter{SessionID: "session-2"}, false},
+		{"approved match", Filter{Approved: &approved}, true},
+		{"command contains", Filter{CommandContains: "status"}, true},
+		{"command does not contain", Filter{CommandContains: "push"}, false},
+		{"since before", Filter{Since: now.Add(-time.Hour)}, true},
+		{"since after", Filter{Since: now.Add(time.Hour)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(entry); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	entries := []Entry{
+		{Command: "git status", Approved: true, Segments: []Segment{
+			{Command: "git status", Approved: true, Match: &Match{Type: "subcommand", Name: "git"}},
+		}},
+		{Command: "git status", Approved: true, Segments: []Segment{
+			{Command: "git status", Approved: true, Match: &Match{Type: "subcommand", Name: "git"}},
+		}},
+		{Command: "ls && rm -rf /", Approved: false, Segments: []Segment{
+			{Command: "ls", Approved: true, Match: &Match{Type: "simple", Name: "read-only"}},
+			{Command: "rm -rf /", Approved: false, Rejection: &Rejection{Code: CodeDenyMatch, Name: "rm root"}},
+		}},
+		{Command: "curl example.com", Approved: false, Segments: []Segment{
+			{Command: "curl example.com", Approved: false, Rejection: &Rejection{Code: CodeNoMatch}},
+		}},
+	}
+
+	stats := ComputeStats(entries, 2)
+
+	if stats.Total != 4 || stats.Approved != 2 || stats.Rejected != 2 {
+		t.Errorf("totals = %d/%d/%d, want 4/2/2", stats.Total, stats.Approved, stats.Rejected)
+	}
+	if stats.ApprovalRate != 0.5 {
+		t.Errorf("ApprovalRate = %v, want 0.5", stats.ApprovalRate)
+	}
+	if stats.Matches["git"] != 2 || stats.Matches["read-only"] != 1 {
+		t.Errorf("Matches = %v", stats.Matches)
+	}
+	if stats.Rejections[CodeDenyMatch] != 1 || stats.Rejections[CodeNoMatch] != 1 {
+		t.Errorf("Rejections = %v", stats.Rejections)
+	}
+	if len(stats.TopCommands) != 2 {
+		t.Fatalf("TopCommands has %d entries, want 2", len(stats.TopCommands))
+	}
+	if stats.TopCommands[0] != (CommandCount{Command: "git status", Count: 2}) {
+		t.Errorf("TopCommands[0] = %+v", stats.TopCommands[0])
+	}
+	if stats.TopCommands[1].Command != "curl example.com" {
+		t.Errorf("TopCommands[1] = %+v, want alphabetical tie-break", stats.TopCommands[1])
+	}
+}
+
+func TestComputeStatsEmpty(t *testing.T) {
+	stats := ComputeStats(nil, 10)
+	if stats.Total != 0 || stats.ApprovalRate != 0 || len(stats.TopCommands) != 0 {
+		t.Errorf("ComputeStats(nil) = %+v", stats)
+	}
+}
@@ -0,0 +1,42 @@
+package audit
+
+import "regexp"
+
+// RedactionMarker replaces redacted text in audit entries.
+const RedactionMarker = "***"
+
+// Redact returns a copy of e with every match of the patterns replaced by
+// RedactionMarker in the command, reason, raw input and output, and each segment's
+// command and rejection detail. e is not modified.
+func Redact(e Entry, patterns []*regexp.Regexp) Entry {
+	if len(patterns) == 0 {
+		return e
+	}
+
+	redact := func(s string) string {
+		for _, re := range patterns {
+			s = re.ReplaceAllLiteralString(s, RedactionMarker)
+		}
+		return s
+	}
+
+	e.Command = redact(e.Command)
+	e.Reason = redact(e.Reason)
+	e.Input = redact(e.Input)
+	e.Output = redact(e.Output)
+
+	segments := make([]Segment, len(e.Segments))
+	for i, seg := range e.Segments {
+		seg.Command = redact(seg.Command)
+		if seg.Rejection != nil {
+			rejection := *seg.Rejection
+			rejection.Detail = redact(rejection.Detail)
+			seg.Rejection = &rejection
+		}
+		segments[i] = seg
+	}
+	if e.Segments != nil {
+		e.Segments = segments
+	}
+	return e
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`Bearer \S+`),
+		regexp.MustCompile(`--password \S+`),
+	}
+
+	command := `curl -H "Authorization: Bearer xyz123" https://x && login --password hunter2`
+	e := Entry{
+		Command: command,
+		Reason:  "login --password hunter2",
+		Input:   `{"tool_input":{"command":"curl -H \"Authorization: Bearer xyz123\" https://x"}}`,
+		Output:  `use "login --password hunter2"`,
+		Segments: []Segment{
+			{Command: `curl -H "Authorization: Bearer xyz123" https://x`},
+			{Command: "login --password hunter2", Rejection: &Rejection{Code: CodeRewrite, Detail: "login --password hunter2"}},
+		},
+	}
+
+	got := Redact(e, patterns)
+
+	fields := []string{got.Command, got.Reason, got.Input, got.Output, got.Segments[0].Command, got.Segments[1].Command, got.Segments[1].Rejection.Detail}
+	for _, field := range fields {
+		if strings.Contains(field, "xyz123") || strings.Contains(field, "hunter2") {
+			t.Errorf("redacted field still contains a secret: %q", field)
+		}
+		if !strings.Contains(field, RedactionMarker) {
+			t.Errorf("redacted field should contain %q: %q", RedactionMarker, field)
+		}
+	}
+
+	// The original entry is untouched
+	if e.Command != command || e.Segments[1].Rejection.Detail != "login --password hunter2" {
+		t.Error("Redact should not modify its argument")
+	}
+}
+
+func TestRedactNoPatterns(t *testing.T) {
+	e := Entry{Command: "echo secret", Segments: []Segment{{Command: "echo secret"}}}
+	if got := Redact(e, nil); got.Command != "echo secret" || got.Segments[0].Command != "echo secret" {
+		t.Errorf("Redact with no patterns = %+v, want unchanged", got)
+	}
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dgerlanc/mmi/internal/constants"
+	"github.com/dgerlanc/mmi/internal/logger"
+)
+
+// CacheDir is the subdirectory of the config directory that holds compiled
+// config caches.
+const CacheDir = "cache"
+
+// configCache is a compiled config together with everything it was built
+// from. It is only valid while each of those is unchanged.
+type configCache struct {
+	// Build identifies the mmi binary that wrote the cache, whose defaults
+	// and Config layout it reflects
+	Build string
+	// Sources are the files, include globs, and environment variables the
+	// config was built from
+	Sources loadSources
+	// Config is the compiled config. Its regexps are stored as their
+	// sources and recompiled when the cache is read.
+	Config *Config
+}
+
+// loadSources records the inputs of a config load: the files read, the
+// matches of each include glob, and the environment variables referenced.
+type loadSources struct {
+	// Files maps each file read to the hex SHA-256 of its content
+	Files map[string]string
+	// Globs maps each include glob to the files it matched, sorted
+	Globs map[string][]string
+	// Env maps each referenced environment variable to its value
+	Env map[string]string
+}
+
+// recording is the loadSources of the load in progress, or nil when the
+// current load isn't being cached.
+var recording *loadSources
+
+// readSource reads a config file, recording its hash if a load is being
+// recorded.
+func readSource(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil && recording != nil {
+		recording.Files[path] = hashBytes(data)
+	}
+	return data, err
+}
+
+// recordGlob records the files an include glob expanded to.
+func recordGlob(pattern string, matches []string) {
+	if recording != nil {
+		recording.Globs[pattern] = slices.Clone(matches)
+	}
+}
+
+// recordEnv records the value of a referenced environment variable.
+func recordEnv(name, value string) {
+	if recording != nil {
+		recording.Env[name] = value
+	}
+}
+
+// loadWithCache loads the config file at configPath, whose contents are
+// data, from its cache if none of its sources changed since the cache was
+// written. Otherwise it loads the config from data and rewrites the cache.
+// It also returns the sources of the config, which are recorded even if
+// loading fails.
+func loadWithCache(configPath string, data []byte) (*Config, loadSources, error) {
+	cachePath, build := configCachePath(configPath), buildStamp()
+	if cachePath != "" && build != "" {
+		if cache, ok := readConfigCache(cachePath, build, configPath, data); ok {
+			logger.Debug("config loaded from cache", "cache", cachePath)
+			return cache.Config, cache.Sources, nil
+		}
+	}
+
+	recording = &loadSources{
+		Files: map[string]string{configPath: hashBytes(data)},
+		Globs: make(map[string][]string),
+		Env:   make(map[string]string),
+	}
+	cfg, err := LoadConfigWithDir(data, filepath.Dir(configPath))
+	if err == nil {
+		err = mergeExtraConfigs(cfg)
+	}
+	sources := *recording
+	recording = nil
+	if err != nil {
+		return nil, sources, err
+	}
+
+	if cachePath != "" && build != "" {
+		if err := writeConfigCache(cachePath, build, sources, cfg); err != nil {
+			logger.Debug("failed to write config cache", "cache", cachePath, "error", err)
+		}
+	}
+	return cfg, sources, nil
+}
+
+// readConfigCache returns the cache at cachePath if it was written by this
+// binary and its sources are unchanged. data is the current content of
+// configPath, which has already been read.
+func readConfigCache(cachePath, build, configPath string, data []byte) (*configCache, bool) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	var cache configCache
+	if err := json.NewDecoder(f).Decode(&cache); err != nil {
+		logger.Debug("ignoring unreadable config cache", "cache", cachePath, "error", err)
+		return nil, false
+	}
+	if cache.Build != build || cache.Config == nil || cache.Sources.Files[configPath] != hashBytes(data) {
+		return nil, false
+	}
+	if !cache.Sources.unchanged() {
+		logger.Debug("config cache is stale", "cache", cachePath)
+		return nil, false
+	}
+
+	return &cache, true
+}
+
+// unchanged reports whether every recorded file, include glob, and
+// environment variable still has its recorded content, matches, or value.
+// A file recorded with an empty hash couldn't be read, and is unchanged
+// while it still can't be. A variable recorded as empty is unchanged while
+// it is unset.
+func (s loadSources) unchanged() bool {
+	for path, hash := range s.Files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if hash != "" {
+				return false
+			}
+			continue
+		}
+		if hashBytes(data) != hash {
+			return false
+		}
+	}
+	for pattern, matches := range s.Globs {
+		current, err := filepath.Glob(pattern)
+		if err != nil {
+			return false
+		}
+		slices.Sort(current)
+		if !slices.Equal(current, matches) {
+			return false
+		}
+	}
+	for name, value := range s.Env {
+		if os.Getenv(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// writeConfigCache writes the cache of cfg, built by build from sources, to
+// path. The file is replaced atomically so a concurrent reader never sees a
+// partial file.
+func writeConfigCache(path, build string, sources loadSources, cfg *Config) error {
+	data, err := json.Marshal(configCache{Build: build, Sources: sources, Config: cfg})
+	if err != nil {
+		return fmt.Errorf("failed to encode config cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), constants.DirMode); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// configCachePath returns where the cache for the config file at configPath
+// is kept: a file in the cache subdirectory of the config directory named
+// for the config file's absolute path. Returns "" if the config directory
+// can't be determined.
+func configCachePath(configPath string) string {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return ""
+	}
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, CacheDir, hashBytes([]byte(absPath))[:16]+".json")
+}
+
+// buildStamp identifies the running binary by its path, size, and
+// modification time, so a rebuilt or upgraded mmi ignores caches written
+// by another build. Returns "" if the binary can't be found.
+func buildStamp() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %d %d", exe, info.Size(), info.ModTime().UnixNano())
+}
+
+// hashBytes returns the hex SHA-256 of data.
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
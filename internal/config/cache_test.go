@@ -0,0 +1,271 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// initCacheTest points Init at a temp config directory holding files, which
+// maps names relative to the directory to their content, and returns the
+// directory.
+func initCacheTest(t *testing.T, files map[string]string) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	t.Setenv("MMI_CONFIG", tmpDir)
+	for name, content := range files {
+		writeCacheTestFile(t, tmpDir, name, content)
+	}
+	t.Cleanup(Reset)
+	return tmpDir
+}
+
+func writeCacheTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reinit reloads the config as a new mmi process would and returns the names
+// of its safe command patterns.
+func reinit(t *testing.T) []string {
+	t.Helper()
+	Reset()
+	if err := Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	var names []string
+	for _, p := range Get().SafeCommands {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestInitWritesAndUsesConfigCache(t *testing.T) {
+	data := `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+
+[tools.Read]
+field = "file_path"
+allow = ['^/src/']
+
+[audit]
+redact = ['token=\S+']
+`
+	tmpDir := initCacheTest(t, map[string]string{"config.toml": data})
+	configPath := filepath.Join(tmpDir, "config.toml")
+	reinit(t)
+
+	cachePath := configCachePath(configPath)
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Fatalf("cache file not written: %v", err)
+	}
+
+	// Rewrite the cache with a renamed pattern so a load from it is
+	// distinguishable from a load from config.toml
+	cfg, err := LoadConfig([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SafeCommands[0].Name = "from-cache"
+	sources := loadSources{Files: map[string]string{configPath: hashBytes([]byte(data))}}
+	if err := writeConfigCache(cachePath, buildStamp(), sources, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := reinit(t); !slices.Equal(names, []string{"from-cache"}) {
+		t.Fatalf("SafeCommands = %v, want the cached config", names)
+	}
+	cached := Get()
+	if re := cached.SafeCommands[0].Regex; re == nil || !re.MatchString("ls -la") {
+		t.Errorf("cached SafeCommands[0].Regex = %v, want a regexp matching ls -la", re)
+	}
+	if re := cached.Tools["Read"].Allow[0].Regex; re == nil || !re.MatchString("/src/main.go") {
+		t.Errorf("cached tool regexp = %v, want a regexp matching /src/main.go", re)
+	}
+	if len(cached.Audit.Redact) != 1 || len(cached.Security.DangerousWrappers) != len(DefaultDangerousWrappers) {
+		t.Errorf("cached Redact = %v, DangerousWrappers = %v, want them restored", cached.Audit.Redact, cached.Security.DangerousWrappers)
+	}
+}
+
+func TestConfigCacheInvalidatedByConfigChange(t *testing.T) {
+	tmpDir := initCacheTest(t, map[string]string{"config.toml": `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`})
+	reinit(t)
+
+	writeCacheTestFile(t, tmpDir, "config.toml", `
+[[commands.simple]]
+name = "build"
+commands = ["make"]
+`)
+	if names := reinit(t); !slices.Equal(names, []string{"build"}) {
+		t.Errorf("SafeCommands = %v, want [build] after the config changed", names)
+	}
+}
+
+func TestConfigCacheInvalidatedByIncludeChange(t *testing.T) {
+	tmpDir := initCacheTest(t, map[string]string{
+		"config.toml": `include = ["extra.toml"]`,
+		"extra.toml": `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`,
+	})
+	reinit(t)
+
+	writeCacheTestFile(t, tmpDir, "extra.toml", `
+[[commands.simple]]
+name = "build"
+commands = ["make"]
+`)
+	if names := reinit(t); !slices.Equal(names, []string{"build"}) {
+		t.Errorf("SafeCommands = %v, want [build] after the include changed", names)
+	}
+}
+
+func TestConfigCacheInvalidatedByNewGlobMatch(t *testing.T) {
+	tmpDir := initCacheTest(t, map[string]string{
+		"config.toml": `include = ["conf.d/*.toml"]`,
+		"conf.d/a.toml": `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`,
+	})
+	reinit(t)
+
+	writeCacheTestFile(t, tmpDir, "conf.d/b.toml", `
+[[commands.simple]]
+name = "build"
+commands = ["make"]
+`)
+	if names := reinit(t); !slices.Equal(names, []string{"read-only", "build"}) {
+		t.Errorf("SafeCommands = %v, want [read-only build] after a new file matched the include", names)
+	}
+}
+
+func TestConfigCacheInvalidatedByProfileChange(t *testing.T) {
+	tmpDir := initCacheTest(t, map[string]string{
+		"config.toml": `extends = "base"`,
+		"profiles/base.toml": `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`,
+	})
+	reinit(t)
+
+	writeCacheTestFile(t, tmpDir, "profiles/base.toml", `
+[[commands.simple]]
+name = "build"
+commands = ["make"]
+`)
+	if names := reinit(t); !slices.Equal(names, []string{"build"}) {
+		t.Errorf("SafeCommands = %v, want [build] after the profile changed", names)
+	}
+}
+
+func TestConfigCacheInvalidatedByEnvChange(t *testing.T) {
+	t.Setenv("MMI_CACHE_TEST_TOOL", "ls")
+	initCacheTest(t, map[string]string{"config.toml": `
+[[commands.simple]]
+name = "tool"
+commands = ["$MMI_CACHE_TEST_TOOL"]
+`})
+	reinit(t)
+
+	t.Setenv("MMI_CACHE_TEST_TOOL", "make")
+	reinit(t)
+	if got := Get().SafeCommands[0].Regex; !got.MatchString("make") || got.MatchString("ls") {
+		t.Errorf("SafeCommands[0] = %q, want a pattern for make after the variable changed", got)
+	}
+}
+
+func TestConfigCachePreservesEmptyAllowedEnvVars(t *testing.T) {
+	initCacheTest(t, map[string]string{"config.toml": `
+[security]
+allowed_env_vars = []
+`})
+	reinit(t)
+	reinit(t)
+
+	if got := Get().Security.AllowedEnvVars; got == nil || len(got) != 0 {
+		t.Errorf("AllowedEnvVars = %#v after loading from cache, want empty (no variables allowed)", got)
+	}
+}
+
+func TestConfigCacheRoundTripsPresets(t *testing.T) {
+	for _, name := range Presets() {
+		t.Run(name, func(t *testing.T) {
+			data, err := GetPreset(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "config.toml")
+			writeCacheTestFile(t, dir, "config.toml", string(data))
+			path := filepath.Join(dir, "cache.json")
+			sources := loadSources{Files: map[string]string{configPath: hashBytes(data)}}
+			if err := writeConfigCache(path, "build", sources, cfg); err != nil {
+				t.Fatal(err)
+			}
+			cached, ok := readConfigCache(path, "build", configPath, data)
+			if !ok {
+				t.Fatal("readConfigCache() rejected a fresh cache")
+			}
+			if !reflect.DeepEqual(cached.Config, cfg) {
+				t.Errorf("cached config differs from the loaded config:\n got %+v\nwant %+v", cached.Config, cfg)
+			}
+		})
+	}
+}
+
+func TestConfigCacheInvalidatedByExtraConfigChange(t *testing.T) {
+	extraDir := t.TempDir()
+	writeCacheTestFile(t, extraDir, "config.toml", `
+[[commands.simple]]
+name = "team"
+commands = ["make"]
+`)
+	t.Setenv("MMI_CONFIG_EXTRA", extraDir)
+	initCacheTest(t, map[string]string{"config.toml": `
+[[commands.simple]]
+name = "personal"
+commands = ["ls"]
+`})
+	if got := reinit(t); !slices.Equal(got, []string{"personal", "team"}) {
+		t.Fatalf("SafeCommands = %v, want [personal team]", got)
+	}
+
+	writeCacheTestFile(t, extraDir, "config.toml", `
+[[commands.simple]]
+name = "team v2"
+commands = ["make"]
+`)
+	if got := reinit(t); !slices.Equal(got, []string{"personal", "team v2"}) {
+		t.Errorf("SafeCommands = %v, want the changed extra config", got)
+	}
+
+	t.Setenv("MMI_CONFIG_EXTRA", "")
+	if got := reinit(t); !slices.Equal(got, []string{"personal"}) {
+		t.Errorf("SafeCommands = %v, want only the main config once MMI_CONFIG_EXTRA is cleared", got)
+	}
+}
@@ -2,11 +2,17 @@
 package config
 
 import (
+	"cmp"
 	_ "embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/dgerlanc/mmi/internal/constants"
@@ -17,12 +23,100 @@ import (
 //go:embed config.toml
 var defaultConfig []byte
 
+//go:embed project.toml
+var projectTemplate []byte
+
+// SchemaVersion is the version of the config file format. It changes when a
+// config that loaded before would load differently.
+const SchemaVersion = 1
+
+// schemaChanges describes what changed in each schema version, for the
+// warning shown when a config declares an older one. Version 0 is a config
+// without schema_version.
+var schemaChanges = map[int]string{
+	1: "schema_version was introduced; no fields were renamed or removed",
+}
+
+// ProfilesDir is the subdirectory of the config directory that holds
+// profiles referenced by extends.
+const ProfilesDir = "profiles"
+
+// DefaultXargsCommands is used when the config has no [xargs] section.
+var DefaultXargsCommands = []string{"xargs"}
+
+// DefaultProtectedWritePaths is used when the config doesn't set
+// [security] protected_write_paths.
+var DefaultProtectedWritePaths = []string{
+	"/etc/*",
+	"~/.ssh/*",
+	"~/.bashrc",
+	"~/.bash_profile",
+	"~/.profile",
+	"~/.zshrc",
+	"~/.zprofile",
+}
+
+// DefaultDangerousWrappers is used when the config doesn't set
+// [security] dangerous_wrappers: env clearing or splitting the environment
+// it passes on, and nice raising priority.
+var DefaultDangerousWrappers = []string{
+	`^env\s+(-i|--ignore-environment|-)(\s|$)`,
+	`^env\s+(-S|--split-string)`,
+	`^nice\s+(-n\s*|--adjustment=|-)-\d+`,
+}
+
+// DefaultMatchTimeout is used when the config doesn't set
+// [limits] match_timeout_ms.
+const DefaultMatchTimeout = 50 * time.Millisecond
+
+// DefaultProtectedEnvVars is used when the config doesn't set
+// [security] protected_env_vars.
+var DefaultProtectedEnvVars = []string{
+	"LD_PRELOAD",
+	"LD_LIBRARY_PATH",
+	"LD_AUDIT",
+	"DYLD_INSERT_LIBRARIES",
+	"DYLD_LIBRARY_PATH",
+	"PATH",
+	"IFS",
+	"BASH_ENV",
+	"ENV",
+}
+
+// DefaultInterpreters is used when the config doesn't set
+// [security] interpreters: the shells and scripting languages that run a
+// program read from stdin.
+var DefaultInterpreters = []string{
+	"sh",
+	"bash",
+	"zsh",
+	"dash",
+	"ksh",
+	"python",
+	"python3",
+	"node",
+	"perl",
+	"ruby",
+}
+
 const (
 	UnmatchedAsk         = "ask"
 	UnmatchedPassthrough = "passthrough"
 	UnmatchedDeny        = "deny"
 )
 
+// Decisions for commands that can't be parsed, set by [security] unparseable.
+const (
+	UnparseableAsk  = "ask"
+	UnparseableDeny = "deny"
+)
+
+// Decisions for commands with nothing to run, set by [security] empty_command.
+const (
+	EmptyCommandAsk   = "ask"
+	EmptyCommandAllow = "allow"
+)
+
 // Config holds the compiled patterns from configuration.
 type Config struct {
 	// WrapperPatterns are safe prefixes that can wrap commands
@@ -31,6 +125,13 @@ type Config struct {
 	SafeCommands []patterns.Pattern
 	// DenyPatterns are patterns that are always rejected (checked before approval)
 	DenyPatterns []patterns.Pattern
+	// AllowOverrides are patterns that approve a command even if it matches
+	// a deny pattern, for narrow exceptions to broad deny rules
+	AllowOverrides []patterns.Pattern
+	// DescriptionAllow and DescriptionDeny are patterns matched against the
+	// description Claude gives a Bash command, not the command itself
+	DescriptionAllow []patterns.Pattern
+	DescriptionDeny  []patterns.Pattern
 	// SubshellAllowAll when true skips command substitution rejection
 	SubshellAllowAll bool
 	// RewriteRules are patterns that trigger command rewrite suggestions
@@ -38,6 +139,130 @@ type Config struct {
 	// Unmatched controls behavior when a command doesn't match any pattern.
 	// Valid values: "ask" (default), "passthrough", "deny"
 	Unmatched string
+	// Security holds opt-in relaxations of built-in structural checks
+	Security Security
+	// XargsCommands are commands that run the command given as their
+	// arguments, like xargs. The inner command is validated separately.
+	XargsCommands []string
+	// Tools configures approval of non-Bash tools, keyed by tool name
+	Tools map[string]ToolConfig
+	// Audit holds the [audit] settings
+	Audit Audit
+	// Limits holds the [limits] settings
+	Limits Limits
+	// Metrics holds the [metrics] settings
+	Metrics Metrics
+	// Output holds the [output] settings
+	Output Output
+	// Warnings are non-fatal problems found while loading, such as
+	// regex patterns that are likely to match slowly
+	Warnings []string
+	// SchemaVersion is the schema_version declared by the loaded file, or 0
+	SchemaVersion int
+	// Profile is the profile named by the loaded file's extends, or ""
+	Profile string
+}
+
+// Security holds the [security] settings. All options except
+// AllowMultiline default to the strictest behavior.
+type Security struct {
+	// AllowProcessSubstitution when true skips process substitution
+	// (<(...) and >(...)) rejection
+	AllowProcessSubstitution bool
+	// AllowSubshells when true permits $(...) command substitution if every
+	// command inside it is approved on its own
+	AllowSubshells bool
+	// AllowBackticks when true permits `...` command substitution under the
+	// same condition
+	AllowBackticks bool
+	// ProtectedWritePaths are glob patterns for files that output
+	// redirections may not write to. A pattern also protects everything
+	// below a directory it matches.
+	ProtectedWritePaths []string
+	// ProtectedEnvVars are environment variable names that may not be
+	// assigned before a command, as in LD_PRELOAD=x cmd or env PATH=x cmd
+	ProtectedEnvVars []string
+	// AllowedEnvVars, when non-nil, are the only environment variable names
+	// that may be assigned before a command
+	AllowedEnvVars []string
+	// DangerousWrappers match wrapper invocations that are rejected even
+	// though the wrapper is allowed, such as env -i. Each is matched against
+	// the text a wrapper is stripped from.
+	DangerousWrappers []*regexp.Regexp
+	// Interpreters are the commands that run a program read from stdin.
+	// Piping downloaded, decoded, or any other content into one, or feeding
+	// it a here-string, is rejected.
+	Interpreters []string
+	// Unparseable is the decision for commands that can't be parsed:
+	// "ask" (default) or "deny"
+	Unparseable string
+	// EmptyCommand is the decision for commands that are empty or contain
+	// only whitespace or comments: "ask" (default) or "allow"
+	EmptyCommand string
+	// IgnoreSegmentDeny when true gives a command whose segments match the
+	// deny list or no pattern the unmatched decision instead of a deny. Set
+	// by any_deny_denies_all = false; the zero value denies such a command.
+	IgnoreSegmentDeny bool
+	// AllowPartialApproval when true approves a command whose segments that
+	// aren't approved merely match no pattern, as long as one is approved.
+	// Set by require_all_allow = false; the zero value requires every
+	// segment to be approved.
+	AllowPartialApproval bool
+	// AllowMultiline when true (default) evaluates commands that contain
+	// newlines. When false they are denied before parsing.
+	AllowMultiline bool
+	// AllowDeclarations when true approves export, local, declare, typeset,
+	// and readonly segments with literal values. Protected variables are
+	// still denied.
+	AllowDeclarations bool
+}
+
+// Metrics holds the [metrics] settings.
+type Metrics struct {
+	// File is where a Prometheus textfile of decision and rejection counters
+	// is written after each hook run. Empty disables it.
+	File string
+}
+
+// Output holds the [output] settings.
+type Output struct {
+	// ApprovalReasonTemplate builds the reason sent with approvals from the
+	// ApprovalPlaceholders. Empty sends the matched pattern names.
+	ApprovalReasonTemplate string
+	// NearMissHints when true adds near-miss hints to the reason sent for
+	// unmatched commands, such as which subcommands are allowed
+	NearMissHints bool
+}
+
+// ApprovalPlaceholders are the placeholders an approval_reason_template may
+// use: the matched pattern names as joined by default, the number of
+// segments, and the full command.
+var ApprovalPlaceholders = []string{"{matched}", "{segments}", "{command}"}
+
+// placeholderRegex matches a {name} placeholder in a template.
+var placeholderRegex = regexp.MustCompile(`\{[A-Za-z_]+\}`)
+
+// Limits holds the [limits] settings.
+type Limits struct {
+	// MatchTimeout bounds each deny and safe pattern check on a segment.
+	// A segment whose check runs longer is rejected. Zero disables it.
+	MatchTimeout time.Duration
+}
+
+// Audit holds the [audit] settings.
+type Audit struct {
+	// Redact are patterns whose matches are replaced with "***" before
+	// commands are written to the audit log
+	Redact []*regexp.Regexp
+	// Output is where audit entries are written: "stderr", a file path, or
+	// "" for the default file
+	Output string
+	// MaxAge is how long rotated backups of the audit log file are kept;
+	// older backups are deleted. Zero keeps them indefinitely.
+	MaxAge time.Duration
+	// ResolvePaths when true records the absolute path of programs run by a
+	// relative path, like ./deploy.sh, in each audit segment
+	ResolvePaths bool
 }
 
 var (
@@ -49,8 +274,42 @@ var (
 	globalInitError error
 	// globalConfigPath stores the config file path used by Init()
 	globalConfigPath string
+	// globalSources records what the loaded configuration was built from
+	globalSources loadSources
+	// configFileOverride is an explicit config file set by SetConfigFile
+	configFileOverride string
+	// defaultsWhenMissing is set by SetDefaultsWhenMissing
+	defaultsWhenMissing bool
 )
 
+// SetConfigFile makes Init load exactly the file at path instead of
+// config.toml in the config directory. Includes and profiles are resolved
+// relative to the file's directory. An empty path restores the default.
+func SetConfigFile(path string) {
+	configFileOverride = path
+}
+
+// SetDefaultsWhenMissing makes Init fall back to the embedded default config,
+// the one mmi init writes, when the config file doesn't exist, instead of the
+// empty config that asks about every command. A config file that exists but
+// fails to load still falls back to the empty config.
+func SetDefaultsWhenMissing(enabled bool) {
+	defaultsWhenMissing = enabled
+}
+
+// GetConfigFile returns the config file Init loads: the file set with
+// SetConfigFile, or config.toml in the config directory.
+func GetConfigFile() (string, error) {
+	if configFileOverride != "" {
+		return configFileOverride, nil
+	}
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, constants.ConfigFileName), nil
+}
+
 // GetConfigDir returns the config directory path.
 // Uses MMI_CONFIG env var if set, otherwise ~/.config/mmi
 func GetConfigDir() (string, error) {
@@ -94,7 +353,11 @@ func parseSection(sectionData map[string]any, isWrapper bool, sectionName string
 		case "simple":
 			entries := toMapSlice(value)
 			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
 				name, _ := entry["name"].(string)
+				exact, _ := entry["exact"].(bool)
+				ignoreCase, _ := entry["ignore_case"].(bool)
 				cmds := toStringSlice(entry["commands"])
 				if len(cmds) == 0 {
 					if name != "" {
@@ -102,76 +365,235 @@ func parseSection(sectionData map[string]any, isWrapper bool, sectionName string
 					}
 					return nil, fmt.Errorf("%s.simple[%d]: \"commands\" field is required and must not be empty", sectionName, i)
 				}
+				minArgs, maxArgs, err := entryArgLimits(entry, fmt.Sprintf("%s.simple[%d]", sectionName, i), isWrapper)
+				if err != nil {
+					return nil, err
+				}
 				for _, cmd := range cmds {
 					var pattern string
 					var patternName string
 					if isWrapper {
-						pattern = patterns.BuildWrapperPattern(cmd, nil)
+						pattern = patterns.BuildWrapperPattern(cmd, nil, nil)
 						patternName = cmd
+					} else if exact {
+						pattern = patterns.BuildExactPattern(cmd)
+						patternName = name
 					} else {
 						pattern = patterns.BuildSimplePattern(cmd)
 						patternName = name
 					}
+					pattern = withIgnoreCase(pattern, ignoreCase)
 					re, err := regexp.Compile(pattern)
 					if err != nil {
 						return nil, fmt.Errorf("invalid pattern for command %q: %w", cmd, err)
 					}
-					result = append(result, patterns.Pattern{Regex: re, Name: patternName, Type: "simple", Pattern: pattern})
+					result = append(result, patterns.Pattern{Regex: re, Name: patternName, Type: "simple", Pattern: pattern, Command: cmd, MinArgs: minArgs, MaxArgs: maxArgs, Priority: priority, Note: note})
+				}
+			}
+
+		case "builtin":
+			// [[commands.builtin]] commands = ["cd", "pushd"]
+			if isWrapper {
+				return nil, fmt.Errorf("%s.builtin is not supported; builtins can't wrap commands", sectionName)
+			}
+			for i, entry := range toMapSlice(value) {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
+				name, _ := entry["name"].(string)
+				builtins := toStringSlice(entry["commands"])
+				if len(builtins) == 0 {
+					if name != "" {
+						return nil, fmt.Errorf("%s.builtin[%d] %q: \"commands\" field is required and must not be empty", sectionName, i, name)
+					}
+					return nil, fmt.Errorf("%s.builtin[%d]: \"commands\" field is required and must not be empty", sectionName, i)
+				}
+				for _, builtin := range builtins {
+					pattern, ok := patterns.BuildBuiltinPattern(builtin)
+					if !ok {
+						return nil, fmt.Errorf("%s.builtin[%d]: unknown builtin %q (supported: %s)", sectionName, i, builtin, strings.Join(patterns.Builtins(), ", "))
+					}
+					patternName := name
+					if patternName == "" {
+						patternName = builtin
+					}
+					re, err := regexp.Compile(pattern)
+					if err != nil {
+						return nil, fmt.Errorf("invalid pattern for builtin %q: %w", builtin, err)
+					}
+					result = append(result, patterns.Pattern{Regex: re, Name: patternName, Type: "builtin", Pattern: pattern, Command: builtin, Priority: priority, Note: note})
 				}
 			}
 
 		case "command":
 			entries := toMapSlice(value)
 			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
 				cmd, _ := entry["command"].(string)
 				if cmd == "" {
 					return nil, fmt.Errorf("%s.command[%d]: \"command\" field is required and must not be empty", sectionName, i)
 				}
 				flags := toStringSlice(entry["flags"])
-				pattern := patterns.BuildWrapperPattern(cmd, flags)
+				args := toStringSlice(entry["args"])
+				pattern := patterns.BuildWrapperPattern(cmd, flags, args)
 				re, err := regexp.Compile(pattern)
 				if err != nil {
 					return nil, fmt.Errorf("invalid pattern for command %q: %w", cmd, err)
 				}
-				result = append(result, patterns.Pattern{Regex: re, Name: cmd, Type: "command", Pattern: pattern})
+				result = append(result, patterns.Pattern{Regex: re, Name: cmd, Type: "command", Pattern: pattern, Command: cmd, Priority: priority, Note: note})
 			}
 
 		case "subcommand":
 			entries := toMapSlice(value)
 			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
 				cmd, _ := entry["command"].(string)
 				if cmd == "" {
 					return nil, fmt.Errorf("%s.subcommand[%d]: \"command\" field is required and must not be empty", sectionName, i)
 				}
 				subs := toStringSlice(entry["subcommands"])
 				flags := toStringSlice(entry["flags"])
-				if len(subs) == 0 {
-					return nil, fmt.Errorf("%s.subcommand[%d] %q: \"subcommands\" field is required and must not be empty", sectionName, i, cmd)
+				denied := toStringSlice(entry["denied_subcommands"])
+				if len(subs) == 0 && len(denied) == 0 {
+					return nil, fmt.Errorf("%s.subcommand[%d] %q: \"subcommands\" or \"denied_subcommands\" field is required and must not be empty", sectionName, i, cmd)
+				}
+				minArgs, maxArgs, err := entryArgLimits(entry, fmt.Sprintf("%s.subcommand[%d] %q", sectionName, i, cmd), isWrapper)
+				if err != nil {
+					return nil, err
+				}
+				// With only denied subcommands, every other use of the command is allowed
+				pattern := patterns.BuildSimplePattern(cmd)
+				if len(subs) > 0 {
+					pattern = patterns.BuildSubcommandPattern(cmd, subs, flags)
+				}
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("invalid pattern for command %q: %w", cmd, err)
+				}
+				var except *regexp.Regexp
+				if len(denied) > 0 {
+					if isWrapper {
+						return nil, fmt.Errorf("%s.subcommand[%d] %q: \"denied_subcommands\" is not supported for wrappers", sectionName, i, cmd)
+					}
+					except, err = regexp.Compile(patterns.BuildDeniedSubcommandPattern(cmd, denied))
+					if err != nil {
+						return nil, fmt.Errorf("invalid denied_subcommands for command %q: %w", cmd, err)
+					}
+				}
+				result = append(result, patterns.Pattern{
+					Regex:             re,
+					Name:              cmd,
+					Type:              "subcommand",
+					Pattern:           pattern,
+					Command:           cmd,
+					Subcommands:       subs,
+					Except:            except,
+					DeniedSubcommands: denied,
+					MinArgs:           minArgs,
+					MaxArgs:           maxArgs,
+					Priority:          priority,
+					Note:              note,
+				})
+			}
+
+		case "anyof":
+			entries := toMapSlice(value)
+			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
+				cmd, _ := entry["command"].(string)
+				if cmd == "" {
+					return nil, fmt.Errorf("%s.anyof[%d]: \"command\" field is required and must not be empty", sectionName, i)
+				}
+				groupEntries := toMapSlice(entry["groups"])
+				if len(groupEntries) == 0 {
+					return nil, fmt.Errorf("%s.anyof[%d] %q: \"groups\" field is required and must not be empty", sectionName, i, cmd)
+				}
+				var groups []patterns.SubcommandGroup
+				var allSubs []string
+				for j, g := range groupEntries {
+					subs := toStringSlice(g["subcommands"])
+					if len(subs) == 0 {
+						return nil, fmt.Errorf("%s.anyof[%d] %q: groups[%d] \"subcommands\" field is required and must not be empty", sectionName, i, cmd, j)
+					}
+					groups = append(groups, patterns.SubcommandGroup{Subcommands: subs, Flags: toStringSlice(g["flags"])})
+					allSubs = append(allSubs, subs...)
+				}
+				pattern := patterns.BuildAnyOfPattern(cmd, groups)
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("invalid pattern for command %q: %w", cmd, err)
+				}
+				result = append(result, patterns.Pattern{
+					Regex:       re,
+					Name:        cmd,
+					Type:        "anyof",
+					Pattern:     pattern,
+					Command:     cmd,
+					Subcommands: allSubs,
+					Priority:    priority,
+					Note:        note,
+				})
+			}
+
+		case "pathrestricted":
+			entries := toMapSlice(value)
+			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
+				cmd, _ := entry["command"].(string)
+				if cmd == "" {
+					return nil, fmt.Errorf("%s.pathrestricted[%d]: \"command\" field is required and must not be empty", sectionName, i)
+				}
+				allowed := toStringSlice(entry["allowed_prefixes"])
+				denied := toStringSlice(entry["denied_prefixes"])
+				if len(allowed) == 0 && len(denied) == 0 {
+					return nil, fmt.Errorf("%s.pathrestricted[%d] %q: at least one of \"allowed_prefixes\" or \"denied_prefixes\" is required", sectionName, i, cmd)
 				}
-				pattern := patterns.BuildSubcommandPattern(cmd, subs, flags)
+				pattern := patterns.BuildSimplePattern(cmd)
 				re, err := regexp.Compile(pattern)
 				if err != nil {
 					return nil, fmt.Errorf("invalid pattern for command %q: %w", cmd, err)
 				}
-				result = append(result, patterns.Pattern{Regex: re, Name: cmd, Type: "subcommand", Pattern: pattern})
+				result = append(result, patterns.Pattern{
+					Regex:           re,
+					Name:            cmd,
+					Type:            "pathrestricted",
+					Pattern:         pattern,
+					Command:         cmd,
+					AllowedPrefixes: allowed,
+					DeniedPrefixes:  denied,
+					Priority:        priority,
+					Note:            note,
+				})
 			}
 
 		case "regex":
 			entries := toMapSlice(value)
 			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
 				pattern, _ := entry["pattern"].(string)
 				patternName, _ := entry["name"].(string)
+				ignoreCase, _ := entry["ignore_case"].(bool)
+				multiline, _ := entry["multiline"].(bool)
 				if pattern == "" {
 					if patternName != "" {
 						return nil, fmt.Errorf("%s.regex[%d] %q: \"pattern\" field is required and must not be empty", sectionName, i, patternName)
 					}
 					return nil, fmt.Errorf("%s.regex[%d]: \"pattern\" field is required and must not be empty", sectionName, i)
 				}
+				minArgs, maxArgs, err := entryArgLimits(entry, fmt.Sprintf("%s.regex[%d]", sectionName, i), isWrapper)
+				if err != nil {
+					return nil, err
+				}
+				pattern = withMultiline(withIgnoreCase(pattern, ignoreCase), multiline)
 				re, err := regexp.Compile(pattern)
 				if err != nil {
 					return nil, fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
 				}
-				result = append(result, patterns.Pattern{Regex: re, Name: patternName, Type: "regex", Pattern: pattern})
+				result = append(result, patterns.Pattern{Regex: re, Name: patternName, Type: "regex", Pattern: pattern, MinArgs: minArgs, MaxArgs: maxArgs, Priority: priority, Note: note})
 			}
 		}
 	}
@@ -179,6 +601,59 @@ func parseSection(sectionData map[string]any, isWrapper bool, sectionName string
 	return result, nil
 }
 
+// withIgnoreCase returns pattern with the case-insensitive flag set when the
+// entry has ignore_case = true. The flag only applies to that pattern.
+func withIgnoreCase(pattern string, ignoreCase bool) string {
+	if !ignoreCase {
+		return pattern
+	}
+	return "(?i)" + pattern
+}
+
+// withMultiline returns pattern with the multi-line flag set when the regex
+// entry has multiline = true, so ^ and $ match at the start and end of each
+// line of the command rather than only of the whole command.
+func withMultiline(pattern string, multiline bool) string {
+	if !multiline {
+		return pattern
+	}
+	return "(?m)" + pattern
+}
+
+// entryArgLimits returns the optional min_args and max_args fields of the
+// pattern entry at where, which bound its positional arguments. They must not
+// be negative, min_args must not exceed max_args, and wrappers can't set them.
+func entryArgLimits(entry map[string]any, where string, isWrapper bool) (minArgs, maxArgs *int, err error) {
+	for _, field := range []struct {
+		name  string
+		limit **int
+	}{{"min_args", &minArgs}, {"max_args", &maxArgs}} {
+		value, ok := entry[field.name]
+		if !ok {
+			continue
+		}
+		n, isInt := value.(int64)
+		if !isInt || n < 0 {
+			return nil, nil, fmt.Errorf("%s: %q must be a non-negative integer", where, field.name)
+		}
+		if isWrapper {
+			return nil, nil, fmt.Errorf("%s: %q is not supported for wrappers", where, field.name)
+		}
+		limit := int(n)
+		*field.limit = &limit
+	}
+	if minArgs != nil && maxArgs != nil && *minArgs > *maxArgs {
+		return nil, nil, fmt.Errorf("%s: \"min_args\" (%d) must not exceed \"max_args\" (%d)", where, *minArgs, *maxArgs)
+	}
+	return minArgs, maxArgs, nil
+}
+
+// entryPriority returns the optional priority field of a pattern entry.
+func entryPriority(entry map[string]any) int {
+	priority, _ := entry["priority"].(int64)
+	return int(priority)
+}
+
 // toStringSlice converts an interface{} to []string
 func toStringSlice(v any) []string {
 	if v == nil {
@@ -226,7 +701,74 @@ func LoadConfig(data []byte) (*Config, error) {
 
 // LoadConfigWithDir loads the config from TOML data with a base directory for includes.
 func LoadConfigWithDir(data []byte, configDir string) (*Config, error) {
-	return loadConfigWithIncludes(data, configDir, make(map[string]bool))
+	cfg, err := loadConfigWithIncludes(data, configDir, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	if warning := schemaWarning(cfg.SchemaVersion); warning != "" {
+		cfg.Warnings = append(cfg.Warnings, warning)
+	}
+	if cfg.Security.AllowPartialApproval {
+		cfg.Warnings = append(cfg.Warnings, "[security] require_all_allow = false approves commands with segments that match no pattern, such as the second half of \"ls && rm -rf ~\"")
+	}
+	sortByPriority(cfg.SafeCommands)
+	sortByPriority(cfg.DenyPatterns)
+	sortByPriority(cfg.AllowOverrides)
+	sortByPriority(cfg.DescriptionAllow)
+	sortByPriority(cfg.DescriptionDeny)
+	return cfg, nil
+}
+
+// schemaWarning describes the changes since a config's declared schema
+// version, or returns "" if it is current.
+func schemaWarning(version int) string {
+	if version > SchemaVersion {
+		return fmt.Sprintf("schema_version %d is newer than this mmi supports (%d); upgrade mmi", version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return ""
+	}
+	var changes []string
+	for v := version + 1; v <= SchemaVersion; v++ {
+		changes = append(changes, fmt.Sprintf("version %d: %s", v, schemaChanges[v]))
+	}
+	declared := fmt.Sprintf("schema_version %d is older than the current version %d", version, SchemaVersion)
+	if version == 0 {
+		declared = fmt.Sprintf("schema_version is missing; the current version is %d", SchemaVersion)
+	}
+	return fmt.Sprintf("%s (%s); review the config and set schema_version = %d", declared, strings.Join(changes, "; "), SchemaVersion)
+}
+
+// sortByPriority orders pats by descending priority, keeping config order
+// among patterns with the same priority.
+func sortByPriority(pats []patterns.Pattern) {
+	slices.SortStableFunc(pats, func(a, b patterns.Pattern) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+}
+
+// includeGlobChars are the characters that make an include entry a glob.
+const includeGlobChars = "*?["
+
+// resolveInclude returns the files an include entry names, relative to
+// configDir. An entry containing glob metacharacters (*, ?, [) is expanded
+// to its matches in sorted order, and may match nothing; any other entry
+// names a single file.
+func resolveInclude(configDir, include string) ([]string, error) {
+	includePath := filepath.Join(configDir, include)
+	if !strings.ContainsAny(include, includeGlobChars) {
+		return []string{includePath}, nil
+	}
+	matches, err := filepath.Glob(includePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern %q: %w", include, err)
+	}
+	if len(matches) == 0 {
+		logger.Debug("include pattern matched no files", "include", include)
+	}
+	slices.Sort(matches)
+	recordGlob(includePath, matches)
+	return matches, nil
 }
 
 // loadConfigWithIncludes loads config with include support and cycle detection.
@@ -236,9 +778,39 @@ func loadConfigWithIncludes(data []byte, configDir string, visited map[string]bo
 		return nil, fmt.Errorf("failed to parse TOML: %w", err)
 	}
 
-	cfg := &Config{}
+	// Expand environment variable references before compiling patterns
+	if err := interpolateEnv(raw); err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Security: Security{AllowMultiline: true},
+		Limits:   Limits{MatchTimeout: DefaultMatchTimeout},
+	}
+
+	if version, ok := raw["schema_version"]; ok {
+		v, isInt := version.(int64)
+		if !isInt || v < 1 {
+			return nil, fmt.Errorf("schema_version must be a positive integer, got %v", version)
+		}
+		cfg.SchemaVersion = int(v)
+	}
+
+	// Load the extended profile first so this file's patterns layer on top
+	if extends, ok := raw["extends"].(string); ok && extends != "" {
+		if configDir == "" {
+			logger.Debug("extends directive ignored (no config directory)", "extends", extends)
+		} else {
+			parentCfg, err := loadProfile(extends, configDir, visited)
+			if err != nil {
+				return nil, err
+			}
+			mergeConfig(cfg, parentCfg)
+			cfg.Profile = extends
+		}
+	}
 
-	// Process includes first
+	// Process includes
 	if includeVal, ok := raw["include"]; ok {
 		includes := toStringSlice(includeVal)
 		for _, include := range includes {
@@ -247,43 +819,42 @@ func loadConfigWithIncludes(data []byte, configDir string, visited map[string]bo
 				continue
 			}
 
-			includePath := filepath.Join(configDir, include)
-
-			// Check for cycles
-			absPath, err := filepath.Abs(includePath)
+			includePaths, err := resolveInclude(configDir, include)
 			if err != nil {
-				return nil, fmt.Errorf("failed to resolve include path %q: %w", include, err)
-			}
-			if visited[absPath] {
-				return nil, fmt.Errorf("circular include detected: %s", include)
+				return nil, err
 			}
-			visited[absPath] = true
+			for _, includePath := range includePaths {
+				// Name the matched file, not the pattern, in errors
+				name := include
+				if strings.ContainsAny(include, includeGlobChars) {
+					name, _ = filepath.Rel(configDir, includePath)
+				}
 
-			// Load included file
-			includeData, err := os.ReadFile(includePath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read include file %q: %w", include, err)
-			}
+				// Check for cycles
+				absPath, err := filepath.Abs(includePath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to resolve include path %q: %w", name, err)
+				}
+				if visited[absPath] {
+					return nil, fmt.Errorf("circular include detected: %s", name)
+				}
+				visited[absPath] = true
 
-			logger.Debug("loading include", "path", includePath)
-			includeCfg, err := loadConfigWithIncludes(includeData, configDir, visited)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse include file %q: %w", include, err)
-			}
+				// Load included file
+				includeData, err := readSource(includePath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read include file %q: %w", name, err)
+				}
 
-			// Merge included config
-			cfg.WrapperPatterns = append(cfg.WrapperPatterns, includeCfg.WrapperPatterns...)
-			cfg.SafeCommands = append(cfg.SafeCommands, includeCfg.SafeCommands...)
-			cfg.DenyPatterns = append(cfg.DenyPatterns, includeCfg.DenyPatterns...)
-			// SubshellAllowAll: unconditional assignment — last value wins.
-			// If an included file omits [subshell], its zero value (false) will
-			// overwrite a previous include's true. This is the safer default.
-			cfg.SubshellAllowAll = includeCfg.SubshellAllowAll
-			cfg.RewriteRules = append(cfg.RewriteRules, includeCfg.RewriteRules...)
-			// Unmatched: unconditional assignment — last value wins, same as SubshellAllowAll.
-			// If an included file omits [defaults], its zero value ("") will
-			// be normalized to "ask" at the end of parsing.
-			cfg.Unmatched = includeCfg.Unmatched
+				logger.Debug("loading include", "path", includePath)
+				includeCfg, err := loadConfigWithIncludes(includeData, configDir, visited)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse include file %q: %w", name, err)
+				}
+
+				// Merge included config
+				mergeConfig(cfg, includeCfg)
+			}
 		}
 	}
 
@@ -302,6 +873,12 @@ func loadConfigWithIncludes(data []byte, configDir string, visited map[string]bo
 			return nil, fmt.Errorf("failed to parse commands: %w", err)
 		}
 		cfg.SafeCommands = append(cfg.SafeCommands, commands...)
+
+		descriptions, err := parseDescriptionEntries(commandsSection["description"], "commands")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse commands: %w", err)
+		}
+		cfg.DescriptionAllow = append(cfg.DescriptionAllow, descriptions...)
 	}
 
 	if denySection, ok := raw["deny"].(map[string]any); ok {
@@ -310,6 +887,20 @@ func loadConfigWithIncludes(data []byte, configDir string, visited map[string]bo
 			return nil, fmt.Errorf("failed to parse deny: %w", err)
 		}
 		cfg.DenyPatterns = append(cfg.DenyPatterns, deny...)
+
+		descriptions, err := parseDescriptionEntries(denySection["description"], "deny")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse deny: %w", err)
+		}
+		cfg.DescriptionDeny = append(cfg.DescriptionDeny, descriptions...)
+	}
+
+	if allowSection, ok := raw["allow"].(map[string]any); ok {
+		allow, err := parseSection(allowSection, false, "allow")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse allow: %w", err)
+		}
+		cfg.AllowOverrides = append(cfg.AllowOverrides, allow...)
 	}
 
 	// Parse subshell section
@@ -319,6 +910,147 @@ func loadConfigWithIncludes(data []byte, configDir string, visited map[string]bo
 		}
 	}
 
+	// Parse security section
+	if securitySection, ok := raw["security"].(map[string]any); ok {
+		if allow, ok := securitySection["allow_process_substitution"].(bool); ok {
+			cfg.Security.AllowProcessSubstitution = allow
+		}
+		if allow, ok := securitySection["allow_subshells"].(bool); ok {
+			cfg.Security.AllowSubshells = allow
+		}
+		if allow, ok := securitySection["allow_backticks"].(bool); ok {
+			cfg.Security.AllowBackticks = allow
+		}
+		if paths, ok := securitySection["protected_write_paths"].([]any); ok {
+			cfg.Security.ProtectedWritePaths = toStringSlice(paths)
+			for _, p := range cfg.Security.ProtectedWritePaths {
+				if _, err := filepath.Match(p, ""); err != nil {
+					return nil, fmt.Errorf("invalid [security] protected_write_paths pattern %q: %w", p, err)
+				}
+			}
+		}
+		if names, ok := securitySection["protected_env_vars"].([]any); ok {
+			cfg.Security.ProtectedEnvVars = toStringSlice(names)
+		}
+		if names, ok := securitySection["allowed_env_vars"].([]any); ok {
+			cfg.Security.AllowedEnvVars = toStringSlice(names)
+		}
+		if names, ok := securitySection["interpreters"].([]any); ok {
+			cfg.Security.Interpreters = toStringSlice(names)
+		}
+		if wrappers, ok := securitySection["dangerous_wrappers"].([]any); ok {
+			compiled, err := compileDangerousWrappers(toStringSlice(wrappers))
+			if err != nil {
+				return nil, err
+			}
+			cfg.Security.DangerousWrappers = compiled
+		}
+		if unparseable, ok := securitySection["unparseable"].(string); ok {
+			switch unparseable {
+			case UnparseableAsk, UnparseableDeny:
+				cfg.Security.Unparseable = unparseable
+			default:
+				return nil, fmt.Errorf("invalid [security] unparseable value %q: must be \"ask\" or \"deny\"", unparseable)
+			}
+		}
+		if empty, ok := securitySection["empty_command"].(string); ok {
+			switch empty {
+			case EmptyCommandAsk, EmptyCommandAllow:
+				cfg.Security.EmptyCommand = empty
+			default:
+				return nil, fmt.Errorf("invalid [security] empty_command value %q: must be \"ask\" or \"allow\"", empty)
+			}
+		}
+		if anyDeny, ok := securitySection["any_deny_denies_all"].(bool); ok {
+			cfg.Security.IgnoreSegmentDeny = !anyDeny
+		}
+		if requireAll, ok := securitySection["require_all_allow"].(bool); ok {
+			cfg.Security.AllowPartialApproval = !requireAll
+		}
+		if multiline, ok := securitySection["allow_multiline"].(bool); ok {
+			cfg.Security.AllowMultiline = multiline
+		}
+		if declarations, ok := securitySection["allow_declarations"].(bool); ok {
+			cfg.Security.AllowDeclarations = declarations
+		}
+	}
+
+	// Parse xargs section
+	if xargsSection, ok := raw["xargs"].(map[string]any); ok {
+		if commands, ok := xargsSection["commands"].([]any); ok {
+			cfg.XargsCommands = toStringSlice(commands)
+		}
+	}
+
+	// Parse audit section
+	if auditSection, ok := raw["audit"].(map[string]any); ok {
+		for _, pattern := range toStringSlice(auditSection["redact"]) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid [audit] redact pattern %q: %w", pattern, err)
+			}
+			cfg.Audit.Redact = append(cfg.Audit.Redact, re)
+		}
+		if output, ok := auditSection["output"].(string); ok {
+			if output == "stdout" {
+				return nil, fmt.Errorf("invalid [audit] output %q: the hook writes its decision to stdout", output)
+			}
+			cfg.Audit.Output = output
+		}
+		if maxAge, ok := auditSection["max_age"]; ok {
+			s, isString := maxAge.(string)
+			d, err := time.ParseDuration(s)
+			if !isString || err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid [audit] max_age %v: must be a non-negative duration such as \"720h\"", maxAge)
+			}
+			cfg.Audit.MaxAge = d
+		}
+		if resolve, ok := auditSection["resolve_paths"].(bool); ok {
+			cfg.Audit.ResolvePaths = resolve
+		}
+	}
+
+	// Parse limits section
+	if limitsSection, ok := raw["limits"].(map[string]any); ok {
+		if timeout, ok := limitsSection["match_timeout_ms"]; ok {
+			ms, isInt := timeout.(int64)
+			if !isInt || ms < 0 {
+				return nil, fmt.Errorf("invalid [limits] match_timeout_ms %v: must be a non-negative integer", timeout)
+			}
+			cfg.Limits.MatchTimeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	// Parse metrics section
+	if metricsSection, ok := raw["metrics"].(map[string]any); ok {
+		if file, ok := metricsSection["file"].(string); ok {
+			cfg.Metrics.File = file
+		}
+	}
+
+	if outputSection, ok := raw["output"].(map[string]any); ok {
+		if template, ok := outputSection["approval_reason_template"].(string); ok {
+			for _, placeholder := range placeholderRegex.FindAllString(template, -1) {
+				if !slices.Contains(ApprovalPlaceholders, placeholder) {
+					return nil, fmt.Errorf("invalid [output] approval_reason_template: unknown placeholder %s (use %s)", placeholder, strings.Join(ApprovalPlaceholders, ", "))
+				}
+			}
+			cfg.Output.ApprovalReasonTemplate = template
+		}
+		if hints, ok := outputSection["near_miss_hints"].(bool); ok {
+			cfg.Output.NearMissHints = hints
+		}
+	}
+
+	// Parse tools section
+	if toolsSection, ok := raw["tools"].(map[string]any); ok {
+		tools, err := parseToolsSection(toolsSection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse tools: %w", err)
+		}
+		cfg.Tools = mergeTools(cfg.Tools, tools)
+	}
+
 	// Parse rewrites section
 	if rewritesSection, ok := raw["rewrites"].(map[string]any); ok {
 		rewrites, err := parseRewriteSection(rewritesSection)
@@ -344,21 +1076,275 @@ func loadConfigWithIncludes(data []byte, configDir string, visited map[string]bo
 		cfg.Unmatched = UnmatchedAsk
 	}
 
+	if cfg.XargsCommands == nil {
+		cfg.XargsCommands = DefaultXargsCommands
+	}
+
+	if cfg.Security.ProtectedWritePaths == nil {
+		cfg.Security.ProtectedWritePaths = DefaultProtectedWritePaths
+	}
+
+	if cfg.Security.Unparseable == "" {
+		cfg.Security.Unparseable = UnparseableAsk
+	}
+
+	if cfg.Security.EmptyCommand == "" {
+		cfg.Security.EmptyCommand = EmptyCommandAsk
+	}
+
+	if cfg.Security.ProtectedEnvVars == nil {
+		cfg.Security.ProtectedEnvVars = DefaultProtectedEnvVars
+	}
+
+	if cfg.Security.DangerousWrappers == nil {
+		cfg.Security.DangerousWrappers, _ = compileDangerousWrappers(DefaultDangerousWrappers)
+	}
+
+	if cfg.Security.Interpreters == nil {
+		cfg.Security.Interpreters = DefaultInterpreters
+	}
+
+	cfg.Warnings = append(cfg.Warnings, checkRegexWarnings(raw)...)
+
 	return cfg, nil
 }
 
+// compileDangerousWrappers compiles [security] dangerous_wrappers patterns.
+// The result is non-nil even when patterns is empty, so an empty list
+// disables the check rather than selecting the defaults.
+func compileDangerousWrappers(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid [security] dangerous_wrappers pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// loadProfile loads profiles/<name>.toml from configDir, following its own
+// extends and include directives.
+func loadProfile(name, configDir string, visited map[string]bool) (*Config, error) {
+	profilePath := filepath.Join(configDir, ProfilesDir, name+".toml")
+
+	// Check for cycles
+	absPath, err := filepath.Abs(profilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve profile path %q: %w", name, err)
+	}
+	if visited[absPath] {
+		return nil, fmt.Errorf("circular extends detected: %s", name)
+	}
+	visited[absPath] = true
+
+	profileData, err := readSource(profilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile %q: %w", name, err)
+	}
+
+	logger.Debug("loading profile", "path", profilePath)
+	profileCfg, err := loadConfigWithIncludes(profileData, configDir, visited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile %q: %w", name, err)
+	}
+	return profileCfg, nil
+}
+
+// mergeConfig merges src, loaded from an include or extended profile, into dst.
+func mergeConfig(dst, src *Config) {
+	dst.WrapperPatterns = append(dst.WrapperPatterns, src.WrapperPatterns...)
+	dst.SafeCommands = append(dst.SafeCommands, src.SafeCommands...)
+	dst.DenyPatterns = append(dst.DenyPatterns, src.DenyPatterns...)
+	dst.AllowOverrides = append(dst.AllowOverrides, src.AllowOverrides...)
+	dst.DescriptionAllow = append(dst.DescriptionAllow, src.DescriptionAllow...)
+	dst.DescriptionDeny = append(dst.DescriptionDeny, src.DescriptionDeny...)
+	// SubshellAllowAll: unconditional assignment — last value wins.
+	// If an included file omits [subshell], its zero value (false) will
+	// overwrite a previous include's true. This is the safer default.
+	dst.SubshellAllowAll = src.SubshellAllowAll
+	dst.RewriteRules = append(dst.RewriteRules, src.RewriteRules...)
+	// Unmatched: unconditional assignment — last value wins, same as SubshellAllowAll.
+	// If an included file omits [defaults], its zero value ("") will
+	// be normalized to "ask" at the end of parsing.
+	dst.Unmatched = src.Unmatched
+	// Security: unconditional assignment — last value wins, same as SubshellAllowAll.
+	dst.Security = src.Security
+	// XargsCommands: unconditional assignment — last value wins. An included
+	// file without [xargs] carries the default list.
+	dst.XargsCommands = src.XargsCommands
+	dst.Tools = mergeTools(dst.Tools, src.Tools)
+	// Limits: unconditional assignment — last value wins. An included file
+	// without [limits] carries the default timeout.
+	dst.Limits = src.Limits
+	if src.Metrics.File != "" {
+		dst.Metrics.File = src.Metrics.File
+	}
+	if src.Output.ApprovalReasonTemplate != "" {
+		dst.Output.ApprovalReasonTemplate = src.Output.ApprovalReasonTemplate
+	}
+	if src.Output.NearMissHints {
+		dst.Output.NearMissHints = true
+	}
+	dst.Audit.Redact = append(dst.Audit.Redact, src.Audit.Redact...)
+	if src.Audit.Output != "" {
+		dst.Audit.Output = src.Audit.Output
+	}
+	if src.Audit.MaxAge != 0 {
+		dst.Audit.MaxAge = src.Audit.MaxAge
+	}
+	if src.Audit.ResolvePaths {
+		dst.Audit.ResolvePaths = true
+	}
+	dst.Warnings = append(dst.Warnings, src.Warnings...)
+}
+
+// mergePatterns appends the patterns of src to those of dst, leaving the
+// settings of dst alone.
+func mergePatterns(dst, src *Config) {
+	dst.WrapperPatterns = append(dst.WrapperPatterns, src.WrapperPatterns...)
+	dst.SafeCommands = append(dst.SafeCommands, src.SafeCommands...)
+	dst.DenyPatterns = append(dst.DenyPatterns, src.DenyPatterns...)
+	dst.AllowOverrides = append(dst.AllowOverrides, src.AllowOverrides...)
+	dst.DescriptionAllow = append(dst.DescriptionAllow, src.DescriptionAllow...)
+	dst.DescriptionDeny = append(dst.DescriptionDeny, src.DescriptionDeny...)
+	dst.RewriteRules = append(dst.RewriteRules, src.RewriteRules...)
+	dst.Audit.Redact = append(dst.Audit.Redact, src.Audit.Redact...)
+	dst.Warnings = append(dst.Warnings, src.Warnings...)
+}
+
+// mergeExtraConfigs merges the patterns of the config.toml in each directory
+// listed in MMI_CONFIG_EXTRA into cfg, in order, so a shared team config can
+// be layered on a personal one. Includes are resolved relative to each
+// directory. Settings like [security] come from cfg alone. A listed
+// directory without a readable, valid config.toml is an error.
+func mergeExtraConfigs(cfg *Config) error {
+	value := os.Getenv(constants.EnvConfigExtra)
+	recordEnv(constants.EnvConfigExtra, value)
+	for _, dir := range filepath.SplitList(value) {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, constants.ConfigFileName)
+		data, err := readSource(path)
+		if err != nil {
+			if recording != nil {
+				recording.Files[path] = ""
+			}
+			return fmt.Errorf("failed to read %s config: %w", constants.EnvConfigExtra, err)
+		}
+		extra, err := LoadConfigWithDir(data, dir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		mergePatterns(cfg, extra)
+	}
+	sortByPriority(cfg.SafeCommands)
+	sortByPriority(cfg.DenyPatterns)
+	sortByPriority(cfg.AllowOverrides)
+	sortByPriority(cfg.DescriptionAllow)
+	sortByPriority(cfg.DescriptionDeny)
+	return nil
+}
+
+// checkRegexWarnings scans the raw regex entries of every pattern section and
+// returns a warning for each pattern with nested quantifiers, for each allow
+// pattern that isn't anchored with ^, and for each simple allow command that
+// contains a space.
+func checkRegexWarnings(raw map[string]any) []string {
+	var warnings []string
+	for _, sectionName := range []string{"commands", "allow"} {
+		section, ok := raw[sectionName].(map[string]any)
+		if !ok {
+			continue
+		}
+		for i, entry := range toMapSlice(section["regex"]) {
+			pattern, _ := entry["pattern"].(string)
+			if pattern == "" || patterns.StartsWithAnchor(pattern) {
+				continue
+			}
+			name, _ := entry["name"].(string)
+			warnings = append(warnings, fmt.Sprintf("%s.regex[%d] %q: pattern %q doesn't start with ^, so it can match anywhere in a command, including its arguments", sectionName, i, name, pattern))
+		}
+		for i, entry := range toMapSlice(section["simple"]) {
+			name, _ := entry["name"].(string)
+			for _, cmd := range toStringSlice(entry["commands"]) {
+				if strings.ContainsAny(cmd, " \t") {
+					warnings = append(warnings, fmt.Sprintf("%s.simple[%d] %q: command %q contains a space, so it only matches when nothing comes between its words; use [[commands.subcommand]] to allow options before a subcommand", sectionName, i, name, cmd))
+				}
+			}
+		}
+	}
+	for _, sectionName := range []string{"deny", "allow", "wrappers", "commands", "rewrites"} {
+		section, ok := raw[sectionName].(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, sectionType := range []string{"regex", "description"} {
+			for i, entry := range toMapSlice(section[sectionType]) {
+				pattern, _ := entry["pattern"].(string)
+				if !patterns.HasNestedQuantifier(pattern) {
+					continue
+				}
+				name, _ := entry["name"].(string)
+				warnings = append(warnings, fmt.Sprintf("%s.%s[%d] %q: pattern %q has nested quantifiers and may match slowly", sectionName, sectionType, i, name, pattern))
+			}
+		}
+	}
+	return warnings
+}
+
+// parseDescriptionEntries parses the description entries of the commands or
+// deny section, named by sectionName. Each is a regex matched against the
+// description of a Bash command:
+//
+//	[[deny.description]]
+//	name = "force push"
+//	pattern = '(?i)force.push'
+//	reason = "ask before force pushing"
+func parseDescriptionEntries(value any, sectionName string) ([]patterns.Pattern, error) {
+	var result []patterns.Pattern
+	for i, entry := range toMapSlice(value) {
+		priority := entryPriority(entry)
+		note, _ := entry["note"].(string)
+		pattern, _ := entry["pattern"].(string)
+		name, _ := entry["name"].(string)
+		reason, _ := entry["reason"].(string)
+		ignoreCase, _ := entry["ignore_case"].(bool)
+		multiline, _ := entry["multiline"].(bool)
+		if pattern == "" {
+			if name != "" {
+				return nil, fmt.Errorf("%s.description[%d] %q: \"pattern\" field is required and must not be empty", sectionName, i, name)
+			}
+			return nil, fmt.Errorf("%s.description[%d]: \"pattern\" field is required and must not be empty", sectionName, i)
+		}
+		pattern = withMultiline(withIgnoreCase(pattern, ignoreCase), multiline)
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid description pattern %q: %w", pattern, err)
+		}
+		result = append(result, patterns.Pattern{Regex: re, Name: name, Type: "description", Pattern: pattern, Reason: reason, Priority: priority, Note: note})
+	}
+	return result, nil
+}
+
 // parseDenySection parses the deny section of the config.
-// Deny patterns use simple and regex subsections (no subcommand support).
+// Deny patterns use simple, regex, and subcommand subsections.
 func parseDenySection(sectionData map[string]any) ([]patterns.Pattern, error) {
 	var result []patterns.Pattern
 
 	for sectionType, value := range sectionData {
 		switch sectionType {
 		case "simple":
-			// [[deny.simple]] name = "label", commands = [...]
+			// [[deny.simple]] name = "label", commands = [...], reason = "message"
 			entries := toMapSlice(value)
 			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
 				name, _ := entry["name"].(string)
+				reason, _ := entry["reason"].(string)
+				ignoreCase, _ := entry["ignore_case"].(bool)
 				cmds := toStringSlice(entry["commands"])
 				if len(cmds) == 0 {
 					if name != "" {
@@ -368,32 +1354,77 @@ func parseDenySection(sectionData map[string]any) ([]patterns.Pattern, error) {
 				}
 				for _, cmd := range cmds {
 					// For deny patterns, match the command at the start
-					pattern := patterns.BuildSimplePattern(cmd)
+					pattern := withIgnoreCase(patterns.BuildSimplePattern(cmd), ignoreCase)
 					re, err := regexp.Compile(pattern)
 					if err != nil {
 						return nil, fmt.Errorf("invalid deny pattern for command %q: %w", cmd, err)
 					}
-					result = append(result, patterns.Pattern{Regex: re, Name: name, Type: "simple", Pattern: pattern})
+					result = append(result, patterns.Pattern{Regex: re, Name: name, Type: "simple", Pattern: pattern, Reason: reason, Priority: priority, Note: note})
 				}
 			}
 
 		case "regex":
-			// [[deny.regex]] pattern = "^regex", name = "desc"
+			// [[deny.regex]] pattern = "^regex", name = "desc", reason = "message"
 			entries := toMapSlice(value)
 			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
 				pattern, _ := entry["pattern"].(string)
 				patternName, _ := entry["name"].(string)
+				reason, _ := entry["reason"].(string)
+				ignoreCase, _ := entry["ignore_case"].(bool)
+				multiline, _ := entry["multiline"].(bool)
 				if pattern == "" {
 					if patternName != "" {
 						return nil, fmt.Errorf("deny.regex[%d] %q: \"pattern\" field is required and must not be empty", i, patternName)
 					}
 					return nil, fmt.Errorf("deny.regex[%d]: \"pattern\" field is required and must not be empty", i)
 				}
+				pattern = withMultiline(withIgnoreCase(pattern, ignoreCase), multiline)
 				re, err := regexp.Compile(pattern)
 				if err != nil {
 					return nil, fmt.Errorf("invalid deny regex pattern %q: %w", pattern, err)
 				}
-				result = append(result, patterns.Pattern{Regex: re, Name: patternName, Type: "regex", Pattern: pattern})
+				result = append(result, patterns.Pattern{Regex: re, Name: patternName, Type: "regex", Pattern: pattern, Reason: reason, Priority: priority, Note: note})
+			}
+
+		case "subcommand":
+			// [[deny.subcommand]] command = "git", subcommands = [...], reason = "message"
+			entries := toMapSlice(value)
+			for i, entry := range entries {
+				priority := entryPriority(entry)
+				note, _ := entry["note"].(string)
+				name, _ := entry["name"].(string)
+				reason, _ := entry["reason"].(string)
+				ignoreCase, _ := entry["ignore_case"].(bool)
+				cmd, _ := entry["command"].(string)
+				if cmd == "" {
+					return nil, fmt.Errorf("deny.subcommand[%d]: \"command\" field is required and must not be empty", i)
+				}
+				subs := toStringSlice(entry["subcommands"])
+				flags := toStringSlice(entry["flags"])
+				if len(subs) == 0 {
+					return nil, fmt.Errorf("deny.subcommand[%d] %q: \"subcommands\" field is required and must not be empty", i, cmd)
+				}
+				if name == "" {
+					name = cmd
+				}
+				pattern := withIgnoreCase(patterns.BuildSubcommandPattern(cmd, subs, flags), ignoreCase)
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("invalid deny pattern for command %q: %w", cmd, err)
+				}
+				result = append(result, patterns.Pattern{
+					Regex:       re,
+					Name:        name,
+					Type:        "subcommand",
+					Pattern:     pattern,
+					Command:     cmd,
+					Subcommands: subs,
+					Reason:      reason,
+					Priority:    priority,
+					Note:        note,
+				})
 			}
 		}
 	}
@@ -478,59 +1509,120 @@ func parseRewriteSection(sectionData map[string]any) ([]patterns.RewriteRule, er
 	return result, nil
 }
 
-// loadEmbeddedDefaults returns an empty config that denies all commands.
-// This ensures mmi rejects everything when no config file exists.
-func loadEmbeddedDefaults() *Config {
-	return &Config{}
+// fallbackConfig returns the config used when loading the config file failed
+// with err: by default a config with no patterns, so every command is asked
+// about, and the same settings LoadConfig gives an empty file. It is not the
+// embedded config.toml, which is only a starting point written by mmi init,
+// unless SetDefaultsWhenMissing opted in and the file doesn't exist. The
+// choice can't be a [security] fail_closed setting, since settings live in
+// the file that failed to load.
+func fallbackConfig(err error) *Config {
+	if defaultsWhenMissing && errors.Is(err, fs.ErrNotExist) {
+		cfg, loadErr := LoadConfig(defaultConfig)
+		if loadErr == nil {
+			return cfg
+		}
+		logger.Debug("failed to load the embedded default config", "error", loadErr)
+	}
+	cfg, loadErr := LoadConfig(nil)
+	if loadErr != nil {
+		logger.Debug("failed to load an empty config", "error", loadErr)
+		return &Config{Security: Security{AllowMultiline: true}, Limits: Limits{MatchTimeout: DefaultMatchTimeout}}
+	}
+	// The schema warning is about the missing file, not a config to fix
+	cfg.Warnings = nil
+	return cfg
 }
 
 // Init loads configuration from files.
-// If loading fails, it falls back to embedded defaults.
+// If loading fails, it falls back to fallbackConfig.
 // Note: This does not auto-create config files. Use EnsureConfigFiles() if needed.
 func Init() error {
 	if configInitialized {
 		return nil
 	}
 
-	configDir, err := GetConfigDir()
+	cfg, configPath, sources, err := loadConfigFile()
+	globalConfigPath = configPath
+	globalSources = sources
+	configInitialized = true
 	if err != nil {
-		logger.Debug("failed to get config dir, using embedded defaults", "error", err)
-		globalConfig = loadEmbeddedDefaults()
+		logger.Debug("failed to load config, using the fallback config", "path", configPath, "error", err)
+		globalConfig = fallbackConfig(err)
 		globalInitError = err
-		configInitialized = true
 		return err
 	}
 
-	configPath := filepath.Join(configDir, constants.ConfigFileName)
+	globalConfig = cfg
+	globalInitError = nil
+	logLoaded(configPath, cfg)
+	return nil
+}
+
+// Reload loads the config file again and, if it loads, replaces the current
+// configuration with it. If it fails, the current configuration is kept and
+// the error is returned.
+func Reload() error {
+	if !configInitialized {
+		return Init()
+	}
+
+	cfg, configPath, sources, err := loadConfigFile()
+	// Remember what the failed load read, so Stale reports the next change
+	// rather than the one that was just rejected
+	globalSources = sources
+	if err != nil {
+		logger.Debug("failed to reload config, keeping the current config", "path", configPath, "error", err)
+		return err
+	}
+
+	globalConfig = cfg
 	globalConfigPath = configPath
+	globalInitError = nil
+	logLoaded(configPath, cfg)
+	return nil
+}
+
+// Stale reports whether a file, include glob match, or environment variable
+// the current configuration was loaded from has changed since it was loaded.
+// A config file that couldn't be read counts as changed once it can be.
+func Stale() bool {
+	if !configInitialized {
+		return false
+	}
+	return !globalSources.unchanged()
+}
+
+// loadConfigFile loads the config file Init uses, returning its path and
+// what it was built from, which is recorded even if loading fails.
+func loadConfigFile() (*Config, string, loadSources, error) {
+	configPath, err := GetConfigFile()
+	if err != nil {
+		return nil, "", loadSources{}, err
+	}
 
 	configData, err := os.ReadFile(configPath)
 	if err != nil {
-		logger.Debug("failed to read config file, using embedded defaults", "path", configPath, "error", err)
-		globalConfig = loadEmbeddedDefaults()
-		initErr := fmt.Errorf("failed to read config.toml: %w", err)
-		globalInitError = initErr
-		configInitialized = true
-		return initErr
+		sources := loadSources{Files: map[string]string{configPath: ""}}
+		return nil, configPath, sources, fmt.Errorf("failed to read config.toml: %w", err)
 	}
 
-	globalConfig, err = LoadConfigWithDir(configData, configDir)
+	cfg, sources, err := loadWithCache(configPath, configData)
 	if err != nil {
-		logger.Debug("failed to parse config, using embedded defaults", "error", err)
-		globalConfig = loadEmbeddedDefaults()
-		initErr := fmt.Errorf("failed to load config: %w", err)
-		globalInitError = initErr
-		configInitialized = true
-		return initErr
+		return nil, configPath, sources, fmt.Errorf("failed to load config: %w", err)
 	}
+	return cfg, configPath, sources, nil
+}
 
+// logLoaded logs a successfully loaded configuration and its warnings.
+func logLoaded(configPath string, cfg *Config) {
 	logger.Debug("config loaded successfully",
 		"path", configPath,
-		"wrappers", len(globalConfig.WrapperPatterns),
-		"commands", len(globalConfig.SafeCommands))
-	globalInitError = nil
-	configInitialized = true
-	return nil
+		"wrappers", len(cfg.WrapperPatterns),
+		"commands", len(cfg.SafeCommands))
+	for _, warning := range cfg.Warnings {
+		logger.Debug("config warning", "warning", warning)
+	}
 }
 
 // Get returns the current configuration.
@@ -561,9 +1653,15 @@ func Reset() {
 	globalConfig = nil
 	globalInitError = nil
 	globalConfigPath = ""
+	globalSources = loadSources{}
 }
 
 // GetDefaultConfig returns the embedded default configuration.
 func GetDefaultConfig() []byte {
 	return defaultConfig
 }
+
+// GetProjectTemplate returns the embedded starter project config.
+func GetProjectTemplate() []byte {
+	return projectTemplate
+}
@@ -1,10 +1,18 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/patterns"
 )
 
 func TestInitErrorNilOnValidConfig(t *testing.T) {
@@ -32,6 +40,96 @@ commands = ["echo"]
 	}
 }
 
+func TestInitMergesExtraConfigDirs(t *testing.T) {
+	mainDir, teamDir, sharedDir := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("MMI_CONFIG", mainDir)
+	t.Setenv("MMI_CONFIG_EXTRA", teamDir+string(os.PathListSeparator)+sharedDir)
+	t.Cleanup(Reset)
+
+	files := map[string]string{
+		mainDir: `
+[security]
+allow_declarations = true
+
+[[commands.simple]]
+name = "personal"
+commands = ["ls"]
+`,
+		teamDir: `
+include = ["extra.toml"]
+
+[[deny.simple]]
+name = "team deny"
+commands = ["terraform"]
+
+[[commands.simple]]
+name = "team"
+commands = ["make"]
+`,
+		sharedDir: `
+[[commands.simple]]
+name = "shared"
+commands = ["go"]
+`,
+	}
+	for dir, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Includes resolve relative to the extra directory
+	if err := os.WriteFile(filepath.Join(teamDir, "extra.toml"), []byte(`
+[[commands.simple]]
+name = "team include"
+commands = ["cargo"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Reset()
+	if err := Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	cfg := Get()
+
+	var names []string
+	for _, p := range cfg.SafeCommands {
+		names = append(names, p.Name)
+	}
+	if want := []string{"personal", "team include", "team", "shared"}; !slices.Equal(names, want) {
+		t.Errorf("SafeCommands = %v, want %v", names, want)
+	}
+	if len(cfg.DenyPatterns) != 1 || cfg.DenyPatterns[0].Name != "team deny" {
+		t.Errorf("DenyPatterns = %v, want the team deny pattern", cfg.DenyPatterns)
+	}
+	// Settings come from the main config only
+	if !cfg.Security.AllowDeclarations {
+		t.Error("Security.AllowDeclarations should keep the main config's value")
+	}
+}
+
+func TestInitErrorOnMissingExtraConfig(t *testing.T) {
+	mainDir := t.TempDir()
+	t.Setenv("MMI_CONFIG", mainDir)
+	t.Setenv("MMI_CONFIG_EXTRA", filepath.Join(t.TempDir(), "missing"))
+	t.Cleanup(Reset)
+	if err := os.WriteFile(filepath.Join(mainDir, "config.toml"), []byte(`
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Reset()
+	if err := Init(); err == nil {
+		t.Fatal("Init() should fail when an MMI_CONFIG_EXTRA directory has no config.toml")
+	}
+	if len(Get().SafeCommands) != 0 {
+		t.Error("a failed load should fall back to the empty default config")
+	}
+}
+
 func TestInitErrorOnInvalidTOML(t *testing.T) {
 	// Create temp directory with invalid TOML
 	tmpDir := t.TempDir()
@@ -85,6 +183,140 @@ func TestInitErrorOnMissingConfigFile(t *testing.T) {
 	}
 }
 
+func TestEmbeddedDefaultConfigLoads(t *testing.T) {
+	if _, err := LoadConfig(GetDefaultConfig()); err != nil {
+		t.Fatalf("LoadConfig(embedded config.toml) error = %v", err)
+	}
+}
+
+func TestFallbackForMissingConfig(t *testing.T) {
+	defaults, err := LoadConfig(GetDefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := t.TempDir()
+	if err := os.WriteFile(filepath.Join(invalid, "config.toml"), []byte("not = [valid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		dir          string
+		defaults     bool
+		wantCommands int
+	}{
+		{"missing asks about everything", t.TempDir(), false, 0},
+		{"missing uses embedded defaults when enabled", t.TempDir(), true, len(defaults.SafeCommands)},
+		{"invalid asks about everything even when enabled", invalid, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MMI_CONFIG", tt.dir)
+			SetDefaultsWhenMissing(tt.defaults)
+			defer SetDefaultsWhenMissing(false)
+			Reset()
+			defer Reset()
+
+			if err := Init(); err == nil {
+				t.Error("Init() error = nil, want the load failure reported")
+			}
+			if got := len(Get().SafeCommands); got != tt.wantCommands {
+				t.Errorf("fallback has %d safe commands, want %d", got, tt.wantCommands)
+			}
+			if !tt.defaults || tt.wantCommands == 0 {
+				// Settings match an empty file's, so multi-line commands
+				// are asked about rather than denied outright
+				if !reflect.DeepEqual(Get().Security, empty.Security) || Get().Limits != empty.Limits {
+					t.Errorf("fallback settings = %+v %+v, want the defaults %+v %+v", Get().Security, Get().Limits, empty.Security, empty.Limits)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadSwapsConfig(t *testing.T) {
+	tmpDir := initCacheTest(t, map[string]string{"config.toml": `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`})
+	reinit(t)
+	if Stale() {
+		t.Fatal("Stale() = true right after loading")
+	}
+
+	writeCacheTestFile(t, tmpDir, "config.toml", `
+[[commands.simple]]
+name = "build"
+commands = ["make"]
+`)
+	if !Stale() {
+		t.Fatal("Stale() = false after the config file changed")
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := Get().SafeCommands; len(got) != 1 || got[0].Name != "build" {
+		t.Errorf("SafeCommands = %v, want [build] after Reload", got)
+	}
+	if Stale() {
+		t.Error("Stale() = true after Reload")
+	}
+}
+
+func TestReloadKeepsConfigOnFailure(t *testing.T) {
+	tmpDir := initCacheTest(t, map[string]string{"config.toml": `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`})
+	reinit(t)
+
+	writeCacheTestFile(t, tmpDir, "config.toml", `[[commands.simple]`)
+	if err := Reload(); err == nil || !strings.Contains(err.Error(), "failed to load config") {
+		t.Fatalf("Reload() error = %v, want a load failure", err)
+	}
+	if got := Get().SafeCommands; len(got) != 1 || got[0].Name != "read-only" {
+		t.Errorf("SafeCommands = %v, want the previous config kept", got)
+	}
+	if InitError() != nil {
+		t.Errorf("InitError() = %v, want nil while the previous config is in use", InitError())
+	}
+	if Stale() {
+		t.Error("Stale() = true for the failed change, which would retry it on every check")
+	}
+}
+
+func TestStaleAfterMissingConfigAppears(t *testing.T) {
+	tmpDir := initCacheTest(t, nil)
+	Reset()
+	if err := Init(); err == nil {
+		t.Fatal("Init() should fail without a config file")
+	}
+	if Stale() {
+		t.Fatal("Stale() = true while the config file is still missing")
+	}
+
+	writeCacheTestFile(t, tmpDir, "config.toml", `
+[[commands.simple]]
+name = "read-only"
+commands = ["ls"]
+`)
+	if !Stale() {
+		t.Fatal("Stale() = false after the config file was created")
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if InitError() != nil || len(Get().SafeCommands) != 1 {
+		t.Errorf("InitError() = %v, SafeCommands = %v, want the new config", InitError(), Get().SafeCommands)
+	}
+}
+
 func TestResetClearsInitError(t *testing.T) {
 	// Create a broken config to produce an error
 	tmpDir := t.TempDir()
@@ -184,173 +416,819 @@ func TestLoadConfigCircularInclude(t *testing.T) {
 	}
 }
 
-func TestLoadConfigDenyPatterns(t *testing.T) {
-	data := []byte(`
-[[deny.simple]]
-name = "dangerous"
-commands = ["rm", "sudo"]
-
-[[deny.regex]]
-pattern = 'rm\s+-rf\s+/'
-name = "rm root"
-`)
-	cfg, err := LoadConfig(data)
-	if err != nil {
-		t.Fatalf("LoadConfig failed: %v", err)
+func TestLoadConfigIncludeGlob(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	if err := os.MkdirAll(confDir, 0755); err != nil {
+		t.Fatal(err)
 	}
-	if len(cfg.DenyPatterns) != 3 {
-		t.Errorf("expected 3 deny patterns, got %d", len(cfg.DenyPatterns))
+	fragments := map[string]string{
+		"20-node.toml":   "[[commands.simple]]\nname = \"node\"\ncommands = [\"npm\"]\n",
+		"10-python.toml": "[[commands.simple]]\nname = \"python\"\ncommands = [\"pytest\"]\n",
+		"README.md":      "not a config",
+	}
+	for name, content := range fragments {
+		if err := os.WriteFile(filepath.Join(confDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
 	}
-}
 
-// Validation tests
+	mainConfig := []byte(`
+include = ["conf.d/*.toml", "empty.d/*.toml"]
 
-func TestValidateSimpleCommandsMissing(t *testing.T) {
-	data := []byte(`
 [[commands.simple]]
-name = "empty"
+name = "main"
+commands = ["echo"]
 `)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for missing commands field")
+	cfg, err := LoadConfigWithDir(mainConfig, dir)
+	if err != nil {
+		t.Fatalf("LoadConfigWithDir failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "commands.simple[0]") {
-		t.Errorf("error should reference commands.simple[0], got: %v", err)
+
+	var names []string
+	for _, p := range cfg.SafeCommands {
+		names = append(names, p.Name)
 	}
-	if !strings.Contains(err.Error(), "\"commands\" field is required") {
-		t.Errorf("error should mention commands field, got: %v", err)
+	want := []string{"python", "node", "main"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("safe command names = %v, want %v (fragments in sorted order, then the main file)", names, want)
 	}
 }
 
-func TestValidateSimpleCommandsEmpty(t *testing.T) {
-	data := []byte(`
-[[commands.simple]]
-name = "empty"
-commands = []
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for empty commands array")
+func TestLoadConfigIncludeGlobErrors(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	if err := os.MkdirAll(confDir, 0755); err != nil {
+		t.Fatal(err)
 	}
-}
-
-func TestValidateCommandMissing(t *testing.T) {
-	data := []byte(`
-[[wrappers.command]]
-flags = ["-n <arg>"]
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for missing command field")
+	if err := os.WriteFile(filepath.Join(confDir, "loop.toml"), []byte(`include = ["conf.d/*.toml"]`), 0644); err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(err.Error(), "wrappers.command[0]") {
-		t.Errorf("error should reference wrappers.command[0], got: %v", err)
+
+	_, err := LoadConfigWithDir([]byte(`include = ["conf.d/*.toml"]`), dir)
+	if err == nil || !strings.Contains(err.Error(), "circular include detected: conf.d/loop.toml") {
+		t.Errorf("error = %v, want a circular include naming the matched file", err)
 	}
-}
 
-func TestValidateCommandEmpty(t *testing.T) {
-	data := []byte(`
-[[wrappers.command]]
-command = ""
-flags = ["-n <arg>"]
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for empty command field")
+	_, err = LoadConfigWithDir([]byte(`include = ["conf.d/[.toml"]`), dir)
+	if err == nil || !strings.Contains(err.Error(), "invalid include pattern") {
+		t.Errorf("error = %v, want an invalid include pattern error", err)
 	}
 }
 
-func TestValidateSubcommandCommandMissing(t *testing.T) {
-	data := []byte(`
-[[commands.subcommand]]
-subcommands = ["diff", "log"]
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for missing command field")
+// writeProfile writes profiles/<name>.toml under dir.
+func writeProfile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	profilesDir := filepath.Join(dir, ProfilesDir)
+	if err := os.MkdirAll(profilesDir, 0755); err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(err.Error(), "commands.subcommand[0]") {
-		t.Errorf("error should reference commands.subcommand[0], got: %v", err)
+	if err := os.WriteFile(filepath.Join(profilesDir, name+".toml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
 	}
 }
 
-func TestValidateSubcommandSubcommandsMissing(t *testing.T) {
-	data := []byte(`
-[[commands.subcommand]]
-command = "git"
+func TestLoadConfigExtendsChain(t *testing.T) {
+	dir := t.TempDir()
+
+	writeProfile(t, dir, "base", `
+[[commands.simple]]
+name = "base"
+commands = ["ls"]
+
+[[deny.simple]]
+name = "base deny"
+commands = ["rm"]
+
+[defaults]
+unmatched = "deny"
 `)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for missing subcommands field")
-	}
-	if !strings.Contains(err.Error(), `"git"`) {
-		t.Errorf("error should include command name, got: %v", err)
-	}
-}
+	writeProfile(t, dir, "lenient", `
+extends = "base"
 
-func TestValidateSubcommandSubcommandsEmpty(t *testing.T) {
-	data := []byte(`
-[[commands.subcommand]]
-command = "git"
-subcommands = []
+[[commands.simple]]
+name = "lenient"
+commands = ["make"]
+
+[[deny.simple]]
+name = "lenient deny"
+commands = ["sudo"]
 `)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for empty subcommands array")
+
+	cfg, err := LoadConfigWithDir([]byte(`
+extends = "lenient"
+
+[[commands.simple]]
+name = "main"
+commands = ["echo"]
+`), dir)
+	if err != nil {
+		t.Fatalf("LoadConfigWithDir() error = %v", err)
 	}
-}
 
-func TestValidateRegexPatternMissing(t *testing.T) {
-	data := []byte(`
-[[commands.regex]]
-name = "empty pattern"
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for missing pattern field")
+	// Parent patterns come first, child patterns are appended
+	var names []string
+	for _, p := range cfg.SafeCommands {
+		names = append(names, p.Name)
 	}
-	if !strings.Contains(err.Error(), "commands.regex[0]") {
-		t.Errorf("error should reference commands.regex[0], got: %v", err)
+	if strings.Join(names, ",") != "base,lenient,main" {
+		t.Errorf("SafeCommands names = %v, want [base lenient main]", names)
 	}
-}
 
-func TestValidateRegexPatternEmpty(t *testing.T) {
-	data := []byte(`
-[[commands.regex]]
-pattern = ""
-name = "empty pattern"
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for empty pattern field")
+	// Deny patterns from every level apply
+	if len(cfg.DenyPatterns) != 2 {
+		t.Errorf("expected 2 deny patterns, got %d", len(cfg.DenyPatterns))
 	}
-}
 
-func TestValidateDenySimpleCommandsMissing(t *testing.T) {
-	data := []byte(`
-[[deny.simple]]
-name = "dangerous"
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for missing commands in deny.simple")
+	// Scalars are inherited unless overridden
+	if cfg.Unmatched != UnmatchedDeny {
+		t.Errorf("Unmatched = %q, want %q", cfg.Unmatched, UnmatchedDeny)
 	}
-	if !strings.Contains(err.Error(), "deny.simple[0]") {
-		t.Errorf("error should reference deny.simple[0], got: %v", err)
+
+	// The profile is the one the loaded file extends directly
+	if cfg.Profile != "lenient" {
+		t.Errorf("Profile = %q, want lenient", cfg.Profile)
 	}
 }
 
-func TestValidateDenyRegexPatternMissing(t *testing.T) {
-	data := []byte(`
-[[deny.regex]]
-name = "dangerous"
-`)
-	_, err := LoadConfig(data)
-	if err == nil {
-		t.Error("expected error for missing pattern in deny.regex")
+func TestLoadConfigExtendsCycle(t *testing.T) {
+	dir := t.TempDir()
+
+	writeProfile(t, dir, "a", `extends = "b"`)
+	writeProfile(t, dir, "b", `extends = "a"`)
+
+	_, err := LoadConfigWithDir([]byte(`extends = "a"`), dir)
+	if err == nil || !strings.Contains(err.Error(), "circular extends detected") {
+		t.Errorf("expected circular extends error, got %v", err)
 	}
-	if !strings.Contains(err.Error(), "deny.regex[0]") {
-		t.Errorf("error should reference deny.regex[0], got: %v", err)
+}
+
+func TestLoadConfigExtendsMissingProfile(t *testing.T) {
+	_, err := LoadConfigWithDir([]byte(`extends = "missing"`), t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), `failed to read profile "missing"`) {
+		t.Errorf("expected missing profile error, got %v", err)
+	}
+}
+
+func TestLoadConfigNote(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+note = "never run as root"
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<num>"]
+note = "bounded test runs"
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+note = "needed for CI"
+
+[[commands.regex]]
+name = "builtin"
+pattern = '^true$'
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	notes := map[string]string{}
+	for _, pats := range [][]patterns.Pattern{cfg.DenyPatterns, cfg.WrapperPatterns, cfg.SafeCommands} {
+		for _, p := range pats {
+			notes[p.Name] = p.Note
+		}
+	}
+	want := map[string]string{
+		"privilege escalation": "never run as root",
+		"timeout":              "bounded test runs",
+		"git":                  "needed for CI",
+		"builtin":              "",
+	}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("notes = %v, want %v", notes, want)
+	}
+}
+
+func TestLoadConfigDenyReason(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+reason = "Ask the user to run this themselves."
+
+[[deny.regex]]
+name = "rm root"
+pattern = 'rm\s+-rf\s+/'
+reason = "Refusing: this deletes system files."
+
+[[deny.simple]]
+name = "no reason"
+commands = ["su"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	reasons := make(map[string]string)
+	for _, p := range cfg.DenyPatterns {
+		reasons[p.Name] = p.Reason
+	}
+	if reasons["privilege escalation"] != "Ask the user to run this themselves." {
+		t.Errorf("deny.simple reason = %q", reasons["privilege escalation"])
+	}
+	if reasons["rm root"] != "Refusing: this deletes system files." {
+		t.Errorf("deny.regex reason = %q", reasons["rm root"])
+	}
+	if reasons["no reason"] != "" {
+		t.Errorf("expected empty reason, got %q", reasons["no reason"])
+	}
+}
+
+func TestLoadConfigDenyPatterns(t *testing.T) {
+	data := []byte(`
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm", "sudo"]
+
+[[deny.regex]]
+pattern = 'rm\s+-rf\s+/'
+name = "rm root"
+`)
+	cfg, err := LoadConfig(data)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.DenyPatterns) != 3 {
+		t.Errorf("expected 3 deny patterns, got %d", len(cfg.DenyPatterns))
+	}
+}
+
+func TestLoadConfigDeniedSubcommands(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[commands.subcommand]]
+command = "git"
+denied_subcommands = ["push", "reset --hard"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	p := cfg.SafeCommands[0]
+	if p.Pattern != `^git\b` || p.Except == nil || !slices.Equal(p.DeniedSubcommands, []string{"push", "reset --hard"}) {
+		t.Errorf("pattern = %+v, want ^git\\b with an exception for the denied subcommands", p)
+	}
+
+	// Both fields narrow the allowed subcommands further
+	cfg, err = LoadConfig([]byte(`
+[[commands.subcommand]]
+command = "git"
+subcommands = ["reset", "status"]
+denied_subcommands = ["reset --hard"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if p := cfg.SafeCommands[0]; p.Pattern != `^git\s+(reset|status)\b` || p.Except == nil {
+		t.Errorf("pattern = %+v, want the subcommand pattern with an exception", p)
+	}
+
+	for _, bad := range []string{
+		"[[commands.subcommand]]\ncommand = \"git\"",
+		"[[wrappers.subcommand]]\ncommand = \"git\"\ndenied_subcommands = [\"push\"]",
+	} {
+		if _, err := LoadConfig([]byte(bad)); err == nil || !strings.Contains(err.Error(), "subcommand[0]") {
+			t.Errorf("LoadConfig(%q) error = %v, want a subcommand error", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigDenySubcommand(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[deny.subcommand]]
+command = "git"
+subcommands = ["push", "reset"]
+flags = ["-C <arg>"]
+reason = "Ask before changing the remote or history."
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.DenyPatterns) != 1 {
+		t.Fatalf("expected 1 deny pattern, got %d", len(cfg.DenyPatterns))
+	}
+	p := cfg.DenyPatterns[0]
+	if p.Type != "subcommand" || p.Name != "git" || p.Reason == "" {
+		t.Errorf("deny pattern = %+v, want a named subcommand pattern with a reason", p)
+	}
+
+	tests := []struct {
+		input   string
+		matches bool
+	}{
+		{"git push origin main", true},
+		{"git reset --hard", true},
+		{"git -C /repo push", true},
+		{"git status", false},
+		{"git pushy", false},
+	}
+	for _, tt := range tests {
+		if got := p.Regex.MatchString(tt.input); got != tt.matches {
+			t.Errorf("matching %q = %v, want %v", tt.input, got, tt.matches)
+		}
+	}
+
+	for _, bad := range []string{
+		"[[deny.subcommand]]\nsubcommands = [\"push\"]",
+		"[[deny.subcommand]]\ncommand = \"git\"",
+	} {
+		if _, err := LoadConfig([]byte(bad)); err == nil || !strings.Contains(err.Error(), "deny.subcommand[0]") {
+			t.Errorf("LoadConfig(%q) error = %v, want a deny.subcommand error", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigSimpleExact(t *testing.T) {
+	data := []byte(`
+[[commands.simple]]
+name = "bare echo"
+commands = ["echo"]
+exact = true
+
+[[commands.simple]]
+name = "listing"
+commands = ["ls"]
+`)
+	cfg, err := LoadConfig(data)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.SafeCommands) != 2 {
+		t.Fatalf("expected 2 safe commands, got %d", len(cfg.SafeCommands))
+	}
+
+	tests := []struct {
+		input   string
+		matches bool
+	}{
+		{"echo", true},
+		{"echo hello", false},
+		{"ls", true},
+		{"ls -la", true},
+	}
+	for _, tt := range tests {
+		matched := false
+		for _, p := range cfg.SafeCommands {
+			if p.Regex.MatchString(tt.input) {
+				matched = true
+				break
+			}
+		}
+		if matched != tt.matches {
+			t.Errorf("matching %q = %v, want %v", tt.input, matched, tt.matches)
+		}
+	}
+}
+
+func TestLoadConfigMultiline(t *testing.T) {
+	data := []byte(`
+[[deny.regex]]
+pattern = '^rm\s'
+name = "rm on any line"
+multiline = true
+ignore_case = true
+
+[[deny.regex]]
+pattern = '^shutdown\b'
+name = "shutdown"
+
+[[commands.regex]]
+pattern = '^make$'
+name = "make"
+multiline = true
+
+[[deny.description]]
+pattern = '^delete'
+name = "deletes"
+multiline = true
+`)
+	cfg, err := LoadConfig(data)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		input   string
+		pats    []patterns.Pattern
+		matches bool
+	}{
+		{"echo 'x\nrm -rf /'", cfg.DenyPatterns, true},
+		{"echo 'x\nRM -rf /'", cfg.DenyPatterns, true},
+		// multiline only applies to the entry that sets it
+		{"echo 'x\nshutdown now'", cfg.DenyPatterns, false},
+		{"make\nls", cfg.SafeCommands, true},
+		{"first\ndelete everything", cfg.DescriptionDeny, true},
+	}
+	for _, tt := range tests {
+		matched := false
+		for _, p := range tt.pats {
+			if p.Regex.MatchString(tt.input) {
+				matched = true
+				break
+			}
+		}
+		if matched != tt.matches {
+			t.Errorf("matching %q = %v, want %v", tt.input, matched, tt.matches)
+		}
+	}
+}
+
+func TestLoadConfigIgnoreCase(t *testing.T) {
+	data := []byte(`
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+ignore_case = true
+
+[[deny.regex]]
+pattern = '^rm\s+-rf'
+name = "force remove"
+ignore_case = true
+
+[[deny.simple]]
+name = "shutdown"
+commands = ["shutdown"]
+
+[[commands.simple]]
+name = "make"
+commands = ["make"]
+ignore_case = true
+`)
+	cfg, err := LoadConfig(data)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		input   string
+		pats    []patterns.Pattern
+		matches bool
+	}{
+		{"sudo ls", cfg.DenyPatterns, true},
+		{"SUDO ls", cfg.DenyPatterns, true},
+		{"Sudo ls", cfg.DenyPatterns, true},
+		{"RM -RF /", cfg.DenyPatterns, true},
+		{"shutdown now", cfg.DenyPatterns, true},
+		// ignore_case only applies to the entry that sets it
+		{"SHUTDOWN now", cfg.DenyPatterns, false},
+		{"MAKE build", cfg.SafeCommands, true},
+	}
+	for _, tt := range tests {
+		matched := false
+		for _, p := range tt.pats {
+			if p.Regex.MatchString(tt.input) {
+				matched = true
+				break
+			}
+		}
+		if matched != tt.matches {
+			t.Errorf("matching %q = %v, want %v", tt.input, matched, tt.matches)
+		}
+	}
+}
+
+func TestLoadConfigPriority(t *testing.T) {
+	data := []byte(`
+[[commands.simple]]
+name = "any git"
+commands = ["git"]
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+priority = 10
+
+[[commands.regex]]
+pattern = '^ls\b'
+name = "listing"
+priority = -1
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+
+[[deny.regex]]
+pattern = '^rm\s+-rf'
+name = "force remove"
+priority = 5
+`)
+	cfg, err := LoadConfig(data)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	var safe []string
+	for _, p := range cfg.SafeCommands {
+		safe = append(safe, p.Name)
+	}
+	if want := []string{"git", "any git", "listing"}; !reflect.DeepEqual(safe, want) {
+		t.Errorf("safe command order = %v, want %v", safe, want)
+	}
+	if cfg.DenyPatterns[0].Name != "force remove" || cfg.DenyPatterns[0].Priority != 5 {
+		t.Errorf("first deny pattern = %q (priority %d), want force remove (priority 5)", cfg.DenyPatterns[0].Name, cfg.DenyPatterns[0].Priority)
+	}
+}
+
+// Validation tests
+
+func TestValidateSimpleCommandsMissing(t *testing.T) {
+	data := []byte(`
+[[commands.simple]]
+name = "empty"
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for missing commands field")
+	}
+	if !strings.Contains(err.Error(), "commands.simple[0]") {
+		t.Errorf("error should reference commands.simple[0], got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "\"commands\" field is required") {
+		t.Errorf("error should mention commands field, got: %v", err)
+	}
+}
+
+func TestValidateSimpleCommandsEmpty(t *testing.T) {
+	data := []byte(`
+[[commands.simple]]
+name = "empty"
+commands = []
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for empty commands array")
+	}
+}
+
+func TestValidateCommandMissing(t *testing.T) {
+	data := []byte(`
+[[wrappers.command]]
+flags = ["-n <arg>"]
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for missing command field")
+	}
+	if !strings.Contains(err.Error(), "wrappers.command[0]") {
+		t.Errorf("error should reference wrappers.command[0], got: %v", err)
+	}
+}
+
+func TestValidateCommandEmpty(t *testing.T) {
+	data := []byte(`
+[[wrappers.command]]
+command = ""
+flags = ["-n <arg>"]
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for empty command field")
+	}
+}
+
+func TestValidateSubcommandCommandMissing(t *testing.T) {
+	data := []byte(`
+[[commands.subcommand]]
+subcommands = ["diff", "log"]
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for missing command field")
+	}
+	if !strings.Contains(err.Error(), "commands.subcommand[0]") {
+		t.Errorf("error should reference commands.subcommand[0], got: %v", err)
+	}
+}
+
+func TestValidateSubcommandSubcommandsMissing(t *testing.T) {
+	data := []byte(`
+[[commands.subcommand]]
+command = "git"
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for missing subcommands field")
+	}
+	if !strings.Contains(err.Error(), `"git"`) {
+		t.Errorf("error should include command name, got: %v", err)
+	}
+}
+
+func TestValidateSubcommandSubcommandsEmpty(t *testing.T) {
+	data := []byte(`
+[[commands.subcommand]]
+command = "git"
+subcommands = []
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for empty subcommands array")
+	}
+}
+
+func TestLoadConfigAnyOf(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[commands.anyof]]
+command = "docker"
+groups = [
+  { subcommands = ["compose up", "compose down"] },
+  { subcommands = ["ps", "images"], flags = ["--context <arg>"] },
+]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.SafeCommands) != 1 {
+		t.Fatalf("SafeCommands = %d, want 1", len(cfg.SafeCommands))
+	}
+	p := cfg.SafeCommands[0]
+	if p.Type != "anyof" || p.Name != "docker" || p.Command != "docker" {
+		t.Errorf("pattern = %+v, want anyof docker", p)
+	}
+	if !reflect.DeepEqual(p.Subcommands, []string{"compose up", "compose down", "ps", "images"}) {
+		t.Errorf("Subcommands = %v, want every group's subcommands", p.Subcommands)
+	}
+	for _, cmd := range []string{"docker compose up", "docker --context prod ps"} {
+		if !p.Regex.MatchString(cmd) {
+			t.Errorf("%q should match %s", cmd, p.Pattern)
+		}
+	}
+	for _, cmd := range []string{"docker run alpine", "docker --context prod compose up"} {
+		if p.Regex.MatchString(cmd) {
+			t.Errorf("%q should not match %s", cmd, p.Pattern)
+		}
+	}
+}
+
+func TestValidateAnyOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"missing command", `groups = [{ subcommands = ["ps"] }]`, "commands.anyof[0]"},
+		{"missing groups", `command = "docker"`, `"groups" field is required`},
+		{"empty group", `command = "docker"
+groups = [{ subcommands = ["ps"] }, { flags = ["-a"] }]`, "groups[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig([]byte("[[commands.anyof]]\n" + tt.config + "\n"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRegexPatternMissing(t *testing.T) {
+	data := []byte(`
+[[commands.regex]]
+name = "empty pattern"
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for missing pattern field")
+	}
+	if !strings.Contains(err.Error(), "commands.regex[0]") {
+		t.Errorf("error should reference commands.regex[0], got: %v", err)
+	}
+}
+
+func TestValidateRegexPatternEmpty(t *testing.T) {
+	data := []byte(`
+[[commands.regex]]
+pattern = ""
+name = "empty pattern"
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for empty pattern field")
+	}
+}
+
+func TestValidateDenySimpleCommandsMissing(t *testing.T) {
+	data := []byte(`
+[[deny.simple]]
+name = "dangerous"
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for missing commands in deny.simple")
+	}
+	if !strings.Contains(err.Error(), "deny.simple[0]") {
+		t.Errorf("error should reference deny.simple[0], got: %v", err)
+	}
+}
+
+func TestValidateDenyRegexPatternMissing(t *testing.T) {
+	data := []byte(`
+[[deny.regex]]
+name = "dangerous"
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Error("expected error for missing pattern in deny.regex")
+	}
+	if !strings.Contains(err.Error(), "deny.regex[0]") {
+		t.Errorf("error should reference deny.regex[0], got: %v", err)
+	}
+}
+
+func TestLoadConfigDescriptionPatterns(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[commands.description]]
+name = "formatting"
+pattern = '^Format Go sources$'
+
+[[deny.description]]
+name = "force push"
+pattern = 'force.push'
+ignore_case = true
+reason = "force pushes need review"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.DescriptionAllow) != 1 || cfg.DescriptionAllow[0].Type != "description" || cfg.DescriptionAllow[0].Name != "formatting" {
+		t.Errorf("DescriptionAllow = %+v, want the formatting pattern", cfg.DescriptionAllow)
+	}
+	if len(cfg.DescriptionDeny) != 1 || !cfg.DescriptionDeny[0].Regex.MatchString("Force push main") || cfg.DescriptionDeny[0].Reason != "force pushes need review" {
+		t.Errorf("DescriptionDeny = %+v, want a case-insensitive force push pattern", cfg.DescriptionDeny)
+	}
+	if len(cfg.SafeCommands) != 0 || len(cfg.DenyPatterns) != 0 {
+		t.Errorf("description patterns leaked into SafeCommands %v or DenyPatterns %v", cfg.SafeCommands, cfg.DenyPatterns)
+	}
+}
+
+func TestLoadConfigBuiltins(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[commands.builtin]]
+commands = ["cd", "pushd"]
+
+[[commands.builtin]]
+name = "flow"
+commands = ["true"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	var names []string
+	for _, p := range cfg.SafeCommands {
+		if p.Type != "builtin" {
+			t.Errorf("pattern %q has type %q, want builtin", p.Name, p.Type)
+		}
+		names = append(names, p.Name)
+	}
+	slices.Sort(names)
+	if want := []string{"cd", "flow", "pushd"}; !slices.Equal(names, want) {
+		t.Errorf("pattern names = %v, want %v", names, want)
+	}
+}
+
+func TestValidateBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"unknown builtin", "[[commands.builtin]]\ncommands = [\"cd\", \"eval\"]\n", `unknown builtin "eval"`},
+		{"missing commands", "[[commands.builtin]]\nname = \"nav\"\n", `commands.builtin[0] "nav"`},
+		{"wrapper", "[[wrappers.builtin]]\ncommands = [\"cd\"]\n", "wrappers.builtin is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDescriptionPatternMissing(t *testing.T) {
+	data := []byte(`
+[[deny.description]]
+name = "force push"
+`)
+	_, err := LoadConfig(data)
+	if err == nil {
+		t.Fatal("expected error for missing pattern in deny.description")
+	}
+	if !strings.Contains(err.Error(), "deny.description[0]") {
+		t.Errorf("error should reference deny.description[0], got: %v", err)
 	}
 }
 
@@ -420,109 +1298,629 @@ commands = ["echo"]
 	if err != nil {
 		t.Fatalf("LoadConfig failed: %v", err)
 	}
-	if !cfg.SubshellAllowAll {
-		t.Error("SubshellAllowAll should be true when allow_all = true")
+	if !cfg.SubshellAllowAll {
+		t.Error("SubshellAllowAll should be true when allow_all = true")
+	}
+}
+
+func TestLoadConfigSubshellAllowAllFalse(t *testing.T) {
+	data := []byte(`
+[subshell]
+allow_all = false
+
+[[commands.simple]]
+name = "test"
+commands = ["echo"]
+`)
+	cfg, err := LoadConfig(data)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.SubshellAllowAll {
+		t.Error("SubshellAllowAll should be false when allow_all = false")
+	}
+}
+
+func TestLoadConfigSubshellAllowAllIncludeOverride(t *testing.T) {
+	dir := t.TempDir()
+
+	mainConfig := []byte(`
+include = ["extra.toml"]
+
+[subshell]
+allow_all = false
+
+[[commands.simple]]
+name = "main"
+commands = ["echo"]
+`)
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), mainConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	extraConfig := []byte(`
+[subshell]
+allow_all = true
+`)
+	if err := os.WriteFile(filepath.Join(dir, "extra.toml"), extraConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigWithDir(mainConfig, dir)
+	if err != nil {
+		t.Fatalf("LoadConfigWithDir failed: %v", err)
+	}
+	if cfg.SubshellAllowAll {
+		t.Error("SubshellAllowAll should be false — main config overrides included file")
+	}
+}
+
+func TestLoadConfigSubshellAllowAllFromInclude(t *testing.T) {
+	dir := t.TempDir()
+
+	mainConfig := []byte(`
+include = ["extra.toml"]
+
+[[commands.simple]]
+name = "main"
+commands = ["echo"]
+`)
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), mainConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	extraConfig := []byte(`
+[subshell]
+allow_all = true
+`)
+	if err := os.WriteFile(filepath.Join(dir, "extra.toml"), extraConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigWithDir(mainConfig, dir)
+	if err != nil {
+		t.Fatalf("LoadConfigWithDir failed: %v", err)
+	}
+	if !cfg.SubshellAllowAll {
+		t.Error("SubshellAllowAll should be true — inherited from included file")
+	}
+}
+
+func TestLoadConfigSubshellAllowAllInvalidType(t *testing.T) {
+	data := []byte(`
+[subshell]
+allow_all = "yes"
+
+[[commands.simple]]
+name = "test"
+commands = ["echo"]
+`)
+	cfg, err := LoadConfig(data)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.SubshellAllowAll {
+		t.Error("SubshellAllowAll should be false when allow_all has invalid type")
+	}
+}
+
+func TestLoadConfigSecurityDefaults(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[commands.simple]]
+name = "test"
+commands = ["echo"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.AllowProcessSubstitution {
+		t.Error("AllowProcessSubstitution should default to false")
+	}
+}
+
+func TestLoadConfigSecurityAllowProcessSubstitution(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[security]
+allow_process_substitution = true
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.Security.AllowProcessSubstitution {
+		t.Error("AllowProcessSubstitution should be true when allow_process_substitution = true")
+	}
+}
+
+func TestLoadConfigXargsCommands(t *testing.T) {
+	cfg, err := LoadConfig([]byte(``))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.XargsCommands, DefaultXargsCommands) {
+		t.Errorf("XargsCommands = %v, want default %v", cfg.XargsCommands, DefaultXargsCommands)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[xargs]
+commands = ["xargs", "parallel"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.XargsCommands, []string{"xargs", "parallel"}) {
+		t.Errorf("XargsCommands = %v, want [xargs parallel]", cfg.XargsCommands)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[xargs]
+commands = []
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.XargsCommands) != 0 {
+		t.Errorf("XargsCommands = %v, want empty", cfg.XargsCommands)
+	}
+}
+
+func TestLoadConfigProtectedWritePaths(t *testing.T) {
+	cfg, err := LoadConfig([]byte(``))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Security.ProtectedWritePaths, DefaultProtectedWritePaths) {
+		t.Errorf("ProtectedWritePaths = %v, want default %v", cfg.Security.ProtectedWritePaths, DefaultProtectedWritePaths)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[security]
+protected_write_paths = ["/srv/*", "~/.gitconfig"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Security.ProtectedWritePaths, []string{"/srv/*", "~/.gitconfig"}) {
+		t.Errorf("ProtectedWritePaths = %v, want [/srv/* ~/.gitconfig]", cfg.Security.ProtectedWritePaths)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[security]
+protected_write_paths = []
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Security.ProtectedWritePaths) != 0 {
+		t.Errorf("ProtectedWritePaths = %v, want empty", cfg.Security.ProtectedWritePaths)
+	}
+
+	_, err = LoadConfig([]byte(`
+[security]
+protected_write_paths = ["/etc/["]
+`))
+	if err == nil || !strings.Contains(err.Error(), "protected_write_paths") {
+		t.Errorf("LoadConfig with invalid glob error = %v, want protected_write_paths error", err)
+	}
+}
+
+func TestLoadConfigEnvVars(t *testing.T) {
+	cfg, err := LoadConfig([]byte(``))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Security.ProtectedEnvVars, DefaultProtectedEnvVars) {
+		t.Errorf("ProtectedEnvVars = %v, want default %v", cfg.Security.ProtectedEnvVars, DefaultProtectedEnvVars)
+	}
+	if cfg.Security.AllowedEnvVars != nil {
+		t.Errorf("AllowedEnvVars = %v, want nil", cfg.Security.AllowedEnvVars)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[security]
+protected_env_vars = ["GIT_SSH"]
+allowed_env_vars = []
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Security.ProtectedEnvVars, []string{"GIT_SSH"}) {
+		t.Errorf("ProtectedEnvVars = %v, want [GIT_SSH]", cfg.Security.ProtectedEnvVars)
+	}
+	if cfg.Security.AllowedEnvVars == nil || len(cfg.Security.AllowedEnvVars) != 0 {
+		t.Errorf("AllowedEnvVars = %#v, want empty, non-nil", cfg.Security.AllowedEnvVars)
+	}
+}
+
+func TestLoadConfigAllowOverrides(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[allow.simple]]
+name = "status"
+commands = ["git status"]
+
+[[allow.regex]]
+pattern = '^rm -rf \./build$'
+name = "clean build"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	names := make(map[string]string)
+	for _, p := range cfg.AllowOverrides {
+		names[p.Name] = p.Type
+	}
+	if !reflect.DeepEqual(names, map[string]string{"status": "simple", "clean build": "regex"}) {
+		t.Errorf("AllowOverrides = %v, want status (simple) and clean build (regex)", names)
+	}
+	if len(cfg.SafeCommands) != 0 || len(cfg.DenyPatterns) != 0 {
+		t.Errorf("allow entries leaked into SafeCommands (%d) or DenyPatterns (%d)", len(cfg.SafeCommands), len(cfg.DenyPatterns))
+	}
+
+	_, err = LoadConfig([]byte("[[allow.regex]]\nname = \"empty\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "allow.regex[0]") {
+		t.Errorf("LoadConfig with empty allow pattern error = %v, want allow.regex[0] error", err)
+	}
+}
+
+func TestLoadConfigDangerousWrappers(t *testing.T) {
+	patternStrings := func(res []*regexp.Regexp) []string {
+		var s []string
+		for _, re := range res {
+			s = append(s, re.String())
+		}
+		return s
+	}
+
+	cfg, err := LoadConfig([]byte(``))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := patternStrings(cfg.Security.DangerousWrappers); !reflect.DeepEqual(got, DefaultDangerousWrappers) {
+		t.Errorf("DangerousWrappers = %v, want default %v", got, DefaultDangerousWrappers)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[security]
+dangerous_wrappers = ['^timeout\s+0\b']
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := patternStrings(cfg.Security.DangerousWrappers); !reflect.DeepEqual(got, []string{`^timeout\s+0\b`}) {
+		t.Errorf("DangerousWrappers = %v, want [^timeout\\s+0\\b]", got)
+	}
+
+	cfg, err = LoadConfig([]byte("[security]\ndangerous_wrappers = []\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.DangerousWrappers == nil || len(cfg.Security.DangerousWrappers) != 0 {
+		t.Errorf("DangerousWrappers = %v, want empty, non-nil", cfg.Security.DangerousWrappers)
+	}
+
+	_, err = LoadConfig([]byte("[security]\ndangerous_wrappers = ['^env(']\n"))
+	if err == nil || !strings.Contains(err.Error(), "dangerous_wrappers") {
+		t.Errorf("LoadConfig with invalid pattern error = %v, want dangerous_wrappers error", err)
+	}
+}
+
+func TestLoadConfigInterpreters(t *testing.T) {
+	cfg, err := LoadConfig([]byte(``))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Security.Interpreters, DefaultInterpreters) {
+		t.Errorf("Interpreters = %v, want default %v", cfg.Security.Interpreters, DefaultInterpreters)
+	}
+
+	cfg, err = LoadConfig([]byte("[security]\ninterpreters = [\"sh\", \"deno\"]\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := []string{"sh", "deno"}; !reflect.DeepEqual(cfg.Security.Interpreters, want) {
+		t.Errorf("Interpreters = %v, want %v", cfg.Security.Interpreters, want)
+	}
+
+	cfg, err = LoadConfig([]byte("[security]\ninterpreters = []\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.Interpreters == nil || len(cfg.Security.Interpreters) != 0 {
+		t.Errorf("Interpreters = %v, want empty, non-nil", cfg.Security.Interpreters)
 	}
 }
 
-func TestLoadConfigSubshellAllowAllFalse(t *testing.T) {
-	data := []byte(`
-[subshell]
-allow_all = false
+func TestLoadConfigMatchTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"default", "", DefaultMatchTimeout, false},
+		{"set", "[limits]\nmatch_timeout_ms = 200\n", 200 * time.Millisecond, false},
+		{"disabled", "[limits]\nmatch_timeout_ms = 0\n", 0, false},
+		{"negative", "[limits]\nmatch_timeout_ms = -1\n", 0, true},
+		{"not an integer", "[limits]\nmatch_timeout_ms = \"50ms\"\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig([]byte(tt.config))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "match_timeout_ms") {
+					t.Errorf("LoadConfig error = %v, want match_timeout_ms error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if cfg.Limits.MatchTimeout != tt.want {
+				t.Errorf("MatchTimeout = %s, want %s", cfg.Limits.MatchTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPopulatesTypeAndPattern(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[wrappers.simple]]
+commands = ["sudo"]
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
 
 [[commands.simple]]
-name = "test"
-commands = ["echo"]
-`)
-	cfg, err := LoadConfig(data)
+name = "safe"
+commands = ["ls"]
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+
+[[commands.regex]]
+pattern = '^true$'
+name = "true"
+
+[[commands.pathrestricted]]
+command = "cat"
+allowed_prefixes = ["./"]
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+
+[[deny.regex]]
+pattern = '^shutdown\b'
+name = "shutdown"
+`))
 	if err != nil {
 		t.Fatalf("LoadConfig failed: %v", err)
 	}
-	if cfg.SubshellAllowAll {
-		t.Error("SubshellAllowAll should be false when allow_all = false")
+
+	var all []patterns.Pattern
+	all = append(all, cfg.WrapperPatterns...)
+	all = append(all, cfg.SafeCommands...)
+	all = append(all, cfg.DenyPatterns...)
+
+	// Subsections are parsed in map order, so look patterns up by name
+	wantTypes := map[string]string{
+		"sudo":      "simple",
+		"timeout":   "command",
+		"safe":      "simple",
+		"git":       "subcommand",
+		"true":      "regex",
+		"cat":       "pathrestricted",
+		"dangerous": "simple",
+		"shutdown":  "regex",
+	}
+	if len(all) != len(wantTypes) {
+		t.Fatalf("got %d patterns, want %d", len(all), len(wantTypes))
+	}
+	for _, p := range all {
+		if want, ok := wantTypes[p.Name]; !ok || p.Type != want {
+			t.Errorf("pattern %q Type = %q, want %q", p.Name, p.Type, want)
+		}
+		if p.Pattern == "" || p.Pattern != p.Regex.String() {
+			t.Errorf("pattern %q Pattern = %q, want compiled regex %q", p.Name, p.Pattern, p.Regex.String())
+		}
 	}
 }
 
-func TestLoadConfigSubshellAllowAllIncludeOverride(t *testing.T) {
-	dir := t.TempDir()
-
-	mainConfig := []byte(`
-include = ["extra.toml"]
+func TestLoadConfigAuditRedact(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[audit]
+redact = ['Bearer \S+', '--password \S+']
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Audit.Redact) != 2 {
+		t.Fatalf("Audit.Redact has %d patterns, want 2", len(cfg.Audit.Redact))
+	}
+	if !cfg.Audit.Redact[0].MatchString("Authorization: Bearer xyz") {
+		t.Error("first redact pattern should match a bearer token")
+	}
 
-[subshell]
-allow_all = false
+	_, err = LoadConfig([]byte(`
+[audit]
+redact = ['(']
+`))
+	if err == nil || !strings.Contains(err.Error(), "[audit] redact") {
+		t.Errorf("LoadConfig with invalid redact pattern error = %v, want [audit] redact error", err)
+	}
+}
 
+func TestSetConfigFile(t *testing.T) {
+	// The explicit file wins over the config directory
+	configDir := t.TempDir()
+	t.Setenv("MMI_CONFIG", configDir)
+	if err := os.WriteFile(filepath.Join(configDir, "config.toml"), []byte(`
 [[commands.simple]]
-name = "main"
+name = "global"
 commands = ["echo"]
-`)
-	if err := os.WriteFile(filepath.Join(dir, "config.toml"), mainConfig, 0644); err != nil {
+`), 0644); err != nil {
 		t.Fatal(err)
 	}
 
-	extraConfig := []byte(`
-[subshell]
-allow_all = true
-`)
-	if err := os.WriteFile(filepath.Join(dir, "extra.toml"), extraConfig, 0644); err != nil {
+	fileDir := t.TempDir()
+	configFile := filepath.Join(fileDir, "one-off.toml")
+	if err := os.WriteFile(configFile, []byte(`
+include = ["extra.toml"]
+
+[[commands.simple]]
+name = "one-off"
+commands = ["make"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fileDir, "extra.toml"), []byte(`
+[[commands.simple]]
+name = "extra"
+commands = ["ls"]
+`), 0644); err != nil {
 		t.Fatal(err)
 	}
 
-	cfg, err := LoadConfigWithDir(mainConfig, dir)
-	if err != nil {
-		t.Fatalf("LoadConfigWithDir failed: %v", err)
+	SetConfigFile(configFile)
+	defer SetConfigFile("")
+	Reset()
+	defer Reset()
+	if err := Init(); err != nil {
+		t.Fatalf("Init() returned error: %v", err)
 	}
-	if cfg.SubshellAllowAll {
-		t.Error("SubshellAllowAll should be false — main config overrides included file")
+
+	if got := GetConfigPath(); got != configFile {
+		t.Errorf("GetConfigPath() = %q, want %q", got, configFile)
+	}
+	var names []string
+	for _, p := range Get().SafeCommands {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"extra", "one-off"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("safe command names = %v, want %v (includes resolved next to the file)", names, want)
+	}
+
+	// Clearing the override goes back to the config directory
+	SetConfigFile("")
+	Reset()
+	if err := Init(); err != nil {
+		t.Fatalf("Init() returned error: %v", err)
+	}
+	if got, want := GetConfigPath(), filepath.Join(configDir, "config.toml"); got != want {
+		t.Errorf("GetConfigPath() after clearing = %q, want %q", got, want)
 	}
 }
 
-func TestLoadConfigSubshellAllowAllFromInclude(t *testing.T) {
-	dir := t.TempDir()
+func TestLoadConfigAuditOutput(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[audit]
+output = "stderr"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Audit.Output != "stderr" {
+		t.Errorf("Audit.Output = %q, want stderr", cfg.Audit.Output)
+	}
 
-	mainConfig := []byte(`
-include = ["extra.toml"]
+	_, err = LoadConfig([]byte(`
+[audit]
+output = "stdout"
+`))
+	if err == nil || !strings.Contains(err.Error(), "[audit] output") {
+		t.Errorf("LoadConfig with stdout output error = %v, want [audit] output error", err)
+	}
+}
 
-[[commands.simple]]
-name = "main"
-commands = ["echo"]
-`)
-	if err := os.WriteFile(filepath.Join(dir, "config.toml"), mainConfig, 0644); err != nil {
-		t.Fatal(err)
+func TestLoadConfigAuditMaxAge(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[audit]
+max_age = "720h"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Audit.MaxAge != 720*time.Hour {
+		t.Errorf("Audit.MaxAge = %v, want 720h", cfg.Audit.MaxAge)
 	}
 
-	extraConfig := []byte(`
-[subshell]
-allow_all = true
-`)
-	if err := os.WriteFile(filepath.Join(dir, "extra.toml"), extraConfig, 0644); err != nil {
-		t.Fatal(err)
+	for _, value := range []string{`"30 days"`, `"-1h"`, `720`} {
+		_, err := LoadConfig([]byte("[audit]\nmax_age = " + value + "\n"))
+		if err == nil || !strings.Contains(err.Error(), "[audit] max_age") {
+			t.Errorf("LoadConfig with max_age = %s error = %v, want [audit] max_age error", value, err)
+		}
 	}
+}
 
-	cfg, err := LoadConfigWithDir(mainConfig, dir)
+func TestLoadConfigAuditResolvePaths(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[audit]
+resolve_paths = true
+`))
 	if err != nil {
-		t.Fatalf("LoadConfigWithDir failed: %v", err)
+		t.Fatalf("LoadConfig failed: %v", err)
 	}
-	if !cfg.SubshellAllowAll {
-		t.Error("SubshellAllowAll should be true — inherited from included file")
+	if !cfg.Audit.ResolvePaths {
+		t.Error("Audit.ResolvePaths = false, want true")
 	}
 }
 
-func TestLoadConfigSubshellAllowAllInvalidType(t *testing.T) {
-	data := []byte(`
-[subshell]
-allow_all = "yes"
-
+func TestLoadConfigSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		warning string // substring of the expected warning, "" for none
+	}{
+		{"current", "schema_version = 1\n", ""},
+		{"missing", "", "schema_version is missing"},
+		{"zero", "schema_version = 0\n", "schema_version must be a positive integer"},
+		{"newer", "schema_version = 99\n", "newer than this mmi supports"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig([]byte(tt.config + `
 [[commands.simple]]
-name = "test"
-commands = ["echo"]
-`)
-	cfg, err := LoadConfig(data)
-	if err != nil {
-		t.Fatalf("LoadConfig failed: %v", err)
+name = "safe"
+commands = ["ls"]
+`))
+			if strings.Contains(tt.warning, "must be") {
+				if err == nil || !strings.Contains(err.Error(), tt.warning) {
+					t.Fatalf("LoadConfig error = %v, want %q", err, tt.warning)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if tt.warning == "" {
+				if len(cfg.Warnings) != 0 {
+					t.Errorf("Warnings = %v, want none", cfg.Warnings)
+				}
+				return
+			}
+			if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], tt.warning) {
+				t.Errorf("Warnings = %v, want one containing %q", cfg.Warnings, tt.warning)
+			}
+		})
 	}
-	if cfg.SubshellAllowAll {
-		t.Error("SubshellAllowAll should be false when allow_all has invalid type")
+}
+
+func TestSchemaWarningDescribesChanges(t *testing.T) {
+	if got := schemaWarning(SchemaVersion); got != "" {
+		t.Errorf("schemaWarning(current) = %q, want none", got)
+	}
+	got := schemaWarning(0)
+	for v := 1; v <= SchemaVersion; v++ {
+		if !strings.Contains(got, schemaChanges[v]) {
+			t.Errorf("schemaWarning(0) = %q, missing the changes in version %d", got, v)
+		}
+	}
+	if !strings.Contains(got, fmt.Sprintf("set schema_version = %d", SchemaVersion)) {
+		t.Errorf("schemaWarning(0) = %q, should say which version to set", got)
 	}
 }
 
@@ -795,6 +2193,170 @@ commands = ["echo"]
 	}
 }
 
+func TestLoadConfigUnparseable(t *testing.T) {
+	cfg, err := LoadConfig([]byte(``))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.Unparseable != UnparseableAsk {
+		t.Errorf("Unparseable = %q, want default %q", cfg.Security.Unparseable, UnparseableAsk)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[security]
+unparseable = "deny"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.Unparseable != UnparseableDeny {
+		t.Errorf("Unparseable = %q, want %q", cfg.Security.Unparseable, UnparseableDeny)
+	}
+
+	_, err = LoadConfig([]byte(`
+[security]
+unparseable = "passthrough"
+`))
+	if err == nil || !strings.Contains(err.Error(), "unparseable") {
+		t.Errorf("LoadConfig error = %v, want an invalid unparseable error", err)
+	}
+}
+
+func TestLoadConfigEmptyCommand(t *testing.T) {
+	cfg, err := LoadConfig([]byte(``))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.EmptyCommand != EmptyCommandAsk {
+		t.Errorf("EmptyCommand = %q, want default %q", cfg.Security.EmptyCommand, EmptyCommandAsk)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[security]
+empty_command = "allow"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.EmptyCommand != EmptyCommandAllow {
+		t.Errorf("EmptyCommand = %q, want %q", cfg.Security.EmptyCommand, EmptyCommandAllow)
+	}
+
+	_, err = LoadConfig([]byte(`
+[security]
+empty_command = "deny"
+`))
+	if err == nil || !strings.Contains(err.Error(), "empty_command") {
+		t.Errorf("LoadConfig error = %v, want an invalid empty_command error", err)
+	}
+}
+
+func TestLoadConfigSegmentAggregation(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`schema_version = 1`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.IgnoreSegmentDeny || cfg.Security.AllowPartialApproval || !cfg.Security.AllowMultiline {
+		t.Errorf("Security = %+v, want any_deny_denies_all, require_all_allow, and allow_multiline on by default", cfg.Security)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("Warnings = %v, want none", cfg.Warnings)
+	}
+
+	cfg, err = LoadConfig([]byte(`
+schema_version = 1
+
+[security]
+any_deny_denies_all = false
+require_all_allow = false
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.Security.IgnoreSegmentDeny || !cfg.Security.AllowPartialApproval {
+		t.Errorf("Security = %+v, want both relaxations on", cfg.Security)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "require_all_allow") {
+		t.Errorf("Warnings = %v, want a require_all_allow warning", cfg.Warnings)
+	}
+}
+
+func TestLoadConfigAllowMultiline(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[security]
+allow_multiline = false
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.AllowMultiline {
+		t.Error("AllowMultiline = true, want false")
+	}
+}
+
+func TestLoadConfigAllowDeclarations(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`schema_version = 1`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Security.AllowDeclarations {
+		t.Error("AllowDeclarations = true by default, want false")
+	}
+
+	cfg, err = LoadConfig([]byte(`
+[security]
+allow_declarations = true
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.Security.AllowDeclarations {
+		t.Error("AllowDeclarations = false, want true")
+	}
+}
+
+func TestLoadConfigApprovalReasonTemplate(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[output]
+approval_reason_template = "auto-approved by mmi: {matched}"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := cfg.Output.ApprovalReasonTemplate; got != "auto-approved by mmi: {matched}" {
+		t.Errorf("ApprovalReasonTemplate = %q", got)
+	}
+
+	_, err = LoadConfig([]byte(`
+[output]
+approval_reason_template = "{reason}"
+`))
+	if err == nil || !strings.Contains(err.Error(), "unknown placeholder {reason}") {
+		t.Errorf("LoadConfig error = %v, want an unknown placeholder error", err)
+	}
+}
+
+func TestLoadConfigNearMissHints(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[output]
+near_miss_hints = true
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.Output.NearMissHints {
+		t.Error("NearMissHints = false, want true")
+	}
+
+	cfg, err = LoadConfig([]byte(""))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Output.NearMissHints {
+		t.Error("NearMissHints should default to false")
+	}
+}
+
 func TestLoadConfigUnmatchedIncludeOverride(t *testing.T) {
 	dir := t.TempDir()
 
@@ -885,3 +2447,163 @@ commands = ["echo"]
 		t.Errorf("GetConfigPath() after Reset() = %q, want empty string", got)
 	}
 }
+
+func TestLoadConfigPathRestricted(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[commands.pathrestricted]]
+command = "cat"
+allowed_prefixes = ["./", "src/"]
+denied_prefixes = ["/etc/"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.SafeCommands) != 1 {
+		t.Fatalf("expected 1 safe command, got %d", len(cfg.SafeCommands))
+	}
+	p := cfg.SafeCommands[0]
+	if p.Type != "pathrestricted" || p.Name != "cat" {
+		t.Errorf("got Type=%q Name=%q, want pathrestricted/cat", p.Type, p.Name)
+	}
+	if len(p.AllowedPrefixes) != 2 || len(p.DeniedPrefixes) != 1 {
+		t.Errorf("got allowed=%v denied=%v", p.AllowedPrefixes, p.DeniedPrefixes)
+	}
+}
+
+func TestValidatePathRestrictedRequiresPrefixes(t *testing.T) {
+	_, err := LoadConfig([]byte(`
+[[commands.pathrestricted]]
+command = "cat"
+`))
+	if err == nil {
+		t.Fatal("expected error for pathrestricted entry without prefixes")
+	}
+	if !strings.Contains(err.Error(), "commands.pathrestricted[0]") {
+		t.Errorf("error should identify the entry, got: %v", err)
+	}
+}
+
+func TestLoadConfigArgLimits(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[[commands.simple]]
+name = "rm"
+commands = ["rm"]
+max_args = 1
+
+[[commands.regex]]
+pattern = '^touch\b'
+name = "touch"
+min_args = 1
+max_args = 3
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	limits := map[string][2]int{}
+	for _, p := range cfg.SafeCommands {
+		lim := [2]int{-1, -1}
+		if p.MinArgs != nil {
+			lim[0] = *p.MinArgs
+		}
+		if p.MaxArgs != nil {
+			lim[1] = *p.MaxArgs
+		}
+		limits[p.Name] = lim
+	}
+	if got := limits["rm"]; got != [2]int{-1, 1} {
+		t.Errorf("rm limits = %v, want [-1 1]", got)
+	}
+	if got := limits["touch"]; got != [2]int{1, 3} {
+		t.Errorf("touch limits = %v, want [1 3]", got)
+	}
+}
+
+func TestLoadConfigInvalidArgLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"negative", "[[commands.simple]]\ncommands = [\"rm\"]\nmax_args = -1", `"max_args" must be a non-negative integer`},
+		{"not an integer", "[[commands.simple]]\ncommands = [\"rm\"]\nmin_args = \"1\"", `"min_args" must be a non-negative integer`},
+		{"min exceeds max", "[[commands.simple]]\ncommands = [\"rm\"]\nmin_args = 2\nmax_args = 1", `"min_args" (2) must not exceed "max_args" (1)`},
+		{"wrapper", "[[wrappers.simple]]\ncommands = [\"sudo\"]\nmax_args = 1", "not supported for wrappers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig([]byte(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigWarnsOnUnanchoredPatterns(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+schema_version = 1
+[[commands.regex]]
+pattern = '^git\s+status\b'
+name = "anchored"
+
+[[commands.regex]]
+pattern = 'status'
+name = "unanchored"
+
+[[allow.regex]]
+pattern = '(?i)rm -rf build'
+name = "clean build"
+
+[[deny.regex]]
+pattern = 'rm -rf /'
+name = "deny anywhere"
+
+[[commands.simple]]
+name = "spaced"
+commands = ["ls", "git status"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	want := []string{
+		`commands.regex[1] "unanchored": pattern "status" doesn't start with ^`,
+		`commands.simple[0] "spaced": command "git status" contains a space`,
+		`allow.regex[0] "clean build": pattern "(?i)rm -rf build" doesn't start with ^`,
+	}
+	if len(cfg.Warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %d: %v", len(want), len(cfg.Warnings), cfg.Warnings)
+	}
+	for _, w := range want {
+		found := false
+		for _, got := range cfg.Warnings {
+			found = found || strings.Contains(got, w)
+		}
+		if !found {
+			t.Errorf("warnings should contain %q, got: %v", w, cfg.Warnings)
+		}
+	}
+}
+
+func TestLoadConfigWarnsOnNestedQuantifiers(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+schema_version = 1
+[[commands.regex]]
+pattern = '^ls\b'
+name = "listing"
+
+[[commands.regex]]
+pattern = '^(a+)+$'
+name = "pathological"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(cfg.Warnings), cfg.Warnings)
+	}
+	if !strings.Contains(cfg.Warnings[0], `commands.regex[1] "pathological"`) {
+		t.Errorf("warning should identify the entry, got: %s", cfg.Warnings[0])
+	}
+}
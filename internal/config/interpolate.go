@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// interpolatedFields are the entry fields whose values may reference
+// environment variables as $VAR or ${VAR}.
+var interpolatedFields = map[string]bool{
+	"command":          true,
+	"commands":         true,
+	"subcommands":      true,
+	"flags":            true,
+	"args":             true,
+	"pattern":          true,
+	"match":            true,
+	"allowed_prefixes": true,
+	"denied_prefixes":  true,
+}
+
+// interpolateEnv expands environment variable references in the pattern
+// fields of every entry in the raw config, in place. Referencing an undefined
+// variable is an error.
+func interpolateEnv(raw map[string]any) error {
+	for _, sectionName := range []string{"deny", "allow", "wrappers", "commands", "rewrites"} {
+		section, ok := raw[sectionName].(map[string]any)
+		if !ok {
+			continue
+		}
+		// Sort section types so the first error reported is deterministic
+		sectionTypes := make([]string, 0, len(section))
+		for sectionType := range section {
+			sectionTypes = append(sectionTypes, sectionType)
+		}
+		sort.Strings(sectionTypes)
+
+		for _, sectionType := range sectionTypes {
+			for i, entry := range toMapSlice(section[sectionType]) {
+				if err := interpolateEntry(entry); err != nil {
+					return fmt.Errorf("%s.%s[%d] %w", sectionName, sectionType, i, err)
+				}
+				// The groups of an anyof entry have their own pattern fields
+				for j, group := range toMapSlice(entry["groups"]) {
+					if err := interpolateEntry(group); err != nil {
+						return fmt.Errorf("%s.%s[%d] groups[%d] %w", sectionName, sectionType, i, j, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// interpolateEntry expands the pattern fields of entry in place. Errors are
+// prefixed with the field name.
+func interpolateEntry(entry map[string]any) error {
+	for field, value := range entry {
+		if !interpolatedFields[field] {
+			continue
+		}
+		expanded, err := expandValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		entry[field] = expanded
+	}
+	return nil
+}
+
+// expandValue expands a string or array of strings. Other values are
+// returned unchanged.
+func expandValue(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return expandEnv(v)
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			expanded, err := expandValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = expanded
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// expandEnv replaces $VAR and ${VAR} references in s with the values of the
+// environment variables. A "$" not followed by a variable name, such as a
+// regex end anchor, or escaped as "\$", is left as is.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			sb.WriteString(`\$`)
+			i++
+			continue
+		}
+		if c != '$' {
+			sb.WriteByte(c)
+			continue
+		}
+
+		name, width := envVarName(s[i+1:])
+		if name == "" {
+			sb.WriteByte(c)
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("undefined environment variable %q in %q", name, s)
+		}
+		recordEnv(name, value)
+		sb.WriteString(value)
+		i += width
+	}
+	return sb.String(), nil
+}
+
+// envVarName parses a variable reference following a "$": either NAME or
+// {NAME}. Returns the name and the number of bytes consumed, or "" if s
+// doesn't start with a valid reference.
+func envVarName(s string) (name string, width int) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.IndexByte(s, '}')
+		if end < 0 || !isEnvVarName(s[1:end]) {
+			return "", 0
+		}
+		return s[1:end], end + 1
+	}
+
+	n := 0
+	for n < len(s) && isEnvVarChar(s[n], n == 0) {
+		n++
+	}
+	return s[:n], n
+}
+
+// isEnvVarName reports whether s is a valid environment variable name.
+func isEnvVarName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isEnvVarChar(s[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEnvVarChar reports whether c may appear in a variable name. Digits are
+// not allowed first, so regex replacement references like $1 are untouched.
+func isEnvVarChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
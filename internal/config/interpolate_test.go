@@ -0,0 +1,113 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("MMI_TEST_HOME", "/home/alice")
+	t.Setenv("MMI_TEST_EMPTY", "")
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"$MMI_TEST_HOME/projects/", "/home/alice/projects/", false},
+		{"${MMI_TEST_HOME}/projects/", "/home/alice/projects/", false},
+		{"pre${MMI_TEST_EMPTY}post", "prepost", false},
+		{"no variables", "no variables", false},
+		{"^(true|false)$", "^(true|false)$", false},
+		{`^echo\s+\$HOME`, `^echo\s+\$HOME`, false},
+		{"$1 and ${", "$1 and ${", false},
+		{"$MMI_TEST_UNSET_VAR/x", "", true},
+		{"${MMI_TEST_UNSET_VAR}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := expandEnv(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandEnv(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandEnv(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInterpolatesEnv(t *testing.T) {
+	t.Setenv("MMI_TEST_HOME", "/home/alice")
+	t.Setenv("MMI_TEST_TOOL", "mytool")
+
+	cfg, err := LoadConfig([]byte(`
+[[commands.pathrestricted]]
+command = "cat"
+allowed_prefixes = ["$MMI_TEST_HOME/projects/"]
+
+[[commands.simple]]
+name = "tool"
+commands = ["${MMI_TEST_TOOL}"]
+
+[[commands.regex]]
+name = "tool regex"
+pattern = '^${MMI_TEST_TOOL}\s+run$'
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	var prefixes []string
+	matched := map[string]bool{}
+	for _, p := range cfg.SafeCommands {
+		if p.Type == "pathrestricted" {
+			prefixes = p.AllowedPrefixes
+		}
+		for _, cmd := range []string{"mytool build", "mytool run"} {
+			if p.Regex.MatchString(cmd) {
+				matched[p.Name+": "+cmd] = true
+			}
+		}
+	}
+	if len(prefixes) != 1 || prefixes[0] != "/home/alice/projects/" {
+		t.Errorf("AllowedPrefixes = %v, want [/home/alice/projects/]", prefixes)
+	}
+	if !matched["tool: mytool build"] {
+		t.Error("expected simple command to be interpolated")
+	}
+	if !matched["tool regex: mytool run"] {
+		t.Error("expected regex pattern to be interpolated")
+	}
+}
+
+func TestLoadConfigInterpolatesAllowOverrides(t *testing.T) {
+	t.Setenv("MMI_TEST_BUILD_DIR", "./build")
+
+	cfg, err := LoadConfig([]byte(`
+[[allow.regex]]
+name = "clean build"
+pattern = '^rm -rf ${MMI_TEST_BUILD_DIR}$'
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.AllowOverrides) != 1 || !cfg.AllowOverrides[0].Regex.MatchString("rm -rf ./build") {
+		t.Errorf("AllowOverrides = %+v, want the pattern interpolated to match rm -rf ./build", cfg.AllowOverrides)
+	}
+}
+
+func TestLoadConfigUndefinedEnvVar(t *testing.T) {
+	_, err := LoadConfig([]byte(`
+[[deny.simple]]
+name = "repo"
+commands = ["$MMI_TEST_UNSET_VAR"]
+`))
+	if err == nil {
+		t.Fatal("expected error for undefined environment variable")
+	}
+	if !strings.Contains(err.Error(), `deny.simple[0] commands: undefined environment variable "MMI_TEST_UNSET_VAR"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
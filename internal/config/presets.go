@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+//go:embed presets/*.toml
+var presetFiles embed.FS
+
+// presetFragments lists the fragments each preset adds to presets/base.toml,
+// in order.
+var presetFragments = map[string][]string{
+	"python":      {"python"},
+	"node":        {"node"},
+	"datascience": {"python", "datascience"},
+}
+
+// Presets returns the names of the config presets, sorted.
+func Presets() []string {
+	names := make([]string, 0, len(presetFragments))
+	for name := range presetFragments {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// GetPreset returns the config for the named preset: the shared deny rules,
+// wrappers, and commands of presets/base.toml followed by the preset's
+// fragments.
+func GetPreset(name string) ([]byte, error) {
+	fragments, ok := presetFragments[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q: must be one of %s", name, strings.Join(Presets(), ", "))
+	}
+
+	var buf bytes.Buffer
+	for _, file := range append([]string{"base"}, fragments...) {
+		data, err := presetFiles.ReadFile("presets/" + file + ".toml")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read preset fragment %q: %w", file, err)
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
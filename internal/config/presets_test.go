@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPresetsLoad(t *testing.T) {
+	for _, name := range Presets() {
+		t.Run(name, func(t *testing.T) {
+			data, err := GetPreset(name)
+			if err != nil {
+				t.Fatalf("GetPreset(%q) failed: %v", name, err)
+			}
+			cfg, err := LoadConfig(data)
+			if err != nil {
+				t.Fatalf("preset %q failed to load: %v", name, err)
+			}
+			if len(cfg.DenyPatterns) == 0 {
+				t.Errorf("preset %q has no deny patterns", name)
+			}
+			if len(cfg.Warnings) != 0 {
+				t.Errorf("preset %q has warnings: %v", name, cfg.Warnings)
+			}
+		})
+	}
+}
+
+func TestGetPresetUnknown(t *testing.T) {
+	_, err := GetPreset("cobol")
+	if err == nil || !strings.Contains(err.Error(), "python") {
+		t.Errorf("GetPreset(\"cobol\") error = %v, want it to list the presets", err)
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/dgerlanc/mmi/internal/constants"
+	"github.com/dgerlanc/mmi/internal/logger"
+)
+
+// FindProjectConfig searches dir and its parents for a project config file.
+// Returns the path of the nearest one, or "" if none is found.
+func FindProjectConfig(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, constants.ProjectConfigFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ForDir returns the configuration for commands run in dir: the global
+// configuration with the nearest project config file layered on top.
+//
+// A project config can only add patterns. Its deny patterns are appended to
+// the global ones, and because deny patterns are checked first, global deny
+// patterns always win. Its allow overrides are ignored for the same reason.
+// Scalar settings such as [subshell] and [defaults] come from the global
+// configuration only.
+//
+// If the global configuration failed to load, or the project config can't be
+// loaded, the global configuration is returned unchanged.
+func ForDir(dir string) *Config {
+	cfg := Get()
+	if InitError() != nil {
+		return cfg
+	}
+
+	path := FindProjectConfig(dir)
+	if path == "" {
+		return cfg
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Debug("failed to read project config", "path", path, "error", err)
+		return cfg
+	}
+
+	projectCfg, err := LoadConfigWithDir(data, filepath.Dir(path))
+	if err != nil {
+		logger.Debug("failed to load project config", "path", path, "error", err)
+		return cfg
+	}
+
+	logger.Debug("project config loaded",
+		"path", path,
+		"wrappers", len(projectCfg.WrapperPatterns),
+		"commands", len(projectCfg.SafeCommands))
+	return mergeProject(cfg, projectCfg)
+}
+
+// mergeProject returns a copy of base with the patterns of project appended.
+func mergeProject(base, project *Config) *Config {
+	merged := *base
+	merged.WrapperPatterns = appendCopy(base.WrapperPatterns, project.WrapperPatterns)
+	merged.SafeCommands = appendCopy(base.SafeCommands, project.SafeCommands)
+	merged.DenyPatterns = appendCopy(base.DenyPatterns, project.DenyPatterns)
+	merged.DescriptionAllow = appendCopy(base.DescriptionAllow, project.DescriptionAllow)
+	merged.DescriptionDeny = appendCopy(base.DescriptionDeny, project.DescriptionDeny)
+	merged.RewriteRules = appendCopy(base.RewriteRules, project.RewriteRules)
+	merged.Warnings = appendCopy(base.Warnings, project.Warnings)
+	sortByPriority(merged.SafeCommands)
+	sortByPriority(merged.DenyPatterns)
+	return &merged
+}
+
+// appendCopy appends b to a copy of a, leaving a's backing array untouched.
+func appendCopy[T any](a, b []T) []T {
+	result := make([]T, 0, len(a)+len(b))
+	result = append(result, a...)
+	return append(result, b...)
+}
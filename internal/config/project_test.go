@@ -0,0 +1,175 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupProjectTree writes a global config and returns a temp repo root.
+func setupProjectTree(t *testing.T, globalConfig string) string {
+	t.Helper()
+	configDir := t.TempDir()
+	t.Setenv("MMI_CONFIG", configDir)
+	if err := os.WriteFile(filepath.Join(configDir, "config.toml"), []byte(globalConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Reset()
+	t.Cleanup(Reset)
+	return t.TempDir()
+}
+
+func hasSafeCommand(cfg *Config, name string) bool {
+	for _, p := range cfg.SafeCommands {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFindProjectConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b", "c")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := FindProjectConfig(nested); got != "" {
+		t.Errorf("FindProjectConfig() = %q, want no match", got)
+	}
+
+	projectPath := filepath.Join(root, "a", ".mmi.toml")
+	if err := os.WriteFile(projectPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindProjectConfig(nested); got != projectPath {
+		t.Errorf("FindProjectConfig() = %q, want %q", got, projectPath)
+	}
+
+	// The nearest file wins
+	nearerPath := filepath.Join(nested, ".mmi.toml")
+	if err := os.WriteFile(nearerPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindProjectConfig(nested); got != nearerPath {
+		t.Errorf("FindProjectConfig() = %q, want %q", got, nearerPath)
+	}
+
+	if got := FindProjectConfig(""); got != "" {
+		t.Errorf("FindProjectConfig(\"\") = %q, want \"\"", got)
+	}
+}
+
+func TestForDirMergesProjectConfig(t *testing.T) {
+	root := setupProjectTree(t, `
+[[commands.simple]]
+name = "global"
+commands = ["ls"]
+
+[[deny.simple]]
+name = "no rm"
+commands = ["rm"]
+
+[[allow.regex]]
+pattern = '^rm -rf \./build$'
+name = "clean build"
+
+[defaults]
+unmatched = "deny"
+`)
+	project := `
+[[commands.simple]]
+name = "project"
+commands = ["make"]
+
+[[deny.simple]]
+name = "no deploy"
+commands = ["deploy"]
+
+[[allow.simple]]
+name = "project rm"
+commands = ["rm"]
+
+[defaults]
+unmatched = "passthrough"
+`
+	if err := os.WriteFile(filepath.Join(root, ".mmi.toml"), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(root, "src", "pkg")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := ForDir(subdir)
+
+	if !hasSafeCommand(cfg, "global") || !hasSafeCommand(cfg, "project") {
+		t.Errorf("expected global and project commands, got %d safe commands", len(cfg.SafeCommands))
+	}
+	if len(cfg.DenyPatterns) != 2 || cfg.DenyPatterns[0].Name != "no rm" {
+		t.Errorf("expected global deny first followed by project deny, got %d patterns", len(cfg.DenyPatterns))
+	}
+	if cfg.Unmatched != UnmatchedDeny {
+		t.Errorf("Unmatched = %q, want global value %q", cfg.Unmatched, UnmatchedDeny)
+	}
+	// A project can't override global deny patterns
+	if len(cfg.AllowOverrides) != 1 || cfg.AllowOverrides[0].Name != "clean build" {
+		t.Errorf("AllowOverrides = %v, want only the global override", cfg.AllowOverrides)
+	}
+
+	// The global config must not be modified
+	if hasSafeCommand(Get(), "project") {
+		t.Error("ForDir() modified the global config")
+	}
+}
+
+func TestForDirWithoutProjectConfig(t *testing.T) {
+	root := setupProjectTree(t, `
+[[commands.simple]]
+name = "global"
+commands = ["ls"]
+`)
+
+	if cfg := ForDir(root); cfg != Get() {
+		t.Error("ForDir() without a project config should return the global config")
+	}
+}
+
+func TestForDirInvalidProjectConfig(t *testing.T) {
+	root := setupProjectTree(t, `
+[[commands.simple]]
+name = "global"
+commands = ["ls"]
+`)
+	if err := os.WriteFile(filepath.Join(root, ".mmi.toml"), []byte(`[[commands.simple]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg := ForDir(root); cfg != Get() {
+		t.Error("ForDir() with an invalid project config should fall back to the global config")
+	}
+}
+
+func TestForDirProjectIncludes(t *testing.T) {
+	root := setupProjectTree(t, `
+[[commands.simple]]
+name = "global"
+commands = ["ls"]
+`)
+	if err := os.WriteFile(filepath.Join(root, ".mmi.toml"), []byte(`include = ["extra.toml"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	extra := `
+[[commands.simple]]
+name = "extra"
+commands = ["cargo"]
+`
+	if err := os.WriteFile(filepath.Join(root, "extra.toml"), []byte(extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg := ForDir(root); !hasSafeCommand(cfg, "extra") {
+		t.Error("expected project include to be resolved relative to the project directory")
+	}
+}
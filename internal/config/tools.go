@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/dgerlanc/mmi/internal/patterns"
+)
+
+// ToolConfig holds the [tools.<name>] settings for a non-Bash tool.
+type ToolConfig struct {
+	// Field is the tool_input field holding the string to match, like "file_path"
+	Field string
+	// Allow are the patterns that approve the tool call
+	Allow []patterns.Pattern
+	// Deny are the patterns that always reject the tool call
+	Deny []patterns.Pattern
+}
+
+// parseToolsSection parses the [tools] section. Each subsection names a tool
+// and lists the input field to match and its allow and deny regexes:
+//
+//	[tools.Read]
+//	field = "file_path"
+//	allow = ['^/home/me/project/']
+//	deny = ['\.env$']
+func parseToolsSection(sectionData map[string]any) (map[string]ToolConfig, error) {
+	result := make(map[string]ToolConfig)
+	for name, value := range sectionData {
+		entry, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("tools.%s: must be a table", name)
+		}
+		if name == "Bash" {
+			return nil, fmt.Errorf("tools.%s: Bash commands are configured with the [commands] and [deny] sections", name)
+		}
+
+		field, _ := entry["field"].(string)
+		if field == "" {
+			return nil, fmt.Errorf("tools.%s: \"field\" field is required and must not be empty", name)
+		}
+
+		allow, err := compileToolPatterns(name, "allow", toStringSlice(entry["allow"]))
+		if err != nil {
+			return nil, err
+		}
+		deny, err := compileToolPatterns(name, "deny", toStringSlice(entry["deny"]))
+		if err != nil {
+			return nil, err
+		}
+
+		result[name] = ToolConfig{Field: field, Allow: allow, Deny: deny}
+	}
+	return result, nil
+}
+
+// compileToolPatterns compiles the allow or deny regexes of a tool. Each
+// pattern is named after itself.
+func compileToolPatterns(tool, kind string, raw []string) ([]patterns.Pattern, error) {
+	var result []patterns.Pattern
+	for i, pattern := range raw {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("tools.%s.%s[%d]: invalid pattern %q: %w", tool, kind, i, pattern, err)
+		}
+		result = append(result, patterns.Pattern{Regex: re, Name: pattern, Type: "regex", Pattern: pattern})
+	}
+	return result, nil
+}
+
+// mergeTools merges the tool settings of src into dst. Patterns are appended;
+// the field is taken from src.
+func mergeTools(dst, src map[string]ToolConfig) map[string]ToolConfig {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]ToolConfig)
+	}
+	for name, tool := range src {
+		existing := dst[name]
+		existing.Field = tool.Field
+		existing.Allow = append(existing.Allow, tool.Allow...)
+		existing.Deny = append(existing.Deny, tool.Deny...)
+		dst[name] = existing
+	}
+	return dst
+}
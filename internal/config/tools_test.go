@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigTools(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+[tools.Read]
+field = "file_path"
+allow = ['^/src/', '^/docs/']
+deny = ['\.env$']
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tool, ok := cfg.Tools["Read"]
+	if !ok {
+		t.Fatal("Tools should contain Read")
+	}
+	if tool.Field != "file_path" {
+		t.Errorf("Field = %q, want file_path", tool.Field)
+	}
+	if len(tool.Allow) != 2 || len(tool.Deny) != 1 {
+		t.Fatalf("got %d allow and %d deny patterns, want 2 and 1", len(tool.Allow), len(tool.Deny))
+	}
+	if !tool.Deny[0].Regex.MatchString("/src/.env") {
+		t.Error("deny pattern should match /src/.env")
+	}
+}
+
+func TestLoadConfigToolsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"missing field", "[tools.Read]\nallow = ['^/src/']\n", `tools.Read: "field" field is required`},
+		{"invalid regex", "[tools.Read]\nfield = \"file_path\"\nallow = ['(']\n", "tools.Read.allow[0]: invalid pattern"},
+		{"bash", "[tools.Bash]\nfield = \"command\"\n", "tools.Bash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig([]byte(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigToolsMergedFromIncludes(t *testing.T) {
+	tmpDir := t.TempDir()
+	included := `
+[tools.Read]
+field = "file_path"
+allow = ['^/docs/']
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "read.toml"), []byte(included), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigWithDir([]byte(`
+include = ["read.toml"]
+
+[tools.Read]
+field = "file_path"
+allow = ['^/src/']
+`), tmpDir)
+	if err != nil {
+		t.Fatalf("LoadConfigWithDir failed: %v", err)
+	}
+	if got := len(cfg.Tools["Read"].Allow); got != 2 {
+		t.Errorf("Read allow patterns = %d, want 2", got)
+	}
+}
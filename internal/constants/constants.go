@@ -10,7 +10,13 @@ const (
 )
 
 // Environment variables
-const EnvConfigDir = "MMI_CONFIG"
+const (
+	EnvConfigDir     = "MMI_CONFIG"
+	EnvConfigExtra   = "MMI_CONFIG_EXTRA"
+	EnvPassthrough   = "MMI_PASSTHROUGH"
+	EnvAuditOutput   = "MMI_AUDIT_OUTPUT"
+	EnvNoDefaultDeny = "MMI_NO_DEFAULT_DENY"
+)
 
 // Application paths
 const (
@@ -19,4 +25,5 @@ const (
 	ClaudeConfigDir    = ".claude"
 	ClaudeSettingsFile = "settings.json"
 	ConfigFileName     = "config.toml"
+	ProjectConfigFile  = ".mmi.toml"
 )
@@ -0,0 +1,269 @@
+package hook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/patterns"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// parseCallArgs parses a single simple command and returns its arguments as
+// literal strings, with quotes removed. The command name is args[0].
+// ok is false if the command is not a simple call or any argument contains an
+// expansion (variables, globs, braces, substitutions) whose value can't be
+// known statically.
+func parseCallArgs(cmd string) (args []string, ok bool) {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return nil, false
+	}
+	call, isCall := prog.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !isCall {
+		return nil, false
+	}
+	for _, word := range call.Args {
+		s, literal := wordLiteral(word)
+		if !literal || hasUnquotedGlob(word) {
+			return nil, false
+		}
+		args = append(args, s)
+	}
+	return args, len(args) > 0
+}
+
+// wordLiteral returns the unquoted value of a shell word.
+// literal is false if the word contains any part that the shell would expand.
+func wordLiteral(word *syntax.Word) (value string, literal bool) {
+	var sb strings.Builder
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range p.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+// positionalArgs returns the non-flag arguments following the command name.
+// Everything after a "--" terminator is positional.
+func positionalArgs(args []string) []string {
+	var result []string
+	endOfFlags := false
+	for _, arg := range args[1:] {
+		if !endOfFlags {
+			if arg == "--" {
+				endOfFlags = true
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+// pathArg is an argument of a path-restricted command that may name a path.
+type pathArg struct {
+	path string
+	// optionValue is set for a number following an option, like the 5 in
+	// head -n 5, which is more likely the option's value than a file
+	optionValue bool
+}
+
+// pathArgs returns the arguments of a command that may name paths: its
+// positional arguments, the values attached to long options (--file=x), and
+// the rest of a short option cluster that looks like a path (-f/etc/x).
+// A lone "-" means standard input and is skipped. Everything after a "--"
+// terminator is positional.
+func pathArgs(args []string) []pathArg {
+	var result []pathArg
+	endOfFlags := false
+	afterOption := false
+	for _, arg := range args[1:] {
+		if !endOfFlags && strings.HasPrefix(arg, "-") {
+			switch {
+			case arg == "-":
+				// Standard input
+				afterOption = false
+				continue
+			case arg == "--":
+				endOfFlags = true
+			case strings.HasPrefix(arg, "--"):
+				if _, value, found := strings.Cut(arg, "="); found && value != "" {
+					result = append(result, pathArg{path: value})
+				}
+			case len(arg) > 2 && looksLikePath(arg[2:]):
+				result = append(result, pathArg{path: arg[2:]})
+			}
+			afterOption = arg != "--"
+			continue
+		}
+		result = append(result, pathArg{path: arg, optionValue: afterOption && isNumber(arg)})
+		afterOption = false
+	}
+	return result
+}
+
+// looksLikePath reports whether s, the rest of a short option cluster, reads
+// as a path rather than more option letters.
+func looksLikePath(s string) bool {
+	return strings.ContainsRune(s, '/') || strings.HasPrefix(s, "~") || strings.HasPrefix(s, ".")
+}
+
+// isNumber reports whether s is a non-empty string of decimal digits.
+func isNumber(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// expandHome replaces a leading "~" with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// hasPathPrefix reports whether path lies within prefix after cleaning both.
+// A relative prefix of "." or "./" matches any relative path that does not
+// escape the current directory.
+func hasPathPrefix(path, prefix string) bool {
+	path = filepath.Clean(expandHome(path))
+	prefix = filepath.Clean(expandHome(prefix))
+
+	if prefix == "." {
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, "../")
+	}
+	if path == prefix {
+		return true
+	}
+	if prefix == "/" {
+		return filepath.IsAbs(path)
+	}
+	return strings.HasPrefix(path, prefix+"/")
+}
+
+// checkPathRestrictions validates the path arguments of cmd, and the targets
+// of its input redirections, against the allowed and denied path prefixes of
+// p, resolving relative paths against dir. Numbers that follow an option are
+// only checked against the denied prefixes, since they are usually the
+// option's value. Returns a description of the first violation, or "" if all
+// arguments are permitted.
+func checkPathRestrictions(cmd string, p patterns.Pattern, dir workDir, inputs []string) string {
+	args, ok := parseCallArgs(cmd)
+	if !ok {
+		return "arguments cannot be resolved statically"
+	}
+
+	candidates := pathArgs(args)
+	for _, input := range inputs {
+		if input == dynamicWord {
+			return "input redirection target cannot be resolved statically"
+		}
+		candidates = append(candidates, pathArg{path: input})
+	}
+	for _, candidate := range candidates {
+		arg := candidate.path
+		path, ok := dir.resolve(arg)
+		if !ok {
+			return fmt.Sprintf("path %q is relative to a directory changed by a cd that cannot be resolved statically", arg)
+		}
+		for _, denied := range p.DeniedPrefixes {
+			if hasPathPrefix(path, dir.resolvePrefix(denied)) {
+				return fmt.Sprintf("path %q is under denied prefix %q", arg, denied)
+			}
+		}
+		if len(p.AllowedPrefixes) == 0 || candidate.optionValue {
+			continue
+		}
+		allowed := false
+		for _, prefix := range p.AllowedPrefixes {
+			if hasPathPrefix(path, dir.resolvePrefix(prefix)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("path %q is outside allowed prefixes", arg)
+		}
+	}
+	return ""
+}
+
+// hasUnquotedGlob reports whether word contains an unquoted glob or brace
+// expansion, which makes the number of arguments it becomes unknowable.
+func hasUnquotedGlob(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		if lit, ok := part.(*syntax.Lit); ok && strings.ContainsAny(lit.Value, "*?[{") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArgCount validates the number of positional arguments of cmd against
+// the min_args and max_args bounds of p. For subcommand patterns, the words of
+// the matched subcommand aren't counted. Returns a description of the
+// violation, or "" if the count is within bounds.
+func checkArgCount(cmd string, p patterns.Pattern) string {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return "argument count cannot be determined statically"
+	}
+	call, isCall := prog.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !isCall || len(call.Args) == 0 {
+		return "argument count cannot be determined statically"
+	}
+	var args []string
+	for _, word := range call.Args {
+		s, literal := wordLiteral(word)
+		if !literal || hasUnquotedGlob(word) {
+			return "argument count cannot be determined statically"
+		}
+		args = append(args, s)
+	}
+
+	positional := positionalArgs(args)
+	if p.Type == "subcommand" {
+		skip := 0
+		for _, sub := range p.Subcommands {
+			words := strings.Fields(sub)
+			if len(words) > skip && len(words) <= len(positional) && slices.Equal(words, positional[:len(words)]) {
+				skip = len(words)
+			}
+		}
+		positional = positional[skip:]
+	}
+
+	n := len(positional)
+	switch {
+	case p.MinArgs != nil && n < *p.MinArgs:
+		return fmt.Sprintf("%d arguments given, at least %d required", n, *p.MinArgs)
+	case p.MaxArgs != nil && n > *p.MaxArgs:
+		return fmt.Sprintf("%d arguments given, at most %d allowed", n, *p.MaxArgs)
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package hook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCallArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		cmd    string
+		want   []string
+		wantOK bool
+	}{
+		{"plain args", "cat src/main.go", []string{"cat", "src/main.go"}, true},
+		{"single quoted", "cat 'my file.txt'", []string{"cat", "my file.txt"}, true},
+		{"double quoted", `cat "my file.txt"`, []string{"cat", "my file.txt"}, true},
+		{"mixed quoting", `cat src/"a b"/c`, []string{"cat", "src/a b/c"}, true},
+		{"variable expansion", "cat $HOME/x", nil, false},
+		{"quoted variable expansion", `cat "$HOME/x"`, nil, false},
+		{"glob", "cat /e*/shadow", nil, false},
+		{"brace expansion", "cat {/etc,/tmp}/shadow", nil, false},
+		{"quoted glob", "cat '/e*/shadow'", []string{"cat", "/e*/shadow"}, true},
+		{"not a simple call", "ls && pwd", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCallArgs(tt.cmd)
+			if ok != tt.wantOK {
+				t.Fatalf("parseCallArgs(%q) ok = %v, want %v", tt.cmd, ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCallArgs(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPositionalArgs(t *testing.T) {
+	got := positionalArgs([]string{"head", "-n", "5", "a.txt", "--", "-b.txt"})
+	want := []string{"5", "a.txt", "-b.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("positionalArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestPathArgs(t *testing.T) {
+	got := pathArgs([]string{"grep", "-n", "5", "--file=/etc/x", "-f/etc/y", "-la", "-", "a.txt", "--", "-b.txt"})
+	want := []pathArg{
+		{path: "5", optionValue: true},
+		{path: "/etc/x"},
+		{path: "/etc/y"},
+		{path: "a.txt"},
+		{path: "-b.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pathArgs() = %+v, want %+v", got, want)
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix string
+		want   bool
+	}{
+		{"src/main.go", "src/", true},
+		{"src", "src/", true},
+		{"srcfoo/x", "src/", false},
+		{"./src/main.go", "src/", true},
+		{"src/../../etc/passwd", "src/", false},
+		{"main.go", "./", true},
+		{"../main.go", "./", false},
+		{"/etc/main.go", "./", false},
+		{"/etc/passwd", "/etc/", true},
+		{"/etcetera", "/etc/", false},
+		{"/var/../etc/shadow", "/etc/", true},
+	}
+
+	for _, tt := range tests {
+		if got := hasPathPrefix(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("hasPathPrefix(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestHasPathPrefixExpandsHome(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+
+	if !hasPathPrefix("/home/tester/.ssh/id_rsa", "~/.ssh/") {
+		t.Error("expected absolute path under ~/.ssh/ to match")
+	}
+	if !hasPathPrefix("~/.ssh/id_rsa", "/home/tester/.ssh") {
+		t.Error("expected ~ in path to expand to home directory")
+	}
+}
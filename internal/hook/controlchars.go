@@ -0,0 +1,19 @@
+package hook
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// findControlChar describes the first NUL byte or control character in cmd
+// other than whitespace like tab and newline, or returns "" if there is none.
+// Such characters are invisible when the command is reviewed, and terminals
+// and shells may interpret them differently than the parser.
+func findControlChar(cmd string) string {
+	for i, r := range cmd {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return fmt.Sprintf("%U at byte %d", r, i)
+		}
+	}
+	return ""
+}
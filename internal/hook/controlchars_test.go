@@ -0,0 +1,66 @@
+package hook
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+)
+
+func TestFindControlChar(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"ls -la", ""},
+		{"ls\tfoo\nfoo\r\n", ""},
+		{"echo héllo", ""},
+		{"ls\x00rm", "U+0000 at byte 2"},
+		{"echo \x1b[2Jhi", "U+001B at byte 5"},
+		{"cat f\x7f", "U+007F at byte 5"},
+		{"echo \u0085", ""},
+	}
+	for _, tt := range tests {
+		if got := findControlChar(tt.cmd); got != tt.want {
+			t.Errorf("findControlChar(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestProcessWithResultControlChars(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.simple]]
+name = "safe"
+commands = ["ls", "echo"]
+`)
+	defer cleanupConfig()
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	tests := []struct {
+		name string
+		cmd  string // JSON-escaped
+	}{
+		{"NUL byte", `ls\u0000 -la`},
+		{"escape sequence", `echo \u001b[1A\u001b[2Kls`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"` + tt.cmd + `"}}`))
+			if result.Approved {
+				t.Fatal("expected command with control characters to be rejected")
+			}
+			if result.Output != FormatDeny("command contains control characters") {
+				t.Errorf("Output = %s, want deny", result.Output)
+			}
+			entry := readLastAuditEntry(t, logPath)
+			if len(entry.Segments) != 1 || entry.Segments[0].Rejection == nil || entry.Segments[0].Rejection.Code != audit.CodeInvalidChars {
+				t.Errorf("Segments = %+v, want one %s rejection", entry.Segments, audit.CodeInvalidChars)
+			}
+		})
+	}
+
+	if result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls -la\techo hi"}}`)); !result.Approved {
+		t.Errorf("expected command with only whitespace to be approved, got %s", result.Output)
+	}
+}
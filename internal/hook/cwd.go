@@ -0,0 +1,137 @@
+package hook
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/patterns"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// workDir is the directory a segment runs in, as far as it can be known
+// statically. Path-restricted commands resolve relative paths against it.
+// The zero value resolves nothing, which keeps paths as written.
+type workDir struct {
+	// start is the directory the command was started in, "" if unknown
+	start string
+	// cwd is the directory after any earlier cd. It is relative to start
+	// when start is unknown, and "" before any cd.
+	cwd string
+	// lost is set after a cd whose target can't be determined
+	lost bool
+}
+
+// trackWorkDirs returns the directory each of segments runs in, starting
+// from start and following the cd commands among them. A cd affects every
+// later segment, whatever operator joins them, so `cd a || rm x` is resolved
+// as if the cd succeeded.
+func trackWorkDirs(start string, segments []string, wrapperPatterns []patterns.Pattern) []workDir {
+	dirs := make([]workDir, len(segments))
+	dir := workDir{start: start, cwd: start}
+	for i, segment := range segments {
+		dirs[i] = dir
+		coreCmd, _ := StripWrappers(segment, wrapperPatterns)
+		dir = dir.afterCd(coreCmd)
+	}
+	return dirs
+}
+
+// segmentWorkDirs maps each of segments to the directories it runs in, as
+// returned by trackWorkDirs. A segment that appears more than once, like the
+// two echos of "echo x > f; cd ~; echo x > f", maps to every directory.
+func segmentWorkDirs(segments []string, dirs []workDir) map[string][]workDir {
+	result := make(map[string][]workDir, len(segments))
+	for i, segment := range segments {
+		result[segment] = append(result[segment], dirs[i])
+	}
+	return result
+}
+
+// afterCd returns the directory after running cmd, which changes it only if
+// cmd is a cd.
+func (d workDir) afterCd(cmd string) workDir {
+	if fields := strings.Fields(cmd); len(fields) == 0 || fields[0] != "cd" {
+		return d
+	}
+	args, ok := parseCallArgs(cmd)
+	if !ok {
+		d.lost = true
+		return d
+	}
+
+	targets := positionalArgs(args)
+	var target string
+	switch {
+	case len(targets) == 0:
+		target = "~"
+	case targets[0] == "-":
+		d.lost = true
+		return d
+	default:
+		target = targets[0]
+	}
+	target = expandHome(target)
+	if target == "~" {
+		// The home directory couldn't be determined
+		d.lost = true
+		return d
+	}
+	if filepath.IsAbs(target) {
+		d.cwd = filepath.Clean(target)
+	} else {
+		d.cwd = filepath.Join(d.cwd, target)
+	}
+	return d
+}
+
+// resolve returns path as seen from d: absolute and home-relative paths are
+// unchanged, relative paths are joined to the current directory. ok is false
+// for a relative path after the directory was lost.
+func (d workDir) resolve(path string) (resolved string, ok bool) {
+	path = expandHome(path)
+	if filepath.IsAbs(path) {
+		return path, true
+	}
+	if d.lost {
+		return "", false
+	}
+	if d.cwd == "" {
+		return path, true
+	}
+	return filepath.Join(d.cwd, path), true
+}
+
+// resolvePrefix returns a path-restriction prefix as seen from d. Relative
+// prefixes are relative to the directory the command was started in, not to
+// the current one, so a cd can't move them.
+func (d workDir) resolvePrefix(prefix string) string {
+	prefix = expandHome(prefix)
+	if filepath.IsAbs(prefix) || d.start == "" {
+		return prefix
+	}
+	return filepath.Join(d.start, prefix)
+}
+
+// resolveCommandPath returns the absolute path of the program cmd runs when
+// it is named by a path, like ./deploy.sh or bin/tool, as seen from d.
+// Returns "" for commands looked up in PATH, for command words that aren't
+// literal, and when the directory can't be known.
+func resolveCommandPath(cmd string, d workDir) string {
+	prog, err := syntax.NewParser().Parse(strings.NewReader(cmd), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return ""
+	}
+	call, ok := prog.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return ""
+	}
+	name, literal := wordLiteral(call.Args[0])
+	if !literal || !strings.Contains(name, "/") {
+		return ""
+	}
+	resolved, ok := d.resolve(name)
+	if !ok || !filepath.IsAbs(resolved) {
+		return ""
+	}
+	return filepath.Clean(resolved)
+}
@@ -0,0 +1,151 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestTrackWorkDirs(t *testing.T) {
+	segments := []string{"ls", "cd sub", "ls", "cd ../other", "cd /tmp", "cd $DIR", "ls"}
+	want := []workDir{
+		{start: "/proj", cwd: "/proj"},
+		{start: "/proj", cwd: "/proj"},
+		{start: "/proj", cwd: "/proj/sub"},
+		{start: "/proj", cwd: "/proj/sub"},
+		{start: "/proj", cwd: "/proj/other"},
+		{start: "/proj", cwd: "/tmp"},
+		{start: "/proj", cwd: "/tmp", lost: true},
+	}
+
+	got := trackWorkDirs("/proj", segments, nil)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("segment %d (%q) runs in %+v, want %+v", i, segments[i], got[i], want[i])
+		}
+	}
+}
+
+func TestWorkDirResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		dir    workDir
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"relative", workDir{start: "/proj", cwd: "/proj/sub"}, "foo", "/proj/sub/foo", true},
+		{"parent", workDir{start: "/proj", cwd: "/proj/sub"}, "../foo", "/proj/foo", true},
+		{"absolute", workDir{start: "/proj", cwd: "/proj/sub"}, "/etc/hosts", "/etc/hosts", true},
+		{"unknown start", workDir{}, "foo", "foo", true},
+		{"relative cd from unknown start", workDir{cwd: ".."}, "foo", "../foo", true},
+		{"lost", workDir{start: "/proj", cwd: "/proj", lost: true}, "foo", "", false},
+		{"lost absolute", workDir{start: "/proj", cwd: "/proj", lost: true}, "/tmp/foo", "/tmp/foo", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.dir.resolve(tt.path)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("resolve(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPathRestrictionsFollowCd(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "cd"
+commands = ["cd"]
+
+[[commands.pathrestricted]]
+command = "rm"
+allowed_prefixes = ["./", "/proj/"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		cwd      string
+		approved bool
+	}{
+		{"rm foo", "/proj", true},
+		{"cd /tmp && rm foo", "/proj", false},
+		{"cd sub && rm foo", "/proj", true},
+		{"cd .. && rm foo", "/proj", false},
+		{"cd /proj/a && rm ../b", "/proj", true},
+		{"cd / && rm -rf etc", "/proj", false},
+		{"cd $DIR && rm foo", "/proj", false},
+		{"cd $DIR && rm /proj/foo", "/proj", true},
+		{"rm foo", "/elsewhere", true},
+		{"cd /tmp && rm foo", "", false},
+		{"cd sub && rm foo", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cwd+": "+tt.cmd, func(t *testing.T) {
+			result := EvaluateCommandInDir(tt.cmd, tt.cwd, cfg)
+			if result.Approved != tt.approved {
+				t.Errorf("Approved = %v, want %v (segments: %+v)", result.Approved, tt.approved, result.Segments)
+			}
+		})
+	}
+}
+
+func TestResolveCommandPath(t *testing.T) {
+	proj := workDir{start: "/proj", cwd: "/proj"}
+	tests := []struct {
+		name string
+		cmd  string
+		dir  workDir
+		want string
+	}{
+		{"script", "./x.sh --flag", proj, "/proj/x.sh"},
+		{"nested", "bin/tool", proj, "/proj/bin/tool"},
+		{"parent", "../x.sh", workDir{start: "/proj", cwd: "/proj/sub"}, "/proj/x.sh"},
+		{"quoted", `"./my script.sh"`, proj, "/proj/my script.sh"},
+		{"absolute", "/usr/bin/env ls", proj, "/usr/bin/env"},
+		{"in PATH", "ls -la", proj, ""},
+		{"unknown start", "./x.sh", workDir{}, ""},
+		{"lost", "./x.sh", workDir{start: "/proj", cwd: "/proj", lost: true}, ""},
+		{"not literal", "$DIR/x.sh", proj, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveCommandPath(tt.cmd, tt.dir); got != tt.want {
+				t.Errorf("resolveCommandPath(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvedPathInAudit(t *testing.T) {
+	load := func(audit string) *config.Config {
+		cfg, err := config.LoadConfig([]byte(audit + `
+[[commands.simple]]
+name = "cd"
+commands = ["cd"]
+`))
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		return cfg
+	}
+
+	result := EvaluateCommandInDir("./x.sh && cd sub && ./x.sh", "/proj", load("[audit]\nresolve_paths = true\n"))
+	want := []string{"/proj/x.sh", "", "/proj/sub/x.sh"}
+	for i, seg := range result.Segments {
+		if seg.ResolvedPath != want[i] {
+			t.Errorf("segment %d (%q) ResolvedPath = %q, want %q", i, seg.Command, seg.ResolvedPath, want[i])
+		}
+	}
+
+	result = EvaluateCommandInDir("./x.sh", "/proj", load(""))
+	if got := result.Segments[0].ResolvedPath; got != "" {
+		t.Errorf("ResolvedPath = %q without resolve_paths, want none", got)
+	}
+}
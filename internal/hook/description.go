@@ -0,0 +1,86 @@
+package hook
+
+import (
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/logger"
+)
+
+// applyDescriptionPatterns adjusts result, the evaluation of a Bash command,
+// for the description Claude gave it. A description matching a deny
+// description pattern denies the command. Otherwise a description matching
+// an allow description pattern approves a command whose only problem is
+// segments that matched no pattern; deny matches and structural rejections
+// still stand. The description is written by the model, so it only narrows
+// or fills gaps in command matching and never overrides a rejection.
+func applyDescriptionPatterns(result Result, description string, cfg *config.Config) Result {
+	if description == "" {
+		return result
+	}
+
+	if denyResult := CheckDeny(description, cfg.DescriptionDeny); denyResult.Denied {
+		logger.Debug("rejected by description deny list", "description", description, "pattern", denyResult.Name)
+		reason := denyResult.Reason
+		if reason == "" {
+			reason = "command description matches deny list"
+			if denyResult.Name != "" {
+				reason += ": " + denyResult.Name
+			}
+		}
+		rejection := audit.Rejection{
+			Code:    audit.CodeDenyMatch,
+			Name:    denyResult.Name,
+			Pattern: denyResult.Pattern,
+			Detail:  "description matches",
+		}
+		segments := make([]audit.Segment, len(result.Segments))
+		for i, seg := range result.Segments {
+			if seg.Rejection == nil {
+				seg.Approved = false
+				seg.Match = nil
+				seg.Rejection = &rejection
+			}
+			segments[i] = seg
+		}
+		return Result{Command: result.Command, Approved: false, Reason: reason, Output: FormatDeny(reason), DenyMatch: true, Segments: segments}
+	}
+
+	if result.Approved || len(result.Segments) == 0 {
+		return result
+	}
+	for _, seg := range result.Segments {
+		if !seg.Approved && (seg.Rejection == nil || (seg.Rejection.Code != audit.CodeNoMatch && seg.Rejection.Code != audit.CodePassthrough)) {
+			return result
+		}
+	}
+	safeResult := CheckSafe(description, cfg.DescriptionAllow)
+	if !safeResult.Matched {
+		return result
+	}
+
+	logger.Debug("approved by description", "description", description, "pattern", safeResult.Name)
+	var reasons []string
+	segments := make([]audit.Segment, len(result.Segments))
+	for i, seg := range result.Segments {
+		if !seg.Approved {
+			seg.Approved = true
+			seg.Rejection = nil
+			seg.Match = &audit.Match{
+				Type:    safeResult.Type,
+				Name:    safeResult.Name,
+				Pattern: safeResult.Pattern,
+				Note:    safeResult.Note,
+			}
+		}
+		segments[i] = seg
+		if len(seg.Wrappers) > 0 {
+			reasons = append(reasons, strings.Join(seg.Wrappers, "+")+" + "+seg.Match.Name)
+		} else {
+			reasons = append(reasons, seg.Match.Name)
+		}
+	}
+	reason := strings.Join(reasons, " | ")
+	return Result{Command: result.Command, Approved: true, Reason: reason, Output: FormatApproval(reason), Segments: segments}
+}
@@ -0,0 +1,95 @@
+package hook
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+)
+
+const descriptionTestConfig = `
+[[commands.subcommand]]
+command = "git"
+subcommands = ["push", "status"]
+
+[[commands.description]]
+name = "formatting"
+pattern = '^Format (Go|Python) sources$'
+
+[[deny.simple]]
+name = "rm"
+commands = ["rm"]
+
+[[deny.description]]
+name = "force push"
+pattern = '(?i)force.push'
+`
+
+// processWithDescription runs a Bash hook request for command with the
+// given description.
+func processWithDescription(command, description string) Result {
+	return ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"` + command + `","description":"` + description + `"}}`))
+}
+
+func TestDescriptionDenyBlocksAllowedCommand(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, descriptionTestConfig)
+	defer cleanupConfig()
+
+	result := processWithDescription("git push --force origin main", "Force push the rebased branch")
+	if result.Approved || !result.DenyMatch {
+		t.Fatalf("Approved = %v, DenyMatch = %v, want a deny match", result.Approved, result.DenyMatch)
+	}
+	want := "command description matches deny list: force push"
+	if result.Output != FormatDeny(want) {
+		t.Errorf("Output = %s, want deny reason %q", result.Output, want)
+	}
+	if len(result.Segments) != 1 || result.Segments[0].Rejection == nil || result.Segments[0].Rejection.Code != audit.CodeDenyMatch {
+		t.Errorf("Segments = %+v, want a DENY_MATCH rejection", result.Segments)
+	}
+
+	// Without the description the same command is approved
+	if result := processWithDescription("git push --force origin main", "Update the remote branch"); !result.Approved {
+		t.Errorf("expected approval without a denied description, got %s", result.Output)
+	}
+}
+
+func TestDescriptionAllowApprovesUnmatchedCommand(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, descriptionTestConfig)
+	defer cleanupConfig()
+
+	result := processWithDescription("gofmt -w .", "Format Go sources")
+	if !result.Approved {
+		t.Fatalf("expected approval, got %s", result.Output)
+	}
+	if result.Reason != "formatting" {
+		t.Errorf("Reason = %q, want %q", result.Reason, "formatting")
+	}
+	if m := result.Segments[0].Match; m == nil || m.Type != "description" {
+		t.Errorf("Segments[0].Match = %+v, want a description match", m)
+	}
+
+	if result := processWithDescription("gofmt -w .", "Rewrite the sources"); result.Approved {
+		t.Error("expected rejection for a description matching no pattern")
+	}
+}
+
+func TestDescriptionAllowDoesNotOverrideRejection(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, descriptionTestConfig)
+	defer cleanupConfig()
+
+	tests := []struct {
+		name string
+		cmd  string
+	}{
+		{"deny list", "rm -rf build"},
+		{"deny list in chain", "gofmt -w . && rm -rf build"},
+		{"command substitution", "gofmt -w $(cat files)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := processWithDescription(tt.cmd, "Format Go sources"); result.Approved {
+				t.Errorf("expected rejection for %q despite an allowed description", tt.cmd)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package hook
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// diskDevicePatterns are glob patterns for block devices that writing to can
+// destroy a filesystem. A pattern also covers everything below a directory it
+// matches, like /dev/disk/by-id/*.
+var diskDevicePatterns = []string{
+	"/dev/sd*",
+	"/dev/hd*",
+	"/dev/vd*",
+	"/dev/xvd*",
+	"/dev/nvme*",
+	"/dev/mmcblk*",
+	"/dev/disk*",
+	"/dev/rdisk*",
+	"/dev/md*",
+	"/dev/dm-*",
+	"/dev/mapper",
+	"/dev/loop*",
+}
+
+// isDiskDevice reports whether target names a disk device.
+func isDiskDevice(target string) bool {
+	for _, pattern := range diskDevicePatterns {
+		if matchesProtectedPath(target, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// ddOutputFiles returns the of= operands of the dd invocations in call. Words
+// after one whose base name is dd are treated as its operands, so dd run
+// through a wrapper like sudo or timeout is found too.
+func ddOutputFiles(call *syntax.CallExpr) []string {
+	var files []string
+	inDD := false
+	for _, arg := range call.Args {
+		word, literal := wordLiteral(arg)
+		if !literal {
+			continue
+		}
+		if !inDD {
+			inDD = path.Base(word) == "dd"
+			continue
+		}
+		if file, found := strings.CutPrefix(word, "of="); found {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// findDeviceWrites finds segments of cmd that write to a disk device, either
+// through a write redirection or a dd of= operand. Like findSensitiveRedirects,
+// a redirection on a compound command applies to every segment inside it.
+// Returns a map from each affected segment, printed the same way as
+// SplitCommandChain, to a description of the offending write.
+func findDeviceWrites(cmd string) map[string]string {
+	// A simple command has no redirections, so only dd can write
+	if isSimpleCommand(cmd) && !hasCommandWord(cmd, "dd") {
+		return nil
+	}
+
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil
+	}
+
+	printer := syntax.NewPrinter()
+	result := make(map[string]string)
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		stmt, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+
+		var detail string
+		for _, target := range writeRedirectTargets(stmt.Redirs) {
+			if isDiskDevice(target) {
+				detail = fmt.Sprintf("redirect writes to disk device %q", target)
+				break
+			}
+		}
+		if call, ok := stmt.Cmd.(*syntax.CallExpr); ok && detail == "" {
+			for _, file := range ddOutputFiles(call) {
+				if isDiskDevice(file) {
+					detail = fmt.Sprintf("dd writes to disk device %q", file)
+					break
+				}
+			}
+		}
+		if detail == "" {
+			return true
+		}
+
+		var segments []string
+		extractCommands(stmt.Cmd, printer, &segments)
+		for _, segment := range segments {
+			if _, seen := result[segment]; !seen {
+				result[segment] = detail
+			}
+		}
+		return true
+	})
+	return result
+}
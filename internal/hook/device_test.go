@@ -0,0 +1,89 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestFindDeviceWrites(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		want []string // affected segments
+	}{
+		{"dd of disk", "dd if=/dev/zero of=/dev/sda", []string{"dd if=/dev/zero of=/dev/sda"}},
+		{"dd of partition", "dd if=image.iso of=/dev/sdb1 bs=4M", []string{"dd if=image.iso of=/dev/sdb1 bs=4M"}},
+		{"dd quoted", `dd if=/dev/zero "of=/dev/sda"`, []string{`dd if=/dev/zero "of=/dev/sda"`}},
+		{"dd through wrapper", "sudo dd if=/dev/zero of=/dev/nvme0n1", []string{"sudo dd if=/dev/zero of=/dev/nvme0n1"}},
+		{"dd by path", "/bin/dd of=/dev/disk2", []string{"/bin/dd of=/dev/disk2"}},
+		{"redirect nvme", "echo x >/dev/nvme0n1", []string{"echo x"}},
+		{"redirect spaced", "echo x >   /dev/sda", []string{"echo x"}},
+		{"redirect quoted", "echo x > '/dev/sda'", []string{"echo x"}},
+		{"redirect by id", "cat img > /dev/disk/by-id/usb-stick", []string{"cat img"}},
+		{"redirect mapper", "cat img > /dev/mapper/root", []string{"cat img"}},
+		{"only one segment", "ls && echo x > /dev/sda", []string{"echo x"}},
+		{"dd of file", "dd if=/dev/sda of=backup.img", nil},
+		{"dd input only", "dd if=/dev/sda", nil},
+		{"of before dd", "echo of=/dev/sda", nil},
+		{"dev null", "echo x > /dev/null", nil},
+		{"dev stderr", "echo x > /dev/stderr", nil},
+		{"read from disk", "cat < /dev/sda", nil},
+		{"quoted text", "echo 'x > /dev/sda'", nil},
+		{"unparseable", "echo 'x > /dev/sda", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findDeviceWrites(tt.cmd)
+			if len(got) != len(tt.want) {
+				t.Fatalf("findDeviceWrites(%q) = %v, want segments %q", tt.cmd, got, tt.want)
+			}
+			for _, seg := range tt.want {
+				if _, ok := got[seg]; !ok {
+					t.Errorf("findDeviceWrites(%q) = %v, missing segment %q", tt.cmd, got, seg)
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceWriteRejectedEvenIfAllowed(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "tools"
+commands = ["dd", "echo"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"dd if=/dev/zero of=/dev/sda", false},
+		{"echo x >/dev/nvme0n1", false},
+		{"dd if=/dev/zero of=zeros.bin count=1", true},
+		{"echo x > /dev/null", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if result.Output != FormatDeny("command writes to a disk device") {
+				t.Errorf("Output = %s, want deny decision", result.Output)
+			}
+			if rej := result.Segments[0].Rejection; rej == nil || rej.Code != audit.CodeDeviceWrite {
+				t.Errorf("Rejection = %+v, want %s", rej, audit.CodeDeviceWrite)
+			}
+		})
+	}
+}
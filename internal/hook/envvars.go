@@ -0,0 +1,203 @@
+package hook
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/config"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// envAssignmentRegex matches a NAME=value argument to env.
+var envAssignmentRegex = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=`)
+
+// envOptionsWithArg are env options whose value is the next argument.
+var envOptionsWithArg = map[string]bool{
+	"-u":             true,
+	"--unset":        true,
+	"-C":             true,
+	"--chdir":        true,
+	"-S":             true,
+	"--split-string": true,
+}
+
+// assignedEnvVars returns the names of the environment variables call sets
+// for the command it runs: its leading NAME=value assignments, and the
+// NAME=value operands of env. Words after one whose base name is env are
+// treated as its operands, so env run through a wrapper like timeout is
+// found too.
+func assignedEnvVars(call *syntax.CallExpr) []string {
+	var names []string
+	for _, assign := range call.Assigns {
+		if assign.Name != nil {
+			names = append(names, assign.Name.Value)
+		}
+	}
+
+	inEnv := false
+	skipNext := false
+	for _, arg := range call.Args {
+		word, literal := wordLiteral(arg)
+		if !inEnv {
+			inEnv = literal && path.Base(word) == "env"
+			continue
+		}
+		if skipNext {
+			skipNext = false
+			continue
+		}
+		if !literal {
+			// NAME="$X" assigns NAME whatever $X expands to
+			if m := envAssignmentRegex.FindStringSubmatch(wordLiteralPrefix(arg)); m != nil {
+				names = append(names, m[1])
+				continue
+			}
+			break
+		}
+		if m := envAssignmentRegex.FindStringSubmatch(word); m != nil {
+			names = append(names, m[1])
+			continue
+		}
+		if strings.HasPrefix(word, "-") {
+			skipNext = envOptionsWithArg[word]
+			continue
+		}
+		// The first operand that isn't an option or assignment is the command
+		break
+	}
+	return names
+}
+
+// wordLiteralPrefix returns the unquoted value of the leading parts of word
+// that the shell wouldn't expand, up to its first expansion.
+func wordLiteralPrefix(word *syntax.Word) string {
+	var sb strings.Builder
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range p.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return sb.String()
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return sb.String()
+		}
+	}
+	return sb.String()
+}
+
+// envVarViolation describes why name may not be assigned before a command
+// under security, or returns "" if it may.
+func envVarViolation(name string, security config.Security) string {
+	if slices.Contains(security.ProtectedEnvVars, name) {
+		return fmt.Sprintf("assigns protected environment variable %q", name)
+	}
+	if security.AllowedEnvVars != nil && !slices.Contains(security.AllowedEnvVars, name) {
+		return fmt.Sprintf("assigns environment variable %q, which is not in allowed_env_vars", name)
+	}
+	return ""
+}
+
+// declaredEnvVars returns the names of the variables decl sets. Every
+// variant counts: local PATH=x changes what the rest of a function runs as
+// much as export PATH=x does.
+func declaredEnvVars(decl *syntax.DeclClause) []string {
+	var names []string
+	for _, assign := range decl.Args {
+		if assign.Name != nil {
+			names = append(names, assign.Name.Value)
+		}
+	}
+	return names
+}
+
+// isPlainDeclaration reports whether segment is a single declaration, like
+// export FOO=bar or local -r n=1, whose options and values are all literal.
+func isPlainDeclaration(segment string) bool {
+	prog, err := syntax.NewParser().Parse(strings.NewReader(segment), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return false
+	}
+	stmt := prog.Stmts[0]
+	decl, ok := stmt.Cmd.(*syntax.DeclClause)
+	if !ok || stmt.Negated || stmt.Background || len(stmt.Redirs) > 0 {
+		return false
+	}
+	for _, assign := range decl.Args {
+		if assign.Array != nil || assign.Index != nil || assign.Append {
+			return false
+		}
+		if assign.Name == nil && (assign.Value == nil || !strings.HasPrefix(assign.Value.Lit(), "-")) {
+			return false
+		}
+		if assign.Value != nil {
+			if _, literal := wordLiteral(assign.Value); !literal {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// findEnvAssignments finds segments of cmd that assign an environment
+// variable that security doesn't permit before a command, or declare one
+// with export, local, declare, typeset, or readonly.
+// Returns a map from each affected segment, printed the same way as
+// SplitCommandChain, to a description of the offending assignment.
+func findEnvAssignments(cmd string, security config.Security) map[string]string {
+	// A simple command can only assign with a NAME=value word or declare
+	// with a reserved word like export
+	if isSimpleCommand(cmd) && !strings.Contains(cmd, "=") && !hasReservedWord(cmd) {
+		return nil
+	}
+
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil
+	}
+
+	printer := syntax.NewPrinter()
+	result := make(map[string]string)
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		var names []string
+		switch node := node.(type) {
+		case *syntax.CallExpr:
+			names = assignedEnvVars(node)
+		case *syntax.DeclClause:
+			names = declaredEnvVars(node)
+		default:
+			return true
+		}
+
+		var detail string
+		for _, name := range names {
+			if detail = envVarViolation(name, security); detail != "" {
+				break
+			}
+		}
+		if detail == "" {
+			return true
+		}
+
+		var buf strings.Builder
+		if err := printer.Print(&buf, node); err == nil {
+			segment := strings.TrimSpace(buf.String())
+			if _, seen := result[segment]; !seen {
+				result[segment] = detail
+			}
+		}
+		return true
+	})
+	return result
+}
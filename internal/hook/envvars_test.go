@@ -0,0 +1,190 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestFindEnvAssignments(t *testing.T) {
+	security := config.Security{ProtectedEnvVars: config.DefaultProtectedEnvVars}
+
+	tests := []struct {
+		name string
+		cmd  string
+		want []string // affected segments
+	}{
+		{"ld preload", "LD_PRELOAD=x pytest", []string{"LD_PRELOAD=x pytest"}},
+		{"after allowed var", "FOO=1 PATH=/evil ls", []string{"FOO=1 PATH=/evil ls"}},
+		{"quoted value", `IFS="," read a b`, []string{`IFS="," read a b`}},
+		{"env operand", "env PATH=/evil ls", []string{"env PATH=/evil ls"}},
+		{"env after option", "env -i LD_LIBRARY_PATH=/tmp ls", []string{"env -i LD_LIBRARY_PATH=/tmp ls"}},
+		{"env option with value", "env -u HOME PATH=/evil ls", []string{"env -u HOME PATH=/evil ls"}},
+		{"env through wrapper", "timeout 5 env PATH=/evil ls", []string{"timeout 5 env PATH=/evil ls"}},
+		{"env variable value", `env PATH="$X" ls`, []string{`env PATH="$X" ls`}},
+		{"env quoted variable value", `env "LD_PRELOAD=$X" ls`, []string{`env "LD_PRELOAD=$X" ls`}},
+		{"env after variable value", `env FOO=$X PATH=/evil ls`, []string{`env FOO=$X PATH=/evil ls`}},
+		{"env allowed variable value", `env FOO="$X" ls`, nil},
+		{"only one segment", "ls && PATH=/evil make", []string{"PATH=/evil make"}},
+		{"allowed var", "FOO=1 pytest", nil},
+		{"env allowed var", "env FOO=1 pytest", nil},
+		{"operand after command", "make PATH=/evil", nil},
+		{"env after command", "ls env PATH=/evil", []string{"ls env PATH=/evil"}},
+		{"unparseable", "PATH=/evil 'ls", nil},
+		{"export", "export PATH=/evil", []string{"export PATH=/evil"}},
+		{"export without value", "ls && export LD_PRELOAD", []string{"export LD_PRELOAD"}},
+		{"export allowed var", "export FOO=1", nil},
+		{"local", "f() { local PATH=/evil; ls; }", []string{"local PATH=/evil"}},
+		{"declare with option", "declare -x LD_PRELOAD=x", []string{"declare -x LD_PRELOAD=x"}},
+		{"readonly", "readonly IFS=,", []string{"readonly IFS=,"}},
+		{"local allowed var", "local i=0", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findEnvAssignments(tt.cmd, security)
+			if len(got) != len(tt.want) {
+				t.Fatalf("findEnvAssignments(%q) = %v, want segments %q", tt.cmd, got, tt.want)
+			}
+			for _, seg := range tt.want {
+				if _, ok := got[seg]; !ok {
+					t.Errorf("findEnvAssignments(%q) = %v, missing segment %q", tt.cmd, got, seg)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvAssignmentRejectedEvenIfAllowed(t *testing.T) {
+	load := func(security string) *config.Config {
+		cfg, err := config.LoadConfig([]byte(security + `
+[[wrappers.regex]]
+pattern = '^([A-Z_][A-Z0-9_]*=[^\s]*\s+)+'
+name = "env vars"
+
+[[wrappers.simple]]
+name = "env"
+commands = ["env"]
+
+[[commands.simple]]
+name = "test"
+commands = ["pytest"]
+`))
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		return cfg
+	}
+	defaults := load("")
+	allowlist := load("[security]\nallowed_env_vars = [\"FOO\"]\n")
+	unprotected := load("[security]\nprotected_env_vars = []\n")
+
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		cmd      string
+		approved bool
+	}{
+		{"plain var", defaults, "FOO=1 pytest", true},
+		{"ld preload", defaults, "LD_PRELOAD=x pytest", false},
+		{"path", defaults, "PATH=/evil pytest", false},
+		{"env path", defaults, "env PATH=/evil pytest", false},
+		{"env path from variable", defaults, `env PATH="$X" pytest`, false},
+		{"allowlisted var", allowlist, "FOO=1 pytest", true},
+		{"var not in allowlist", allowlist, "BAR=1 pytest", false},
+		{"protected despite allowlist", allowlist, "LD_PRELOAD=x pytest", false},
+		{"check disabled", unprotected, "LD_PRELOAD=x pytest", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, tt.cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if result.Output != FormatDeny("command sets a protected environment variable") {
+				t.Errorf("Output = %s, want deny decision", result.Output)
+			}
+			if rej := result.Segments[0].Rejection; rej == nil || rej.Code != audit.CodeEnvAssignment {
+				t.Errorf("Rejection = %+v, want %s", rej, audit.CodeEnvAssignment)
+			}
+		})
+	}
+}
+
+func TestIsPlainDeclaration(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{"export FOO=1", true},
+		{"export FOO", true},
+		{"local -r n=1", true},
+		{"declare -x A=1 B='two words'", true},
+		{"readonly X", true},
+		{"export FOO=$HOME", false},
+		{"export FOO=1 > out", false},
+		{"declare -a arr=(1 2)", false},
+		{"export FOO+=x", false},
+		{"echo FOO=1", false},
+		{"export FOO=1; ls", false},
+		{"export 'ls'", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			if got := isPlainDeclaration(tt.cmd); got != tt.want {
+				t.Errorf("isPlainDeclaration(%q) = %v, want %v", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowDeclarations(t *testing.T) {
+	load := func(security string) *config.Config {
+		cfg, err := config.LoadConfig([]byte(security + `
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`))
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		return cfg
+	}
+	disabled := load("")
+	enabled := load("[security]\nallow_declarations = true\n")
+
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		cmd      string
+		approved bool
+	}{
+		{"disabled by default", disabled, "export FOO=1", false},
+		{"export", enabled, "export FOO=1", true},
+		{"chained", enabled, "export FOO=1 && ls", true},
+		{"local", enabled, "local -r n=1", true},
+		{"protected", enabled, "export LD_PRELOAD=x", false},
+		{"protected path", enabled, "export PATH=/evil", false},
+		{"expansion", enabled, "export FOO=$HOME", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, tt.cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("EvaluateCommand(%q).Approved = %v, want %v (reason: %s)", tt.cmd, result.Approved, tt.approved, result.Reason)
+			}
+			if tt.approved && tt.cmd == "export FOO=1" {
+				if m := result.Segments[0].Match; m == nil || m.Type != MatchTypeDeclaration {
+					t.Errorf("Match = %+v, want type %s", m, MatchTypeDeclaration)
+				}
+			}
+		})
+	}
+}
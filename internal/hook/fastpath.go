@@ -0,0 +1,73 @@
+package hook
+
+import (
+	"path"
+	"strings"
+)
+
+// simpleWordChars are the characters a command may contain to skip shell
+// parsing. Shell metacharacters (&|;<>()$`), quotes, escapes, comments,
+// braces, and newlines are all excluded, so each whitespace-separated word
+// is a literal argument.
+const simpleWordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789" +
+	"-_./=:,+@%~*?[]^"
+
+// reservedWords are words that make the parser build something other than a
+// plain command (if, for, declare, ...) or fail. A simple command containing
+// any of them, in any position, is parsed in full.
+var reservedWords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "fi": true,
+	"case": true, "esac": true, "for": true, "select": true, "while": true,
+	"until": true, "do": true, "done": true, "in": true, "function": true,
+	"time": true, "coproc": true, "[[": true, "]]": true,
+	"declare": true, "local": true, "export": true, "readonly": true,
+	"typeset": true, "nameref": true, "let": true,
+}
+
+// splitSimpleCommand is the fast path of SplitCommandChain for a single
+// command made only of literal words, which is how most commands arrive.
+// It returns the command as the parser would print it, with single spaces
+// between words. ok is false if cmd needs a full parse.
+func splitSimpleCommand(cmd string) (segments []string, ok bool) {
+	if !isSimpleCommand(cmd) || hasReservedWord(cmd) {
+		return nil, false
+	}
+	return []string{strings.Join(strings.Fields(cmd), " ")}, true
+}
+
+// isSimpleCommand reports whether cmd contains only simpleWordChars, spaces,
+// and tabs.
+func isSimpleCommand(cmd string) bool {
+	for i := 0; i < len(cmd); i++ {
+		if c := cmd[i]; c != ' ' && c != '\t' && strings.IndexByte(simpleWordChars, c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCommandWord reports whether a word of cmd, split on whitespace, has one
+// of names as its base name. For a simple command, as isSimpleCommand
+// accepts, this finds every word the parse-based checks would take for one
+// of those commands, so they can skip parsing when there is none.
+func hasCommandWord(cmd string, names ...string) bool {
+	for _, field := range strings.Fields(cmd) {
+		for _, name := range names {
+			if path.Base(field) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasReservedWord reports whether a word of cmd, split on whitespace, is one
+// of the reservedWords.
+func hasReservedWord(cmd string) bool {
+	for _, field := range strings.Fields(cmd) {
+		if reservedWords[field] {
+			return true
+		}
+	}
+	return false
+}
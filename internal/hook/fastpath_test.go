@@ -0,0 +1,173 @@
+package hook
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+// fastPathCommands are commands that splitSimpleCommand handles itself.
+var fastPathCommands = []string{
+	"git status",
+	"ls -la",
+	"  ls   -la  ",
+	"ls\t-la",
+	"pytest -v tests/test_foo.py::test_bar",
+	"FOO=bar ls",
+	"FOO=bar",
+	"a[1]=x",
+	"timeout 30 go test ./...",
+	"rm -rf /",
+	"rm -rf ~/.ssh",
+	"find . -name *.go",
+	"[ -f go.mod ]",
+	"chmod a+rwx file",
+	"dd if=/dev/zero of=/dev/sda",
+	"git log --format=%H@%an",
+	"echo done-ish",
+	"tee /etc/hosts",
+	"sudo tee -a ~/.bashrc",
+	"dd if=/dev/zero of=/etc/passwd",
+	"env PATH=/evil ls",
+	"LD_PRELOAD=x ls",
+}
+
+// slowPathCommands are commands that need a full parse.
+var slowPathCommands = []string{
+	"git add . && git commit",
+	"cat file | grep foo",
+	"ls; pwd",
+	"sleep 1 &",
+	"echo $(whoami)",
+	"echo `whoami`",
+	"echo $HOME",
+	"echo hi > out.txt",
+	"cat < in.txt",
+	"(cd sub)",
+	"echo 'a  b'",
+	`echo "a  b"`,
+	`echo a\ b`,
+	"ls # comment",
+	"{ ls; }",
+	"! ls",
+	"ls\npwd",
+	"if",
+	"for",
+	"echo done",
+	"time ls",
+	"declare x=1",
+	"export PATH=/tmp",
+	"[[ -f x ]]",
+	"echo héllo",
+	"echo 'unclosed",
+}
+
+func TestSplitSimpleCommandMatchesParse(t *testing.T) {
+	for _, cmd := range fastPathCommands {
+		t.Run(cmd, func(t *testing.T) {
+			fast, ok := splitSimpleCommand(cmd)
+			if !ok {
+				t.Fatalf("splitSimpleCommand(%q) declined, want the fast path", cmd)
+			}
+			parsed, operators, err := parseCommandChain(cmd)
+			if err != nil {
+				t.Fatalf("parseCommandChain(%q) error = %v", cmd, err)
+			}
+			if !reflect.DeepEqual(fast, parsed) {
+				t.Errorf("fast path = %q, full parse = %q", fast, parsed)
+			}
+			if !reflect.DeepEqual(operators, []string{""}) {
+				t.Errorf("full parse operators = %q, want the fast path's [\"\"]", operators)
+			}
+		})
+	}
+}
+
+func TestSplitSimpleCommandDeclines(t *testing.T) {
+	for _, cmd := range slowPathCommands {
+		if segments, ok := splitSimpleCommand(cmd); ok {
+			t.Errorf("splitSimpleCommand(%q) = %q, want a full parse", cmd, segments)
+		}
+	}
+}
+
+func TestEvaluateCommandSameOnBothPaths(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.regex]]
+pattern = 'rm\s+(-[rRfF]+\s+)*/'
+name = "rm root"
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<num>"]
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status", "log"]
+
+[[commands.simple]]
+name = "read-only"
+commands = ["ls", "find", "dd", "chmod", "[", "tee"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	for _, cmd := range fastPathCommands {
+		t.Run(cmd, func(t *testing.T) {
+			got := EvaluateCommand(cmd, cfg)
+			// A trailing semicolon forces the full parse without changing
+			// the command's meaning
+			want := EvaluateCommand(cmd+";", cfg)
+			if got.Approved != want.Approved || got.Output != want.Output ||
+				!reflect.DeepEqual(got.Segments, want.Segments) {
+				t.Errorf("fast path result %+v differs from full parse %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestChecksSkipParsingMatchParse(t *testing.T) {
+	security := config.Security{ProtectedEnvVars: config.DefaultProtectedEnvVars}
+	for _, cmd := range fastPathCommands {
+		t.Run(cmd, func(t *testing.T) {
+			// A trailing semicolon forces the full parse
+			parsed := cmd + ";"
+			if got, want := findSensitiveRedirects(cmd, config.DefaultProtectedWritePaths, nil), findSensitiveRedirects(parsed, config.DefaultProtectedWritePaths, nil); len(got) != len(want) {
+				t.Errorf("findSensitiveRedirects() = %v, full parse = %v", got, want)
+			}
+			if got, want := findDeviceWrites(cmd), findDeviceWrites(parsed); len(got) != len(want) {
+				t.Errorf("findDeviceWrites() = %v, full parse = %v", got, want)
+			}
+			if got, want := findEnvAssignments(cmd, security), findEnvAssignments(parsed, security); len(got) != len(want) {
+				t.Errorf("findEnvAssignments() = %v, full parse = %v", got, want)
+			}
+		})
+	}
+}
+
+func BenchmarkSplitCommandChainPaths(b *testing.B) {
+	const cmd = "pytest -v tests/test_foo.py"
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = splitSimpleCommand(cmd)
+		}
+	})
+	b.Run("parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _, _ = parseCommandChain(cmd)
+		}
+	})
+}
+
+func BenchmarkEvaluateSimpleCommand(b *testing.B) {
+	cfg, err := config.LoadConfig(config.GetDefaultConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	const cmd = "pytest -v tests/test_foo.py"
+	for i := 0; i < b.N; i++ {
+		EvaluateCommand(cmd, cfg)
+	}
+}
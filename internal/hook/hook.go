@@ -2,11 +2,14 @@
 package hook
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +36,14 @@ const (
 // Audit log version
 const AuditVersion = 1
 
+// MatchTypeAllowOverride is the audit match type of a segment approved by an
+// [allow] override despite matching the deny list.
+const MatchTypeAllowOverride = "allow-override"
+
+// MatchTypeDeclaration is the audit match type of a declaration like
+// export FOO=bar approved by [security] allow_declarations.
+const MatchTypeDeclaration = "declaration"
+
 // Result contains the outcome of processing a command.
 type Result struct {
 	Command     string // The command that was processed
@@ -40,6 +51,9 @@ type Result struct {
 	Reason      string // The reason for approval/denial
 	Output      string // The JSON output sent to Claude Code
 	Passthrough bool   // Whether MMI abstained (no output, let Claude Code decide)
+	DenyMatch   bool   // Whether any segment matched the deny list
+	// Segments holds the per-segment evaluation details, in command order
+	Segments []audit.Segment
 }
 
 // ToolInputData represents the tool_input field in the Claude Code hook input
@@ -134,6 +148,11 @@ func findQuotedHeredocRanges(cmd string) []byteRange {
 // containsDangerousPattern checks if the command contains dangerous patterns ($( or backticks)
 // while excluding content inside quoted heredocs where these characters are literal.
 func containsDangerousPattern(cmd string) bool {
+	// Heredocs can only exclude matches, so there's nothing to parse for
+	// without any
+	if !dangerousPattern.MatchString(cmd) {
+		return false
+	}
 	excludeRanges := findQuotedHeredocRanges(cmd)
 
 	// If no heredocs, do the simple check
@@ -165,6 +184,26 @@ func containsDangerousPattern(cmd string) bool {
 	return false
 }
 
+// containsProcessSubstitution reports whether the command contains a process
+// substitution (<(...) or >(...)), which runs an arbitrary command.
+// Unparseable commands report false; they are rejected elsewhere.
+func containsProcessSubstitution(cmd string) bool {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return false
+	}
+
+	found := false
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		if _, ok := node.(*syntax.ProcSubst); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
 // Read a command and return whether it should be approved and the reason.
 // Returns false for parse errors, non-Bash tools, dangerous patterns, or unsafe commands.
 func Process(r io.Reader) (approved bool, reason string) {
@@ -175,6 +214,14 @@ func Process(r io.Reader) (approved bool, reason string) {
 // ProcessWithResult reads from a stream and returns a Result with full details.
 // This is useful when the caller needs the original command for logging.
 func ProcessWithResult(r io.Reader) Result {
+	return processWithContext(context.Background(), r)
+}
+
+// processWithContext is ProcessWithResult for a caller that may abandon it
+// when ctx is done. Once ctx is done it stops before loading the config and
+// doesn't write the audit log, so an abandoned evaluation can't record a
+// decision that was never emitted.
+func processWithContext(ctx context.Context, r io.Reader) Result {
 	startTime := time.Now()
 
 	// Read raw JSON first so we can log it
@@ -193,42 +240,144 @@ func ProcessWithResult(r io.Reader) Result {
 		return Result{Output: output}
 	}
 
-	if input.ToolName != ToolNameBash {
-		logger.Debug("not a Bash command", "tool", input.ToolName)
-		output := FormatAsk("not a Bash command")
-		return Result{Output: output}
+	if ctx.Err() != nil {
+		return Result{Output: FormatAsk("evaluation abandoned")}
+	}
+
+	// Layer the project's .mmi.toml, if any, on top of the global config
+	cfg := config.ForDir(input.Cwd)
+
+	var result Result
+	if input.ToolName == ToolNameBash {
+		result = EvaluateCommandInDir(input.ToolInput.Command, input.Cwd, cfg)
+		result = applyDescriptionPatterns(result, input.ToolInput.Description, cfg)
+	} else {
+		tool, ok := cfg.Tools[input.ToolName]
+		if !ok {
+			logger.Debug("not a Bash command", "tool", input.ToolName)
+			output := FormatAsk("not a Bash command")
+			return Result{Output: output}
+		}
+		value, ok := toolInputField(rawBytes, tool.Field)
+		if !ok {
+			logger.Debug("tool input field missing", "tool", input.ToolName, "field", tool.Field)
+			output := FormatAsk(fmt.Sprintf("%s input has no %q field", input.ToolName, tool.Field))
+			return Result{Output: output}
+		}
+		result = EvaluateTool(input.ToolName, value, tool, cfg.Unmatched)
 	}
+	if result.Approved && cfg.Output.ApprovalReasonTemplate != "" {
+		result.Reason = formatApprovalReason(cfg.Output.ApprovalReasonTemplate, result)
+		result.Output = FormatApproval(result.Reason)
+	}
+	if ctx.Err() != nil {
+		logger.Debug("skipping audit log for abandoned evaluation", "command", result.Command)
+		return result
+	}
+	durationMs := float64(time.Since(startTime).Microseconds()) / 1000.0
+	logAudit(result, durationMs, input, rawInput, cfg)
+	return result
+}
+
+// EvaluateCommand runs a bare command string through the full approval
+// pipeline (chain splitting, wrapper stripping, deny, safe, and rewrite
+// checks) using cfg. Nothing is written to the audit log.
+func EvaluateCommand(cmd string, cfg *config.Config) Result {
+	return EvaluateCommandInDir(cmd, "", cfg)
+}
 
-	cmd := input.ToolInput.Command
+// EvaluateCommandInDir is EvaluateCommand for a command started in cwd.
+// Path-restricted commands resolve relative paths against cwd, or against
+// the directory set by an earlier cd in the chain. An empty cwd leaves
+// relative paths as written.
+func EvaluateCommandInDir(cmd, cwd string, cfg *config.Config) Result {
 	logger.Debug("processing command", "command", cmd)
 
-	cfg := config.Get()
+	// Control characters can hide what a command does from the reviewer
+	if detail := findControlChar(cmd); detail != "" {
+		logger.Debug("rejected control character", "command", cmd, "detail", detail)
+		reason := "command contains control characters"
+		segments := []audit.Segment{{
+			Command:   cmd,
+			Approved:  false,
+			Rejection: &audit.Rejection{Code: audit.CodeInvalidChars, Detail: detail},
+		}}
+		return Result{Command: cmd, Approved: false, Reason: reason, Output: FormatDeny(reason), Segments: segments}
+	}
 
-	cmdSegments, err := SplitCommandChain(cmd)
+	// Later lines of a multi-line command are easy to miss when reviewing it
+	if !cfg.Security.AllowMultiline && strings.Contains(cmd, "\n") {
+		logger.Debug("rejected multi-line command", "command", cmd)
+		reason := "command spans multiple lines"
+		segments := []audit.Segment{{
+			Command:   cmd,
+			Approved:  false,
+			Rejection: &audit.Rejection{Code: audit.CodeMultiline},
+		}}
+		return Result{Command: cmd, Approved: false, Reason: reason, Output: FormatDeny(reason), Segments: segments}
+	}
+
+	cmdSegments, operators, err := SplitCommandChain(cmd)
 	if err != nil {
 		logger.Debug("rejected unparseable command", "command", cmd)
-		durationMs := float64(time.Since(startTime).Microseconds()) / 1000.0
 		segments := []audit.Segment{{
 			Command:   cmd,
 			Approved:  false,
 			Rejection: &audit.Rejection{Code: audit.CodeUnparseable, Detail: "parse error"},
 		}}
 		output := FormatAsk("unparseable command")
-		logAudit(cmd, false, segments, durationMs, input.SessionID, input.ToolUseID, input.Cwd, rawInput, output)
-		return Result{Command: cmd, Approved: false, Reason: "unparseable command", Output: output}
+		if cfg.Security.Unparseable == config.UnparseableDeny {
+			output = FormatDeny("unparseable command")
+		}
+		return Result{Command: cmd, Approved: false, Reason: "unparseable command", Output: output, Segments: segments}
 	}
 	logger.Debug("split command chain", "segments", len(cmdSegments))
 
+	// Nothing runs for an empty or comment-only command, but approving it
+	// implicitly would be surprising, so the decision is explicit
+	if len(cmdSegments) == 0 {
+		logger.Debug("empty command", "command", cmd, "decision", cfg.Security.EmptyCommand)
+		reason := "empty command"
+		if cfg.Security.EmptyCommand == config.EmptyCommandAllow {
+			return Result{Command: cmd, Approved: true, Reason: reason, Output: FormatApproval(reason), Segments: []audit.Segment{}}
+		}
+		return Result{Command: cmd, Approved: false, Reason: reason, Output: FormatAsk(reason), Segments: []audit.Segment{}}
+	}
+
 	var reasons []string
 	var auditSegments []audit.Segment
 	overallApproved := true
 	hasDenyMatch := false
+	var denials []DenyResult
 	hasRewrite := false
 	var rewriteSuggestions []string
+	hasPipeToShell := false
+	hasObfuscatedExec := false
+	hasSensitiveRedirect := false
+	hasDeviceWrite := false
+	hasEnvAssignment := false
+	hasDangerousWrapper := false
+	hasScriptEscape := false
+	// Pipes and substitutions need metacharacters that a simple command
+	// can't contain
+	var pipeToShell, decodeToShell, pipedPrograms map[string]string
+	var substitutions map[string]substitutionKinds
+	if !isSimpleCommand(cmd) {
+		pipeToShell = findPipeToShell(cmd, cfg.WrapperPatterns, cfg.Security.Interpreters)
+		decodeToShell = findDecodeToShell(cmd, cfg.WrapperPatterns, cfg.Security.Interpreters)
+		pipedPrograms = findPipedPrograms(cmd, cfg.WrapperPatterns, cfg.Security.Interpreters)
+		substitutions = findSubstitutionKinds(cmd)
+	}
+	workDirs := trackWorkDirs(cwd, cmdSegments, cfg.WrapperPatterns)
+	sensitiveRedirects := findSensitiveRedirects(cmd, cfg.Security.ProtectedWritePaths, segmentWorkDirs(cmdSegments, workDirs))
+	deviceWrites := findDeviceWrites(cmd)
+	envAssignments := findEnvAssignments(cmd, cfg.Security)
+	inputRedirects := findInputRedirects(cmd)
+	hereStrings := findHereStringScripts(cmd, cfg.WrapperPatterns, cfg.Security.Interpreters)
 
 	// Evaluate ALL segments - don't return early on rejection
 	for i, segment := range cmdSegments {
-		coreCmd, wrappers := StripWrappers(segment, cfg.WrapperPatterns)
+		coreCmd, wrappers, stripped := stripWrappers(segment, cfg.WrapperPatterns)
 		logger.Debug("processing segment",
 			"index", i,
 			"segment", segment,
@@ -237,26 +386,180 @@ func ProcessWithResult(r io.Reader) Result {
 
 		// Check for dangerous patterns (command substitution) in this segment
 		if !cfg.SubshellAllowAll && containsDangerousPattern(segment) {
-			logger.Debug("rejected dangerous pattern in segment", "segment", segment)
+			if rejection, denial := checkCommandSubstitutions(segment, substitutions[segment], cfg); rejection != nil {
+				logger.Debug("rejected dangerous pattern in segment", "segment", segment, "detail", rejection.Detail)
+				overallApproved = false
+				if denial != nil {
+					hasDenyMatch = true
+					denials = append(denials, *denial)
+				}
+				auditSegments = append(auditSegments, audit.Segment{
+					Command:   segment,
+					Approved:  false,
+					Wrappers:  wrappers,
+					Rejection: rejection,
+				})
+				continue
+			}
+		}
+
+		// Check for process substitution in this segment
+		if !cfg.Security.AllowProcessSubstitution && containsProcessSubstitution(segment) {
+			logger.Debug("rejected process substitution in segment", "segment", segment)
 			overallApproved = false
 			auditSegments = append(auditSegments, audit.Segment{
 				Command:  segment,
 				Approved: false,
 				Wrappers: wrappers,
 				Rejection: &audit.Rejection{
-					Code:    audit.CodeCommandSubstitution,
-					Pattern: "$(...)",
+					Code:    audit.CodeProcessSubstitution,
+					Pattern: "<(...)",
 				},
 			})
 			continue
 		}
 
-		// Check deny list on core command (after splitting chain and stripping wrappers)
-		denyResult := CheckDeny(coreCmd, cfg.DenyPatterns)
-		if denyResult.Denied {
+		// Reject redirections, tee, and dd writes to protected files, even if allowed
+		// Targets that can't be resolved statically fail closed by asking
+		if write, ok := sensitiveRedirects[segment]; ok {
+			logger.Debug("rejected sensitive redirect", "segment", segment, "detail", write.detail)
+			overallApproved = false
+			if !write.unresolved {
+				hasSensitiveRedirect = true
+			}
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:  segment,
+				Approved: false,
+				Wrappers: wrappers,
+				Rejection: &audit.Rejection{
+					Code:   audit.CodeSensitiveRedirect,
+					Detail: write.detail,
+				},
+			})
+			continue
+		}
+
+		// Reject writes to disk devices, even if allowed
+		if detail, ok := deviceWrites[segment]; ok {
+			logger.Debug("rejected device write", "segment", segment, "detail", detail)
+			overallApproved = false
+			hasDeviceWrite = true
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:  segment,
+				Approved: false,
+				Wrappers: wrappers,
+				Rejection: &audit.Rejection{
+					Code:   audit.CodeDeviceWrite,
+					Detail: detail,
+				},
+			})
+			continue
+		}
+
+		// Reject assignments to protected environment variables, even if allowed
+		if detail, ok := envAssignments[segment]; ok {
+			logger.Debug("rejected environment assignment", "segment", segment, "detail", detail)
+			overallApproved = false
+			hasEnvAssignment = true
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:  segment,
+				Approved: false,
+				Wrappers: wrappers,
+				Rejection: &audit.Rejection{
+					Code:   audit.CodeEnvAssignment,
+					Detail: detail,
+				},
+			})
+			continue
+		}
+
+		// Reject interpreters that execute downloaded content, even if allowed
+		if detail, ok := pipeToShell[segment]; ok {
+			logger.Debug("rejected pipe to shell", "segment", segment, "detail", detail)
+			overallApproved = false
+			hasPipeToShell = true
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:  segment,
+				Approved: false,
+				Wrappers: wrappers,
+				Rejection: &audit.Rejection{
+					Code:   audit.CodePipeToShell,
+					Detail: detail,
+				},
+			})
+			continue
+		}
+
+		// Reject interpreters that execute decoded content, which hides what runs
+		if detail, ok := decodeToShell[segment]; ok {
+			logger.Debug("rejected decode to shell", "segment", segment, "detail", detail)
+			overallApproved = false
+			hasObfuscatedExec = true
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:  segment,
+				Approved: false,
+				Wrappers: wrappers,
+				Rejection: &audit.Rejection{
+					Code:   audit.CodeObfuscatedExec,
+					Detail: detail,
+				},
+			})
+			continue
+		}
+
+		// An allow override matching the core command beats the deny rules
+		// that match it
+		var override SafeResult
+		if len(cfg.AllowOverrides) > 0 {
+			var ok bool
+			override, ok = matchWithTimeout(cfg.Limits.MatchTimeout, func() SafeResult {
+				return checkSafe(coreCmd, cfg.AllowOverrides, workDirs[i], inputRedirects[segment])
+			})
+			if !ok {
+				auditSegments = append(auditSegments, timeoutSegment(segment, wrappers, "allow", cfg.Limits.MatchTimeout))
+				overallApproved = false
+				continue
+			}
+		}
+
+		// Check deny list on core command (after splitting chain and stripping wrappers),
+		// then on the text each wrapper was stripped from, starting with the full
+		// segment, so rules targeting wrappers like ^sudo or ^env\s+-i still fire.
+		// Rules an override beats for the core command are skipped in the
+		// wrapper text too, but rules that match only the wrappers still apply.
+		denyMatches, ok := matchWithTimeout(cfg.Limits.MatchTimeout, func() []DenyResult {
+			matches := CheckDenyAll(coreCmd, cfg.DenyPatterns)
+			var overridden []DenyResult
+			if override.Matched {
+				overridden, matches = matches, nil
+			}
+			for _, text := range stripped {
+				for _, m := range CheckDenyAll(text, cfg.DenyPatterns) {
+					if !slices.Contains(matches, m) && !slices.Contains(overridden, m) {
+						matches = append(matches, m)
+					}
+				}
+			}
+			return matches
+		})
+		if !ok {
+			auditSegments = append(auditSegments, timeoutSegment(segment, wrappers, "deny", cfg.Limits.MatchTimeout))
+			overallApproved = false
+			continue
+		}
+		if len(denyMatches) > 0 {
+			denyResult := denyMatches[0]
+			// Every matched rule is recorded when there are several
+			var matchNames []string
+			if len(denyMatches) > 1 {
+				for _, m := range denyMatches {
+					matchNames = append(matchNames, m.Name)
+				}
+			}
 			logger.Debug("rejected by deny list", "command", coreCmd, "reason", denyResult.Name)
 			overallApproved = false
 			hasDenyMatch = true
+			denials = append(denials, denyResult)
 			auditSegments = append(auditSegments, audit.Segment{
 				Command:  segment,
 				Approved: false,
@@ -265,13 +568,78 @@ func ProcessWithResult(r io.Reader) Result {
 					Code:    audit.CodeDenyMatch,
 					Name:    denyResult.Name,
 					Pattern: denyResult.Pattern,
+					Detail:  denyResult.Reason,
+					Matches: matchNames,
 				},
 			})
 			continue
 		}
 
+		// Reject wrapper invocations that are dangerous even though the wrapper is
+		// allowed. Deny rules come first so they keep their own name and reason.
+		if rejection := checkDangerousWrappers(stripped, cfg.Security.DangerousWrappers); rejection != nil {
+			logger.Debug("rejected dangerous wrapper", "segment", segment, "detail", rejection.Detail)
+			overallApproved = false
+			hasDangerousWrapper = true
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:   segment,
+				Approved:  false,
+				Wrappers:  wrappers,
+				Rejection: rejection,
+			})
+			continue
+		}
+
+		// Reject awk, sed, and perl programs that run shell commands, which
+		// would otherwise pass as the read-only tool that is allowed
+		if rejection := checkScriptEscapes(coreCmd); rejection != nil {
+			logger.Debug("rejected script escape", "segment", segment, "detail", rejection.Detail)
+			overallApproved = false
+			hasScriptEscape = true
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:   segment,
+				Approved:  false,
+				Wrappers:  wrappers,
+				Rejection: rejection,
+			})
+			continue
+		}
+
+		if override.Matched {
+			logger.Debug("matched allow override", "command", coreCmd, "pattern", override.Name)
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:  segment,
+				Approved: true,
+				Wrappers: wrappers,
+				Match: &audit.Match{
+					Type:    MatchTypeAllowOverride,
+					Name:    override.Name,
+					Pattern: override.Pattern,
+					Note:    override.Note,
+				},
+			})
+			if len(wrappers) > 0 {
+				reasons = append(reasons, strings.Join(wrappers, "+")+" + "+override.Name)
+			} else {
+				reasons = append(reasons, override.Name)
+			}
+			continue
+		}
+
 		// Check safe patterns
-		safeResult := CheckSafe(coreCmd, cfg.SafeCommands)
+		safeResult, ok := matchWithTimeout(cfg.Limits.MatchTimeout, func() SafeResult {
+			return checkSafe(coreCmd, cfg.SafeCommands, workDirs[i], inputRedirects[segment])
+		})
+		if !ok {
+			auditSegments = append(auditSegments, timeoutSegment(segment, wrappers, "safe", cfg.Limits.MatchTimeout))
+			overallApproved = false
+			continue
+		}
+		// Protected variables were rejected above, so any other plain
+		// declaration is safe when enabled
+		if !safeResult.Matched && cfg.Security.AllowDeclarations && len(wrappers) == 0 && isPlainDeclaration(segment) {
+			safeResult = SafeResult{Matched: true, Type: MatchTypeDeclaration, Name: "declaration"}
+		}
 
 		// Check rewrite rules (regardless of safe match)
 		rewriteResult := CheckRewrite(coreCmd, cfg.RewriteRules)
@@ -294,6 +662,23 @@ func ProcessWithResult(r io.Reader) Result {
 			continue
 		}
 
+		if safeResult.Violation != "" {
+			logger.Debug("rejected arguments", "command", coreCmd, "violation", safeResult.Violation)
+			overallApproved = false
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:  segment,
+				Approved: false,
+				Wrappers: wrappers,
+				Rejection: &audit.Rejection{
+					Code:    safeResult.ViolationCode,
+					Name:    safeResult.Name,
+					Pattern: safeResult.Pattern,
+					Detail:  safeResult.Violation,
+				},
+			})
+			continue
+		}
+
 		if !safeResult.Matched {
 			logger.Debug("rejected unsafe command", "command", coreCmd)
 			overallApproved = false
@@ -305,7 +690,36 @@ func ProcessWithResult(r io.Reader) Result {
 				Command:   segment,
 				Approved:  false,
 				Wrappers:  wrappers,
-				Rejection: &audit.Rejection{Code: rejCode},
+				Rejection: &audit.Rejection{Code: rejCode, Detail: safeResult.NearMiss},
+			})
+			continue
+		}
+
+		// Validate commands run on the segment's behalf, like xargs's argument
+		// or a here-string fed to a shell. A program piped into an
+		// interpreter can't be validated.
+		rejection, denial := checkInnerCommands(coreCmd, cfg)
+		if hs, ok := hereStrings[segment]; ok && rejection == nil {
+			rejection, denial = checkHereString(hs, cfg)
+		}
+		if detail, ok := pipedPrograms[segment]; ok && rejection == nil {
+			rejection = &audit.Rejection{
+				Code:   audit.CodeInnerCommand,
+				Detail: fmt.Sprintf("%s runs piped input as code, which can't be validated", detail),
+			}
+		}
+		if rejection != nil {
+			logger.Debug("rejected inner command", "command", coreCmd, "detail", rejection.Detail)
+			overallApproved = false
+			if denial != nil {
+				hasDenyMatch = true
+				denials = append(denials, *denial)
+			}
+			auditSegments = append(auditSegments, audit.Segment{
+				Command:   segment,
+				Approved:  false,
+				Wrappers:  wrappers,
+				Rejection: rejection,
 			})
 			continue
 		}
@@ -321,6 +735,7 @@ func ProcessWithResult(r io.Reader) Result {
 				Type:    safeResult.Type,
 				Name:    safeResult.Name,
 				Pattern: safeResult.Pattern,
+				Note:    safeResult.Note,
 			},
 		})
 
@@ -330,59 +745,307 @@ func ProcessWithResult(r io.Reader) Result {
 			reasons = append(reasons, safeResult.Name)
 		}
 	}
+	for i := range auditSegments {
+		auditSegments[i].Operator = operators[i]
+		if cfg.Audit.ResolvePaths {
+			coreCmd, _ := StripWrappers(cmdSegments[i], cfg.WrapperPatterns)
+			auditSegments[i].ResolvedPath = resolveCommandPath(coreCmd, workDirs[i])
+		}
+	}
 
-	// Log and return based on overall result
-	durationMs := float64(time.Since(startTime).Microseconds()) / 1000.0
+	// Segments rejected only for matching no pattern are weighed by the
+	// any_deny_denies_all and require_all_allow settings
+	unmatchedSegments, approvedSegments := 0, 0
+	for _, seg := range auditSegments {
+		switch {
+		case seg.Approved:
+			approvedSegments++
+		case seg.Rejection != nil && (seg.Rejection.Code == audit.CodeNoMatch || seg.Rejection.Code == audit.CodePassthrough):
+			unmatchedSegments++
+		}
+	}
+	if !overallApproved && cfg.Security.AllowPartialApproval && approvedSegments > 0 &&
+		approvedSegments+unmatchedSegments == len(auditSegments) {
+		logger.Debug("approved despite unmatched segments", "unmatched", unmatchedSegments)
+		overallApproved = true
+	}
+
+	// Return based on overall result
 	if !overallApproved {
-		var output string
+		var output, reason string
 		passthrough := false
-		if hasDenyMatch {
-			output = `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"deny","permissionDecisionReason":"command matches deny list"}}`
+		if hasDenyMatch && (!cfg.Security.IgnoreSegmentDeny || unmatchedSegments == 0) {
+			reason = formatDenyReason(denials)
+			output = FormatDeny(reason)
+		} else if hasPipeToShell {
+			reason = "command pipes downloaded content into an interpreter"
+			output = FormatDeny(reason)
+		} else if hasObfuscatedExec {
+			reason = "command pipes decoded content into an interpreter"
+			output = FormatDeny(reason)
+		} else if hasSensitiveRedirect {
+			reason = "command redirects output to a protected path"
+			output = FormatDeny(reason)
+		} else if hasDeviceWrite {
+			reason = "command writes to a disk device"
+			output = FormatDeny(reason)
+		} else if hasEnvAssignment {
+			reason = "command sets a protected environment variable"
+			output = FormatDeny(reason)
+		} else if hasDangerousWrapper {
+			reason = "command runs an allowed wrapper in a dangerous way"
+			output = FormatDeny(reason)
+		} else if hasScriptEscape {
+			reason = "command runs a shell command from an awk, sed, or perl program"
+			output = FormatDeny(reason)
 		} else if hasRewrite {
-			reason := strings.Join(rewriteSuggestions, "; ")
+			reason = strings.Join(rewriteSuggestions, "; ")
 			output = FormatDeny(reason)
 		} else {
+			message := "command not in allow list"
+			if cfg.Output.NearMissHints {
+				message = withNearMissHints(message, auditSegments)
+			}
 			switch cfg.Unmatched {
 			case config.UnmatchedPassthrough:
 				output = ""
 				passthrough = true
 			case config.UnmatchedDeny:
-				output = FormatDeny("command not in allow list")
+				output = FormatDeny(message)
 			default:
-				output = FormatAsk("command not in allow list")
+				output = FormatAsk(message)
 			}
 		}
-		logAudit(cmd, false, auditSegments, durationMs, input.SessionID, input.ToolUseID, input.Cwd, rawInput, output)
-		return Result{Command: cmd, Approved: false, Output: output, Passthrough: passthrough}
+		return Result{Command: cmd, Approved: false, Reason: reason, Output: output, Passthrough: passthrough, DenyMatch: hasDenyMatch, Segments: auditSegments}
 	}
 	reason := strings.Join(reasons, " | ")
 	logger.Debug("approved", "reason", reason)
 	output := FormatApproval(reason)
-	logAudit(cmd, true, auditSegments, durationMs, input.SessionID, input.ToolUseID, input.Cwd, rawInput, output)
-	return Result{Command: cmd, Approved: true, Reason: reason, Output: output}
+	return Result{Command: cmd, Approved: true, Reason: reason, Output: output, Segments: auditSegments}
+}
+
+// withNearMissHints appends the near-miss hints of the unmatched segments to
+// message, so Claude can retry with an allowed form, e.g. "command not in
+// allow list (git push: git is allowed but subcommand 'push' is not in
+// [diff, log])". Returns message unchanged if there are none.
+func withNearMissHints(message string, segments []audit.Segment) string {
+	var hints []string
+	for _, seg := range segments {
+		if seg.Rejection != nil && seg.Rejection.Code == audit.CodeNoMatch && seg.Rejection.Detail != "" {
+			hints = append(hints, seg.Command+": "+seg.Rejection.Detail)
+		}
+	}
+	if len(hints) == 0 {
+		return message
+	}
+	return message + " (" + strings.Join(hints, "; ") + ")"
+}
+
+// formatDenyReason builds the deny decision reason from the matched deny
+// patterns. Custom reasons are shown as written; patterns without one are
+// listed by name after the default message. Duplicates are skipped.
+func formatDenyReason(denials []DenyResult) string {
+	var reasons, names []string
+	seen := make(map[string]bool)
+	for _, d := range denials {
+		if d.Reason != "" {
+			if !seen["reason:"+d.Reason] {
+				seen["reason:"+d.Reason] = true
+				reasons = append(reasons, d.Reason)
+			}
+			continue
+		}
+		if d.Name != "" && !seen["name:"+d.Name] {
+			seen["name:"+d.Name] = true
+			names = append(names, d.Name)
+		}
+	}
+
+	if len(names) > 0 {
+		reasons = append(reasons, "command matches deny list: "+strings.Join(names, ", "))
+	} else if len(reasons) == 0 {
+		reasons = append(reasons, "command matches deny list")
+	}
+	return strings.Join(reasons, "; ")
 }
 
 // SafeResult contains detailed information about a safe pattern match.
 type SafeResult struct {
 	Matched bool
 	Name    string
-	Type    string // simple, subcommand, regex, command
+	Type    string // simple, subcommand, regex, command, pathrestricted
 	Pattern string
+	Note    string // note from the matched pattern, if any
+	// Violation is set when a pattern matched the command but its arguments
+	// are not permitted: a path outside a pathrestricted pattern's prefixes,
+	// or an argument count outside min_args and max_args. Matched is false in
+	// that case.
+	Violation string
+	// ViolationCode is the rejection code for Violation: PATH_RESTRICTED or
+	// ARG_COUNT.
+	ViolationCode string
+	// NearMiss explains how an unmatched command came close to a safe
+	// pattern, as returned by FindNearMiss. Empty if it didn't.
+	NearMiss string
 }
 
 // CheckSafe checks if a command matches a safe pattern and returns details.
+// Path restrictions and argument count limits act as constraints: if any
+// matching pattern rejects the command's arguments, the command is not safe
+// regardless of other matching patterns.
 func CheckSafe(cmd string, safeCommands []patterns.Pattern) SafeResult {
+	return checkSafe(cmd, safeCommands, workDir{}, nil)
+}
+
+// checkSafe is CheckSafe with relative paths in path-restricted commands
+// resolved against dir, and inputs, the targets of the segment's input
+// redirections, checked like their path arguments.
+func checkSafe(cmd string, safeCommands []patterns.Pattern, dir workDir, inputs []string) SafeResult {
+	result := SafeResult{Matched: false}
 	for _, p := range safeCommands {
-		if p.Regex.MatchString(cmd) {
-			return SafeResult{
+		if !p.Regex.MatchString(cmd) || matchesDeniedSubcommand(cmd, p) {
+			continue
+		}
+		if p.Type == "pathrestricted" {
+			if violation := checkPathRestrictions(cmd, p, dir, inputs); violation != "" {
+				return SafeResult{
+					Matched:       false,
+					Name:          p.Name,
+					Type:          p.Type,
+					Pattern:       p.Pattern,
+					Violation:     violation,
+					ViolationCode: audit.CodePathRestricted,
+				}
+			}
+		}
+		if p.MinArgs != nil || p.MaxArgs != nil {
+			if violation := checkArgCount(cmd, p); violation != "" {
+				return SafeResult{
+					Matched:       false,
+					Name:          p.Name,
+					Type:          p.Type,
+					Pattern:       p.Pattern,
+					Violation:     violation,
+					ViolationCode: audit.CodeArgCount,
+				}
+			}
+		}
+		if !result.Matched {
+			result = SafeResult{
 				Matched: true,
 				Name:    p.Name,
 				Type:    p.Type,
 				Pattern: p.Pattern,
+				Note:    p.Note,
 			}
 		}
 	}
-	return SafeResult{Matched: false}
+	if !result.Matched {
+		result.NearMiss = FindNearMiss(cmd, safeCommands)
+	}
+	return result
+}
+
+// matchesDeniedSubcommand reports whether cmd uses one of the denied
+// subcommands of p. Except is matched against the unquoted words of the
+// parsed call, so quoting can't hide a subcommand (git 'push'). Fails closed:
+// a command that doesn't parse as a single call, or whose non-literal words
+// could expand to a denied subcommand (git $X), is treated as denied.
+func matchesDeniedSubcommand(cmd string, p patterns.Pattern) bool {
+	if p.Except == nil {
+		return false
+	}
+	prog, err := syntax.NewParser().Parse(strings.NewReader(cmd), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return true
+	}
+	call, isCall := prog.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !isCall || len(call.Args) == 0 {
+		return true
+	}
+	words := make([]string, len(call.Args))
+	var dynamic []int
+	for i, word := range call.Args {
+		value, literal := wordLiteral(word)
+		if !literal || hasUnquotedGlob(word) {
+			dynamic = append(dynamic, i)
+			continue
+		}
+		words[i] = value
+	}
+	if len(dynamic) == 0 {
+		return p.Except.MatchString(strings.Join(words, " "))
+	}
+	// Try each denied subcommand, and each of its words, in place of the
+	// words whose value isn't known
+	var candidates []string
+	for _, sub := range p.DeniedSubcommands {
+		candidates = append(candidates, sub)
+		candidates = append(candidates, strings.Fields(sub)...)
+	}
+	for _, candidate := range candidates {
+		for _, i := range dynamic {
+			words[i] = candidate
+		}
+		if p.Except.MatchString(strings.Join(words, " ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindNearMiss explains why a command that matched no safe pattern came close to
+// matching one, e.g. "git is allowed but subcommand 'push' is not in [diff, log]".
+// Returns "" if no safe pattern is for the same command name.
+func FindNearMiss(cmd string, safeCommands []patterns.Pattern) string {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return ""
+	}
+	name := fields[0]
+
+	for _, p := range safeCommands {
+		if p.Command != name {
+			continue
+		}
+		if matchesDeniedSubcommand(cmd, p) {
+			return fmt.Sprintf("%s is allowed except for subcommands in [%s]", name, strings.Join(p.DeniedSubcommands, ", "))
+		}
+		switch p.Type {
+		case "subcommand", "anyof":
+			sub := ""
+			for _, f := range fields[1:] {
+				if !strings.HasPrefix(f, "-") {
+					sub = f
+					break
+				}
+			}
+			if sub == "" {
+				return fmt.Sprintf("%s is allowed only with a subcommand in [%s]", name, strings.Join(p.Subcommands, ", "))
+			}
+			return fmt.Sprintf("%s is allowed but subcommand '%s' is not in [%s]", name, sub, strings.Join(p.Subcommands, ", "))
+		case "simple":
+			if p.Pattern == patterns.BuildExactPattern(p.Command) {
+				return fmt.Sprintf("%s is allowed only without arguments", name)
+			}
+		}
+	}
+	return ""
+}
+
+// timeoutSegment records a segment whose check against the named pattern list
+// ran longer than timeout. The segment is treated like an unmatched one.
+func timeoutSegment(segment string, wrappers []string, list string, timeout time.Duration) audit.Segment {
+	logger.Debug("rejected segment after match timeout", "segment", segment, "patterns", list, "timeout", timeout)
+	return audit.Segment{
+		Command:  segment,
+		Approved: false,
+		Wrappers: wrappers,
+		Rejection: &audit.Rejection{
+			Code:   audit.CodeTimeout,
+			Detail: fmt.Sprintf("%s pattern check exceeded %s", list, timeout),
+		},
+	}
 }
 
 // DenyResult contains detailed information about a deny pattern match.
@@ -390,6 +1053,7 @@ type DenyResult struct {
 	Denied  bool
 	Name    string
 	Pattern string
+	Reason  string // custom message from the deny pattern, if any
 }
 
 // CheckDeny checks if a command matches a deny pattern and returns details.
@@ -400,12 +1064,30 @@ func CheckDeny(cmd string, denyPatterns []patterns.Pattern) DenyResult {
 				Denied:  true,
 				Name:    p.Name,
 				Pattern: p.Pattern,
+				Reason:  p.Reason,
 			}
 		}
 	}
 	return DenyResult{Denied: false}
 }
 
+// CheckDenyAll returns every deny pattern that matches a command, in
+// pattern order.
+func CheckDenyAll(cmd string, denyPatterns []patterns.Pattern) []DenyResult {
+	var matches []DenyResult
+	for _, p := range denyPatterns {
+		if p.Regex.MatchString(cmd) {
+			matches = append(matches, DenyResult{
+				Denied:  true,
+				Name:    p.Name,
+				Pattern: p.Pattern,
+				Reason:  p.Reason,
+			})
+		}
+	}
+	return matches
+}
+
 // RewriteResult contains detailed information about a rewrite rule match.
 type RewriteResult struct {
 	Matched     bool
@@ -441,27 +1123,40 @@ func CheckRewrite(coreCmd string, rules []patterns.RewriteRule) RewriteResult {
 	return RewriteResult{Matched: false}
 }
 
-// logAudit logs a command decision to the audit log.
-func logAudit(command string, approved bool, segments []audit.Segment, durationMs float64, sessionID, toolUseID, cwd, rawInput, rawOutput string) {
+// logAudit logs the decision for input to the audit log, replacing matches
+// of cfg's redact patterns first.
+func logAudit(result Result, durationMs float64, input Input, rawInput string, cfg *config.Config) {
 	configPath := config.GetConfigPath()
 	var configError string
 	if err := config.InitError(); err != nil {
 		configError = err.Error()
 	}
-	audit.Log(audit.Entry{
+	audit.Log(audit.Redact(audit.Entry{
 		Version:     AuditVersion,
-		SessionID:   sessionID,
-		ToolUseID:   toolUseID,
-		Command:     command,
-		Approved:    approved,
-		Segments:    segments,
+		SessionID:   input.SessionID,
+		ToolUseID:   input.ToolUseID,
+		Command:     result.Command,
+		Approved:    result.Approved,
+		Reason:      result.Reason,
+		Segments:    result.Segments,
 		DurationMs:  durationMs,
-		Cwd:         cwd,
+		Cwd:         input.Cwd,
 		Input:       rawInput,
-		Output:      rawOutput,
+		Output:      result.Output,
 		ConfigPath:  configPath,
 		ConfigError: configError,
-	})
+		Profile:     cfg.Profile,
+	}, cfg.Audit.Redact))
+}
+
+// formatApprovalReason fills in the placeholders of an approval reason
+// template from an approved result.
+func formatApprovalReason(template string, result Result) string {
+	return strings.NewReplacer(
+		"{matched}", result.Reason,
+		"{segments}", strconv.Itoa(len(result.Segments)),
+		"{command}", result.Command,
+	).Replace(template)
 }
 
 // FormatApproval returns the JSON approval output
@@ -520,144 +1215,171 @@ var ErrUnparseable = errors.New("unparseable command")
 
 // SplitCommandChain splits command into segments on &&, ||, ;, |, & using a proper shell parser.
 // This handles quoted strings, redirections, and other shell syntax correctly.
+// Alongside the segments it returns the operator preceding each one: "" for
+// the first segment, otherwise "&&", "||", ";", "|", "|&", or "&". Statements
+// on separate lines are joined by ";". Within a compound command, the first
+// segment of an if or while body is preceded by "&&", of an else branch or
+// until body by "||", and the first segment inside a subshell, block, or
+// loop takes the operator preceding the compound command.
 // Returns ErrUnparseable if the command cannot be parsed.
-func SplitCommandChain(cmd string) ([]string, error) {
+func SplitCommandChain(cmd string) (segments, operators []string, err error) {
 	if strings.TrimSpace(cmd) == "" {
-		return nil, nil
+		return nil, nil, nil
+	}
+	if segments, ok := splitSimpleCommand(cmd); ok {
+		return segments, []string{""}, nil
 	}
+	return parseCommandChain(cmd)
+}
 
+// parseCommandChain is SplitCommandChain's full parse, used for any command
+// that isn't a single command of literal words.
+func parseCommandChain(cmd string) (segments, operators []string, err error) {
 	// Parse the command using the shell parser
 	parser := syntax.NewParser()
 	prog, err := parser.Parse(strings.NewReader(cmd), "")
 	if err != nil {
-		return nil, ErrUnparseable
+		return nil, nil, ErrUnparseable
 	}
 
-	var segments []string
-	printer := syntax.NewPrinter()
-
 	// Walk the AST to extract individual commands
-	for _, stmt := range prog.Stmts {
-		extractCommands(stmt.Cmd, printer, &segments)
-	}
+	extractStmts(prog.Stmts, "", syntax.NewPrinter(), &segments, &operators)
 
-	return segments, nil
+	return segments, operators, nil
 }
 
 // extractCommands recursively extracts simple commands from a shell AST node.
 func extractCommands(node syntax.Command, printer *syntax.Printer, segments *[]string) {
+	var operators []string
+	extractChain(node, "", printer, segments, &operators)
+}
+
+// extractStmts extracts the simple commands of a statement list, the first
+// of which is preceded by op. Later statements are preceded by "&" if the
+// statement before them runs in the background, and ";" otherwise.
+func extractStmts(stmts []*syntax.Stmt, op string, printer *syntax.Printer, segments, operators *[]string) {
+	for i, stmt := range stmts {
+		if i > 0 {
+			op = ";"
+			if stmts[i-1].Background {
+				op = "&"
+			}
+		}
+		extractChain(stmt.Cmd, op, printer, segments, operators)
+	}
+}
+
+// extractChain is extractCommands, also recording the operator preceding
+// each segment. op precedes the first segment of node.
+func extractChain(node syntax.Command, op string, printer *syntax.Printer, segments, operators *[]string) {
 	if node == nil {
 		return
 	}
 
-	switch cmd := node.(type) {
-	case *syntax.CallExpr:
+	// add records node itself as a segment
+	add := func() {
 		var buf strings.Builder
-		printer.Print(&buf, cmd)
+		printer.Print(&buf, node)
 		if s := strings.TrimSpace(buf.String()); s != "" {
 			*segments = append(*segments, s)
+			*operators = append(*operators, op)
 		}
+	}
+
+	switch cmd := node.(type) {
+	case *syntax.CallExpr:
+		add()
 
 	case *syntax.BinaryCmd:
-		extractCommands(cmd.X.Cmd, printer, segments)
-		extractCommands(cmd.Y.Cmd, printer, segments)
+		extractChain(cmd.X.Cmd, op, printer, segments, operators)
+		extractChain(cmd.Y.Cmd, cmd.Op.String(), printer, segments, operators)
 
 	case *syntax.Subshell:
-		for _, stmt := range cmd.Stmts {
-			extractCommands(stmt.Cmd, printer, segments)
-		}
+		extractStmts(cmd.Stmts, op, printer, segments, operators)
 
 	case *syntax.Block:
-		for _, stmt := range cmd.Stmts {
-			extractCommands(stmt.Cmd, printer, segments)
-		}
+		extractStmts(cmd.Stmts, op, printer, segments, operators)
 
 	case *syntax.IfClause:
 		for clause := cmd; clause != nil; clause = clause.Else {
-			for _, stmt := range clause.Cond {
-				extractCommands(stmt.Cmd, printer, segments)
+			if clause != cmd {
+				op = "||"
 			}
-			for _, stmt := range clause.Then {
-				extractCommands(stmt.Cmd, printer, segments)
+			extractStmts(clause.Cond, op, printer, segments, operators)
+			if len(clause.Cond) > 0 {
+				op = "&&"
 			}
+			extractStmts(clause.Then, op, printer, segments, operators)
 		}
 
 	case *syntax.WhileClause:
-		for _, stmt := range cmd.Cond {
-			extractCommands(stmt.Cmd, printer, segments)
-		}
-		for _, stmt := range cmd.Do {
-			extractCommands(stmt.Cmd, printer, segments)
+		extractStmts(cmd.Cond, op, printer, segments, operators)
+		op = "&&"
+		if cmd.Until {
+			op = "||"
 		}
+		extractStmts(cmd.Do, op, printer, segments, operators)
 
 	case *syntax.ForClause:
-		for _, stmt := range cmd.Do {
-			extractCommands(stmt.Cmd, printer, segments)
-		}
+		extractStmts(cmd.Do, op, printer, segments, operators)
 
 	case *syntax.CaseClause:
 		for _, item := range cmd.Items {
-			for _, stmt := range item.Stmts {
-				extractCommands(stmt.Cmd, printer, segments)
-			}
-		}
-
-	case *syntax.DeclClause:
-		var buf strings.Builder
-		printer.Print(&buf, cmd)
-		if s := strings.TrimSpace(buf.String()); s != "" {
-			*segments = append(*segments, s)
-		}
-
-	case *syntax.LetClause:
-		var buf strings.Builder
-		printer.Print(&buf, cmd)
-		if s := strings.TrimSpace(buf.String()); s != "" {
-			*segments = append(*segments, s)
+			extractStmts(item.Stmts, op, printer, segments, operators)
 		}
 
 	case *syntax.TimeClause:
 		if cmd.Stmt != nil {
-			extractCommands(cmd.Stmt.Cmd, printer, segments)
+			extractChain(cmd.Stmt.Cmd, op, printer, segments, operators)
 		}
 
 	case *syntax.CoprocClause:
 		if cmd.Stmt != nil {
-			extractCommands(cmd.Stmt.Cmd, printer, segments)
+			extractChain(cmd.Stmt.Cmd, op, printer, segments, operators)
 		}
 
 	case *syntax.FuncDecl:
 		if cmd.Body != nil {
-			extractCommands(cmd.Body.Cmd, printer, segments)
-		}
-
-	case *syntax.ArithmCmd:
-		var buf strings.Builder
-		printer.Print(&buf, cmd)
-		if s := strings.TrimSpace(buf.String()); s != "" {
-			*segments = append(*segments, s)
-		}
-
-	case *syntax.TestClause:
-		var buf strings.Builder
-		printer.Print(&buf, cmd)
-		if s := strings.TrimSpace(buf.String()); s != "" {
-			*segments = append(*segments, s)
+			extractChain(cmd.Body.Cmd, op, printer, segments, operators)
 		}
 
 	default:
-		var buf strings.Builder
-		printer.Print(&buf, cmd)
-		if s := strings.TrimSpace(buf.String()); s != "" {
-			*segments = append(*segments, s)
+		// DeclClause, LetClause, ArithmCmd, TestClause, and anything else
+		// are checked as a whole
+		add()
+	}
+}
+
+// checkDangerousWrappers returns a DANGEROUS_WRAPPER rejection if any of the
+// texts wrappers were stripped from, as returned by stripWrappers, matches a
+// dangerous wrapper pattern, or nil if none does.
+func checkDangerousWrappers(stripped []string, dangerous []*regexp.Regexp) *audit.Rejection {
+	for _, text := range stripped {
+		for _, re := range dangerous {
+			if m := re.FindString(text); m != "" {
+				return &audit.Rejection{
+					Code:    audit.CodeDangerousWrapper,
+					Pattern: re.String(),
+					Detail:  strings.TrimSpace(m),
+				}
+			}
 		}
 	}
+	return nil
 }
 
 // StripWrappers strips safe wrapper prefixes from a command.
 // Returns (core_cmd, list_of_wrapper_names)
 func StripWrappers(cmd string, wrapperPatterns []patterns.Pattern) (string, []string) {
-	var wrappers []string
+	core, wrappers, _ := stripWrappers(cmd, wrapperPatterns)
+	return core, wrappers
+}
+
+// stripWrappers is StripWrappers that also returns the command as it stood
+// before each wrapper was stripped, so the text a wrapper was stripped from
+// can be deny-checked. For "timeout 5 env -i sh" that is "timeout 5 env -i sh"
+// and "env -i sh".
+func stripWrappers(cmd string, wrapperPatterns []patterns.Pattern) (core string, wrappers, stripped []string) {
 	changed := true
 	for changed {
 		changed = false
@@ -665,11 +1387,12 @@ func StripWrappers(cmd string, wrapperPatterns []patterns.Pattern) (string, []st
 			loc := p.Regex.FindStringIndex(cmd)
 			if loc != nil && loc[0] == 0 {
 				wrappers = append(wrappers, p.Name)
+				stripped = append(stripped, strings.TrimSpace(cmd))
 				cmd = cmd[loc[1]:]
 				changed = true
 				break
 			}
 		}
 	}
-	return strings.TrimSpace(cmd), wrappers
+	return strings.TrimSpace(cmd), wrappers, stripped
 }
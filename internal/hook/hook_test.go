@@ -1,9 +1,12 @@
 package hook
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -405,6 +408,28 @@ func TestCheckSafeResultMatchedFalse(t *testing.T) {
 	}
 }
 
+func TestCheckSafeResultNearMiss(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.subcommand]]
+command = "git"
+subcommands = ["diff", "log"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := CheckSafe("git push origin main", cfg.SafeCommands)
+	if want := "git is allowed but subcommand 'push' is not in [diff, log]"; result.NearMiss != want {
+		t.Errorf("NearMiss = %q, want %q", result.NearMiss, want)
+	}
+	if result := CheckSafe("git log", cfg.SafeCommands); result.NearMiss != "" {
+		t.Errorf("NearMiss = %q for a matched command, want empty", result.NearMiss)
+	}
+	if result := CheckSafe("curl http://x", cfg.SafeCommands); result.NearMiss != "" {
+		t.Errorf("NearMiss = %q for an unrelated command, want empty", result.NearMiss)
+	}
+}
+
 func TestCheckSafeResultSimpleType(t *testing.T) {
 	patterns := mustCompilePatterns(t, []patternDef{
 		{name: "pwd", patternType: "simple", pattern: `^pwd\b`},
@@ -744,6 +769,29 @@ commands = ["ls", "pwd", "whoami"]
 	}
 }
 
+func TestSegmentOperatorsInAudit(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.simple]]
+name = "basic"
+commands = ["ls", "grep", "echo"]
+`)
+	defer cleanupConfig()
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls && grep x | rm y || echo failed"}}`))
+
+	entry := readLastAuditEntry(t, logPath)
+	var operators []string
+	for _, seg := range entry.Segments {
+		operators = append(operators, seg.Operator)
+	}
+	if want := []string{"", "&&", "|", "||"}; !reflect.DeepEqual(operators, want) {
+		t.Errorf("segment operators = %q, want %q", operators, want)
+	}
+}
+
 func TestApprovedSegmentMatchType(t *testing.T) {
 	cleanupConfig := setupTestConfig(t, `
 [commands]
@@ -782,6 +830,32 @@ subcommands = ["status", "log"]
 	}
 }
 
+func TestApprovedSegmentSimpleMatchPattern(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+`)
+	defer cleanupConfig()
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls -la"}}`))
+
+	entry := readLastAuditEntry(t, logPath)
+	if len(entry.Segments) != 1 || entry.Segments[0].Match == nil {
+		t.Fatalf("Expected 1 matched segment, got %+v", entry.Segments)
+	}
+	match := entry.Segments[0].Match
+	if match.Type != "simple" {
+		t.Errorf("Match.Type = %q, want %q", match.Type, "simple")
+	}
+	if match.Pattern != `^ls\b` {
+		t.Errorf("Match.Pattern = %q, want %q", match.Pattern, `^ls\b`)
+	}
+}
+
 func TestApprovedSegmentWithSingleWrapper(t *testing.T) {
 	cleanupConfig := setupTestConfig(t, `
 [wrappers]
@@ -1570,6 +1644,237 @@ commands = ["ls"]
 	}
 }
 
+func TestProcessWithResultUnparseableDeny(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[security]
+unparseable = "deny"
+
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`)
+	defer cleanupConfig()
+
+	input := `{"tool_name":"Bash","tool_input":{"command":"echo 'unclosed"}}`
+	result := ProcessWithResult(strings.NewReader(input))
+
+	if result.Approved {
+		t.Fatal("unparseable command should not be approved")
+	}
+	if result.Output != FormatDeny("unparseable command") {
+		t.Errorf("Output = %s, want deny decision", result.Output)
+	}
+	if rej := result.Segments[0].Rejection; rej == nil || rej.Code != audit.CodeUnparseable {
+		t.Errorf("Rejection = %+v, want %s", rej, audit.CodeUnparseable)
+	}
+}
+
+func TestMixedDenyAndUnmatchedSegments(t *testing.T) {
+	const base = `
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+`
+	tests := []struct {
+		name     string
+		security string
+		cmd      string
+		approved bool
+		output   string
+	}{
+		{"deny and no match", "", "sudo ls && foo", false, FormatDeny("command matches deny list: privilege escalation")},
+		{"deny and approved", "", "ls && sudo ls", false, FormatDeny("command matches deny list: privilege escalation")},
+		{"no match only", "", "ls && foo", false, FormatAsk("command not in allow list")},
+		{"deny and no match asks when any_deny_denies_all is off", "any_deny_denies_all = false", "sudo ls && foo", false, FormatAsk("command not in allow list")},
+		{"deny alone still denies when any_deny_denies_all is off", "any_deny_denies_all = false", "ls && sudo ls", false, FormatDeny("command matches deny list: privilege escalation")},
+		{"no match approved when require_all_allow is off", "require_all_allow = false", "ls && foo", true, ""},
+		{"all unmatched rejected when require_all_allow is off", "require_all_allow = false", "foo && bar", false, FormatAsk("command not in allow list")},
+		{"deny still denies when require_all_allow is off", "require_all_allow = false", "ls && foo && sudo ls", false, FormatDeny("command matches deny list: privilege escalation")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.LoadConfig([]byte("[security]\n" + tt.security + "\n" + base))
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if !tt.approved && result.Output != tt.output {
+				t.Errorf("Output = %s, want %s", result.Output, tt.output)
+			}
+		})
+	}
+}
+
+func TestZeroValueSecurityIsStrict(t *testing.T) {
+	loaded, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	// Built without LoadConfig's defaults, so Security is the zero value
+	cfg := &config.Config{SafeCommands: loaded.SafeCommands, DenyPatterns: loaded.DenyPatterns}
+
+	if result := EvaluateCommand("ls && foo", cfg); result.Approved {
+		t.Errorf("ls && foo approved with zero-value security: %s", result.Output)
+	}
+	want := FormatDeny("command matches deny list: privilege escalation")
+	if result := EvaluateCommand("sudo ls && foo", cfg); result.Output != want {
+		t.Errorf("sudo ls && foo output = %s, want %s", result.Output, want)
+	}
+}
+
+func TestProcessWithResultApprovalReasonTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"", "git | ls"},
+		{"auto-approved by mmi", "auto-approved by mmi"},
+		{"{matched} ({segments} segments): {command}", "git | ls (2 segments): git status && ls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			cleanupConfig := setupTestConfig(t, `
+[output]
+approval_reason_template = "`+tt.template+`"
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`)
+			defer cleanupConfig()
+
+			result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"git status && ls"}}`))
+			if !result.Approved {
+				t.Fatalf("expected approval, got %s", result.Output)
+			}
+			if result.Reason != tt.want {
+				t.Errorf("Reason = %q, want %q", result.Reason, tt.want)
+			}
+			if result.Output != FormatApproval(tt.want) {
+				t.Errorf("Output = %s, want %s", result.Output, FormatApproval(tt.want))
+			}
+		})
+	}
+}
+
+func TestProcessWithResultNearMissHints(t *testing.T) {
+	const base = `
+[[commands.subcommand]]
+command = "git"
+subcommands = ["diff", "log", "status"]
+
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`
+	tests := []struct {
+		name   string
+		config string
+		cmd    string
+		want   string
+	}{
+		{"hint for subcommand", "[output]\nnear_miss_hints = true\n" + base, "git push",
+			"command not in allow list (git push: git is allowed but subcommand 'push' is not in [diff, log, status])"},
+		{"hint in chain", "[output]\nnear_miss_hints = true\n" + base, "ls && git push origin main",
+			"command not in allow list (git push origin main: git is allowed but subcommand 'push' is not in [diff, log, status])"},
+		{"no near miss", "[output]\nnear_miss_hints = true\n" + base, "curl http://x", "command not in allow list"},
+		{"disabled", base, "git push", "command not in allow list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanupConfig := setupTestConfig(t, tt.config)
+			defer cleanupConfig()
+
+			result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"` + tt.cmd + `"}}`))
+			if result.Approved {
+				t.Fatal("expected rejection")
+			}
+			if result.Output != FormatAsk(tt.want) {
+				t.Errorf("Output = %s, want reason %q", result.Output, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessWithResultNearMissInAudit(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.subcommand]]
+command = "git"
+subcommands = ["diff", "log"]
+`)
+	defer cleanupConfig()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"git push"}}`))
+	rej := result.Segments[0].Rejection
+	if rej == nil || rej.Code != audit.CodeNoMatch || rej.Detail != "git is allowed but subcommand 'push' is not in [diff, log]" {
+		t.Errorf("Rejection = %+v, want NO_MATCH with the near miss as detail", rej)
+	}
+}
+
+func TestProcessWithResultMultiline(t *testing.T) {
+	const rules = `
+[[commands.simple]]
+name = "safe"
+commands = ["ls", "pwd"]
+`
+	input := `{"tool_name":"Bash","tool_input":{"command":"ls\npwd"}}`
+
+	t.Run("allowed by default", func(t *testing.T) {
+		cleanupConfig := setupTestConfig(t, rules)
+		defer cleanupConfig()
+
+		result := ProcessWithResult(strings.NewReader(input))
+		if !result.Approved {
+			t.Errorf("expected two-line command to be approved, got %s", result.Output)
+		}
+	})
+
+	t.Run("disallowed", func(t *testing.T) {
+		cleanupConfig := setupTestConfig(t, "[security]\nallow_multiline = false\n"+rules)
+		defer cleanupConfig()
+		logPath, cleanupAudit := setupTestAudit(t)
+		defer cleanupAudit()
+
+		result := ProcessWithResult(strings.NewReader(input))
+		if result.Approved {
+			t.Fatal("expected two-line command to be rejected")
+		}
+		if result.Output != FormatDeny("command spans multiple lines") {
+			t.Errorf("Output = %s, want deny", result.Output)
+		}
+		entry := readLastAuditEntry(t, logPath)
+		if len(entry.Segments) != 1 || entry.Segments[0].Rejection == nil || entry.Segments[0].Rejection.Code != audit.CodeMultiline {
+			t.Errorf("Segments = %+v, want one %s rejection", entry.Segments, audit.CodeMultiline)
+		}
+
+		if result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls && pwd"}}`)); !result.Approved {
+			t.Errorf("expected single-line command to be approved, got %s", result.Output)
+		}
+	})
+}
+
 func TestResultOutputFieldPopulated(t *testing.T) {
 	cleanupConfig := setupTestConfig(t, `
 [commands]
@@ -1631,6 +1936,61 @@ commands = ["ls"]
 	}
 }
 
+func TestProcessWithResultAuditReasonAndProfile(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	configDir := t.TempDir()
+	t.Setenv("MMI_CONFIG", configDir)
+	if err := os.MkdirAll(filepath.Join(configDir, config.ProfilesDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	profile := `
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`
+	if err := os.WriteFile(filepath.Join(configDir, config.ProfilesDir, "ci.toml"), []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "config.toml"), []byte(`extends = "ci"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Init(); err != nil {
+		t.Fatalf("config.Init() error = %v", err)
+	}
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls"}}`))
+	if !result.Approved {
+		t.Fatalf("expected ls to be approved, got reason %q", result.Reason)
+	}
+
+	entry := readLastAuditEntry(t, logPath)
+	if entry.Reason != result.Reason || entry.Reason == "" {
+		t.Errorf("Reason = %q, want %q", entry.Reason, result.Reason)
+	}
+	if entry.Profile != "ci" {
+		t.Errorf("Profile = %q, want ci", entry.Profile)
+	}
+
+	// Denials record their reason too
+	if err := audit.Init(logPath, false); err != nil {
+		t.Fatalf("audit.Init() error = %v", err)
+	}
+	ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"sudo ls"}}`))
+	entry = readLastAuditEntry(t, logPath)
+	if !strings.Contains(entry.Reason, "privilege escalation") {
+		t.Errorf("denied entry Reason = %q, want it to name the deny pattern", entry.Reason)
+	}
+}
+
 func TestProcessWithResultAuditConfigPathEmptyWhenConfigDirFails(t *testing.T) {
 	config.Reset()
 
@@ -1957,6 +2317,9 @@ replace = "uv run python"
 				if output.HookSpecificOutput.PermissionDecisionReason != tt.wantReason {
 					t.Errorf("reason = %q, want %q", output.HookSpecificOutput.PermissionDecisionReason, tt.wantReason)
 				}
+				if result.Reason != tt.wantReason {
+					t.Errorf("Result.Reason = %q, want %q", result.Reason, tt.wantReason)
+				}
 			} else {
 				if !result.Approved {
 					t.Errorf("expected approval, got rejection: %s", result.Output)
@@ -2256,3 +2619,1341 @@ commands = ["ls"]
 		t.Errorf("expected allow decision, got %q", result.Output)
 	}
 }
+
+func TestCheckSafePathRestricted(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.pathrestricted]]
+command = "cat"
+allowed_prefixes = ["./", "src/"]
+denied_prefixes = ["/etc/", "~/.ssh/"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd     string
+		matched bool
+	}{
+		{"cat src/main.go", true},
+		{"cat -n README.md", true},
+		{"cat /etc/passwd", false},
+		{"cat ~/.ssh/id_rsa", false},
+		{"cat ../secret.txt", false},
+		{"cat $HOME/notes", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := CheckSafe(tt.cmd, cfg.SafeCommands)
+			if result.Matched != tt.matched {
+				t.Errorf("CheckSafe(%q).Matched = %v, want %v (violation: %s)", tt.cmd, result.Matched, tt.matched, result.Violation)
+			}
+			if !tt.matched && result.Violation == "" {
+				t.Errorf("CheckSafe(%q).Violation is empty, want a description", tt.cmd)
+			}
+		})
+	}
+}
+
+func TestPathRestrictionsRejectGlobs(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.pathrestricted]]
+command = "cat"
+denied_prefixes = ["/etc/", "~/.ssh/"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"cat /tmp/notes", true},
+		{"cat '/tmp/a*b'", true},
+		{"cat /et[c]/shadow", false},
+		{"cat /e*/shadow", false},
+		{"cat ~/.ss?/id_rsa", false},
+		{"cat {/etc,/tmp}/shadow", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("EvaluateCommand(%q).Approved = %v, want %v (reason: %s)", tt.cmd, result.Approved, tt.approved, result.Reason)
+			}
+		})
+	}
+}
+
+func TestCheckSafePathRestrictionOverridesSimple(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "read-only"
+commands = ["cat"]
+
+[[commands.pathrestricted]]
+command = "cat"
+denied_prefixes = ["/etc/"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if result := CheckSafe("cat /etc/passwd", cfg.SafeCommands); result.Matched {
+		t.Errorf("expected path restriction to reject even though cat is a simple command")
+	}
+	if result := CheckSafe("cat notes.txt", cfg.SafeCommands); !result.Matched {
+		t.Errorf("expected cat notes.txt to be approved")
+	}
+}
+
+func TestPathRestrictionsCheckRedirectsAndOptions(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.pathrestricted]]
+command = "cat"
+denied_prefixes = ["/etc/"]
+
+[[commands.pathrestricted]]
+command = "head"
+allowed_prefixes = ["src/"]
+denied_prefixes = ["/etc/"]
+
+[[commands.pathrestricted]]
+command = "grep"
+allowed_prefixes = ["src/"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"cat < notes.txt", true},
+		{"cat < /etc/shadow", false},
+		{"cat <> /etc/shadow", false},
+		{"cat < $SECRET", false},
+		{"head -n 5 src/main.go", true},
+		{"head --lines 5 src/main.go", true},
+		{"head -n 5 /etc/passwd", false},
+		{"grep --file=/etc/patterns x src/main.go", false},
+		{"grep -f/etc/patterns x src/main.go", false},
+		{"grep --file=src/patterns src/main.go", true},
+		{"grep -e src src/main.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommandInDir(tt.cmd, "/work", cfg)
+			if result.Approved != tt.approved {
+				t.Errorf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+		})
+	}
+
+	// An option value is still checked against the denied prefixes
+	if result := checkSafe("head -n 5", cfg.SafeCommands, workDir{start: "/work", cwd: "/etc"}, nil); result.Matched {
+		t.Errorf("head -n 5 run in /etc should violate the denied prefix")
+	}
+}
+
+func TestProcessWithResultPathRestricted(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.pathrestricted]]
+command = "cat"
+allowed_prefixes = ["./", "src/"]
+denied_prefixes = ["/etc/"]
+`)
+	defer cleanupConfig()
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"cat src/main.go"}}`))
+	if !result.Approved {
+		t.Errorf("expected cat src/main.go to be approved, output: %s", result.Output)
+	}
+
+	result = ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"cat /etc/passwd"}}`))
+	if result.Approved {
+		t.Fatal("expected cat /etc/passwd to be rejected")
+	}
+
+	entry := readLastAuditEntry(t, logPath)
+	if len(entry.Segments) != 1 || entry.Segments[0].Rejection == nil {
+		t.Fatalf("expected one rejected segment, got %+v", entry.Segments)
+	}
+	rejection := entry.Segments[0].Rejection
+	if rejection.Code != audit.CodePathRestricted {
+		t.Errorf("rejection code = %q, want %q", rejection.Code, audit.CodePathRestricted)
+	}
+	if !strings.Contains(rejection.Detail, "/etc/passwd") {
+		t.Errorf("rejection detail = %q, want it to mention the path", rejection.Detail)
+	}
+}
+
+func TestArgCountLimits(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "single-file rm"
+commands = ["rm"]
+max_args = 1
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["add", "stash list"]
+min_args = 1
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"rm foo", true},
+		{"rm -f foo", true},
+		{"rm", true},
+		{"rm a b c", false},
+		{"rm -- -a -b", false},
+		{"rm *.log", false},
+		{"rm $FILE", false},
+		{`rm "*.log"`, true},
+		{"git add main.go", true},
+		{"git add", false},
+		{"git stash list x", true},
+		{"git stash list", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("EvaluateCommand(%q).Approved = %v, want %v (output: %s)", tt.cmd, result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if rej := result.Segments[0].Rejection; rej == nil || rej.Code != audit.CodeArgCount {
+				t.Errorf("Rejection = %+v, want %s", rej, audit.CodeArgCount)
+			}
+		})
+	}
+}
+
+func TestFindNearMiss(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.subcommand]]
+command = "git"
+subcommands = ["diff", "log", "status"]
+flags = ["-C <arg>"]
+
+[[commands.simple]]
+name = "bare echo"
+commands = ["echo"]
+exact = true
+
+[[commands.simple]]
+name = "listing"
+commands = ["ls"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"git push origin main", "git is allowed but subcommand 'push' is not in [diff, log, status]"},
+		{"git --no-pager push", "git is allowed but subcommand 'push' is not in [diff, log, status]"},
+		{"git", "git is allowed only with a subcommand in [diff, log, status]"},
+		{"echo hello", "echo is allowed only without arguments"},
+		{"npm publish", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			if got := FindNearMiss(tt.cmd, cfg.SafeCommands); got != tt.want {
+				t.Errorf("FindNearMiss(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessWithResultDenyReasonIncludesPatternName(t *testing.T) {
+	cleanup := setupTestConfig(t, `
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+`)
+	defer cleanup()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls && sudo ls"}}`))
+	if !result.DenyMatch {
+		t.Error("expected DenyMatch to be true")
+	}
+	if result.Reason != "command matches deny list: privilege escalation" {
+		t.Errorf("Reason = %q", result.Reason)
+	}
+	expected := FormatDeny("command matches deny list: privilege escalation")
+	if result.Output != expected {
+		t.Errorf("Output = %s, want %s", result.Output, expected)
+	}
+
+	result = ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"curl http://x"}}`))
+	if result.DenyMatch {
+		t.Error("expected DenyMatch to be false for an unmatched command")
+	}
+}
+
+func TestProcessWithResultCustomDenyReason(t *testing.T) {
+	cleanup := setupTestConfig(t, `
+[[deny.regex]]
+name = "rm root"
+pattern = 'rm\s+-rf\s+/'
+reason = "Refusing: this deletes system files."
+
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+`)
+	defer cleanup()
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"rm -rf /"}}`))
+	expected := FormatDeny("Refusing: this deletes system files.")
+	if result.Output != expected {
+		t.Errorf("Output = %s, want %s", result.Output, expected)
+	}
+
+	entry := readLastAuditEntry(t, logPath)
+	rejection := entry.Segments[0].Rejection
+	if rejection == nil || rejection.Code != audit.CodeDenyMatch {
+		t.Fatalf("expected DENY_MATCH rejection, got %+v", rejection)
+	}
+	if rejection.Name != "rm root" || rejection.Detail != "Refusing: this deletes system files." {
+		t.Errorf("rejection = %+v, want name and custom reason", rejection)
+	}
+
+	// Patterns without a custom reason are still listed by name
+	result = ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"rm -rf / && sudo ls"}}`))
+	if result.Reason != "Refusing: this deletes system files.; command matches deny list: privilege escalation" {
+		t.Errorf("Reason = %q", result.Reason)
+	}
+}
+
+func TestFormatDenyReason(t *testing.T) {
+	tests := []struct {
+		name    string
+		denials []DenyResult
+		want    string
+	}{
+		{"no names", []DenyResult{{Denied: true}}, "command matches deny list"},
+		{"names deduplicated", []DenyResult{{Name: "a"}, {Name: "b"}, {Name: "a"}}, "command matches deny list: a, b"},
+		{"custom reason", []DenyResult{{Name: "a", Reason: "No."}}, "No."},
+		{"reasons deduplicated", []DenyResult{{Name: "a", Reason: "No."}, {Name: "b", Reason: "No."}}, "No."},
+		{"mixed", []DenyResult{{Name: "a", Reason: "No."}, {Name: "b"}}, "No.; command matches deny list: b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatDenyReason(tt.denials); got != tt.want {
+				t.Errorf("formatDenyReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessWithResultProjectConfig(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.simple]]
+name = "global"
+commands = ["ls"]
+
+[[deny.regex]]
+name = "no force push"
+pattern = 'git\s+push\s+.*--force'
+`)
+	defer cleanupConfig()
+
+	repo := t.TempDir()
+	project := `
+[[commands.subcommand]]
+command = "git"
+subcommands = ["push"]
+
+[[commands.simple]]
+name = "build"
+commands = ["make"]
+`
+	if err := os.WriteFile(filepath.Join(repo, ".mmi.toml"), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(repo, "internal")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	process := func(command, cwd string) Result {
+		input, _ := json.Marshal(Input{ToolName: ToolNameBash, ToolInput: ToolInputData{Command: command}, Cwd: cwd})
+		return ProcessWithResult(bytes.NewReader(input))
+	}
+
+	if result := process("make test", subdir); !result.Approved {
+		t.Errorf("expected project command to be approved in the project, output: %s", result.Output)
+	}
+	if result := process("make test", t.TempDir()); result.Approved {
+		t.Error("expected project command to be rejected outside the project")
+	}
+	if result := process("git push origin main", subdir); !result.Approved {
+		t.Errorf("expected git push to be approved in the project, output: %s", result.Output)
+	}
+	if result := process("git push origin main --force", subdir); result.Approved || !result.DenyMatch {
+		t.Errorf("expected global deny to win over project commands, output: %s", result.Output)
+	}
+}
+
+func TestContainsProcessSubstitution(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{"diff <(ls) <(ls)", true},
+		{"tee >(gzip > out.gz)", true},
+		{"cat file.txt", false},
+		{"echo '<(ls)'", false},
+		{"cat <<'EOF'\n<(ls)\nEOF", false},
+		{"diff <(ls", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			if got := containsProcessSubstitution(tt.cmd); got != tt.want {
+				t.Errorf("containsProcessSubstitution(%q) = %v, want %v", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessSubstitutionRejectedByDefault(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.simple]]
+name = "tools"
+commands = ["diff", "ls"]
+`)
+	defer cleanupConfig()
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"diff <(ls) <(ls)"}}`))
+	if result.Approved {
+		t.Error("Command with process substitution should be rejected by default")
+	}
+
+	entry := readLastAuditEntry(t, logPath)
+	if entry.Segments[0].Rejection == nil {
+		t.Fatal("Expected rejection for process substitution")
+	}
+	if entry.Segments[0].Rejection.Code != audit.CodeProcessSubstitution {
+		t.Errorf("Rejection.Code = %q, want %q", entry.Segments[0].Rejection.Code, audit.CodeProcessSubstitution)
+	}
+}
+
+func TestProcessSubstitutionAllowedWhenConfigured(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[security]
+allow_process_substitution = true
+
+[[commands.simple]]
+name = "tools"
+commands = ["diff", "ls"]
+`)
+	defer cleanupConfig()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"diff <(ls) <(ls)"}}`))
+	if !result.Approved {
+		t.Errorf("Command with process substitution should be approved when allow_process_substitution is true, got output: %s", result.Output)
+	}
+}
+
+func TestEvaluateCommand(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls", "echo"]
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		cmd          string
+		wantApproved bool
+		wantSegments int
+		wantCode     string // rejection code of the last segment
+	}{
+		{"approved", "ls -la", true, 1, ""},
+		{"approved with wrapper", "timeout 10 ls", true, 1, ""},
+		{"approved chain", "ls && echo done", true, 2, ""},
+		{"deny match", "ls && rm -rf /", false, 2, audit.CodeDenyMatch},
+		{"no match", "curl example.com", false, 1, audit.CodeNoMatch},
+		{"command substitution", "echo $(whoami)", false, 1, audit.CodeCommandSubstitution},
+		{"unparseable", "echo 'unclosed", false, 1, audit.CodeUnparseable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Command != tt.cmd {
+				t.Errorf("Command = %q, want %q", result.Command, tt.cmd)
+			}
+			if result.Approved != tt.wantApproved {
+				t.Errorf("Approved = %v, want %v", result.Approved, tt.wantApproved)
+			}
+			if result.Output == "" {
+				t.Error("Output should be populated")
+			}
+			if len(result.Segments) != tt.wantSegments {
+				t.Fatalf("len(Segments) = %d, want %d", len(result.Segments), tt.wantSegments)
+			}
+			last := result.Segments[len(result.Segments)-1]
+			if tt.wantCode == "" {
+				if last.Rejection != nil {
+					t.Errorf("unexpected rejection %+v", last.Rejection)
+				}
+				return
+			}
+			if last.Rejection == nil || last.Rejection.Code != tt.wantCode {
+				t.Errorf("Rejection = %+v, want code %q", last.Rejection, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestEvaluateCommandDoesNotWriteAuditLog(t *testing.T) {
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if result := EvaluateCommand("ls", cfg); !result.Approved {
+		t.Fatalf("ls should be approved, got output: %s", result.Output)
+	}
+	audit.Close()
+	data, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("EvaluateCommand should not write the audit log, got:\n%s", data)
+	}
+}
+
+func TestDenyMatchesUnstrippedSegment(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[wrappers.command]]
+command = "sudo"
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+
+[[deny.regex]]
+pattern = '^sudo\b'
+name = "sudo"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd          string
+		wantApproved bool
+	}{
+		{"sudo ls", false},
+		{"timeout 10 ls", true},
+		{"ls", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.wantApproved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.wantApproved, result.Output)
+			}
+			if tt.wantApproved {
+				return
+			}
+			rej := result.Segments[0].Rejection
+			if rej == nil || rej.Code != audit.CodeDenyMatch || rej.Name != "sudo" {
+				t.Errorf("Rejection = %+v, want DENY_MATCH sudo", rej)
+			}
+			if !result.DenyMatch {
+				t.Error("DenyMatch should be true")
+			}
+		})
+	}
+}
+
+func TestDenyMatchesStrippedWrapperText(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[wrappers.simple]]
+name = "env"
+commands = ["env"]
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["pytest", "sh"]
+
+[[deny.regex]]
+pattern = '^env\s+-i'
+name = "env -i"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd          string
+		wantApproved bool
+	}{
+		{"env pytest", true},
+		{"env -i sh", false},
+		{"timeout 5 env -i sh", false},
+		{"timeout 5 env pytest", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.wantApproved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.wantApproved, result.Output)
+			}
+			if tt.wantApproved {
+				return
+			}
+			rej := result.Segments[0].Rejection
+			if rej == nil || rej.Code != audit.CodeDenyMatch || rej.Name != "env -i" {
+				t.Errorf("Rejection = %+v, want DENY_MATCH env -i", rej)
+			}
+		})
+	}
+}
+
+func TestAllowOverrides(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.regex]]
+pattern = 'rm\s+-rf'
+name = "recursive delete"
+
+[[deny.regex]]
+pattern = '^sudo\b'
+name = "sudo"
+
+[[allow.regex]]
+pattern = '^rm -rf \./build$'
+name = "clean build"
+
+[[allow.simple]]
+name = "status"
+commands = ["git status"]
+
+[[wrappers.simple]]
+name = "sudo"
+commands = ["sudo"]
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd          string
+		wantApproved bool
+	}{
+		{"rm -rf ./build", true},
+		{"git status", true},
+		{"timeout 5 rm -rf ./build", true},
+		{"rm -rf ./build /", false},
+		{"rm -rf ./src", false},
+		// Deny rules that match only the wrappers still apply
+		{"sudo rm -rf ./build", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.wantApproved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.wantApproved, result.Output)
+			}
+			seg := result.Segments[0]
+			if tt.wantApproved {
+				if seg.Match == nil || seg.Match.Type != MatchTypeAllowOverride {
+					t.Errorf("Match = %+v, want type %q", seg.Match, MatchTypeAllowOverride)
+				}
+				return
+			}
+			if seg.Rejection == nil || seg.Rejection.Code != audit.CodeDenyMatch {
+				t.Errorf("Rejection = %+v, want DENY_MATCH", seg.Rejection)
+			}
+		})
+	}
+}
+
+func TestDangerousWrappers(t *testing.T) {
+	configTOML := `
+[[wrappers.simple]]
+name = "env"
+commands = ["env"]
+
+[[wrappers.command]]
+command = "nice"
+flags = ["--adjustment=<arg>", "-n <arg>", ""]
+
+[[wrappers.command]]
+command = "timeout"
+flags = ["<arg>"]
+
+[[commands.simple]]
+name = "safe"
+commands = ["pytest", "sh"]
+`
+	cfg, err := config.LoadConfig([]byte(configTOML))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd        string
+		wantDetail string // "" if approved
+	}{
+		{"env pytest", ""},
+		{"nice -n 10 pytest", ""},
+		{"env -i sh", "env -i"},
+		{"timeout 5 env -i sh", "env -i"},
+		{"env -S 'sh -c id'", "env -S"},
+		{"nice --adjustment=-20 pytest", "nice --adjustment=-20"},
+		{"nice -n -5 pytest", "nice -n -5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != (tt.wantDetail == "") {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.wantDetail == "", result.Output)
+			}
+			if tt.wantDetail == "" {
+				return
+			}
+			rej := result.Segments[0].Rejection
+			if rej == nil || rej.Code != audit.CodeDangerousWrapper || rej.Detail != tt.wantDetail {
+				t.Errorf("Rejection = %+v, want DANGEROUS_WRAPPER %q", rej, tt.wantDetail)
+			}
+			var output Output
+			if err := json.Unmarshal([]byte(result.Output), &output); err != nil {
+				t.Fatalf("failed to parse output: %v", err)
+			}
+			if output.HookSpecificOutput.PermissionDecision != DecisionDeny {
+				t.Errorf("decision = %q, want %q", output.HookSpecificOutput.PermissionDecision, DecisionDeny)
+			}
+		})
+	}
+
+	// An empty list disables the check
+	cfg, err = config.LoadConfig([]byte(configTOML + "\n[security]\ndangerous_wrappers = []\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if result := EvaluateCommand("env -i sh", cfg); result.Approved {
+		t.Errorf("env -i sh approved with dangerous_wrappers = [], want NO_MATCH for core \"-i sh\"")
+	}
+}
+
+func TestProcessWithResultAuditsDangerousWrapper(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[wrappers.simple]]
+name = "env"
+commands = ["env"]
+
+[[commands.simple]]
+name = "shell"
+commands = ["sh"]
+`)
+	defer cleanupConfig()
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"env -i sh"}}`))
+	if result.Approved {
+		t.Fatal("expected env -i sh to be rejected")
+	}
+
+	entry := readLastAuditEntry(t, logPath)
+	if len(entry.Segments) != 1 || entry.Segments[0].Rejection == nil {
+		t.Fatalf("Segments = %+v, want one rejected segment", entry.Segments)
+	}
+	if code := entry.Segments[0].Rejection.Code; code != audit.CodeDangerousWrapper {
+		t.Errorf("Rejection.Code = %q, want %q", code, audit.CodeDangerousWrapper)
+	}
+	if entry.Reason != "command runs an allowed wrapper in a dangerous way" {
+		t.Errorf("Reason = %q", entry.Reason)
+	}
+}
+
+func TestDenyRecordsEveryMatchedRule(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[wrappers.command]]
+command = "sudo"
+
+[[deny.regex]]
+pattern = 'rm\s+-rf'
+name = "recursive delete"
+
+[[deny.regex]]
+pattern = 'rm\s+(-[rRfF]+\s+)*/'
+name = "rm root"
+
+[[deny.regex]]
+pattern = '^sudo\b'
+name = "sudo"
+
+[[deny.simple]]
+name = "curl"
+commands = ["curl"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd         string
+		wantName    string
+		wantMatches []string
+	}{
+		{"rm -rf /", "recursive delete", []string{"recursive delete", "rm root"}},
+		{"sudo rm -rf /", "recursive delete", []string{"recursive delete", "rm root", "sudo"}},
+		{"curl http://x", "curl", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			rej := result.Segments[0].Rejection
+			if rej == nil || rej.Code != audit.CodeDenyMatch {
+				t.Fatalf("Rejection = %+v, want DENY_MATCH", rej)
+			}
+			if rej.Name != tt.wantName {
+				t.Errorf("Name = %q, want the first matched rule %q", rej.Name, tt.wantName)
+			}
+			if !reflect.DeepEqual(rej.Matches, tt.wantMatches) {
+				t.Errorf("Matches = %q, want %q", rej.Matches, tt.wantMatches)
+			}
+		})
+	}
+}
+
+func TestProcessWithResultRedactsAuditLog(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[audit]
+redact = ['Bearer \S+', '--password \S+']
+
+[[commands.simple]]
+name = "safe"
+commands = ["curl"]
+`)
+	defer cleanupConfig()
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	input := `{"tool_name":"Bash","tool_input":{"command":"curl -H 'Authorization: Bearer xyz123' https://x && login --password hunter2"}}`
+	result := ProcessWithResult(strings.NewReader(input))
+	if !strings.Contains(result.Command, "xyz123") {
+		t.Error("redaction should only apply to the audit log, not the Result")
+	}
+
+	audit.Close()
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"xyz123", "hunter2"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("audit log should not contain %q:\n%s", secret, data)
+		}
+	}
+
+	entry := readLastAuditEntry(t, logPath)
+	if !strings.Contains(entry.Command, "***") {
+		t.Errorf("Command = %q, want redaction marker", entry.Command)
+	}
+	for i, seg := range entry.Segments {
+		if !strings.Contains(seg.Command, "***") {
+			t.Errorf("Segments[%d].Command = %q, want redaction marker", i, seg.Command)
+		}
+	}
+}
+
+func TestIgnoreCaseDenyBlocksAnyCase(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.simple]]
+name = "privilege escalation"
+commands = ["sudo"]
+ignore_case = true
+
+[[commands.simple]]
+name = "safe"
+commands = ["SUDO", "sudo"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	for _, cmd := range []string{"sudo ls", "SUDO ls"} {
+		result := EvaluateCommand(cmd, cfg)
+		if result.Approved || !result.DenyMatch {
+			t.Errorf("EvaluateCommand(%q) = approved %v, deny match %v; want denied", cmd, result.Approved, result.DenyMatch)
+		}
+	}
+}
+
+func TestFailedConfigLoadAsksAboutEveryCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"missing config", ""},
+		{"invalid config", "[[commands.simple]\nname = "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.config != "" {
+				if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(tt.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("MMI_CONFIG", dir)
+			config.Reset()
+			t.Cleanup(config.Reset)
+			if err := config.Init(); err == nil {
+				t.Fatal("Init() should fail")
+			}
+
+			// Not even the embedded default config's read-only commands are approved
+			result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls"}}`))
+			if result.Approved {
+				t.Fatal("no command should be approved when the config fails to load")
+			}
+			if result.Output != FormatAsk("command not in allow list") {
+				t.Errorf("Output = %s, want an ask decision", result.Output)
+			}
+		})
+	}
+}
+
+func TestExtraConfigDirsCombine(t *testing.T) {
+	teamDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(teamDir, "config.toml"), []byte(`
+[[deny.simple]]
+name = "team deny"
+commands = ["git push"]
+
+[[commands.simple]]
+name = "team tools"
+commands = ["make", "git"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MMI_CONFIG_EXTRA", teamDir)
+	cleanup := setupTestConfig(t, `
+[[deny.simple]]
+name = "personal deny"
+commands = ["make deploy"]
+
+[[commands.simple]]
+name = "personal tools"
+commands = ["ls"]
+`)
+	defer cleanup()
+
+	tests := []struct {
+		cmd      string
+		approved bool
+		deny     string
+	}{
+		{"ls -la", true, ""},
+		{"make build", true, ""},
+		// A deny rule from either directory beats an allow rule from the other
+		{"git push origin main", false, "team deny"},
+		{"make deploy", false, "personal deny"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, config.Get())
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (%s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.deny == "" {
+				return
+			}
+			if rej := result.Segments[0].Rejection; !result.DenyMatch || rej == nil || rej.Name != tt.deny {
+				t.Errorf("Rejection = %+v, want deny match %q", rej, tt.deny)
+			}
+		})
+	}
+}
+
+func TestMultilineDenyMatchesLaterLine(t *testing.T) {
+	data := `
+[[deny.regex]]
+pattern = '^\s*os\.system\('
+name = "os.system"
+multiline = %v
+
+[[commands.simple]]
+name = "python"
+commands = ["python3"]
+`
+	// The quoted program keeps both lines in a single segment
+	cmd := "python3 -c \"import os\nos.system('rm -rf /')\""
+
+	for _, multiline := range []bool{false, true} {
+		cfg, err := config.LoadConfig([]byte(fmt.Sprintf(data, multiline)))
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		result := EvaluateCommand(cmd, cfg)
+		if multiline && (result.Approved || !result.DenyMatch) {
+			t.Errorf("with multiline = true, approved %v, deny match %v; want denied by the second line", result.Approved, result.DenyMatch)
+		}
+		if !multiline && !result.Approved {
+			t.Errorf("without multiline, ^ should only match the start of the command; got %s", result.Output)
+		}
+	}
+}
+
+func TestPriorityDecidesReportedPattern(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "any git"
+commands = ["git"]
+
+[[commands.regex]]
+pattern = '^git\s+status\b'
+name = "git status"
+priority = 1
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+
+[[deny.regex]]
+pattern = '^rm\s+-rf\s+/'
+name = "rm root"
+priority = 1
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if result := CheckSafe("git status", cfg.SafeCommands); result.Name != "git status" {
+		t.Errorf("CheckSafe(git status).Name = %q, want the higher-priority %q", result.Name, "git status")
+	}
+	if result := CheckSafe("git log", cfg.SafeCommands); result.Name != "any git" {
+		t.Errorf("CheckSafe(git log).Name = %q, want %q", result.Name, "any git")
+	}
+	if result := CheckDeny("rm -rf /", cfg.DenyPatterns); result.Name != "rm root" {
+		t.Errorf("CheckDeny(rm -rf /).Name = %q, want the higher-priority %q", result.Name, "rm root")
+	}
+}
+
+func TestTypedFlagPlaceholders(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[wrappers.command]]
+command = "timeout"
+flags = ["<num>"]
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+flags = ["-C <path>"]
+
+[[commands.simple]]
+name = "python"
+commands = ["pytest"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd          string
+		wantApproved bool
+	}{
+		{"timeout 30 pytest", true},
+		{"timeout abc pytest", false},
+		{"timeout 30s pytest", false},
+		{"git -C ../repo status", true},
+		{"git -C=/tmp/x status", true},
+		{"git -C 'a;b' status", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.wantApproved {
+				t.Errorf("Approved = %v, want %v (output: %s)", result.Approved, tt.wantApproved, result.Output)
+			}
+		})
+	}
+}
+
+func TestMatchIncludesPatternNote(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+note = "needed for CI"
+
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	result := EvaluateCommand("git status && ls", cfg)
+	if !result.Approved {
+		t.Fatalf("expected approval, got %s", result.Output)
+	}
+	if got := result.Segments[0].Match.Note; got != "needed for CI" {
+		t.Errorf("git match Note = %q, want %q", got, "needed for CI")
+	}
+	if got := result.Segments[1].Match.Note; got != "" {
+		t.Errorf("ls match Note = %q, want none", got)
+	}
+}
+
+func TestBuiltinSection(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.builtin]]
+commands = ["pushd", "popd", "export"]
+
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"pushd /tmp", true},
+		{"pushd /tmp && ls", true},
+		{"popd", true},
+		{"popd /tmp", false},
+		{"export FOO=1", true},
+		{"export PATH=/evil", false},
+		{"eval ls", false},
+		{"cd /tmp", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Errorf("EvaluateCommand(%q).Approved = %v, want %v (reason: %s)", tt.cmd, result.Approved, tt.approved, result.Reason)
+			}
+		})
+	}
+}
+
+func TestEmptyCommandDecision(t *testing.T) {
+	for _, tt := range []struct {
+		security string
+		approved bool
+		decision string
+	}{
+		{"", false, DecisionAsk},
+		{"[security]\nempty_command = \"allow\"\n", true, DecisionAllow},
+	} {
+		cleanup := setupTestConfig(t, tt.security)
+		for _, cmd := range []string{"", "   ", "# just a comment"} {
+			t.Run(tt.decision+"/"+cmd, func(t *testing.T) {
+				logPath, auditCleanup := setupTestAudit(t)
+				defer auditCleanup()
+
+				input, _ := json.Marshal(Input{ToolName: ToolNameBash, ToolInput: ToolInputData{Command: cmd}})
+				result := ProcessWithResult(strings.NewReader(string(input)))
+				if result.Approved != tt.approved || result.Reason != "empty command" {
+					t.Errorf("Approved = %v, Reason = %q, want %v, \"empty command\"", result.Approved, result.Reason, tt.approved)
+				}
+				if !strings.Contains(result.Output, `"permissionDecision":"`+tt.decision+`"`) {
+					t.Errorf("Output = %s, want a %s decision", result.Output, tt.decision)
+				}
+
+				entry := readLastAuditEntry(t, logPath)
+				if entry.Reason != "empty command" || entry.Approved != tt.approved {
+					t.Errorf("audit entry = %+v, want an empty command entry", entry)
+				}
+				if entry.Segments == nil || len(entry.Segments) != 0 {
+					t.Errorf("audit Segments = %#v, want an empty list", entry.Segments)
+				}
+			})
+		}
+		cleanup()
+	}
+}
+
+func TestDenySubcommand(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.subcommand]]
+command = "git"
+subcommands = ["push", "reset"]
+
+[[commands.simple]]
+name = "git"
+commands = ["git"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"git push origin main", false},
+		{"git reset --hard HEAD~1", false},
+		{"git status && git push", false},
+		{"git status", true},
+		{"git log --oneline", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("EvaluateCommand(%q).Approved = %v, want %v (reason: %s)", tt.cmd, result.Approved, tt.approved, result.Reason)
+			}
+			if !tt.approved && (!result.DenyMatch || result.Reason != "command matches deny list: git") {
+				t.Errorf("DenyMatch = %v, Reason = %q, want a deny list match", result.DenyMatch, result.Reason)
+			}
+		})
+	}
+}
+
+func TestDeniedSubcommands(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.subcommand]]
+command = "git"
+denied_subcommands = ["push", "reset --hard", "clean -fd"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"git checkout main", true},
+		{"git status", true},
+		{"git reset --soft HEAD~1", true},
+		{"git push origin main", false},
+		{"git -C /repo push", false},
+		{"git reset --hard HEAD", false},
+		{"git clean -fd", false},
+		{"git status && git push", false},
+		{"git 'push' --force", false},
+		{`git pu"sh"`, false},
+		{"git reset '--hard'", false},
+		{`git -C "/repo" "push"`, false},
+		{"git $SUB", false},
+		{"git reset $MODE", false},
+		{"git p*sh", false},
+		{"git log $REF", true},
+		{"git commit -m 'push the fix'", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("EvaluateCommand(%q).Approved = %v, want %v (reason: %s)", tt.cmd, result.Approved, tt.approved, result.Reason)
+			}
+			if !tt.approved && result.DenyMatch {
+				t.Errorf("DenyMatch = true, want a denied subcommand to match no pattern")
+			}
+		})
+	}
+
+	if got, want := FindNearMiss("git push", cfg.SafeCommands), "git is allowed except for subcommands in [push, reset --hard, clean -fd]"; got != want {
+		t.Errorf("FindNearMiss() = %q, want %q", got, want)
+	}
+}
+
+func TestMissingConfigAsksAboutMultilineCommands(t *testing.T) {
+	t.Setenv("MMI_CONFIG", t.TempDir())
+	config.Reset()
+	defer config.Reset()
+	if err := config.Init(); err == nil {
+		t.Fatal("Init() error = nil, want the missing config reported")
+	}
+
+	result := EvaluateCommand("ls\npwd", config.Get())
+	if result.Approved || result.Output != FormatAsk("command not in allow list") {
+		t.Errorf("Output = %s, want an ask decision", result.Output)
+	}
+}
@@ -0,0 +1,433 @@
+package hook
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/patterns"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// xargsArgFlags are the xargs short flags that take a separate argument.
+var xargsArgFlags = map[byte]bool{
+	'a': true,
+	'd': true,
+	'E': true,
+	'I': true,
+	'L': true,
+	'n': true,
+	'P': true,
+	's': true,
+}
+
+// findExecActions are the find actions that run a command.
+var findExecActions = map[string]bool{
+	"-exec":    true,
+	"-execdir": true,
+	"-ok":      true,
+	"-okdir":   true,
+}
+
+// findExecTerminators end the command of a find exec action, as written in
+// the shell.
+var findExecTerminators = map[string]bool{
+	`\;`:  true,
+	`';'`: true,
+	`";"`: true,
+	";":   true,
+	"+":   true,
+}
+
+// shellOptionsWithArg are the shell options that take a separate argument.
+var shellOptionsWithArg = map[string]bool{
+	"-o": true,
+	"+o": true,
+	"-O": true,
+	"+O": true,
+}
+
+// inlineScript returns the script that a shell invocation like bash -c
+// "ls && pwd" runs. found is false if coreCmd is not a shell in interpreters
+// given -c. ok is false if the script can't be determined statically, such
+// as when it comes from a variable.
+func inlineScript(coreCmd string, interpreters []string) (shell, script string, found, ok bool) {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(coreCmd), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return "", "", false, false
+	}
+	call, isCall := prog.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !isCall || len(call.Args) == 0 {
+		return "", "", false, false
+	}
+	name, literal := wordLiteral(call.Args[0])
+	shell = path.Base(name)
+	if !literal || !shellInterpreter(shell, interpreters) {
+		return "", "", false, false
+	}
+
+	// The script is the first argument after the options, if -c is among them
+	hasC := false
+	args := call.Args[1:]
+	for len(args) > 0 {
+		opt, literal := wordLiteral(args[0])
+		if !literal {
+			break
+		}
+		if opt == "--" || opt == "-" {
+			args = args[1:]
+			break
+		}
+		if len(opt) < 2 || (opt[0] != '-' && opt[0] != '+') {
+			break
+		}
+		if !strings.HasPrefix(opt, "--") && strings.ContainsRune(opt[1:], 'c') && opt[0] == '-' {
+			hasC = true
+		}
+		args = args[1:]
+		if shellOptionsWithArg[opt] && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	if !hasC {
+		return shell, "", false, false
+	}
+	if len(args) == 0 {
+		return shell, "", true, false
+	}
+	script, ok = unquoteWord(args[0])
+	return shell, script, true, ok
+}
+
+// unquoteWord returns the value the shell passes for word, after removing
+// quotes and backslash escapes, including those of $'...' strings. Unlike
+// wordLiteral, "echo \"hi\"" yields echo "hi" and $'ls\nrm' yields two lines.
+// ok is false if the word contains any part that the shell would expand.
+func unquoteWord(word *syntax.Word) (value string, ok bool) {
+	if _, literal := wordLiteral(word); !literal {
+		return "", false
+	}
+	fields, err := expand.Fields(nil, word)
+	if err != nil || len(fields) != 1 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+// checkInlineScript validates the script run by a shell's -c option or
+// here-string by evaluating it like a top-level command. runner describes how
+// the script is run, like "bash -c", for rejection details. The first
+// rejected segment of the script rejects the whole command.
+func checkInlineScript(runner, script string, cfg *config.Config) (rejection *audit.Rejection, denial *DenyResult) {
+	if strings.TrimSpace(script) == "" {
+		return nil, nil
+	}
+	result := EvaluateCommand(script, cfg)
+	if result.Approved {
+		return nil, nil
+	}
+	for _, seg := range result.Segments {
+		if seg.Rejection == nil {
+			continue
+		}
+		rejection := *seg.Rejection
+		detail := fmt.Sprintf("%s runs %q", runner, seg.Command)
+		if rejection.Detail != "" {
+			detail += ": " + rejection.Detail
+		} else if rejection.Code == audit.CodeNoMatch || rejection.Code == audit.CodePassthrough {
+			detail += ", which is not in the allow list"
+		}
+		rejection.Detail = detail
+		if rejection.Code == audit.CodeDenyMatch {
+			denial = &DenyResult{Denied: true, Name: rejection.Name, Pattern: rejection.Pattern, Reason: seg.Rejection.Detail}
+		}
+		return &rejection, denial
+	}
+	return &audit.Rejection{
+		Code:   audit.CodeInnerCommand,
+		Detail: fmt.Sprintf("%s runs %q, which is not approved", runner, script),
+	}, nil
+}
+
+// hereStringScript is the here-string an interpreter reads as its program.
+type hereStringScript struct {
+	interpreter string
+	script      string
+	ok          bool // false if the script can't be determined statically
+}
+
+// inlineCodeOptions are the options of the non-shell interpreters that give
+// the program as an argument, leaving stdin as data.
+var inlineCodeOptions = map[string][]string{
+	"python":  {"-c", "-m"},
+	"python3": {"-c", "-m"},
+	"node":    {"-e", "--eval", "-p", "--print"},
+	"perl":    {"-e", "-E"},
+	"ruby":    {"-e"},
+	"php":     {"-r"},
+}
+
+// shellInterpreter reports whether name is one of interpreters that runs its
+// -c argument or a here-string as a shell script, which can be validated like
+// a command. Interpreters other than the scripting languages in
+// inlineCodeOptions are treated as shells.
+func shellInterpreter(name string, interpreters []string) bool {
+	if _, language := inlineCodeOptions[name]; language {
+		return false
+	}
+	return slices.Contains(interpreters, name)
+}
+
+// findHereStringScripts finds interpreters fed a here-string as their
+// program, such as bash <<< "rm -rf /", which hides the command that runs
+// from allow and deny patterns. An interpreter given a script operand or
+// inline code reads the here-string as data and is not reported.
+// Only the commands in interpreters are considered. Returns a map from each
+// interpreter segment, printed the same way as SplitCommandChain, to the
+// here-string it runs.
+func findHereStringScripts(cmd string, wrapperPatterns []patterns.Pattern, interpreters []string) map[string]hereStringScript {
+	if !strings.Contains(cmd, "<<<") {
+		return nil
+	}
+
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil
+	}
+
+	printer := syntax.NewPrinter()
+	result := make(map[string]hereStringScript)
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		stmt, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		if _, isCall := stmt.Cmd.(*syntax.CallExpr); !isCall {
+			return true
+		}
+		var word *syntax.Word
+		for _, redir := range stmt.Redirs {
+			if redir.Op == syntax.WordHdoc && (redir.N == nil || redir.N.Value == "0") {
+				word = redir.Word
+			}
+		}
+		if word == nil {
+			return true
+		}
+		var segments []string
+		extractCommands(stmt.Cmd, printer, &segments)
+		for _, segment := range segments {
+			coreCmd, _ := StripWrappers(segment, wrapperPatterns)
+			interpreter, readsStdin := stdinInterpreter(coreCmd, interpreters)
+			if !readsStdin {
+				continue
+			}
+			script, ok := unquoteWord(word)
+			result[segment] = hereStringScript{interpreter: interpreter, script: script, ok: ok}
+		}
+		return true
+	})
+	return result
+}
+
+// stdinInterpreter returns the name of the interpreter in interpreters that
+// coreCmd runs, and whether it reads its program from stdin because it is
+// given neither inline code nor a script operand other than "-".
+func stdinInterpreter(coreCmd string, interpreters []string) (string, bool) {
+	words, ok := shellWords(coreCmd)
+	if !ok {
+		return "", false
+	}
+	name := path.Base(words[0])
+	if !slices.Contains(interpreters, name) {
+		return "", false
+	}
+	args := words[1:]
+	for len(args) > 0 {
+		opt := args[0]
+		if opt == "-" {
+			return name, true
+		}
+		if opt == "--" {
+			args = args[1:]
+			break
+		}
+		if len(opt) < 2 || (opt[0] != '-' && opt[0] != '+') {
+			break
+		}
+		if shellInterpreter(name, interpreters) {
+			if opt[0] == '-' && !strings.HasPrefix(opt, "--") && strings.ContainsRune(opt[1:], 'c') {
+				return name, false
+			}
+		} else if slices.ContainsFunc(inlineCodeOptions[name], func(code string) bool {
+			return opt == code || (len(code) == 2 && strings.HasPrefix(opt, code))
+		}) {
+			return name, false
+		}
+		args = args[1:]
+		if shellInterpreter(name, interpreters) && shellOptionsWithArg[opt] && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	return name, len(args) == 0 || args[0] == "-"
+}
+
+// checkHereString validates the here-string an interpreter runs. Shell
+// scripts are evaluated like a top-level command; the programs of other
+// interpreters can't be validated and are always rejected.
+func checkHereString(hs hereStringScript, cfg *config.Config) (rejection *audit.Rejection, denial *DenyResult) {
+	if !shellInterpreter(hs.interpreter, cfg.Security.Interpreters) {
+		return &audit.Rejection{
+			Code:   audit.CodeInnerCommand,
+			Detail: fmt.Sprintf("%s runs a here-string as code, which can't be validated", hs.interpreter),
+		}, nil
+	}
+	if !hs.ok {
+		return &audit.Rejection{
+			Code:   audit.CodeInnerCommand,
+			Detail: fmt.Sprintf("cannot determine the here-string run by %s", hs.interpreter),
+		}, nil
+	}
+	return checkInlineScript(hs.interpreter+" <<<", hs.script, cfg)
+}
+
+// shellWords splits a simple command into its words as written, preserving
+// quotes and expansions. ok is false if cmd is not a single simple command.
+func shellWords(cmd string) (words []string, ok bool) {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return nil, false
+	}
+	call, isCall := prog.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !isCall {
+		return nil, false
+	}
+
+	printer := syntax.NewPrinter()
+	for _, word := range call.Args {
+		var buf strings.Builder
+		printer.Print(&buf, word)
+		words = append(words, buf.String())
+	}
+	return words, len(words) > 0
+}
+
+// xargsInnerCommand returns the command an xargs invocation runs, given its
+// words including the xargs command name. Returns "" if no command is given,
+// in which case xargs runs echo.
+func xargsInnerCommand(words []string) string {
+	i := 1
+	for i < len(words) {
+		arg := words[i]
+		if arg == "--" {
+			i++
+			break
+		}
+		if arg == "-" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		// Long options take their values with "=", short ones may be separate
+		if !strings.HasPrefix(arg, "--") && len(arg) == 2 && xargsArgFlags[arg[1]] {
+			i++
+		}
+		i++
+	}
+	if i >= len(words) {
+		return ""
+	}
+	return strings.Join(words[i:], " ")
+}
+
+// findExecCommands returns the commands run by the -exec, -execdir, -ok,
+// and -okdir actions of a find invocation, given its words. A command runs up
+// to its terminating ";" or "+", or to the end of the words if unterminated.
+func findExecCommands(words []string) []string {
+	var commands []string
+	for i := 1; i < len(words); i++ {
+		if !findExecActions[words[i]] {
+			continue
+		}
+		start := i + 1
+		end := start
+		for end < len(words) && !findExecTerminators[words[end]] {
+			end++
+		}
+		if end > start {
+			commands = append(commands, strings.Join(words[start:end], " "))
+		}
+		i = end
+	}
+	return commands
+}
+
+// innerCommands returns the commands that coreCmd runs on its behalf, such as
+// the command given to xargs or find -exec, along with the name of the running command.
+// ok is false if coreCmd runs other commands that can't be determined.
+func innerCommands(coreCmd string, cfg *config.Config) (runner string, inner []string, ok bool) {
+	fields := strings.Fields(coreCmd)
+	if len(fields) == 0 {
+		return "", nil, true
+	}
+	runner = fields[0]
+	isXargs := slices.Contains(cfg.XargsCommands, runner)
+	if !isXargs && runner != "find" {
+		return "", nil, true
+	}
+
+	words, parsed := shellWords(coreCmd)
+	if !parsed {
+		return runner, nil, false
+	}
+	if isXargs {
+		if cmd := xargsInnerCommand(words); cmd != "" {
+			inner = append(inner, cmd)
+		}
+		return runner, inner, true
+	}
+	return runner, findExecCommands(words), true
+}
+
+// checkInnerCommands validates the commands that coreCmd runs on its behalf
+// through the full approval pipeline. Returns nil if they are all approved.
+// denial is set when the rejection came from a deny pattern.
+func checkInnerCommands(coreCmd string, cfg *config.Config) (rejection *audit.Rejection, denial *DenyResult) {
+	if shell, script, found, ok := inlineScript(coreCmd, cfg.Security.Interpreters); found {
+		if !ok {
+			return &audit.Rejection{
+				Code:   audit.CodeInnerCommand,
+				Detail: fmt.Sprintf("cannot determine the script run by %s -c", shell),
+			}, nil
+		}
+		return checkInlineScript(shell+" -c", script, cfg)
+	}
+
+	runner, inner, ok := innerCommands(coreCmd, cfg)
+	if !ok {
+		return &audit.Rejection{
+			Code:   audit.CodeInnerCommand,
+			Detail: fmt.Sprintf("cannot determine the command run by %s", runner),
+		}, nil
+	}
+
+	// Each command is evaluated like a top-level command, so wrapper,
+	// environment, and redirect checks apply to it as well as the deny and
+	// safe lists, and the commands it runs are checked in turn
+	for _, cmd := range inner {
+		rejection, denial := checkInlineScript(runner, cmd, cfg)
+		if rejection == nil {
+			continue
+		}
+		if rejection.Code == audit.CodeNoMatch || rejection.Code == audit.CodePassthrough {
+			rejection.Code = audit.CodeInnerCommand
+		}
+		return rejection, denial
+	}
+	return nil, nil
+}
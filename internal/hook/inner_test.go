@@ -0,0 +1,523 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestXargsInnerCommand(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"xargs rm -rf", "rm -rf"},
+		{"xargs -0 rm", "rm"},
+		{"xargs -n 1 echo", "echo"},
+		{"xargs -n1 echo", "echo"},
+		{"xargs -I {} cp {} /tmp", "cp {} /tmp"},
+		{"xargs --max-args=2 -P 4 grep foo", "grep foo"},
+		{"xargs -- -weird", "-weird"},
+		{"xargs sh -c 'rm \"$1\"'", `sh -c 'rm "$1"'`},
+		{"xargs", ""},
+		{"xargs -0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			words, ok := shellWords(tt.cmd)
+			if !ok {
+				t.Fatalf("shellWords(%q) failed", tt.cmd)
+			}
+			if got := xargsInnerCommand(words); got != tt.want {
+				t.Errorf("xargsInnerCommand(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckInnerCommands(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.regex]]
+name = "recursive delete"
+pattern = 'rm\s+-rf'
+
+[[commands.simple]]
+name = "tools"
+commands = ["xargs", "echo", "ls", "grep"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd        string
+		wantCode   string
+		wantDenied bool
+	}{
+		{"xargs echo", "", false},
+		{"xargs", "", false},
+		{"xargs -0 grep foo", "", false},
+		{"xargs xargs echo", "", false},
+		{"ls -la", "", false},
+		{"xargs rm -rf", audit.CodeDenyMatch, true},
+		{"xargs rm", audit.CodeInnerCommand, false},
+		{"xargs xargs rm -rf", audit.CodeDenyMatch, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			rejection, denial := checkInnerCommands(tt.cmd, cfg)
+			if tt.wantCode == "" {
+				if rejection != nil {
+					t.Errorf("checkInnerCommands(%q) = %+v, want nil", tt.cmd, rejection)
+				}
+				return
+			}
+			if rejection == nil || rejection.Code != tt.wantCode {
+				t.Fatalf("checkInnerCommands(%q) = %+v, want code %s", tt.cmd, rejection, tt.wantCode)
+			}
+			if (denial != nil) != tt.wantDenied {
+				t.Errorf("checkInnerCommands(%q) denial = %+v, want denied %v", tt.cmd, denial, tt.wantDenied)
+			}
+		})
+	}
+}
+
+func TestCheckInnerCommandsConfigurableRunners(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[xargs]
+commands = ["parallel"]
+
+[[commands.simple]]
+name = "tools"
+commands = ["xargs", "parallel", "echo"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rejection, _ := checkInnerCommands("parallel rm", cfg); rejection == nil {
+		t.Error("expected parallel's inner command to be validated")
+	}
+	if rejection, _ := checkInnerCommands("xargs rm", cfg); rejection != nil {
+		t.Errorf("expected xargs not to be treated as a runner, got %+v", rejection)
+	}
+}
+
+func TestInnerCommandsEvaluatedLikeTopLevel(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[wrappers.simple]]
+name = "env"
+commands = ["env"]
+
+[[wrappers.regex]]
+pattern = '^([A-Z_][A-Z0-9_]*=[^\s]*\s+)+'
+name = "env vars"
+
+[[commands.simple]]
+name = "tools"
+commands = ["find", "xargs", "sh", "make"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd  string
+		code string // empty if approved
+	}{
+		{`find . -exec env -i sh \;`, audit.CodeDangerousWrapper},
+		{"xargs env -i make", audit.CodeDangerousWrapper},
+		{"xargs env LD_PRELOAD=x make", audit.CodeEnvAssignment},
+		{"xargs sh -c 'make; rm -rf /'", audit.CodeInnerCommand},
+		{"xargs env make", ""},
+		{`find . -exec env sh \;`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != (tt.code == "") {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.code == "", result.Output)
+			}
+			if tt.code == "" {
+				return
+			}
+			if rej := result.Segments[0].Rejection; rej == nil || rej.Code != tt.code {
+				t.Errorf("Rejection = %+v, want %s", rej, tt.code)
+			}
+		})
+	}
+}
+
+func TestProcessWithResultXargs(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[deny.simple]]
+name = "delete"
+commands = ["rm"]
+
+[[commands.simple]]
+name = "tools"
+commands = ["ls", "xargs", "echo"]
+`)
+	defer cleanupConfig()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls | xargs echo"}}`))
+	if !result.Approved {
+		t.Errorf("expected ls | xargs echo to be approved, output: %s", result.Output)
+	}
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	result = ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls | xargs rm -rf"}}`))
+	if result.Approved || !result.DenyMatch {
+		t.Fatalf("expected ls | xargs rm -rf to be denied, output: %s", result.Output)
+	}
+	if !strings.Contains(result.Output, "command matches deny list: delete") {
+		t.Errorf("expected deny reason to name the pattern, got %s", result.Output)
+	}
+
+	entry := readLastAuditEntry(t, logPath)
+	rejection := entry.Segments[1].Rejection
+	if rejection == nil || rejection.Code != audit.CodeDenyMatch {
+		t.Fatalf("expected DENY_MATCH rejection, got %+v", rejection)
+	}
+	if rejection.Detail != `xargs runs "rm -rf"` {
+		t.Errorf("rejection detail = %q", rejection.Detail)
+	}
+
+	result = ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls | xargs touch"}}`))
+	if result.Approved || result.DenyMatch {
+		t.Errorf("expected ls | xargs touch to be rejected as unmatched, output: %s", result.Output)
+	}
+}
+
+func TestFindExecCommands(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{`find . -name '*.o' -exec rm {} \;`, []string{"rm {}"}},
+		{`find . -exec cat {} ';'`, []string{"cat {}"}},
+		{`find . -execdir grep -l foo {} +`, []string{"grep -l foo {}"}},
+		{`find . -ok rm {} \; -exec cat {} \;`, []string{"rm {}", "cat {}"}},
+		{`find . -exec rm {}`, []string{"rm {}"}},
+		{`find . -name '*.go'`, nil},
+		{`find . -exec \;`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			words, ok := shellWords(tt.cmd)
+			if !ok {
+				t.Fatalf("shellWords(%q) failed", tt.cmd)
+			}
+			got := findExecCommands(words)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("findExecCommands(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessWithResultFindExec(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.simple]]
+name = "read-only"
+commands = ["find", "cat"]
+`)
+	defer cleanupConfig()
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"find . -exec cat {} ;", true},
+		{`find . -name '*.txt' -exec cat {} \;`, true},
+		{"find . -exec rm {} ;", false},
+		{`find . -name '*.o' -exec cat {} \; -execdir rm {} +`, false},
+		{"find . -name '*.go'", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			logPath, cleanupAudit := setupTestAudit(t)
+			defer cleanupAudit()
+
+			input, _ := json.Marshal(Input{ToolName: ToolNameBash, ToolInput: ToolInputData{Command: tt.cmd}})
+			result := ProcessWithResult(bytes.NewReader(input))
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v, output: %s", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+
+			entry := readLastAuditEntry(t, logPath)
+			rejection := entry.Segments[0].Rejection
+			if rejection == nil || rejection.Code != audit.CodeInnerCommand {
+				t.Fatalf("expected %s rejection, got %+v", audit.CodeInnerCommand, rejection)
+			}
+			if !strings.Contains(rejection.Detail, `find runs "rm {}"`) {
+				t.Errorf("rejection detail = %q", rejection.Detail)
+			}
+		})
+	}
+}
+
+func TestInlineScript(t *testing.T) {
+	tests := []struct {
+		cmd    string
+		script string
+		found  bool
+		ok     bool
+	}{
+		{`bash -c "ls && pwd"`, "ls && pwd", true, true},
+		{`sh -c 'rm -rf /'`, "rm -rf /", true, true},
+		{`/bin/zsh -c ls`, "ls", true, true},
+		{`bash -ec 'ls' name arg`, "ls", true, true},
+		{`bash -o pipefail -c 'ls | wc -l'`, "ls | wc -l", true, true},
+		{`bash -x -c ls`, "ls", true, true},
+		{`sh -c "cd x; ls; rm -rf /"`, "cd x; ls; rm -rf /", true, true},
+		{`sh -c "echo \"a b\" \$HOME"`, `echo "a b" $HOME`, true, true},
+		{`sh -c ls\;pwd`, "ls;pwd", true, true},
+		{`sh -c 'ls; '"pwd"`, "ls; pwd", true, true},
+		{`sh -c $'ls\nrm -rf /'`, "ls\nrm -rf /", true, true},
+		{`bash -c "$CMD"`, "", true, false},
+		{`bash -c`, "", true, false},
+		{`bash script.sh`, "", false, false},
+		{`bash`, "", false, false},
+		{`python -c 'print(1)'`, "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			_, script, found, ok := inlineScript(tt.cmd, config.DefaultInterpreters)
+			if found != tt.found || ok != tt.ok || script != tt.script {
+				t.Errorf("inlineScript(%q) = %q, found %v, ok %v; want %q, %v, %v", tt.cmd, script, found, ok, tt.script, tt.found, tt.ok)
+			}
+		})
+	}
+}
+
+func TestInlineScriptEvaluated(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+
+[[commands.simple]]
+name = "tools"
+commands = ["bash", "sh", "cd", "ls", "pwd", "xargs"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+		code     string
+	}{
+		{`bash -c "ls && pwd"`, true, ""},
+		{`sh -c 'ls | pwd'`, true, ""},
+		{`bash script.sh`, true, ""},
+		{`bash -c "rm -rf /"`, false, audit.CodeDenyMatch},
+		{`bash -c "ls && rm -rf /"`, false, audit.CodeDenyMatch},
+		{`sh -c "cd x; ls; pwd"`, true, ""},
+		{`sh -c "cd x; ls; rm -rf /"`, false, audit.CodeDenyMatch},
+		{`sh -c 'ls;rm -rf /'`, false, audit.CodeDenyMatch},
+		{`sh -c ls\;rm`, false, audit.CodeDenyMatch},
+		{`sh -c "ls \"a b\"; rm -rf /"`, false, audit.CodeDenyMatch},
+		{`sh -c $'ls\nrm -rf /'`, false, audit.CodeDenyMatch},
+		{`bash -c "ls && curl http://x"`, false, audit.CodeNoMatch},
+		{`bash -c 'bash -c "rm -rf /"'`, false, audit.CodeDenyMatch},
+		{`bash -c "$CMD"`, false, audit.CodeInnerCommand},
+		{`xargs sh -c 'rm "$1"'`, false, audit.CodeDenyMatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if rej := result.Segments[0].Rejection; rej == nil || rej.Code != tt.code {
+				t.Errorf("Rejection = %+v, want code %s", rej, tt.code)
+			}
+			if tt.code == audit.CodeDenyMatch && !result.DenyMatch {
+				t.Error("DenyMatch should be set when the script runs a denied command")
+			}
+		})
+	}
+}
+
+func TestInlineScriptRejectsLaterStatement(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+
+[[commands.simple]]
+name = "tools"
+commands = ["sh", "cd", "ls"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := EvaluateCommand(`sh -c "cd x; ls; rm -rf /"`, cfg)
+	if result.Approved {
+		t.Fatal("sh -c with a denied final statement should be rejected")
+	}
+	rej := result.Segments[0].Rejection
+	if rej == nil || !strings.Contains(rej.Detail, `sh -c runs "rm -rf /"`) {
+		t.Errorf("Rejection = %+v, want detail naming the final statement", rej)
+	}
+}
+
+func TestStdinInterpreter(t *testing.T) {
+	tests := []struct {
+		cmd        string
+		readsStdin bool
+	}{
+		{`bash`, true},
+		{`/bin/sh -s`, true},
+		{`bash -x -`, true},
+		{`bash -o pipefail`, true},
+		{`python3`, true},
+		{`python3 -u -`, true},
+		{`bash script.sh`, false},
+		{`bash -c "$0"`, false},
+		{`python3 -c 'import sys'`, false},
+		{`python3 script.py`, false},
+		{`node -e 'process.stdin'`, false},
+		{`perl -ne 'print'`, false},
+		{`cat`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			if _, readsStdin := stdinInterpreter(tt.cmd, config.DefaultInterpreters); readsStdin != tt.readsStdin {
+				t.Errorf("stdinInterpreter(%q) = %v, want %v", tt.cmd, readsStdin, tt.readsStdin)
+			}
+		})
+	}
+}
+
+func TestHereStringEvaluated(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+
+[[commands.simple]]
+name = "tools"
+commands = ["bash", "sh", "cat", "ls", "pwd", "python3", "grep"]
+
+[[wrappers.simple]]
+name = "sudo"
+commands = ["sudo"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+		code     string
+	}{
+		{`cat <<< "hello"`, true, ""},
+		{`grep foo <<< "$VAR"`, true, ""},
+		{`bash <<< "ls && pwd"`, true, ""},
+		{`bash script.sh <<< "rm -rf /"`, true, ""},
+		{`python3 script.py <<< "data"`, true, ""},
+		{`bash <<< "rm -rf /"`, false, audit.CodeDenyMatch},
+		{`sh -s <<< 'ls; rm -rf /'`, false, audit.CodeDenyMatch},
+		{`sudo bash <<< "rm -rf /"`, false, audit.CodeDenyMatch},
+		{`ls && bash <<< "rm -rf /"`, false, audit.CodeDenyMatch},
+		{`bash <<< "curl http://x"`, false, audit.CodeNoMatch},
+		{`bash <<< "$CMD"`, false, audit.CodeInnerCommand},
+		{`python3 <<< "print(1)"`, false, audit.CodeInnerCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			rej := result.Segments[len(result.Segments)-1].Rejection
+			if rej == nil || rej.Code != tt.code {
+				t.Errorf("Rejection = %+v, want code %s", rej, tt.code)
+			}
+			if tt.code == audit.CodeDenyMatch && !result.DenyMatch {
+				t.Error("DenyMatch should be set when the here-string runs a denied command")
+			}
+		})
+	}
+}
+
+func TestCustomShellInterpreter(t *testing.T) {
+	const rules = `
+[[commands.simple]]
+name = "tools"
+commands = ["fish", "ls"]
+`
+	without, err := config.LoadConfig([]byte(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	with, err := config.LoadConfig([]byte(rules + "\n[security]\ninterpreters = [\"sh\", \"bash\", \"fish\"]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+		runner   string
+	}{
+		{`fish -c "foo"`, false, "fish -c"},
+		{`fish <<< "foo"`, false, "fish <<<"},
+		{`fish -c "ls"`, true, ""},
+		{`fish <<< "ls"`, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			if result := EvaluateCommand(tt.cmd, without); !result.Approved {
+				t.Errorf("%s should be approved when fish isn't an interpreter, got %s", tt.cmd, result.Output)
+			}
+			result := EvaluateCommand(tt.cmd, with)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if rej := result.Segments[0].Rejection; rej == nil || !strings.Contains(rej.Detail, tt.runner) {
+				t.Errorf("Rejection = %+v, want a detail naming %q", rej, tt.runner)
+			}
+		})
+	}
+
+	php, err := config.LoadConfig([]byte(rules + "\n[[commands.simple]]\nname = \"php\"\ncommands = [\"php\"]\n\n[security]\ninterpreters = [\"sh\", \"php\"]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := EvaluateCommand("php -c php.ini script.php", php); !result.Approved {
+		t.Errorf("php -c names a config file, not a shell script, got %s", result.Output)
+	}
+}
@@ -0,0 +1,164 @@
+package hook
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/patterns"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// downloadTools are commands that fetch remote content to stdout.
+var downloadTools = map[string]bool{
+	"curl":  true,
+	"wget":  true,
+	"fetch": true,
+}
+
+// findPipeToShell finds pipelines that feed the output of a download tool
+// directly into one of interpreters, such as "curl https://x | sh".
+// Returns a map from each receiving interpreter segment, printed the same way
+// as SplitCommandChain, to a description like "curl | sh".
+func findPipeToShell(cmd string, wrapperPatterns []patterns.Pattern, interpreters []string) map[string]string {
+	return findPipedInterpreters(cmd, wrapperPatterns, interpreters, func(coreCmd string) (string, bool) {
+		name := commandName(coreCmd, nil)
+		return name, downloadTools[name]
+	})
+}
+
+// findPipedPrograms finds pipelines that feed any command's output into one
+// of interpreters as its program, such as "echo x | ruby". An interpreter
+// given a script operand or inline code reads the pipe as data and is not
+// reported. Returns a map like findPipeToShell's.
+func findPipedPrograms(cmd string, wrapperPatterns []patterns.Pattern, interpreters []string) map[string]string {
+	found := findPipedInterpreters(cmd, wrapperPatterns, interpreters, func(coreCmd string) (string, bool) {
+		return commandName(coreCmd, nil), true
+	})
+	for segment := range found {
+		coreCmd, _ := StripWrappers(segment, wrapperPatterns)
+		if _, readsStdin := stdinInterpreter(coreCmd, interpreters); !readsStdin {
+			delete(found, segment)
+		}
+	}
+	return found
+}
+
+// findDecodeToShell finds pipelines that feed decoded content directly into
+// one of interpreters, such as "echo ... | base64 -d | sh", which hides the
+// command that runs from allow and deny patterns. Returns a map like
+// findPipeToShell's, with descriptions like "base64 -d | sh".
+func findDecodeToShell(cmd string, wrapperPatterns []patterns.Pattern, interpreters []string) map[string]string {
+	return findPipedInterpreters(cmd, wrapperPatterns, interpreters, decoderName)
+}
+
+// decoderName returns a description of the decoding coreCmd does, like
+// "base64 -d", and whether it decodes at all. base64 and base32 decode with
+// -d, --decode, or -D (macOS), xxd with -r, and openssl with -d.
+func decoderName(coreCmd string) (string, bool) {
+	fields := strings.Fields(coreCmd)
+	if len(fields) == 0 {
+		return "", false
+	}
+	name := filepath.Base(fields[0])
+	for _, arg := range fields[1:] {
+		short := strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--")
+		switch name {
+		case "base64", "base32":
+			if arg == "--decode" || (short && strings.ContainsAny(arg, "dD")) {
+				return name + " -d", true
+			}
+		case "xxd":
+			if arg == "-revert" || (short && strings.Contains(arg, "r")) {
+				return name + " -r", true
+			}
+		case "openssl":
+			if arg == "-d" {
+				return name + " -d", true
+			}
+		}
+	}
+	return "", false
+}
+
+// findPipedInterpreters finds pipelines where a command that isSource
+// accepts feeds directly into one of interpreters. isSource receives the
+// source's core command and returns its name for the description. Returns a
+// map from each receiving interpreter segment, printed the same way as
+// SplitCommandChain, to a description like "<source> | sh".
+func findPipedInterpreters(cmd string, wrapperPatterns []patterns.Pattern, interpreters []string, isSource func(coreCmd string) (string, bool)) map[string]string {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil
+	}
+
+	printer := syntax.NewPrinter()
+	printCall := func(call *syntax.CallExpr) string {
+		var buf strings.Builder
+		printer.Print(&buf, call)
+		return strings.TrimSpace(buf.String())
+	}
+
+	found := make(map[string]string)
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		bin, ok := node.(*syntax.BinaryCmd)
+		if !ok || (bin.Op != syntax.Pipe && bin.Op != syntax.PipeAll) {
+			return true
+		}
+		source := rightmostCall(bin.X.Cmd)
+		sink := leftmostCall(bin.Y.Cmd)
+		if source == nil || sink == nil {
+			return true
+		}
+
+		sinkSegment := printCall(sink)
+		sinkName := commandName(sinkSegment, wrapperPatterns)
+		if !slices.Contains(interpreters, sinkName) {
+			return true
+		}
+		sourceCore, _ := StripWrappers(printCall(source), wrapperPatterns)
+		if sourceName, ok := isSource(sourceCore); ok {
+			found[sinkSegment] = sourceName + " | " + sinkName
+		}
+		return true
+	})
+	return found
+}
+
+// rightmostCall returns the last command of a pipeline, or nil if it isn't a simple call.
+func rightmostCall(cmd syntax.Command) *syntax.CallExpr {
+	switch c := cmd.(type) {
+	case *syntax.CallExpr:
+		return c
+	case *syntax.BinaryCmd:
+		if c.Op == syntax.Pipe || c.Op == syntax.PipeAll {
+			return rightmostCall(c.Y.Cmd)
+		}
+	}
+	return nil
+}
+
+// leftmostCall returns the first command of a pipeline, or nil if it isn't a simple call.
+func leftmostCall(cmd syntax.Command) *syntax.CallExpr {
+	switch c := cmd.(type) {
+	case *syntax.CallExpr:
+		return c
+	case *syntax.BinaryCmd:
+		if c.Op == syntax.Pipe || c.Op == syntax.PipeAll {
+			return leftmostCall(c.X.Cmd)
+		}
+	}
+	return nil
+}
+
+// commandName returns the base name of the command run by segment after
+// stripping wrappers, e.g. "sudo /bin/bash -s" yields "bash".
+func commandName(segment string, wrapperPatterns []patterns.Pattern) string {
+	coreCmd, _ := StripWrappers(segment, wrapperPatterns)
+	fields := strings.Fields(coreCmd)
+	if len(fields) == 0 {
+		return ""
+	}
+	return filepath.Base(fields[0])
+}
@@ -0,0 +1,311 @@
+package hook
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// writeRedirectOps are the redirection operators that write to their target.
+var writeRedirectOps = map[syntax.RedirOperator]bool{
+	syntax.RdrOut:   true, // >
+	syntax.AppOut:   true, // >>
+	syntax.ClbOut:   true, // >|
+	syntax.RdrAll:   true, // &>
+	syntax.AppAll:   true, // &>>
+	syntax.RdrInOut: true, // <>
+}
+
+// readRedirectOps are the redirection operators that read from their target.
+var readRedirectOps = map[syntax.RedirOperator]bool{
+	syntax.RdrIn:    true, // <
+	syntax.RdrInOut: true, // <>
+}
+
+// writeRedirectTargets returns the file targets of the write and append
+// redirections in redirs, as resolved by wordTarget. Targets that can't be
+// resolved statically are returned as dynamicWord.
+func writeRedirectTargets(redirs []*syntax.Redirect) []string {
+	var targets []string
+	for _, redir := range redirs {
+		if !writeRedirectOps[redir.Op] || redir.Word == nil {
+			continue
+		}
+		targets = append(targets, wordTarget(redir.Word))
+	}
+	return targets
+}
+
+// wordTarget returns the file path word names, built from its parts with
+// quotes removed and a leading $HOME written as "~". Words containing an
+// unquoted glob or brace, or any other expansion, can't be resolved
+// statically and are returned as dynamicWord.
+func wordTarget(word *syntax.Word) string {
+	var sb strings.Builder
+	afterHome := false
+	for i, part := range word.Parts {
+		if afterHome && !startsWithSlash(part) {
+			// $HOME.bak names a sibling of the home directory
+			return dynamicWord
+		}
+		afterHome = false
+		switch p := part.(type) {
+		case *syntax.Lit:
+			if strings.ContainsAny(p.Value, "*?[{") {
+				return dynamicWord
+			}
+			sb.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for j, inner := range p.Parts {
+				if afterHome && !startsWithSlash(inner) {
+					return dynamicWord
+				}
+				afterHome = false
+				switch q := inner.(type) {
+				case *syntax.Lit:
+					sb.WriteString(q.Value)
+				case *syntax.ParamExp:
+					if i != 0 || j != 0 || !isHomeParam(q) {
+						return dynamicWord
+					}
+					sb.WriteString("~")
+					afterHome = true
+				default:
+					return dynamicWord
+				}
+			}
+		case *syntax.ParamExp:
+			if i != 0 || !isHomeParam(p) {
+				return dynamicWord
+			}
+			sb.WriteString("~")
+			afterHome = true
+		default:
+			return dynamicWord
+		}
+	}
+	return sb.String()
+}
+
+// isHomeParam reports whether p is a plain $HOME or ${HOME} expansion.
+func isHomeParam(p *syntax.ParamExp) bool {
+	return p.Param != nil && p.Param.Value == "HOME" && !p.Excl && !p.Length && !p.Width &&
+		p.Index == nil && p.Slice == nil && p.Repl == nil && p.Names == 0 && p.Exp == nil
+}
+
+// startsWithSlash reports whether a word part following $HOME continues the
+// path with a "/", so the two together name a path under the home directory.
+func startsWithSlash(part syntax.WordPart) bool {
+	switch p := part.(type) {
+	case *syntax.Lit:
+		return strings.HasPrefix(p.Value, "/")
+	case *syntax.SglQuoted:
+		return strings.HasPrefix(p.Value, "/")
+	case *syntax.DblQuoted:
+		return len(p.Parts) > 0 && startsWithSlash(p.Parts[0])
+	}
+	return false
+}
+
+// teeOutputFiles returns the file operands of the tee invocations in call,
+// as resolved by wordTarget.
+// Like ddOutputFiles, words after one whose base name is tee are treated as
+// its arguments, so tee run through a wrapper like sudo is found too.
+func teeOutputFiles(call *syntax.CallExpr) []string {
+	var files []string
+	inTee := false
+	endOfOptions := false
+	for _, arg := range call.Args {
+		if !inTee {
+			word, literal := wordLiteral(arg)
+			inTee = literal && path.Base(word) == "tee"
+			continue
+		}
+		if word, literal := wordLiteral(arg); literal && !endOfOptions && strings.HasPrefix(word, "-") && word != "-" {
+			endOfOptions = word == "--"
+			continue
+		}
+		files = append(files, wordTarget(arg))
+	}
+	return files
+}
+
+// matchesProtectedPath reports whether path, or any directory containing it,
+// matches the glob pattern. Both are home-expanded and cleaned first.
+func matchesProtectedPath(path, pattern string) bool {
+	path = filepath.Clean(expandHome(path))
+	pattern = filepath.Clean(expandHome(pattern))
+	for {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// sensitiveWrite describes a segment's write to a protected path, or to a
+// target that can't be resolved statically and so might be one.
+type sensitiveWrite struct {
+	detail string
+	// unresolved is set when no target is known to be protected, but one
+	// can't be resolved statically
+	unresolved bool
+}
+
+// findSensitiveRedirects finds write redirections in cmd that target a path
+// matching one of the protected patterns, and tee file operands and dd of=
+// operands that do, since they write the same way. Redirections belong to statements
+// rather than the commands SplitCommandChain returns, so a redirection on a
+// compound command like "{ a; b; } > file" applies to every segment inside it.
+// Relative targets are resolved against the directories each segment runs
+// in, as given by dirs, so "echo x > .bashrc" run in the home directory is
+// found. Redirect and tee targets containing a glob or another expansion
+// than $HOME are reported as unresolved. Returns a map from each affected
+// segment, printed the same way as SplitCommandChain, to its write.
+func findSensitiveRedirects(cmd string, protected []string, dirs map[string][]workDir) map[string]sensitiveWrite {
+	if len(protected) == 0 {
+		return nil
+	}
+	// A simple command has no redirections, so only tee and dd can write
+	if isSimpleCommand(cmd) && !hasCommandWord(cmd, "tee", "dd") {
+		return nil
+	}
+
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil
+	}
+
+	printer := syntax.NewPrinter()
+	result := make(map[string]sensitiveWrite)
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		stmt, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		writes := map[string][]string{"redirect": writeRedirectTargets(stmt.Redirs)}
+		if call, ok := stmt.Cmd.(*syntax.CallExpr); ok {
+			writes["tee"] = teeOutputFiles(call)
+			writes["dd"] = ddOutputFiles(call)
+		}
+		var segments []string
+		extractCommands(stmt.Cmd, printer, &segments)
+		for _, segment := range segments {
+			if prev, seen := result[segment]; seen && !prev.unresolved {
+				continue
+			}
+			if write, found := segmentWrite(writes, protected, dirs[segment]); found {
+				if prev, seen := result[segment]; !seen || prev.unresolved {
+					result[segment] = write
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// findInputRedirects finds the files that cmd's statements read through input
+// redirections, which path-restricted commands check like their arguments.
+// Targets that can't be resolved statically are returned as dynamicWord.
+// Returns a map from each affected segment, printed the same way as
+// SplitCommandChain, to the targets it reads.
+func findInputRedirects(cmd string) map[string][]string {
+	if !strings.Contains(cmd, "<") {
+		return nil
+	}
+
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil
+	}
+
+	printer := syntax.NewPrinter()
+	result := make(map[string][]string)
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		stmt, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		var targets []string
+		for _, redir := range stmt.Redirs {
+			if !readRedirectOps[redir.Op] || redir.Word == nil {
+				continue
+			}
+			target, literal := wordLiteral(redir.Word)
+			if !literal {
+				target = dynamicWord
+			}
+			targets = append(targets, target)
+		}
+		if len(targets) == 0 {
+			return true
+		}
+		var segments []string
+		extractCommands(stmt.Cmd, printer, &segments)
+		for _, segment := range segments {
+			result[segment] = append(result[segment], targets...)
+		}
+		return true
+	})
+	return result
+}
+
+// segmentWrite returns the first write in writes, keyed by writer, to a
+// protected path from any of dirs, or else the first to a target that can't
+// be resolved statically. No dirs means the hook's working directory.
+func segmentWrite(writes map[string][]string, protected []string, dirs []workDir) (write sensitiveWrite, found bool) {
+	if len(dirs) == 0 {
+		dirs = []workDir{{}}
+	}
+	for _, dir := range dirs {
+		for _, writer := range []string{"redirect", "tee", "dd"} {
+			w, ok := sensitiveWriteDetail(writer, writes[writer], protected, dir)
+			if ok && !w.unresolved {
+				return w, true
+			}
+			if ok && !found {
+				write, found = w, true
+			}
+		}
+	}
+	return write, found
+}
+
+// sensitiveWriteDetail describes the first of the targets written by writer
+// that matches a protected pattern or, if none do, the first that can't be
+// resolved statically. found is false if every target is resolved and
+// unprotected. Relative targets are resolved against dir; ones it can't
+// resolve are matched as written.
+func sensitiveWriteDetail(writer string, targets, protected []string, dir workDir) (write sensitiveWrite, found bool) {
+	for _, target := range targets {
+		if target == dynamicWord {
+			if !found {
+				write = sensitiveWrite{detail: writer + " writes to a target that cannot be resolved statically", unresolved: true}
+				found = true
+			}
+			continue
+		}
+		resolved, ok := dir.resolve(target)
+		if !ok {
+			resolved = target
+		}
+		for _, pattern := range protected {
+			if matchesProtectedPath(resolved, pattern) {
+				return sensitiveWrite{detail: fmt.Sprintf("%s writes to %q, which matches protected path %q", writer, target, pattern)}, true
+			}
+		}
+	}
+	return write, found
+}
@@ -0,0 +1,235 @@
+package hook
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestFindSensitiveRedirects(t *testing.T) {
+	protected := config.DefaultProtectedWritePaths
+
+	tests := []struct {
+		name string
+		cmd  string
+		want []string // affected segments
+	}{
+		{"rc file", "echo x > ~/.bashrc", []string{"echo x"}},
+		{"append", "echo x >> ~/.zshrc", []string{"echo x"}},
+		{"etc", "cat foo > /etc/hosts", []string{"cat foo"}},
+		{"nested under etc", "echo x > /etc/ssh/sshd_config", []string{"echo x"}},
+		{"ssh dir", "echo key >> ~/.ssh/authorized_keys", []string{"echo key"}},
+		{"clobber", "echo x >| '/etc/hosts'", []string{"echo x"}},
+		{"stdout and stderr", "make &> /etc/motd", []string{"make"}},
+		{"dot dot", "echo x > /etc/../etc/passwd", []string{"echo x"}},
+		{"home variable", `echo x > "$HOME/.profile"`, []string{"echo x"}},
+		{"compound command", "{ echo a; echo b; } > ~/.bashrc", []string{"echo a", "echo b"}},
+		{"only one segment", "ls && echo x > ~/.bashrc", []string{"echo x"}},
+		{"regular file", "echo x > out.txt", nil},
+		{"similar name", "echo x > ~/.bashrc.bak", nil},
+		{"dev null", "echo x 2> /dev/null", nil},
+		{"input redirect", "cat < /etc/hosts", nil},
+		{"fd duplication", "echo x >&2", nil},
+		{"quoted", "echo 'x > /etc/hosts'", nil},
+		{"unparseable", "echo 'x > /etc/hosts", nil},
+		{"glob", "echo x > ~/.bash[r]c", []string{"echo x"}},
+		{"glob question mark", "echo x > /et?/hosts", []string{"echo x"}},
+		{"quoted home variable prefix", `echo x > "$HOME"/.bashrc`, []string{"echo x"}},
+		{"braced home variable", "echo x > ${HOME}/.bashrc", []string{"echo x"}},
+		{"other variable", `echo x > "$OUT"`, []string{"echo x"}},
+		{"home sibling", "echo x > $HOME.bak", []string{"echo x"}},
+		{"quoted glob", "echo x > '/tmp/a*'", nil},
+		{"tee", "echo x | tee /etc/hosts", []string{"tee /etc/hosts"}},
+		{"tee through sudo", "echo x | sudo tee -a /etc/hosts", []string{"sudo tee -a /etc/hosts"}},
+		{"tee second file", "tee out.log ~/.bashrc", []string{"tee out.log ~/.bashrc"}},
+		{"tee home variable", `tee "$HOME/.zshrc"`, []string{`tee "$HOME/.zshrc"`}},
+		{"tee after end of options", "tee -- /etc/hosts", []string{"tee -- /etc/hosts"}},
+		{"dd output file", "dd if=key of=/etc/ssh/ssh_host_key", []string{"dd if=key of=/etc/ssh/ssh_host_key"}},
+		{"tee glob", "echo x | tee /e*/hosts", []string{"tee /e*/hosts"}},
+		{"tee quoted home variable prefix", `tee "$HOME"/.bashrc`, []string{`tee "$HOME"/.bashrc`}},
+		{"tee other variable", `tee "$OUT"`, []string{`tee "$OUT"`}},
+		{"tee regular file", "echo x | tee out.log", nil},
+		{"tee reading protected path", "cat /etc/hosts | tee hosts.bak", nil},
+		{"dd input file", "dd if=/etc/hosts of=hosts.bak", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findSensitiveRedirects(tt.cmd, protected, nil)
+			if len(got) != len(tt.want) {
+				t.Fatalf("findSensitiveRedirects(%q) = %v, want segments %q", tt.cmd, got, tt.want)
+			}
+			for _, seg := range tt.want {
+				if _, ok := got[seg]; !ok {
+					t.Errorf("findSensitiveRedirects(%q) = %v, missing segment %q", tt.cmd, got, seg)
+				}
+			}
+		})
+	}
+
+	if got := findSensitiveRedirects("echo x > ~/.bashrc", nil, nil); len(got) != 0 {
+		t.Errorf("findSensitiveRedirects with no protected paths = %v, want none", got)
+	}
+}
+
+func TestProcessWithResultSensitiveRedirect(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[[commands.simple]]
+name = "tools"
+commands = ["echo", "cat", "tee"]
+`)
+	defer cleanupConfig()
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"echo x > ~/.bashrc", false},
+		{"cat foo > /etc/hosts", false},
+		{"echo x > out.txt", true},
+		{"tee /etc/hosts", false},
+		{"echo x | tee ~/.ssh/config", false},
+		{"tee out.log", true},
+		{"echo x | tee out.log", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			logPath, cleanupAudit := setupTestAudit(t)
+			defer cleanupAudit()
+
+			input := `{"tool_name":"Bash","tool_input":{"command":"` + tt.cmd + `"}}`
+			result := ProcessWithResult(strings.NewReader(input))
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if !strings.Contains(result.Output, `"permissionDecision":"deny"`) {
+				t.Errorf("Output = %s, want deny decision", result.Output)
+			}
+			entry := readLastAuditEntry(t, logPath)
+			// The write is in the last segment, after any pipeline input
+			if rej := entry.Segments[len(entry.Segments)-1].Rejection; rej == nil || rej.Code != audit.CodeSensitiveRedirect {
+				t.Errorf("Rejection = %+v, want %s", rej, audit.CodeSensitiveRedirect)
+			}
+		})
+	}
+}
+
+func TestSensitiveRedirectConfigurable(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, `
+[security]
+protected_write_paths = ["/srv/data/*"]
+
+[[commands.simple]]
+name = "tools"
+commands = ["echo"]
+`)
+	defer cleanupConfig()
+
+	tests := []struct {
+		cmd      string
+		approved bool
+	}{
+		{"echo x > /srv/data/file", false},
+		{"echo x > ~/.bashrc", true},
+	}
+
+	for _, tt := range tests {
+		input := `{"tool_name":"Bash","tool_input":{"command":"` + tt.cmd + `"}}`
+		if result := ProcessWithResult(strings.NewReader(input)); result.Approved != tt.approved {
+			t.Errorf("%q approved = %v, want %v", tt.cmd, result.Approved, tt.approved)
+		}
+	}
+}
+
+func TestSensitiveRedirectRelativeToCwd(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "tools"
+commands = ["echo", "tee", "dd"]
+
+[[commands.builtin]]
+commands = ["cd"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd      string
+		cwd      string
+		approved bool
+	}{
+		{"echo x > .bashrc", home, false},
+		{"echo x | tee .ssh/config", home, false},
+		{"dd if=x of=.profile", home, false},
+		{"echo x > .bashrc", filepath.Join(home, "project"), true},
+		{"cd ~ && echo x > .bashrc", filepath.Join(home, "project"), false},
+		{"cd .. && echo x >> .zshrc", filepath.Join(home, "project"), false},
+		{"echo x > notes.txt", home, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommandInDir(tt.cmd, tt.cwd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if rej := result.Segments[len(result.Segments)-1].Rejection; rej == nil || rej.Code != audit.CodeSensitiveRedirect {
+				t.Errorf("Rejection = %+v, want %s", rej, audit.CodeSensitiveRedirect)
+			}
+		})
+	}
+}
+
+func TestSensitiveRedirectUnresolvedTarget(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "tools"
+commands = ["echo", "tee"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd      string
+		decision string
+	}{
+		{`echo x > "$HOME"/.bashrc`, "deny"},
+		{"echo x > ~/.bash[r]c", "ask"},
+		{"echo x > /et?/hosts", "ask"},
+		{`echo x > "$OUT"`, "ask"},
+		{"echo x > '/tmp/a*'", "allow"},
+		{"echo x | tee /e*/hosts", "ask"},
+		{`echo x | tee "$HOME"/.bashrc`, "deny"},
+		{"echo x | tee ~/.ss[h]/config", "ask"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if !strings.Contains(result.Output, `"permissionDecision":"`+tt.decision+`"`) {
+				t.Fatalf("Output = %s, want %s decision", result.Output, tt.decision)
+			}
+			if tt.decision == "allow" {
+				return
+			}
+			if rej := result.Segments[len(result.Segments)-1].Rejection; rej == nil || rej.Code != audit.CodeSensitiveRedirect {
+				t.Errorf("Rejection = %+v, want %s", rej, audit.CodeSensitiveRedirect)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package hook
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// awkEscapes match the awk constructs that run a shell command: system(),
+// pipes into or out of a command, and gawk's coprocesses.
+var awkEscapes = []*regexp.Regexp{
+	regexp.MustCompile(`\bsystem\s*\(`),
+	regexp.MustCompile(`\|\s*getline\b`),
+	regexp.MustCompile(`\|&`),
+	regexp.MustCompile(`\bprintf?\b[^;}]*\|`),
+}
+
+// perlEscapes match the perl constructs that run a shell command: system and
+// exec, backticks and qx//, and piped opens.
+var perlEscapes = []*regexp.Regexp{
+	regexp.MustCompile(`\b(system|exec)\b`),
+	regexp.MustCompile("`"),
+	regexp.MustCompile(`\bqx\s*[^\w\s=,;)]`),
+	regexp.MustCompile(`\bopen\b[^;]*(\|\s*["']|["']\s*\||-\|)`),
+}
+
+// dynamicWord stands in for an argument whose value can't be determined
+// statically. Commands containing NUL are rejected before this check, so it
+// can't clash with a real argument.
+const dynamicWord = "\x00"
+
+// awkStrings matches awk string literals, which can't run anything and are
+// removed before looking for escapes, so print "a|b" isn't a pipe.
+var awkStrings = regexp.MustCompile(`"(\\.|[^"\\])*"`)
+
+// awkOptionsWithArg are the awk options that take a separate argument.
+var awkOptionsWithArg = map[string]bool{
+	"-F": true,
+	"-v": true,
+	"-f": true,
+	"-i": true,
+	"-l": true,
+}
+
+// scriptPrograms returns the programs that an awk, sed, or perl invocation
+// runs, given its unquoted arguments after the command name. found is false
+// if the command's program comes from a file instead.
+type scriptPrograms func(args []string) (programs []string, found bool)
+
+// scriptInterpreters are the commands whose program argument is scanned for
+// shell escapes, with the function returning their programs and the check
+// that finds an escape in one.
+var scriptInterpreters = map[string]struct {
+	programs scriptPrograms
+	escape   func(program string) string
+}{
+	"awk":  {awkPrograms, awkEscape},
+	"gawk": {awkPrograms, awkEscape},
+	"mawk": {awkPrograms, awkEscape},
+	"nawk": {awkPrograms, awkEscape},
+	"sed":  {sedPrograms, sedEscape},
+	"gsed": {sedPrograms, sedEscape},
+	"perl": {perlPrograms, perlEscape},
+}
+
+// checkScriptEscapes returns a SCRIPT_ESCAPE rejection if coreCmd runs an
+// awk, sed, or perl program that can run shell commands, like
+// awk 'BEGIN{system("id")}', or nil if it doesn't. Programs read from a file
+// aren't checked; programs that can't be determined statically are rejected.
+func checkScriptEscapes(coreCmd string) *audit.Rejection {
+	fields := strings.Fields(coreCmd)
+	if len(fields) == 0 {
+		return nil
+	}
+	if _, ok := scriptInterpreters[path.Base(fields[0])]; !ok {
+		return nil
+	}
+
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(coreCmd), "")
+	if err != nil || len(prog.Stmts) != 1 {
+		return nil
+	}
+	call, isCall := prog.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !isCall || len(call.Args) == 0 {
+		return nil
+	}
+	name, literal := wordLiteral(call.Args[0])
+	name = path.Base(name)
+	interp, ok := scriptInterpreters[name]
+	if !literal || !ok {
+		return nil
+	}
+
+	// Words that can't be unquoted become a placeholder, which is rejected
+	// only if it turns out to be part of the program
+	var args []string
+	for _, word := range call.Args[1:] {
+		value, ok := unquoteWord(word)
+		if !ok {
+			value = dynamicWord
+		}
+		args = append(args, value)
+	}
+	programs, found := interp.programs(args)
+	if !found {
+		return nil
+	}
+	for _, program := range programs {
+		if strings.Contains(program, dynamicWord) {
+			return &audit.Rejection{
+				Code:   audit.CodeScriptEscape,
+				Detail: fmt.Sprintf("cannot determine the program run by %s", name),
+			}
+		}
+		if escape := interp.escape(program); escape != "" {
+			return &audit.Rejection{
+				Code:   audit.CodeScriptEscape,
+				Detail: fmt.Sprintf("%s program runs a shell command with %s", name, escape),
+			}
+		}
+	}
+	return nil
+}
+
+// awkPrograms returns the programs of an awk invocation: those given with
+// gawk's -e or --source, or else the first operand unless a program file is
+// given with -f.
+func awkPrograms(args []string) ([]string, bool) {
+	var programs []string
+	hasFile := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-e" || arg == "--source":
+			if i+1 < len(args) {
+				programs = append(programs, args[i+1])
+			}
+			i++
+		case strings.HasPrefix(arg, "--source="):
+			programs = append(programs, strings.TrimPrefix(arg, "--source="))
+		case arg == "-f" || arg == "--file" || strings.HasPrefix(arg, "--file=") ||
+			strings.HasPrefix(arg, "-f") && !strings.HasPrefix(arg, "--"):
+			hasFile = true
+			if arg == "-f" || arg == "--file" {
+				i++
+			}
+		case awkOptionsWithArg[arg]:
+			i++
+		case arg == "--" || len(arg) < 2 || arg[0] != '-':
+			if arg == "--" {
+				i++
+			}
+			if len(programs) == 0 && !hasFile && i < len(args) {
+				programs = append(programs, args[i])
+			}
+			return programs, len(programs) > 0
+		}
+	}
+	return programs, len(programs) > 0
+}
+
+// awkEscape describes the shell escape in an awk program, or returns "".
+func awkEscape(program string) string {
+	program = awkStrings.ReplaceAllString(program, `""`)
+	for _, re := range awkEscapes {
+		if m := re.FindString(program); m != "" {
+			return fmt.Sprintf("%q", strings.TrimSpace(m))
+		}
+	}
+	return ""
+}
+
+// sedPrograms returns the scripts of a sed invocation: the arguments of -e
+// and --expression, or else the first operand. A script file given with -f
+// means the program isn't known.
+func sedPrograms(args []string) ([]string, bool) {
+	var programs []string
+	operand := ""
+	hasOperand := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-e" || arg == "--expression":
+			if i+1 < len(args) {
+				programs = append(programs, args[i+1])
+			}
+			i++
+		case strings.HasPrefix(arg, "--expression="):
+			programs = append(programs, strings.TrimPrefix(arg, "--expression="))
+		case arg == "-f" || arg == "--file" || strings.HasPrefix(arg, "--file="):
+			return nil, false
+		case arg == "-l" || arg == "--line-length":
+			i++
+		case len(arg) > 1 && arg[0] == '-' && !strings.HasPrefix(arg, "--"):
+			// A cluster like -ne 's/x/y/' ends with the option taking the
+			// script, which may also be attached: -es/x/y/
+			opt, value, hasValue := clusterOption(arg, "efl", "i")
+			switch {
+			case opt == 'f':
+				return nil, false
+			case opt == 'e' && hasValue:
+				programs = append(programs, value)
+			case opt == 'e' && i+1 < len(args):
+				programs = append(programs, args[i+1])
+				i++
+			case opt == 'l' && !hasValue:
+				i++
+			}
+		case !strings.HasPrefix(arg, "-") && !hasOperand:
+			operand, hasOperand = arg, true
+		}
+	}
+	if len(programs) == 0 && hasOperand {
+		programs = append(programs, operand)
+	}
+	return programs, len(programs) > 0
+}
+
+// sedEscape describes the shell escape in a sed script, the GNU e command
+// or the e flag of an s command, or returns "". The script is scanned one
+// command at a time, skipping addresses and the text of s and y commands so
+// an e inside a regex or replacement doesn't count.
+func sedEscape(script string) string {
+	i := 0
+	for i < len(script) {
+		c := script[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == ';' || c == '{' || c == '}' || c == '!' || c == ',':
+			i++
+		case c >= '0' && c <= '9' || c == '$' || c == '~' || c == '+':
+			i++
+		case c == '/' || c == '\\':
+			// A regex address, delimited by / or by the character after \
+			delim := byte('/')
+			if c == '\\' && i+1 < len(script) {
+				i++
+				delim = script[i]
+			}
+			i = sedSkipDelimited(script, i+1, delim)
+			for i < len(script) && (script[i] == 'I' || script[i] == 'M') {
+				i++
+			}
+		case c == 's' || c == 'y':
+			if i+1 >= len(script) {
+				return ""
+			}
+			delim := script[i+1]
+			i = sedSkipDelimited(script, i+2, delim)
+			i = sedSkipDelimited(script, i, delim)
+			if c == 'y' {
+				continue
+			}
+			start := i
+			for i < len(script) && !strings.ContainsRune(" \t\n;}", rune(script[i])) {
+				if script[i] == 'w' {
+					// The rest of the line is a file name
+					i = sedSkipLine(script, i)
+					break
+				}
+				i++
+			}
+			if strings.ContainsRune(script[start:i], 'e') {
+				return "the s///e flag"
+			}
+		case c == 'e':
+			return "the e command"
+		case c == '#' || strings.IndexByte("aicrRwWbtTv:", c) >= 0:
+			// These take the rest of the line as text, a file, or a label
+			i = sedSkipLine(script, i)
+		default:
+			i++
+		}
+	}
+	return ""
+}
+
+// sedSkipDelimited returns the index just past the next unescaped delim in
+// script at or after i, or len(script) if there is none.
+func sedSkipDelimited(script string, i int, delim byte) int {
+	for i < len(script) {
+		switch script[i] {
+		case '\\':
+			i += 2
+		case delim:
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return len(script)
+}
+
+// sedSkipLine returns the index of the newline ending the line that contains
+// i, or len(script) if it is the last line.
+func sedSkipLine(script string, i int) int {
+	if j := strings.IndexByte(script[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(script)
+}
+
+// perlPrograms returns the programs given to perl with -e or -E, which may
+// be attached to a cluster like -ne. Without them, perl runs a script file.
+func perlPrograms(args []string) ([]string, bool) {
+	var programs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' || strings.HasPrefix(arg, "--") {
+			break
+		}
+		opt, value, hasValue := clusterOption(arg, "eE", "0CdDFiIlmMx")
+		switch {
+		case opt == 0 || opt != 'e' && opt != 'E':
+			continue
+		case hasValue:
+			programs = append(programs, value)
+		case i+1 < len(args):
+			programs = append(programs, args[i+1])
+			i++
+		}
+	}
+	return programs, len(programs) > 0
+}
+
+// clusterOption finds the first option in a cluster of short options like
+// -ne that takes a value: one of withArg, whose value is the rest of the
+// cluster or else the next argument, or one of attached, whose optional value
+// can only be the rest of the cluster. value is the rest of the cluster, and
+// hasValue is false if it is empty. opt is 0 if no such option is found.
+func clusterOption(cluster, withArg, attached string) (opt byte, value string, hasValue bool) {
+	for j := 1; j < len(cluster); j++ {
+		if strings.IndexByte(withArg, cluster[j]) >= 0 || strings.IndexByte(attached, cluster[j]) >= 0 {
+			return cluster[j], cluster[j+1:], j+1 < len(cluster)
+		}
+	}
+	return 0, "", false
+}
+
+// perlEscape describes the shell escape in a perl program, or returns "".
+func perlEscape(program string) string {
+	for _, re := range perlEscapes {
+		if m := re.FindString(program); m != "" {
+			return fmt.Sprintf("%q", strings.TrimSpace(m))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestCheckScriptEscapes(t *testing.T) {
+	tests := []struct {
+		cmd    string
+		escape bool
+	}{
+		{`awk '{print $1}'`, false},
+		{`awk -F, '{print $1 "|" $2}' data.csv`, false},
+		{`awk -v x="$X" '{print x}'`, false},
+		{`awk -f prog.awk data`, false},
+		{`awk 'BEGIN{system("id")}'`, true},
+		{`awk 'BEGIN { system ("rm -rf /") }'`, true},
+		{`/usr/bin/gawk '{print | "sh"}'`, true},
+		{`awk '{"date" | getline d; print d}'`, true},
+		{`gawk -e 'BEGIN{print "x" |& "cat"}'`, true},
+		{`awk "$PROG" file`, true},
+		{`sed 's/a/b/g' file`, false},
+		{`sed -n '/error/p' log`, false},
+		{`sed -e 's/x/e/' -e 's/e/x/'`, false},
+		{`sed -i.bak 's/foo/bar/' file`, false},
+		{`sed '/exec/d' file`, false},
+		{`sed 's/x/id/e'`, true},
+		{`sed -n -e '1e id'`, true},
+		{`sed '$e rm -rf /' file`, true},
+		{`sed -f script.sed file`, false},
+		{`perl -ne 'print if /foo/'`, false},
+		{`perl -pi -e 's/a/b/g' file`, false},
+		{`perl script.pl`, false},
+		{`perl -e 'system("id")'`, true},
+		{`perl -e 'print qx(id)'`, true},
+		{"perl -e 'print `id`'", true},
+		{`perl -MPOSIX -e 'exec "sh"'`, true},
+		{`perl -e 'open(my $f, "-|", "id")'`, true},
+		{`grep system file`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			rej := checkScriptEscapes(tt.cmd)
+			if (rej != nil) != tt.escape {
+				t.Fatalf("checkScriptEscapes(%q) = %+v, want escape %v", tt.cmd, rej, tt.escape)
+			}
+			if rej != nil && rej.Code != audit.CodeScriptEscape {
+				t.Errorf("Code = %s, want %s", rej.Code, audit.CodeScriptEscape)
+			}
+		})
+	}
+}
+
+func TestScriptEscapeRejectsAllowedCommand(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "read-only"
+commands = ["awk", "sed"]
+
+[[wrappers.simple]]
+name = "sudo"
+commands = ["sudo"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := EvaluateCommand(`awk '{print $1}'`, cfg); !result.Approved {
+		t.Errorf("awk '{print $1}' should be approved, got %s", result.Output)
+	}
+
+	for _, cmd := range []string{`awk 'BEGIN{system("id")}'`, `sudo sed 's/x/id/e' file`} {
+		result := EvaluateCommand(cmd, cfg)
+		if result.Approved {
+			t.Fatalf("%s should be rejected", cmd)
+		}
+		if rej := result.Segments[0].Rejection; rej == nil || rej.Code != audit.CodeScriptEscape {
+			t.Errorf("%s: Rejection = %+v, want %s", cmd, rej, audit.CodeScriptEscape)
+		}
+		if result.Output != FormatDeny("command runs a shell command from an awk, sed, or perl program") {
+			t.Errorf("%s: Output = %s, want a deny decision", cmd, result.Output)
+		}
+	}
+}
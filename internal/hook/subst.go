@@ -0,0 +1,153 @@
+package hook
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// substitutionKinds records which forms of command substitution a segment uses.
+type substitutionKinds struct {
+	dollar    bool // $(...)
+	backticks bool // `...`
+}
+
+// findSubstitutionKinds returns the forms of command substitution used by
+// each segment of cmd that has any, keyed by the segment printed the same way
+// as SplitCommandChain. The printer rewrites backticks as $(...), so the
+// forms must be found in the original command.
+func findSubstitutionKinds(cmd string) map[string]substitutionKinds {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil
+	}
+
+	printer := syntax.NewPrinter()
+	result := make(map[string]substitutionKinds)
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		switch node.(type) {
+		case *syntax.CallExpr, *syntax.DeclClause, *syntax.LetClause, *syntax.ArithmCmd, *syntax.TestClause:
+		default:
+			return true
+		}
+		var kinds substitutionKinds
+		syntax.Walk(node, func(n syntax.Node) bool {
+			if subst, ok := n.(*syntax.CmdSubst); ok {
+				if subst.Backquotes {
+					kinds.backticks = true
+				} else {
+					kinds.dollar = true
+				}
+			}
+			return true
+		})
+		if kinds == (substitutionKinds{}) {
+			return true
+		}
+		var buf strings.Builder
+		if err := printer.Print(&buf, node); err == nil {
+			segment := strings.TrimSpace(buf.String())
+			existing := result[segment]
+			result[segment] = substitutionKinds{
+				dollar:    existing.dollar || kinds.dollar,
+				backticks: existing.backticks || kinds.backticks,
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// commandSubstitutions returns the commands run by the outermost command
+// substitutions in segment, one string per substitution. Nested
+// substitutions stay inside their enclosing command and are found when it is
+// evaluated. ok is false if the segment can't be parsed or uses a mksh-only
+// form of substitution.
+func commandSubstitutions(segment string) (inner []string, ok bool) {
+	parser := syntax.NewParser()
+	prog, err := parser.Parse(strings.NewReader(segment), "")
+	if err != nil {
+		return nil, false
+	}
+
+	printer := syntax.NewPrinter()
+	ok = true
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		subst, isSubst := node.(*syntax.CmdSubst)
+		if !isSubst || !ok {
+			return ok
+		}
+		if subst.TempFile || subst.ReplyVar {
+			ok = false
+			return false
+		}
+		var stmts []string
+		for _, stmt := range subst.Stmts {
+			var buf strings.Builder
+			if err := printer.Print(&buf, stmt); err != nil {
+				ok = false
+				return false
+			}
+			stmts = append(stmts, buf.String())
+		}
+		inner = append(inner, strings.Join(stmts, "; "))
+		return false
+	})
+	return inner, ok
+}
+
+// checkCommandSubstitutions validates a segment that contains command
+// substitution syntax. The segment is rejected outright unless every form of
+// substitution it uses is enabled in cfg.Security: allow_subshells for $(...)
+// and allow_backticks for backticks. Otherwise the commands inside each
+// substitution are run through the full approval pipeline, and the first
+// rejected inner segment rejects the whole segment. denial is set when that
+// rejection is a deny match.
+func checkCommandSubstitutions(segment string, kinds substitutionKinds, cfg *config.Config) (rejection *audit.Rejection, denial *DenyResult) {
+	substitutionRejection := &audit.Rejection{
+		Code:    audit.CodeCommandSubstitution,
+		Pattern: "$(...)",
+	}
+	if kinds == (substitutionKinds{}) {
+		// The parser found no substitution to attribute the dangerous pattern
+		// to, so require both forms to be allowed
+		kinds = substitutionKinds{dollar: true, backticks: true}
+	}
+	security := cfg.Security
+	if (kinds.dollar && !security.AllowSubshells) || (kinds.backticks && !security.AllowBackticks) {
+		return substitutionRejection, nil
+	}
+
+	inner, ok := commandSubstitutions(segment)
+	if !ok {
+		return substitutionRejection, nil
+	}
+
+	for _, cmd := range inner {
+		result := EvaluateCommand(cmd, cfg)
+		if result.Approved {
+			continue
+		}
+		for _, seg := range result.Segments {
+			if seg.Rejection == nil {
+				continue
+			}
+			rejection := *seg.Rejection
+			detail := fmt.Sprintf("command substitution runs %q", seg.Command)
+			if rejection.Detail != "" {
+				detail += ": " + rejection.Detail
+			}
+			rejection.Detail = detail
+			if rejection.Code == audit.CodeDenyMatch {
+				denial = &DenyResult{Denied: true, Name: rejection.Name, Pattern: rejection.Pattern, Reason: seg.Rejection.Detail}
+			}
+			return &rejection, denial
+		}
+		return substitutionRejection, nil
+	}
+	return nil, nil
+}
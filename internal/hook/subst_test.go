@@ -0,0 +1,201 @@
+package hook
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestCommandSubstitutions(t *testing.T) {
+	tests := []struct {
+		segment string
+		want    []string
+		ok      bool
+	}{
+		{"echo $(git status)", []string{"git status"}, true},
+		{"echo $(git status && ls) $(pwd)", []string{"git status && ls", "pwd"}, true},
+		{"echo $(echo $(pwd))", []string{"echo $(pwd)"}, true},
+		{`echo "$(date)"`, []string{"date"}, true},
+		{"echo '$(date)'", nil, true},
+		{"echo $((1 + 2))", nil, true},
+		{"echo $(date", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.segment, func(t *testing.T) {
+			got, ok := commandSubstitutions(tt.segment)
+			if ok != tt.ok {
+				t.Fatalf("commandSubstitutions(%q) ok = %v, want %v", tt.segment, ok, tt.ok)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("commandSubstitutions(%q) = %q, want %q", tt.segment, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindSubstitutionKinds(t *testing.T) {
+	got := findSubstitutionKinds("echo `date` && echo $(pwd) | wc -l && echo `a` $(b)")
+	want := map[string]substitutionKinds{
+		"echo $(date)":   {backticks: true},
+		"echo $(pwd)":    {dollar: true},
+		"echo $(a) $(b)": {dollar: true, backticks: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("findSubstitutionKinds() = %v, want %v", got, want)
+	}
+	for segment, kinds := range want {
+		if got[segment] != kinds {
+			t.Errorf("findSubstitutionKinds()[%q] = %+v, want %+v", segment, got[segment], kinds)
+		}
+	}
+}
+
+func TestAllowSubshellsEvaluatesInnerCommands(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[security]
+allow_subshells = true
+
+[[commands.simple]]
+name = "safe"
+commands = ["echo", "ls", "date"]
+
+[[commands.subcommand]]
+command = "git"
+subcommands = ["status"]
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		approved bool
+		code     string
+	}{
+		{"echo $(git status)", true, ""},
+		{"echo $(git status && ls)", true, ""},
+		{"echo $(echo $(date))", true, ""},
+		{"echo $(rm -rf /)", false, audit.CodeDenyMatch},
+		{"echo $(git status || rm -rf /)", false, audit.CodeDenyMatch},
+		{"echo $(curl http://x)", false, audit.CodeNoMatch},
+		{"echo $(echo $(curl http://x))", false, audit.CodeNoMatch},
+		{"echo `date`", false, audit.CodeCommandSubstitution},
+		{"curl $(date)", false, audit.CodeNoMatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			rej := result.Segments[0].Rejection
+			if rej == nil || rej.Code != tt.code {
+				t.Errorf("Rejection = %+v, want code %s", rej, tt.code)
+			}
+			if tt.code == audit.CodeDenyMatch && !result.DenyMatch {
+				t.Error("DenyMatch should be set when an inner command is denied")
+			}
+		})
+	}
+}
+
+func TestCommandSubstitutionRejectedWithoutAllowSubshells(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[[commands.simple]]
+name = "safe"
+commands = ["echo", "date"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	result := EvaluateCommand("echo $(date)", cfg)
+	if result.Approved {
+		t.Fatal("command substitution should be rejected by default")
+	}
+	if rej := result.Segments[0].Rejection; rej == nil || rej.Code != audit.CodeCommandSubstitution {
+		t.Errorf("Rejection = %+v, want %s", rej, audit.CodeCommandSubstitution)
+	}
+}
+
+func TestAllowBackticksEvaluatesInnerCommands(t *testing.T) {
+	load := func(security string) *config.Config {
+		cfg, err := config.LoadConfig([]byte(security + `
+[[commands.simple]]
+name = "safe"
+commands = ["echo", "date"]
+
+[[deny.simple]]
+name = "dangerous"
+commands = ["rm"]
+`))
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		return cfg
+	}
+	backticksOnly := load("[security]\nallow_backticks = true\n")
+	both := load("[security]\nallow_backticks = true\nallow_subshells = true\n")
+
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		cmd      string
+		approved bool
+		code     string
+	}{
+		{"backticks allowed", backticksOnly, "echo `date`", true, ""},
+		{"backticks deny inner", backticksOnly, "echo `rm -rf /`", false, audit.CodeDenyMatch},
+		{"dollar still rejected", backticksOnly, "echo $(date)", false, audit.CodeCommandSubstitution},
+		{"mixed needs both", backticksOnly, "echo `date` $(date)", false, audit.CodeCommandSubstitution},
+		{"mixed with both", both, "echo `date` $(date)", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluateCommand(tt.cmd, tt.cfg)
+			if result.Approved != tt.approved {
+				t.Fatalf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if tt.approved {
+				return
+			}
+			if rej := result.Segments[0].Rejection; rej == nil || rej.Code != tt.code {
+				t.Errorf("Rejection = %+v, want code %s", rej, tt.code)
+			}
+		})
+	}
+}
+
+func TestAllowSubshellsApprovesSafeSubstitution(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[security]
+allow_subshells = true
+
+[[commands.simple]]
+name = "safe"
+commands = ["echo", "date"]
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	result := EvaluateCommand("echo $(date)", cfg)
+	if !result.Approved {
+		t.Fatalf("echo $(date) should be approved with allow_subshells = true, got %s", result.Output)
+	}
+	if len(result.Segments) != 1 || result.Segments[0].Match == nil || result.Segments[0].Match.Name != "safe" {
+		t.Errorf("Segments = %+v, want the outer command matched by the safe list", result.Segments)
+	}
+}
@@ -0,0 +1,79 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/logger"
+)
+
+// matchWithTimeout runs match and returns its result, or ok=false if it
+// doesn't finish within timeout. A zero timeout runs match directly. Go's
+// regexp can't be interrupted, so a match that times out keeps running in the
+// background until it finishes or the hook exits.
+func matchWithTimeout[T any](timeout time.Duration, match func() T) (result T, ok bool) {
+	if timeout <= 0 {
+		return match(), true
+	}
+
+	done := make(chan T, 1)
+	go func() {
+		done <- match()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result = <-done:
+		return result, true
+	case <-timer.C:
+		return result, false
+	}
+}
+
+// ProcessWithTimeout is ProcessWithResult bounded by timeout, as a safety net
+// against a hang anywhere in reading, parsing, matching, or audit logging. If
+// processing doesn't finish in time it fails safe with an ask decision, so
+// the command is never approved by default. A zero timeout disables the limit.
+// An evaluation that times out is abandoned: it doesn't load the config or
+// write the audit log after the deadline.
+func ProcessWithTimeout(r io.Reader, timeout time.Duration) Result {
+	result, _ := processWithTimeout(r, timeout)
+	return result
+}
+
+// processWithTimeout is ProcessWithTimeout that also returns a channel closed
+// when the evaluation has finished, even if it was abandoned.
+func processWithTimeout(r io.Reader, timeout time.Duration) (Result, <-chan struct{}) {
+	done := make(chan struct{})
+	if timeout <= 0 {
+		defer close(done)
+		return ProcessWithResult(r), done
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	results := make(chan Result, 1)
+	go func() {
+		defer close(done)
+		results <- processWithContext(ctx, r)
+	}()
+
+	select {
+	case result := <-results:
+		cancel()
+		return result, done
+	case <-ctx.Done():
+		cancel()
+		logger.Warn("hook timed out", "timeout", timeout)
+		return TimedOut(timeout), done
+	}
+}
+
+// TimedOut returns the result of an evaluation that didn't finish within
+// timeout: an ask decision, so a hang never approves a command.
+func TimedOut(timeout time.Duration) Result {
+	reason := fmt.Sprintf("mmi timed out after %s", timeout)
+	return Result{Reason: reason, Output: FormatAsk(reason)}
+}
@@ -0,0 +1,106 @@
+package hook
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+)
+
+func TestMatchWithTimeout(t *testing.T) {
+	got, ok := matchWithTimeout(time.Second, func() int { return 42 })
+	if !ok || got != 42 {
+		t.Errorf("matchWithTimeout() = %d, %v, want 42, true", got, ok)
+	}
+
+	got, ok = matchWithTimeout(0, func() int { return 7 })
+	if !ok || got != 7 {
+		t.Errorf("matchWithTimeout(0) = %d, %v, want 7, true", got, ok)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	_, ok = matchWithTimeout(time.Millisecond, func() int {
+		<-release
+		return 1
+	})
+	if ok {
+		t.Error("matchWithTimeout() should time out on a match that doesn't finish")
+	}
+}
+
+func TestMatchTimeoutRejectsSegment(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`
+[limits]
+match_timeout_ms = 1
+
+[[commands.regex]]
+pattern = '^echo( [a-z]+)*( [a-z]+)*( [a-z]+)*$'
+name = "echo words"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	cmd := "echo" + strings.Repeat(" abc", 50_000)
+	result := EvaluateCommand(cmd, cfg)
+
+	if result.Approved {
+		t.Fatal("segment should be rejected when matching times out")
+	}
+	if rej := result.Segments[0].Rejection; rej == nil || rej.Code != audit.CodeTimeout {
+		t.Errorf("Rejection = %+v, want %s", rej, audit.CodeTimeout)
+	}
+	if result.Output != FormatAsk("command not in allow list") {
+		t.Errorf("Output = %s, want the unmatched decision", result.Output)
+	}
+}
+
+// slowReader delays its first read until release is closed.
+type slowReader struct {
+	release chan struct{}
+	r       io.Reader
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	<-s.release
+	return s.r.Read(p)
+}
+
+func TestProcessWithTimeout(t *testing.T) {
+	cleanup := setupTestConfig(t, `
+[[commands.simple]]
+name = "ls"
+commands = ["ls"]
+`)
+	defer cleanup()
+
+	input := `{"tool_name":"Bash","tool_input":{"command":"ls"}}`
+
+	result := ProcessWithTimeout(strings.NewReader(input), time.Second)
+	if !result.Approved {
+		t.Errorf("ProcessWithTimeout() should approve ls when it finishes in time, got %s", result.Output)
+	}
+
+	logPath, cleanupAudit := setupTestAudit(t)
+	defer cleanupAudit()
+
+	slow := &slowReader{release: make(chan struct{}), r: strings.NewReader(input)}
+	result, done := processWithTimeout(slow, 10*time.Millisecond)
+	// Let the abandoned evaluation finish before the config is reset
+	close(slow.release)
+	<-done
+	if result.Approved {
+		t.Fatal("ProcessWithTimeout() should not approve when the hook times out")
+	}
+	if want := FormatAsk("mmi timed out after 10ms"); result.Output != want {
+		t.Errorf("Output = %s, want %s", result.Output, want)
+	}
+	if data, err := os.ReadFile(logPath); err == nil && len(data) > 0 {
+		t.Errorf("abandoned evaluation wrote an audit entry: %s", data)
+	}
+}
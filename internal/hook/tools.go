@@ -0,0 +1,83 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+	"github.com/dgerlanc/mmi/internal/config"
+	"github.com/dgerlanc/mmi/internal/logger"
+)
+
+// toolInputField extracts the string value of field from the tool_input of
+// the raw hook input. ok is false if the field is missing or not a string.
+func toolInputField(rawInput []byte, field string) (value string, ok bool) {
+	var input struct {
+		ToolInput map[string]any `json:"tool_input"`
+	}
+	if err := json.Unmarshal(rawInput, &input); err != nil {
+		return "", false
+	}
+	value, ok = input.ToolInput[field].(string)
+	return value, ok
+}
+
+// EvaluateTool checks value, the configured input field of a non-Bash tool
+// call, against the tool's deny and allow patterns. Deny patterns are checked
+// first; values matching neither are handled like unmatched Bash commands.
+func EvaluateTool(toolName, value string, tool config.ToolConfig, unmatched string) Result {
+	logger.Debug("processing tool", "tool", toolName, "value", value)
+
+	if denyResult := CheckDeny(value, tool.Deny); denyResult.Denied {
+		logger.Debug("rejected tool by deny list", "tool", toolName, "pattern", denyResult.Name)
+		reason := formatDenyReason([]DenyResult{denyResult})
+		segment := audit.Segment{
+			Command:  value,
+			Approved: false,
+			Rejection: &audit.Rejection{
+				Code:    audit.CodeDenyMatch,
+				Name:    denyResult.Name,
+				Pattern: denyResult.Pattern,
+			},
+		}
+		return Result{Command: value, Approved: false, Reason: reason, Output: FormatDeny(reason), DenyMatch: true, Segments: []audit.Segment{segment}}
+	}
+
+	safeResult := CheckSafe(value, tool.Allow)
+	if !safeResult.Matched {
+		logger.Debug("rejected unmatched tool input", "tool", toolName, "value", value)
+		rejCode := audit.CodeNoMatch
+		if unmatched == config.UnmatchedPassthrough {
+			rejCode = audit.CodePassthrough
+		}
+		segment := audit.Segment{
+			Command:   value,
+			Approved:  false,
+			Rejection: &audit.Rejection{Code: rejCode},
+		}
+		reason := fmt.Sprintf("%s input not in allow list", toolName)
+		result := Result{Command: value, Approved: false, Segments: []audit.Segment{segment}}
+		switch unmatched {
+		case config.UnmatchedPassthrough:
+			result.Passthrough = true
+		case config.UnmatchedDeny:
+			result.Output = FormatDeny(reason)
+		default:
+			result.Output = FormatAsk(reason)
+		}
+		return result
+	}
+
+	reason := fmt.Sprintf("%s: %s", toolName, safeResult.Name)
+	segment := audit.Segment{
+		Command:  value,
+		Approved: true,
+		Match: &audit.Match{
+			Type:    safeResult.Type,
+			Name:    safeResult.Name,
+			Pattern: safeResult.Pattern,
+			Note:    safeResult.Note,
+		},
+	}
+	return Result{Command: value, Approved: true, Reason: reason, Output: FormatApproval(reason), Segments: []audit.Segment{segment}}
+}
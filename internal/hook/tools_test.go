@@ -0,0 +1,106 @@
+package hook
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgerlanc/mmi/internal/audit"
+)
+
+const toolsTestConfig = `
+[[commands.simple]]
+name = "safe"
+commands = ["ls"]
+
+[tools.Read]
+field = "file_path"
+allow = ['^/home/me/project/']
+deny = ['\.env$', '^/home/me/project/secrets/']
+`
+
+func TestProcessWithResultReadTool(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, toolsTestConfig)
+	defer cleanupConfig()
+
+	tests := []struct {
+		name     string
+		path     string
+		approved bool
+		decision string
+		code     string
+	}{
+		{"allowed path", "/home/me/project/main.go", true, "allow", ""},
+		{"denied file", "/home/me/project/.env", false, "deny", audit.CodeDenyMatch},
+		{"denied directory", "/home/me/project/secrets/key", false, "deny", audit.CodeDenyMatch},
+		{"outside allow list", "/etc/passwd", false, "ask", audit.CodeNoMatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logPath, cleanupAudit := setupTestAudit(t)
+			defer cleanupAudit()
+
+			input := `{"tool_name":"Read","tool_input":{"file_path":"` + tt.path + `"}}`
+			result := ProcessWithResult(strings.NewReader(input))
+			if result.Approved != tt.approved {
+				t.Errorf("Approved = %v, want %v (output: %s)", result.Approved, tt.approved, result.Output)
+			}
+			if !strings.Contains(result.Output, `"permissionDecision":"`+tt.decision+`"`) {
+				t.Errorf("Output = %s, want %s decision", result.Output, tt.decision)
+			}
+
+			entry := readLastAuditEntry(t, logPath)
+			if entry.Command != tt.path {
+				t.Errorf("audit Command = %q, want %q", entry.Command, tt.path)
+			}
+			if len(entry.Segments) != 1 {
+				t.Fatalf("Expected 1 segment, got %d", len(entry.Segments))
+			}
+			if tt.code == "" {
+				if entry.Segments[0].Match == nil {
+					t.Error("Expected Match for approved tool call")
+				}
+				return
+			}
+			if rej := entry.Segments[0].Rejection; rej == nil || rej.Code != tt.code {
+				t.Errorf("Rejection = %+v, want code %s", rej, tt.code)
+			}
+		})
+	}
+}
+
+func TestProcessWithResultUnconfiguredTool(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, toolsTestConfig)
+	defer cleanupConfig()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Write","tool_input":{"file_path":"/home/me/project/main.go"}}`))
+	if result.Approved {
+		t.Error("Unconfigured tool should not be approved")
+	}
+	if !strings.Contains(result.Output, "not a Bash command") {
+		t.Errorf("Output = %s, want not a Bash command", result.Output)
+	}
+}
+
+func TestProcessWithResultToolMissingField(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, toolsTestConfig)
+	defer cleanupConfig()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Read","tool_input":{"path":"/home/me/project/main.go"}}`))
+	if result.Approved {
+		t.Error("Tool call without the configured field should not be approved")
+	}
+	if !strings.Contains(result.Output, `\"file_path\"`) {
+		t.Errorf("Output = %s, want missing field reason", result.Output)
+	}
+}
+
+func TestProcessWithResultBashUnaffectedByTools(t *testing.T) {
+	cleanupConfig := setupTestConfig(t, toolsTestConfig)
+	defer cleanupConfig()
+
+	result := ProcessWithResult(strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"ls -la"}}`))
+	if !result.Approved {
+		t.Errorf("Bash command should still be approved, got output: %s", result.Output)
+	}
+}
@@ -3,7 +3,10 @@
 package patterns
 
 import (
+	"maps"
 	"regexp"
+	"regexp/syntax"
+	"slices"
 	"strings"
 )
 
@@ -11,8 +14,38 @@ import (
 type Pattern struct {
 	Regex   *regexp.Regexp
 	Name    string
-	Type    string // simple, subcommand, command, regex
+	Type    string // simple, subcommand, command, regex, pathrestricted
 	Pattern string // original pattern string
+	// Command and Subcommands record the inputs to builder-generated patterns
+	// so callers can explain near misses. Empty for raw regex patterns.
+	Command     string
+	Subcommands []string
+	// AllowedPrefixes and DeniedPrefixes restrict the path arguments of a
+	// pathrestricted command. Empty for all other pattern types.
+	AllowedPrefixes []string
+	DeniedPrefixes  []string
+	// Except, when set, excludes commands that Regex matches. RE2 has no
+	// lookahead, so a subcommand pattern with denied_subcommands matches the
+	// command with Regex and rejects the denied subcommands with Except,
+	// which is matched against the unquoted words of the command rather
+	// than its shell text.
+	Except *regexp.Regexp
+	// DeniedSubcommands are the subcommands Except rejects, for explaining
+	// near misses
+	DeniedSubcommands []string
+	// MinArgs and MaxArgs, when set, bound the number of positional
+	// arguments a matched command may have. Nil means no bound.
+	MinArgs *int
+	MaxArgs *int
+	// Reason is the message shown when a deny pattern matches. Empty uses
+	// the default deny message.
+	Reason string
+	// Priority orders patterns that match the same command: higher
+	// priorities are checked first. Defaults to 0.
+	Priority int
+	// Note is an optional comment on why the pattern exists. It doesn't
+	// affect matching.
+	Note string
 }
 
 // RewriteRule holds a compiled match pattern and its replacement string.
@@ -24,23 +57,44 @@ type RewriteRule struct {
 	Replace string // replacement string
 }
 
+// flagPlaceholders maps the argument placeholders a flag spec can end with to
+// the regex their argument must match.
+var flagPlaceholders = map[string]string{
+	"<arg>":      `\S+`,
+	"<num>":      `\d+`,
+	"<path>":     `[\w.~/@%+:-]+`,
+	"<duration>": `\d+(?:\.\d+)?[smhd]?`,
+}
+
 // BuildFlagPattern converts a flag specification to a regex pattern.
 // "-f" becomes "(-f\s+)?"
-// "-f <arg>" becomes "(-f\s*\S+\s+)?" (allows -f10 or -f 10)
+// "-f <arg>" becomes "(-f(?:=|\s*)\S+\s+)?" (allows -f10, -f 10, or -f=10)
+// "--file <arg>" becomes "(--file(?:=|\s+)\S+\s+)?" (allows --file x or
+// --file=x, but not --filex, so it can't match a longer flag like --file-list)
 // "<arg>" becomes "(\S+\s+)?" (positional argument)
+// "<num>" and "<path>" work like "<arg>" but only accept a number
+// ("\d+") or a path-shaped token, e.g. "-n <num>" becomes "(-n(?:=|\s*)\d+\s+)?"
+// "<duration>" accepts a number with an optional s, m, h, or d suffix ("30", "1.5m")
 // "" (empty) becomes "" (allows bare command)
 func BuildFlagPattern(flag string) string {
 	flag = strings.TrimSpace(flag)
 	if flag == "" {
 		return ""
 	}
-	if flag == "<arg>" {
-		return `(\S+\s+)?`
+	if arg, ok := flagPlaceholders[flag]; ok {
+		return `(` + arg + `\s+)?`
 	}
-	if strings.HasSuffix(flag, " <arg>") {
-		flagName := strings.TrimSuffix(flag, " <arg>")
-		// Allow optional space between flag and argument (e.g., -n10 or -n 10)
-		return `(` + regexp.QuoteMeta(flagName) + `\s*\S+\s+)?`
+	if i := strings.LastIndex(flag, " "); i >= 0 {
+		flagName, placeholder := flag[:i], flag[i+1:]
+		if arg, ok := flagPlaceholders[placeholder]; ok {
+			// Allow "=", a space, or, for short flags, nothing between
+			// flag and argument (e.g., --config=foo, -n 10, or -n10)
+			separator := `(?:=|\s*)`
+			if strings.HasPrefix(flagName, "--") {
+				separator = `(?:=|\s+)`
+			}
+			return `(` + regexp.QuoteMeta(flagName) + separator + arg + `\s+)?`
+		}
 	}
 	return `(` + regexp.QuoteMeta(flag) + `\s+)?`
 }
@@ -51,37 +105,158 @@ func BuildSimplePattern(cmd string) string {
 	return `^` + regexp.QuoteMeta(cmd) + `\b`
 }
 
+// BuildExactPattern creates a regex for a bare command (no arguments allowed).
+// "echo" becomes "^echo$"
+func BuildExactPattern(cmd string) string {
+	return `^` + regexp.QuoteMeta(cmd) + `$`
+}
+
+// builtinArgs maps each shell builtin BuildBuiltinPattern supports to the
+// regex its arguments must match.
+var builtinArgs = map[string]string{
+	// No arguments
+	"true":  `$`,
+	"false": `$`,
+	":":     `$`,
+	// At most one argument
+	"cd":     `(\s+\S+)?$`,
+	"pushd":  `(\s+\S+)?$`,
+	"popd":   `(\s+[+-]\d+)?$`,
+	"dirs":   `(\s+-[clpv]+)?$`,
+	"pwd":    `(\s+-[LP])?$`,
+	"exit":   `(\s+\d+)?$`,
+	"return": `(\s+\d+)?$`,
+	// Exactly one variable
+	"export": `\s+[A-Za-z_][A-Za-z0-9_]*(=\S*)?$`,
+	"unset":  `\s+[A-Za-z_][A-Za-z0-9_]*$`,
+}
+
+// Builtins returns the shell builtins BuildBuiltinPattern supports, sorted.
+func Builtins() []string {
+	return slices.Sorted(maps.Keys(builtinArgs))
+}
+
+// BuildBuiltinPattern creates a regex for a shell builtin that accepts only
+// the arguments the builtin takes. Returns false if the builtin isn't one of
+// Builtins.
+// "true" becomes "^true$"
+// "cd" becomes "^cd(\s+\S+)?$"
+// "export" becomes "^export\s+[A-Za-z_][A-Za-z0-9_]*(=\S*)?$"
+func BuildBuiltinPattern(name string) (string, bool) {
+	args, ok := builtinArgs[name]
+	if !ok {
+		return "", false
+	}
+	return `^` + regexp.QuoteMeta(name) + args, true
+}
+
 // BuildSubcommandPattern creates a regex for a command with subcommands and optional flags.
 // cmd="git", subcommands=["diff","log"], flags=["-C <arg>"] becomes
 // "^git\s+(-C\s+\S+\s+)?(diff|log)\b"
+// Subcommands may contain several words ("stash list") to match nested
+// subcommands, and "*" as a word matches any single word. A trailing "*"
+// ("remote *") makes explicit that any further arguments are allowed.
 func BuildSubcommandPattern(cmd string, subcommands []string, flags []string) string {
+	return `^` + regexp.QuoteMeta(cmd) + `\s+` + buildSubcommandBody(subcommands, flags) + `\b`
+}
+
+// BuildDeniedSubcommandPattern creates a regex matching a command followed by
+// any of the given subcommands, for rejecting them from a broader pattern.
+// Any options, each with an optional argument, may come before the
+// subcommand, so global flags can't hide it; this errs toward matching.
+// cmd="git", subcommands=["push","reset --hard"] becomes
+// "^git\s+(-\S+\s+(\S+\s+)?)*(push|reset\s+--hard)\b"
+func BuildDeniedSubcommandPattern(cmd string, subcommands []string) string {
+	alternatives := make([]string, len(subcommands))
+	for i, sub := range subcommands {
+		alternatives[i] = buildSubcommandAlternative(sub)
+	}
+	return `^` + regexp.QuoteMeta(cmd) + `\s+(-\S+\s+(\S+\s+)?)*(` + strings.Join(alternatives, "|") + `)\b`
+}
+
+// SubcommandGroup is one alternative of an anyof pattern: a set of
+// subcommands and the flags allowed before them.
+type SubcommandGroup struct {
+	Subcommands []string
+	Flags       []string
+}
+
+// BuildAnyOfPattern creates a regex for a command followed by the
+// subcommands of any one of several groups, each built like
+// BuildSubcommandPattern with its own flags.
+// cmd="docker", groups=[{["compose up"], nil}, {["ps"], ["-a"]}] becomes
+// "^docker\s+((compose\s+up)|(-a\s+)?(ps))\b"
+func BuildAnyOfPattern(cmd string, groups []SubcommandGroup) string {
+	bodies := make([]string, len(groups))
+	for i, g := range groups {
+		bodies[i] = buildSubcommandBody(g.Subcommands, g.Flags)
+	}
+	return `^` + regexp.QuoteMeta(cmd) + `\s+(` + strings.Join(bodies, "|") + `)\b`
+}
+
+// buildSubcommandBody builds the part of a subcommand pattern after the
+// command name: the optional flags followed by a group of the subcommand
+// alternatives joined with |.
+func buildSubcommandBody(subcommands []string, flags []string) string {
 	var flagPatterns string
 	for _, f := range flags {
 		flagPatterns += BuildFlagPattern(f)
 	}
 
-	// Escape subcommands and join with |
-	escaped := make([]string, len(subcommands))
+	// Build each subcommand alternative and join with |
+	alternatives := make([]string, len(subcommands))
 	for i, sub := range subcommands {
-		escaped[i] = regexp.QuoteMeta(sub)
+		alternatives[i] = buildSubcommandAlternative(sub)
 	}
-	subPattern := strings.Join(escaped, "|")
+	return flagPatterns + `(` + strings.Join(alternatives, "|") + `)`
+}
 
-	return `^` + regexp.QuoteMeta(cmd) + `\s+` + flagPatterns + `(` + subPattern + `)\b`
+// buildSubcommandAlternative converts one subcommand entry to a regex alternative.
+// "diff" becomes "diff", "stash list" becomes "stash\s+list",
+// "remote *" becomes "remote" and "*" becomes "\S+".
+func buildSubcommandAlternative(sub string) string {
+	words := strings.Fields(sub)
+	if len(words) > 1 && words[len(words)-1] == "*" {
+		words = words[:len(words)-1]
+	}
+	parts := make([]string, len(words))
+	for i, w := range words {
+		if w == "*" {
+			parts[i] = `\S+`
+		} else {
+			parts[i] = regexp.QuoteMeta(w)
+		}
+	}
+	return strings.Join(parts, `\s+`)
 }
 
 // BuildWrapperPattern creates a regex for a wrapper command.
-// For wrappers with flags, the pattern matches the command followed by flags.
+// For wrappers with flags, the pattern matches the command followed by flags,
+// each optional and in the given order, and then by the required positional
+// args.
 // "timeout" with flags=["<arg>"] becomes "^timeout\s+(\S+\s+)?"
-func BuildWrapperPattern(cmd string, flags []string) string {
-	var flagPatterns string
+// "timeout" with flags=["-s <arg>"] and args=["<num>"] becomes
+// "^timeout\s+(-s(?:=|\s*)\S+\s+)?\d+\s+"
+func BuildWrapperPattern(cmd string, flags, args []string) string {
+	pattern := `^` + regexp.QuoteMeta(cmd) + `\s+`
 	for _, f := range flags {
-		flagPatterns += BuildFlagPattern(f)
+		pattern += BuildFlagPattern(f)
 	}
-	if len(flags) > 0 {
-		return `^` + regexp.QuoteMeta(cmd) + `\s+` + flagPatterns
+	for _, a := range args {
+		pattern += BuildArgPattern(a)
 	}
-	return `^` + regexp.QuoteMeta(cmd) + `\s+`
+	return pattern
+}
+
+// BuildArgPattern converts a required positional argument to a regex pattern.
+// "<num>" becomes "\d+\s+", and any other placeholder is replaced by its
+// regex the same way. Anything else is matched literally: "--" becomes "--\s+".
+func BuildArgPattern(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if re, ok := flagPlaceholders[arg]; ok {
+		return re + `\s+`
+	}
+	return regexp.QuoteMeta(arg) + `\s+`
 }
 
 // Compile compiles a pattern string into a Pattern with the given name.
@@ -102,3 +277,112 @@ func MustCompile(pattern, name string) Pattern {
 	}
 	return p
 }
+
+// HasNestedQuantifier reports whether a regex contains a repeated group whose
+// body can itself repeat without consuming a distinguishing character, such as
+// (a+)+ or (\w+\s?)*. Go's RE2 engine matches in linear time, so these can't
+// backtrack catastrophically, but they are a common authoring mistake and are
+// slow on large inputs. Returns false for patterns that fail to parse.
+func HasNestedQuantifier(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	return hasNestedQuantifier(re)
+}
+
+func hasNestedQuantifier(re *syntax.Regexp) bool {
+	if isUnboundedRepeat(re) && repeatsFreely(re.Sub[0]) {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasNestedQuantifier(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnboundedRepeat reports whether re is a *, + or {n,} repetition.
+func isUnboundedRepeat(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		return re.Max == -1
+	}
+	return false
+}
+
+// canBeEmpty reports whether re is an optional element that may match nothing.
+func canBeEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpQuest, syntax.OpEmptyMatch:
+		return true
+	case syntax.OpRepeat:
+		return re.Min == 0
+	case syntax.OpCapture:
+		return canBeEmpty(re.Sub[0])
+	}
+	return false
+}
+
+// StartsWithAnchor reports whether every match of a regex must begin at the
+// start of the text (or of a line, with (?m)), as with ^git or ^(git|hg)\b.
+// Unanchored patterns like status also match in the middle of a command, such
+// as in an argument. Returns true for patterns that fail to parse.
+func StartsWithAnchor(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return true
+	}
+	return startsWithAnchor(re)
+}
+
+func startsWithAnchor(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginText, syntax.OpBeginLine:
+		return true
+	case syntax.OpCapture:
+		return startsWithAnchor(re.Sub[0])
+	case syntax.OpConcat:
+		return len(re.Sub) > 0 && startsWithAnchor(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !startsWithAnchor(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// repeatsFreely reports whether re is, or consists only of, unbounded repetitions
+// and optional elements, so that an enclosing repetition is ambiguous.
+func repeatsFreely(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpCapture:
+		return repeatsFreely(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if repeatsFreely(sub) {
+				return true
+			}
+		}
+		return false
+	case syntax.OpConcat:
+		hasRepeat := false
+		for _, sub := range re.Sub {
+			switch {
+			case repeatsFreely(sub):
+				hasRepeat = true
+			case canBeEmpty(sub):
+			default:
+				return false
+			}
+		}
+		return hasRepeat
+	}
+	return isUnboundedRepeat(re)
+}
@@ -14,11 +14,16 @@ func TestBuildFlagPattern(t *testing.T) {
 		{"empty string", "", ""},
 		{"positional arg", "<arg>", `(\S+\s+)?`},
 		{"simple flag", "-f", `(-f\s+)?`},
-		{"flag with arg", "-f <arg>", `(-f\s*\S+\s+)?`},
-		{"long flag with arg", "-C <arg>", `(-C\s*\S+\s+)?`},
+		{"flag with arg", "-f <arg>", `(-f(?:=|\s*)\S+\s+)?`},
+		{"long flag with arg", "-C <arg>", `(-C(?:=|\s*)\S+\s+)?`},
 		{"long name flag", "--verbose", `(--verbose\s+)?`},
-		{"long name with arg", "--config <arg>", `(--config\s*\S+\s+)?`},
+		{"long name with arg", "--config <arg>", `(--config(?:=|\s+)\S+\s+)?`},
 		{"whitespace trimming", "  -f  ", `(-f\s+)?`},
+		{"positional num", "<num>", `(\d+\s+)?`},
+		{"flag with num", "-n <num>", `(-n(?:=|\s*)\d+\s+)?`},
+		{"positional path", "<path>", `([\w.~/@%+:-]+\s+)?`},
+		{"flag with path", "--dir <path>", `(--dir(?:=|\s+)[\w.~/@%+:-]+\s+)?`},
+		{"flag with duration", "-k <duration>", `(-k(?:=|\s*)\d+(?:\.\d+)?[smhd]?\s+)?`},
 	}
 
 	for _, tt := range tests {
@@ -47,6 +52,7 @@ func TestBuildFlagPattern_Regex(t *testing.T) {
 		{"flag with arg compact", "-n <arg>", "-n10 ", true},
 		{"flag with arg spaced", "-n <arg>", "-n 10 ", true},
 		{"flag with arg optional", "-n <arg>", "", true},
+		{"flag with arg equals", "--config <arg>", "--config=foo ", true},
 	}
 
 	for _, tt := range tests {
@@ -64,6 +70,32 @@ func TestBuildFlagPattern_Regex(t *testing.T) {
 	}
 }
 
+func TestBuildFlagPattern_EqualsForm(t *testing.T) {
+	// The flag pattern is embedded between a command and a required subcommand
+	re := regexp.MustCompile(`^tool\s+` + BuildFlagPattern("--config <arg>") + `run$`)
+
+	tests := []struct {
+		input   string
+		matches bool
+	}{
+		{"tool --config=foo run", true},
+		{"tool --config foo run", true},
+		{"tool --configfoo run", false},
+		{"tool --config-file=x run", false},
+		{"tool --configure run", false},
+		{"tool run", true},
+		{"tool --config run", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := re.MatchString(tt.input); got != tt.matches {
+				t.Errorf("Pattern %q matching %q = %v, want %v", re.String(), tt.input, got, tt.matches)
+			}
+		})
+	}
+}
+
 func TestBuildSimplePattern(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -111,6 +143,34 @@ func TestBuildSimplePattern_Regex(t *testing.T) {
 	}
 }
 
+func TestBuildExactPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		input   string
+		matches bool
+	}{
+		{"bare command", "echo", "echo", true},
+		{"with args", "echo", "echo hello", false},
+		{"prefix only", "echo", "echoes", false},
+		{"at start only", "echo", "foo echo", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := BuildExactPattern(tt.cmd)
+			if pattern != `^echo$` {
+				t.Errorf("BuildExactPattern(%q) = %q, want %q", tt.cmd, pattern, `^echo$`)
+			}
+			re := regexp.MustCompile(pattern)
+			got := re.MatchString(tt.input)
+			if got != tt.matches {
+				t.Errorf("Pattern %q matching %q = %v, want %v", pattern, tt.input, got, tt.matches)
+			}
+		})
+	}
+}
+
 func TestBuildSubcommandPattern(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -138,14 +198,14 @@ func TestBuildSubcommandPattern(t *testing.T) {
 			cmd:         "git",
 			subcommands: []string{"diff"},
 			flags:       []string{"-C <arg>"},
-			expected:    `^git\s+(-C\s*\S+\s+)?(diff)\b`,
+			expected:    `^git\s+(-C(?:=|\s*)\S+\s+)?(diff)\b`,
 		},
 		{
 			name:        "multiple flags",
 			cmd:         "git",
 			subcommands: []string{"log"},
 			flags:       []string{"-C <arg>", "-n <arg>"},
-			expected:    `^git\s+(-C\s*\S+\s+)?(-n\s*\S+\s+)?(log)\b`,
+			expected:    `^git\s+(-C(?:=|\s*)\S+\s+)?(-n(?:=|\s*)\S+\s+)?(log)\b`,
 		},
 		{
 			name:        "special chars in subcommand",
@@ -154,6 +214,27 @@ func TestBuildSubcommandPattern(t *testing.T) {
 			flags:       nil,
 			expected:    `^npm\s+(run-script)\b`, // hyphen not escaped (only special in char classes)
 		},
+		{
+			name:        "trailing wildcard",
+			cmd:         "git",
+			subcommands: []string{"remote *"},
+			flags:       nil,
+			expected:    `^git\s+(remote)\b`,
+		},
+		{
+			name:        "nested subcommand",
+			cmd:         "git",
+			subcommands: []string{"stash list", "status"},
+			flags:       nil,
+			expected:    `^git\s+(stash\s+list|status)\b`,
+		},
+		{
+			name:        "wildcard word",
+			cmd:         "docker",
+			subcommands: []string{"compose * ls"},
+			flags:       nil,
+			expected:    `^docker\s+(compose\s+\S+\s+ls)\b`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -166,6 +247,36 @@ func TestBuildSubcommandPattern(t *testing.T) {
 	}
 }
 
+func TestBuildDeniedSubcommandPattern(t *testing.T) {
+	pattern := BuildDeniedSubcommandPattern("git", []string{"push", "reset --hard", "clean -fd"})
+	if want := `^git\s+(-\S+\s+(\S+\s+)?)*(push|reset\s+--hard|clean\s+-fd)\b`; pattern != want {
+		t.Fatalf("BuildDeniedSubcommandPattern() = %q, want %q", pattern, want)
+	}
+	re := regexp.MustCompile(pattern)
+
+	tests := []struct {
+		input   string
+		matches bool
+	}{
+		{"git push", true},
+		{"git push origin main", true},
+		{"git reset --hard HEAD", true},
+		{"git clean -fd", true},
+		{"git -C /repo push", true},
+		{"git --no-pager push", true},
+		{"git -c user.name=x push", true},
+		{"git reset --soft HEAD~1", false},
+		{"git checkout main", false},
+		{"git log push", false},
+		{"git pushx", false},
+	}
+	for _, tt := range tests {
+		if got := re.MatchString(tt.input); got != tt.matches {
+			t.Errorf("MatchString(%q) = %v, want %v", tt.input, got, tt.matches)
+		}
+	}
+}
+
 func TestBuildSubcommandPattern_Regex(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -196,11 +307,74 @@ func TestBuildSubcommandPattern_Regex(t *testing.T) {
 	}
 }
 
+func TestBuildArgPattern(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"<num>", `\d+\s+`},
+		{"<duration>", `\d+(?:\.\d+)?[smhd]?\s+`},
+		{" <arg> ", `\S+\s+`},
+		{"--", `--\s+`},
+	}
+
+	for _, tt := range tests {
+		if got := BuildArgPattern(tt.input); got != tt.expected {
+			t.Errorf("BuildArgPattern(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestBuildBuiltinPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		matches bool
+	}{
+		{"true", "true", true},
+		{"true", "true x", false},
+		{"cd", "cd", true},
+		{"cd", "cd /tmp", true},
+		{"cd", "cd a b", false},
+		{"pushd", "pushd /tmp", true},
+		{"popd", "popd +1", true},
+		{"popd", "popd /tmp", false},
+		{"exit", "exit 1", true},
+		{"exit", "exit now", false},
+		{"export", "export FOO=bar", true},
+		{"export", "export FOO", true},
+		{"export", "export", false},
+		{"export", "export A=1 B=2", false},
+		{"unset", "unset FOO", true},
+		{":", ": ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.input, func(t *testing.T) {
+			pattern, ok := BuildBuiltinPattern(tt.name)
+			if !ok {
+				t.Fatalf("BuildBuiltinPattern(%q) not supported", tt.name)
+			}
+			if got := regexp.MustCompile(pattern).MatchString(tt.input); got != tt.matches {
+				t.Errorf("Pattern %q matching %q = %v, want %v", pattern, tt.input, got, tt.matches)
+			}
+		})
+	}
+
+	if pattern, ok := BuildBuiltinPattern("cd"); pattern != `^cd(\s+\S+)?$` || !ok {
+		t.Errorf("BuildBuiltinPattern(cd) = %q, %v", pattern, ok)
+	}
+	if _, ok := BuildBuiltinPattern("eval"); ok {
+		t.Error("BuildBuiltinPattern(eval) should not be supported")
+	}
+}
+
 func TestBuildWrapperPattern(t *testing.T) {
 	tests := []struct {
 		name     string
 		cmd      string
 		flags    []string
+		args     []string
 		expected string
 	}{
 		{
@@ -219,19 +393,26 @@ func TestBuildWrapperPattern(t *testing.T) {
 			name:     "with flag arg",
 			cmd:      "nice",
 			flags:    []string{"-n <arg>"},
-			expected: `^nice\s+(-n\s*\S+\s+)?`,
+			expected: `^nice\s+(-n(?:=|\s*)\S+\s+)?`,
 		},
 		{
 			name:     "multiple flag options",
 			cmd:      "nice",
 			flags:    []string{"-n <arg>", ""},
-			expected: `^nice\s+(-n\s*\S+\s+)?`,
+			expected: `^nice\s+(-n(?:=|\s*)\S+\s+)?`,
+		},
+		{
+			name:     "flags before required arg",
+			cmd:      "timeout",
+			flags:    []string{"--preserve-status", "-s <arg>"},
+			args:     []string{"<num>"},
+			expected: `^timeout\s+(--preserve-status\s+)?(-s(?:=|\s*)\S+\s+)?\d+\s+`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := BuildWrapperPattern(tt.cmd, tt.flags)
+			got := BuildWrapperPattern(tt.cmd, tt.flags, tt.args)
 			if got != tt.expected {
 				t.Errorf("BuildWrapperPattern() = %q, want %q", got, tt.expected)
 			}
@@ -244,22 +425,28 @@ func TestBuildWrapperPattern_Regex(t *testing.T) {
 		name    string
 		cmd     string
 		flags   []string
+		args    []string
 		input   string
 		matches bool
 	}{
-		{"env wrapper", "env", nil, "env ", true},
-		{"env with command", "env", nil, "env pytest", true},
-		{"env no space", "env", nil, "env", false},
-		{"timeout with arg", "timeout", []string{"<arg>"}, "timeout 30 ", true},
-		{"timeout compact", "timeout", []string{"<arg>"}, "timeout 30 pytest", true},
-		{"nice with flag", "nice", []string{"-n <arg>"}, "nice -n 10 ", true},
-		{"nice compact flag", "nice", []string{"-n <arg>"}, "nice -n10 ", true},
-		{"nice without flag", "nice", []string{"-n <arg>"}, "nice ", true},
+		{"env wrapper", "env", nil, nil, "env ", true},
+		{"env with command", "env", nil, nil, "env pytest", true},
+		{"env no space", "env", nil, nil, "env", false},
+		{"timeout with arg", "timeout", []string{"<arg>"}, nil, "timeout 30 ", true},
+		{"timeout compact", "timeout", []string{"<arg>"}, nil, "timeout 30 pytest", true},
+		{"nice with flag", "nice", []string{"-n <arg>"}, nil, "nice -n 10 ", true},
+		{"nice compact flag", "nice", []string{"-n <arg>"}, nil, "nice -n10 ", true},
+		{"nice without flag", "nice", []string{"-n <arg>"}, nil, "nice ", true},
+		{"required arg", "timeout", nil, []string{"<num>"}, "timeout 30 pytest", true},
+		{"required arg missing", "timeout", nil, []string{"<num>"}, "timeout pytest", false},
+		{"signal before duration", "timeout", []string{"-s <arg>"}, []string{"<duration>"}, "timeout -s KILL 1.5m pytest", true},
+		{"duration suffix", "timeout", nil, []string{"<duration>"}, "timeout 30s pytest", true},
+		{"bad duration", "timeout", nil, []string{"<duration>"}, "timeout forever pytest", false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			pattern := BuildWrapperPattern(tt.cmd, tt.flags)
+			pattern := BuildWrapperPattern(tt.cmd, tt.flags, tt.args)
 			re := regexp.MustCompile(pattern)
 			got := re.MatchString(tt.input)
 			if got != tt.matches {
@@ -355,3 +542,118 @@ func TestPattern_Match(t *testing.T) {
 		})
 	}
 }
+
+func TestHasNestedQuantifier(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{`^(a+)+$`, true},
+		{`^(a*)*$`, true},
+		{`(\w+\s?)+`, true},
+		{`(a*b*)*`, true},
+		{`(a|b+)+`, true},
+		{`(x+){2,}`, true},
+		{`^git\s+(status|log)\b`, false},
+		{`^([A-Z_][A-Z0-9_]*=[^\s]*\s+)+`, false},
+		{`^(true|false|exit(\s+\d+)?)$`, false},
+		{`rm\s+(-[rRfF]+\s+)*/`, false},
+		{`(a+){1,3}`, false},
+		{`(`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := HasNestedQuantifier(tt.pattern); got != tt.want {
+				t.Errorf("HasNestedQuantifier(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartsWithAnchor(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{`^git\s+status\b`, true},
+		{`(?i)^make\b`, true},
+		{`^(git|hg) status`, true},
+		{`(^ls|^pwd)$`, true},
+		{`\Apytest`, true},
+		{`(?m)^npm test`, true},
+		{`status`, false},
+		{`git status`, false},
+		{`^ls|pwd`, false},
+		{`(`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := StartsWithAnchor(tt.pattern); got != tt.want {
+				t.Errorf("StartsWithAnchor(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSubcommandPattern_Wildcards(t *testing.T) {
+	pattern := BuildSubcommandPattern("git", []string{"remote *", "stash list"}, nil)
+	re := regexp.MustCompile(pattern)
+
+	tests := []struct {
+		input   string
+		matches bool
+	}{
+		{"git remote add origin url", true},
+		{"git remote", true},
+		{"git stash list", true},
+		{"git stash list --stat", true},
+		{"git stash drop", false},
+		{"git stash", false},
+		{"git push", false},
+		{"git remotes", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := re.MatchString(tt.input); got != tt.matches {
+				t.Errorf("Pattern %q matching %q = %v, want %v", pattern, tt.input, got, tt.matches)
+			}
+		})
+	}
+}
+
+func TestBuildAnyOfPattern(t *testing.T) {
+	pattern := BuildAnyOfPattern("docker", []SubcommandGroup{
+		{Subcommands: []string{"compose up", "compose down"}},
+		{Subcommands: []string{"ps", "images"}, Flags: []string{"--context <arg>"}},
+	})
+	want := `^docker\s+((compose\s+up|compose\s+down)|(--context(?:=|\s+)\S+\s+)?(ps|images))\b`
+	if pattern != want {
+		t.Errorf("BuildAnyOfPattern() = %q, want %q", pattern, want)
+	}
+	re := regexp.MustCompile(pattern)
+
+	tests := []struct {
+		input   string
+		matches bool
+	}{
+		{"docker compose up -d", true},
+		{"docker compose down", true},
+		{"docker ps -a", true},
+		{"docker --context prod images", true},
+		{"docker --context prod compose up", false},
+		{"docker compose rm", false},
+		{"docker run alpine", false},
+		{"docker psx", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := re.MatchString(tt.input); got != tt.matches {
+				t.Errorf("Pattern %q matching %q = %v, want %v", pattern, tt.input, got, tt.matches)
+			}
+		})
+	}
+}
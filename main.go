@@ -24,7 +24,15 @@ import (
 	"github.com/dgerlanc/mmi/cmd"
 )
 
+// Build metadata, set with -ldflags "-X main.version=..." at release time
+var (
+	version string
+	commit  string
+	date    string
+)
+
 func main() {
+	cmd.SetVersionInfo(version, commit, date)
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
 	}
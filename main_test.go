@@ -26,7 +26,8 @@ commands = ["env", "do"]
 
 [[wrappers.command]]
 command = "timeout"
-flags = ["<arg>"]
+flags = ["--preserve-status", "--foreground", "-k <duration>", "--kill-after <duration>", "-s <arg>", "--signal <arg>"]
+args = ["<duration>"]
 
 [[wrappers.command]]
 command = "nice"
@@ -158,7 +159,8 @@ func TestProcess(t *testing.T) {
 		// Edge cases
 		{"non-Bash tool", `{"tool_name":"Read","tool_input":{"file":"/etc/passwd"}}`, false, ""},
 		{"invalid JSON", "invalid json {{{", false, ""},
-		{"empty command", `{"tool_name":"Bash","tool_input":{"command":""}}`, true, ""},
+		{"empty command", `{"tool_name":"Bash","tool_input":{"command":""}}`, false, "empty command"},
+		{"whitespace command", `{"tool_name":"Bash","tool_input":{"command":"   "}}`, false, "empty command"},
 	}
 
 	for _, tt := range tests {
@@ -284,7 +286,7 @@ func TestSplitCommandChain(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := hook.SplitCommandChain(tt.input)
+			got, _, err := hook.SplitCommandChain(tt.input)
 			if tt.expectErr {
 				if err == nil {
 					t.Errorf("SplitCommandChain(%q) expected error, got nil", tt.input)
@@ -301,6 +303,40 @@ func TestSplitCommandChain(t *testing.T) {
 	}
 }
 
+func TestSplitCommandChainOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		segments []string
+		expected []string
+	}{
+		{"simple", "ls -la", []string{"ls -la"}, []string{""}},
+		{"AND then pipe", "a && b | c", []string{"a", "b", "c"}, []string{"", "&&", "|"}},
+		{"OR", "a || b", []string{"a", "b"}, []string{"", "||"}},
+		{"sequence", "a; b\nc", []string{"a", "b", "c"}, []string{"", ";", ";"}},
+		{"background", "a & b", []string{"a", "b"}, []string{"", "&"}},
+		{"pipe all", "a |& b", []string{"a", "b"}, []string{"", "|&"}},
+		{"subshell", "a && (b; c)", []string{"a", "b", "c"}, []string{"", "&&", ";"}},
+		{"if", "if a; then b; else c; fi", []string{"a", "b", "c"}, []string{"", "&&", "||"}},
+		{"while", "while a; do b; done", []string{"a", "b"}, []string{"", "&&"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments, operators, err := hook.SplitCommandChain(tt.input)
+			if err != nil {
+				t.Fatalf("SplitCommandChain(%q) unexpected error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(segments, tt.segments) {
+				t.Errorf("SplitCommandChain(%q) segments = %q, want %q", tt.input, segments, tt.segments)
+			}
+			if !reflect.DeepEqual(operators, tt.expected) {
+				t.Errorf("SplitCommandChain(%q) operators = %q, want %q", tt.input, operators, tt.expected)
+			}
+		})
+	}
+}
+
 func TestStripWrappers(t *testing.T) {
 	cfg := config.Get()
 
@@ -312,6 +348,10 @@ func TestStripWrappers(t *testing.T) {
 	}{
 		{"no wrapper", "pytest", "pytest", nil},
 		{"timeout", "timeout 30 pytest", "pytest", []string{"timeout"}},
+		{"timeout signal", "timeout -s KILL 30 pytest", "pytest", []string{"timeout"}},
+		{"timeout long signal", "timeout --signal=TERM 30s pytest", "pytest", []string{"timeout"}},
+		{"timeout preserve status", "timeout --preserve-status -k 5 1.5m pytest", "pytest", []string{"timeout"}},
+		{"timeout without duration", "timeout pytest", "timeout pytest", nil},
 		{"nice -n", "nice -n 10 pytest", "pytest", []string{"nice"}},
 		{"nice -n compact", "nice -n10 pytest", "pytest", []string{"nice"}},
 		{"env", "env pytest", "pytest", []string{"env"}},
@@ -741,8 +781,8 @@ func TestBuildFlagPattern(t *testing.T) {
 		{"", ""},
 		{"<arg>", `(\S+\s+)?`},
 		{"-f", `(-f\s+)?`},
-		{"-f <arg>", `(-f\s*\S+\s+)?`},
-		{"-C <arg>", `(-C\s*\S+\s+)?`},
+		{"-f <arg>", `(-f(?:=|\s*)\S+\s+)?`},
+		{"-C <arg>", `(-C(?:=|\s*)\S+\s+)?`},
 	}
 
 	for _, tt := range tests {
@@ -769,7 +809,7 @@ func TestBuildSubcommandPattern(t *testing.T) {
 		expected    string
 	}{
 		{"simple", "git", []string{"diff", "log"}, nil, `^git\s+(diff|log)\b`},
-		{"with flag", "git", []string{"diff"}, []string{"-C <arg>"}, `^git\s+(-C\s*\S+\s+)?(diff)\b`},
+		{"with flag", "git", []string{"diff"}, []string{"-C <arg>"}, `^git\s+(-C(?:=|\s*)\S+\s+)?(diff)\b`},
 	}
 
 	for _, tt := range tests {